@@ -0,0 +1,78 @@
+package clients
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"admin-api/config"
+
+	"github.com/pkg/errors"
+)
+
+// BlobStore stores raw payloads, e.g. fetched documents, under a key within
+// a bucket. Artifacts reference them by S3Bucket and S3Key.
+type BlobStore interface {
+	Put(ctx context.Context, key string, body []byte) (bucket string, err error)
+	Get(ctx context.Context, bucket string, key string) ([]byte, error)
+}
+
+type fileBlobStore struct {
+	dir    string
+	bucket string
+}
+
+// NewFileBlobStore returns a BlobStore that keeps each bucket in a directory
+// below cfg.Dir.
+func NewFileBlobStore(cfg config.BlobStoreConfig) (BlobStore, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("blob store bucket must not be empty")
+	}
+	if err := os.MkdirAll(filepath.Join(cfg.Dir, cfg.Bucket), 0o755); err != nil {
+		return nil, errors.Wrap(err, "failed to create blob store directory")
+	}
+	return &fileBlobStore{dir: cfg.Dir, bucket: cfg.Bucket}, nil
+}
+
+func (s *fileBlobStore) Put(ctx context.Context, key string, body []byte) (string, error) {
+	path, err := s.path(s.bucket, key)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", errors.Wrap(err, "failed to create blob directory")
+	}
+
+	// Write to a temporary file first so that readers never see partial blobs
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, body, 0o644); err != nil {
+		return "", errors.Wrap(err, "failed to write blob")
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", errors.Wrap(err, "failed to write blob")
+	}
+	return s.bucket, nil
+}
+
+func (s *fileBlobStore) Get(ctx context.Context, bucket string, key string) ([]byte, error) {
+	path, err := s.path(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read blob")
+	}
+	return body, nil
+}
+
+func (s *fileBlobStore) path(bucket string, key string) (string, error) {
+	bucketDir := filepath.Join(s.dir, bucket)
+	path := filepath.Join(bucketDir, filepath.FromSlash(key))
+	if bucket == "" || filepath.Dir(bucketDir) != filepath.Clean(s.dir) || !strings.HasPrefix(path, bucketDir+string(filepath.Separator)) {
+		return "", errors.Errorf("invalid blob key %q", key)
+	}
+	return path, nil
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/spf13/viper"
 )
 
@@ -10,13 +12,19 @@ const (
 )
 
 type Config struct {
-	Server   ServerConfig
-	Postgres PostgresConfig
-	Scylla   ScyllaConfig
-	Redis    RedisConfig
-	Auth0    Auth0Config
-	Otel     OtelConfig
-	CORS     CORSConfig
+	Server      ServerConfig
+	Postgres    PostgresConfig
+	Scylla      ScyllaConfig
+	Redis       RedisConfig
+	Auth0       Auth0Config
+	Otel        OtelConfig
+	CORS        CORSConfig
+	Scheduler   SchedulerConfig
+	Queue       QueueConfig
+	Reaper      ReaperConfig
+	Concurrency ConcurrencyConfig
+	Worker      WorkerConfig
+	BlobStore   BlobStoreConfig
 }
 
 type ServerConfig struct {
@@ -55,6 +63,99 @@ type CORSConfig struct {
 	AllowOrigins []string
 }
 
+type SchedulerConfig struct {
+	Enabled  bool
+	Interval time.Duration
+	LockTTL  time.Duration
+}
+
+type QueueConfig struct {
+	VisibilityTimeout time.Duration
+	MaxDeliveries     int64
+}
+
+type ReaperConfig struct {
+	Enabled               bool
+	Interval              time.Duration
+	LockTTL               time.Duration
+	DefaultMaxRunDuration time.Duration
+	HeartbeatTimeout      time.Duration
+	// CreatedTimeout fails runs that are still waiting to be started this long
+	// after they were due, zero disables it.
+	CreatedTimeout time.Duration
+}
+
+type ConcurrencyConfig struct {
+	// MaxActiveRunsPerUser caps the active runs across all tasks of a user,
+	// zero means unlimited.
+	MaxActiveRunsPerUser int
+	LockTTL              time.Duration
+	LockWait             time.Duration
+}
+
+type WorkerConfig struct {
+	// Concurrency is the number of task runs a worker executes at a time.
+	Concurrency int
+	// PollInterval is how long a claim blocks waiting for queued runs.
+	PollInterval      time.Duration
+	HeartbeatInterval time.Duration
+	// SourceParallelism is how many sources of a run are fetched at a time
+	// when its definition does not set source_parallelism.
+	SourceParallelism int
+	// MaxSourceURLs caps the URLs a sitemap or feed source expands into when
+	// the source does not set max_urls.
+	MaxSourceURLs int
+	// CrawlMaxDepth and CrawlMaxPages limit crawl sources that do not set
+	// max_depth and max_pages.
+	CrawlMaxDepth int
+	CrawlMaxPages int
+	// ApiMaxPages caps the pages requested by an API source that does not
+	// set max_pages.
+	ApiMaxPages int
+	Fetcher     FetcherConfig
+}
+
+type FetcherConfig struct {
+	Timeout      time.Duration
+	MaxRedirects int
+	// MaxRetries is the number of times a request is retried after a network
+	// error, a 429 or a 5xx response.
+	MaxRetries   int
+	RetryBackoff time.Duration
+	UserAgent    string
+	MaxBodyBytes int64
+	Robots       RobotsConfig
+	Politeness   PolitenessConfig
+}
+
+type RobotsConfig struct {
+	// Enabled skips the URLs disallowed by the robots.txt of their host.
+	Enabled bool
+	// UserAgent is the token matched against the User-agent lines of
+	// robots.txt, the product token of the fetcher's User-Agent by default.
+	UserAgent string
+	// CacheTTL is how long the robots.txt of a host is cached in Redis.
+	CacheTTL time.Duration
+	// MaxCrawlDelay caps the Crawl-delay of a robots.txt that is honoured.
+	MaxCrawlDelay time.Duration
+}
+
+// PolitenessConfig limits the requests sent to each host. The limits are
+// shared by all workers through Redis.
+type PolitenessConfig struct {
+	// MinInterval is the minimum time between two requests to a host. A
+	// longer Crawl-delay of its robots.txt takes precedence.
+	MinInterval time.Duration
+	// MaxConcurrency caps the requests in flight to a host, zero means no
+	// limit.
+	MaxConcurrency int
+}
+
+type BlobStoreConfig struct {
+	Dir    string
+	Bucket string
+}
+
 func Load() (*Config, error) {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
@@ -5,4 +5,22 @@ import "errors"
 var (
 	ErrNoAuthContext = errors.New("no authentication context found")
 	ErrInvalidClaims = errors.New("failed to get user claims from context")
+
+	ErrInvalidTaskDefinition = errors.New("invalid task definition")
+	ErrInvalidRunOverrides   = errors.New("invalid task run overrides")
+	ErrDeadLetterNotFound    = errors.New("dead letter not found")
+	ErrInvalidBackfill       = errors.New("invalid backfill")
+	ErrBackfillNotFound      = errors.New("backfill not found")
+	ErrInvalidPipeline       = errors.New("invalid pipeline")
+	ErrPipelineNotFound      = errors.New("pipeline not found")
+	ErrPipelineRunNotFound   = errors.New("pipeline run not found")
+	ErrTaskRunNotFound       = errors.New("task run not found")
+	ErrTaskRunFinished       = errors.New("task run has already finished")
+	ErrTaskPaused            = errors.New("task is paused")
+	ErrInvalidResumeTime     = errors.New("resume time must be in the future")
+	ErrConcurrentRun         = errors.New("task already has an active run")
+	ErrConcurrencyLimit      = errors.New("maximum number of active runs reached")
+	ErrLockTimeout           = errors.New("timed out waiting for lock")
+	ErrInvalidUpload         = errors.New("invalid upload")
+	ErrUploadNotFound        = errors.New("upload not found")
 )
@@ -0,0 +1,114 @@
+package extract
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"admin-api/models"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// AutoExtractor prepares a document for Auto targets, which are extracted by
+// the LLM. Like the scraper API it produces a single record with the cleaned
+// text of the page as "content" and its image links as "images", leaving out
+// scripts, styles and page chrome such as headers, footers and navigation.
+// The values of the targets are kept as "targets" so that the LLM step knows
+// what to look for.
+//
+// Plain text, CSV, JSON and XML documents are kept as they are. PDFs produce
+// one record per page with text, holding its number as "page".
+type AutoExtractor struct{}
+
+func (AutoExtractor) Extract(doc Document, targets []models.Target) (*Result, error) {
+	names := make([]any, 0, len(targets))
+	for _, target := range targets {
+		names = append(names, target.Value)
+	}
+
+	mediaType := mediaType(doc)
+	switch {
+	case mediaType == "" || strings.Contains(mediaType, "html"):
+	case mediaType == "application/pdf":
+		return autoPdfRecords(doc, names)
+	case isTextMediaType(mediaType):
+		return &Result{Records: []Record{{
+			"content": strings.TrimSpace(strings.TrimPrefix(string(doc.Body), "\uFEFF")),
+			"images":  []any{},
+			"targets": names,
+		}}}, nil
+	default:
+		return &Result{Warnings: []string{fmt.Sprintf("auto targets cannot be prepared from %s documents", mediaType)}}, nil
+	}
+
+	root, err := goquery.NewDocumentFromReader(bytes.NewReader(doc.Body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse html: %w", err)
+	}
+	base, _ := url.Parse(doc.URL)
+
+	images := []any{}
+	root.Find("img[src]").Each(func(i int, img *goquery.Selection) {
+		src, _ := img.Attr("src")
+		images = append(images, resolveURL(base, src))
+	})
+
+	root.Find("script, style, noscript, header, footer, nav, aside").Remove()
+
+	var lines []string
+	for _, node := range root.Nodes {
+		lines = appendTextLines(lines, node)
+	}
+
+	return &Result{Records: []Record{{
+		"content": strings.Join(lines, "\n"),
+		"images":  images,
+		"targets": names,
+	}}}, nil
+}
+
+// autoPdfRecords returns a record for each page of a PDF with text. A PDF
+// without any text, such as a scanned one, only produces a warning.
+func autoPdfRecords(doc Document, names []any) (*Result, error) {
+	pages, count, err := pdfText(doc.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	for _, page := range pages {
+		if page.text == "" {
+			continue
+		}
+		result.Records = append(result.Records, Record{
+			"content": page.text,
+			"images":  []any{},
+			"targets": names,
+			"page":    page.number,
+		})
+	}
+	if len(result.Records) == 0 {
+		result.Warnings = append(result.Warnings, "pdf has no text, it may be scanned")
+	}
+	if count > maxPdfPages {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("only the first %d of %d pdf pages were read", maxPdfPages, count))
+	}
+	return result, nil
+}
+
+// appendTextLines appends the non-empty text nodes below node, one per line.
+func appendTextLines(lines []string, node *html.Node) []string {
+	if node.Type == html.TextNode {
+		if text := normalizeSpace(node.Data); text != "" {
+			lines = append(lines, text)
+		}
+		return lines
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		lines = appendTextLines(lines, child)
+	}
+	return lines
+}
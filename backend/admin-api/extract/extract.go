@@ -0,0 +1,126 @@
+// Package extract turns fetched documents into structured records according
+// to the targets of a task.
+package extract
+
+import (
+	"bytes"
+	"mime"
+	"net/url"
+	"strings"
+)
+
+// Document is a fetched document to extract records from.
+type Document struct {
+	URL         string
+	ContentType string
+	Body        []byte
+}
+
+// mediaType returns the media type of the document, such as text/csv. PDFs
+// served as generic binary downloads are recognized by their header.
+func mediaType(doc Document) string {
+	mediaType, _, _ := mime.ParseMediaType(doc.ContentType)
+	switch mediaType {
+	case "", "application/octet-stream", "binary/octet-stream":
+		if bytes.HasPrefix(doc.Body, []byte("%PDF-")) {
+			return "application/pdf"
+		}
+	}
+	return mediaType
+}
+
+// isTextMediaType reports whether documents of the media type are text that
+// is used as is, such as plain text, CSV and JSON.
+func isTextMediaType(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "text/") || mediaType == "application/csv" ||
+		strings.HasSuffix(mediaType, "json") || strings.HasSuffix(mediaType, "xml")
+}
+
+// documentText returns the document as text, with the text of the pages of
+// PDFs one after the other.
+func documentText(doc Document) (string, error) {
+	if mediaType(doc) != "application/pdf" {
+		return string(doc.Body), nil
+	}
+	pages, _, err := pdfText(doc.Body)
+	if err != nil {
+		return "", err
+	}
+	texts := make([]string, len(pages))
+	for i, page := range pages {
+		texts[i] = page.text
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// Record is one extracted row, keyed by target name.
+type Record map[string]any
+
+// field holds the values a single target matched.
+type field struct {
+	name   string
+	values []any
+}
+
+// zipFields turns the values of each field into rows: the i-th value of every
+// field goes into the i-th record. Fields that matched a single value, such as
+// a page title, are repeated in every record.
+func zipFields(fields []field) []Record {
+	rows := 0
+	for _, f := range fields {
+		if len(f.values) > 1 {
+			rows = max(rows, len(f.values))
+		} else if len(f.values) == 1 {
+			rows = max(rows, 1)
+		}
+	}
+
+	records := make([]Record, rows)
+	for i := range records {
+		records[i] = Record{}
+	}
+	addFields(records, fields)
+	return records
+}
+
+// addFields adds fields to existing records: fields with a single value are
+// added to every record, others by position.
+func addFields(records []Record, fields []field) {
+	for i, record := range records {
+		for _, f := range fields {
+			switch {
+			case len(f.values) == 1:
+				record[f.name] = f.values[0]
+			case i < len(f.values):
+				record[f.name] = f.values[i]
+			}
+		}
+	}
+}
+
+// normalizeSpace trims the text and collapses runs of whitespace.
+func normalizeSpace(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// resolveURL makes a link found in the document absolute.
+func resolveURL(base *url.URL, ref string) string {
+	if base == nil {
+		return ref
+	}
+	u, err := base.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return ref
+	}
+	return u.String()
+}
+
+// isLinkAttribute reports whether the attribute holds a URL that should be
+// resolved against the document URL.
+func isLinkAttribute(name string) bool {
+	switch strings.ToLower(name) {
+	case "href", "src", "action", "data-src", "data-href":
+		return true
+	}
+	return false
+}
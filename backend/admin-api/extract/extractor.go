@@ -0,0 +1,104 @@
+package extract
+
+import (
+	"fmt"
+	"sync"
+
+	"admin-api/models"
+)
+
+// Extractor extracts records from a document for the targets of one target
+// type. Targets of other types are never passed to it.
+type Extractor interface {
+	Extract(doc Document, targets []models.Target) (*Result, error)
+}
+
+// Result is the output of an extractor. Warnings report problems that did not
+// stop the extraction, such as targets that matched nothing.
+type Result struct {
+	Records  []Record
+	Warnings []string
+}
+
+// TargetResult is the result of the extractor of one target type.
+type TargetResult struct {
+	TargetType models.TargetType
+	Result
+}
+
+var (
+	extractorsMu sync.RWMutex
+	extractors   = map[models.TargetType]Extractor{}
+)
+
+func init() {
+	Register(models.TargetTypeAuto, AutoExtractor{})
+	Register(models.TargetTypeXpath, XpathExtractor{})
+	Register(models.TargetTypeQuery, QueryExtractor{})
+	Register(models.TargetTypeRegex, RegexExtractor{})
+	Register(models.TargetTypeTable, TableExtractor{})
+	Register(models.TargetTypeStructured, StructuredExtractor{})
+	Register(models.TargetTypeJsonPath, JsonPathExtractor{})
+}
+
+// Register makes an extractor available for a target type. It panics if the
+// target type already has an extractor, as registration happens at init time.
+func Register(targetType models.TargetType, extractor Extractor) {
+	extractorsMu.Lock()
+	defer extractorsMu.Unlock()
+
+	if extractor == nil {
+		panic("extract: Register extractor is nil")
+	}
+	if _, ok := extractors[targetType]; ok {
+		panic(fmt.Sprintf("extract: Register called twice for target type %d", targetType))
+	}
+	extractors[targetType] = extractor
+}
+
+// Lookup returns the extractor registered for a target type.
+func Lookup(targetType models.TargetType) (Extractor, bool) {
+	extractorsMu.RLock()
+	defer extractorsMu.RUnlock()
+
+	extractor, ok := extractors[targetType]
+	return extractor, ok
+}
+
+// Extract runs the registered extractor of each target type used by the
+// targets, in the order the types first appear. Targets of a type without an
+// extractor are reported as a warning.
+func Extract(doc Document, targets []models.Target) ([]TargetResult, error) {
+	var targetTypes []models.TargetType
+	byType := map[models.TargetType][]models.Target{}
+	for _, target := range targets {
+		if _, ok := byType[target.Type]; !ok {
+			targetTypes = append(targetTypes, target.Type)
+		}
+		byType[target.Type] = append(byType[target.Type], target)
+	}
+
+	results := make([]TargetResult, 0, len(targetTypes))
+	for _, targetType := range targetTypes {
+		extractor, ok := Lookup(targetType)
+		if !ok {
+			results = append(results, TargetResult{
+				TargetType: targetType,
+				Result:     Result{Warnings: []string{fmt.Sprintf("no extractor for target type %d", targetType)}},
+			})
+			continue
+		}
+
+		result, err := extractor.Extract(doc, byType[targetType])
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, TargetResult{TargetType: targetType, Result: *result})
+	}
+	return results, nil
+}
+
+// noMatchWarning is the warning for a target that matched nothing.
+func noMatchWarning(target models.Target) string {
+	return fmt.Sprintf("target %q matched nothing", target.Name)
+}
@@ -0,0 +1,91 @@
+package extract
+
+import (
+	"testing"
+
+	"admin-api/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtract(t *testing.T) {
+	doc := Document{URL: "https://example.com/flats", ContentType: "text/html; charset=utf-8", Body: []byte(listingHTML)}
+
+	t.Run("Targets are dispatched by type", func(t *testing.T) {
+		results, err := Extract(doc, []models.Target{
+			{Type: models.TargetTypeQuery, Name: "heading", Value: "h1"},
+			{Type: models.TargetTypeXpath, Name: "title", Value: "//title"},
+			{Type: models.TargetTypeQuery, Name: "count", Value: "li.listing"},
+		})
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		assert.Equal(t, models.TargetTypeQuery, results[0].TargetType)
+		assert.Len(t, results[0].Records, 3)
+		assert.Equal(t, "Flats for rent", results[0].Records[0]["heading"])
+		assert.Equal(t, models.TargetTypeXpath, results[1].TargetType)
+		assert.Equal(t, []Record{{"title": "Listings"}}, results[1].Records)
+	})
+
+	t.Run("Target types without an extractor are reported", func(t *testing.T) {
+		results, err := Extract(doc, []models.Target{{Type: models.TargetType(99), Name: "unknown", Value: "x"}})
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Empty(t, results[0].Records)
+		assert.Equal(t, []string{"no extractor for target type 99"}, results[0].Warnings)
+	})
+
+	t.Run("Registered extractors are used", func(t *testing.T) {
+		targetType := models.TargetType(100)
+		Register(targetType, staticExtractor{"value": "static"})
+
+		extractor, ok := Lookup(targetType)
+		require.True(t, ok)
+		assert.Equal(t, staticExtractor{"value": "static"}, extractor)
+
+		results, err := Extract(doc, []models.Target{{Type: targetType, Name: "value"}})
+		require.NoError(t, err)
+		assert.Equal(t, []Record{{"value": "static"}}, results[0].Records)
+		assert.Panics(t, func() { Register(targetType, staticExtractor{}) })
+	})
+}
+
+type staticExtractor Record
+
+func (e staticExtractor) Extract(doc Document, targets []models.Target) (*Result, error) {
+	return &Result{Records: []Record{Record(e)}}, nil
+}
+
+func TestAutoExtractor(t *testing.T) {
+	targets := []models.Target{{Type: models.TargetTypeAuto, Value: "rents"}}
+
+	t.Run("Html documents are cleaned", func(t *testing.T) {
+		doc := Document{
+			URL:         "https://example.com/flats",
+			ContentType: "text/html",
+			Body: []byte(`<html><head><style>p{}</style></head><body>
+<nav>Home</nav><h1>Flats</h1><p>One  bed <b>flat</b></p><img src="/a.png"><script>x()</script>
+<footer>Contact</footer></body></html>`),
+		}
+		result, err := AutoExtractor{}.Extract(doc, targets)
+		require.NoError(t, err)
+		assert.Equal(t, []Record{{
+			"content": "Flats\nOne bed\nflat",
+			"images":  []any{"https://example.com/a.png"},
+			"targets": []any{"rents"},
+		}}, result.Records)
+	})
+
+	t.Run("Text documents are kept", func(t *testing.T) {
+		result, err := AutoExtractor{}.Extract(Document{ContentType: "text/plain", Body: []byte(" plain text \n")}, targets)
+		require.NoError(t, err)
+		assert.Equal(t, "plain text", result.Records[0]["content"])
+	})
+
+	t.Run("Binary documents are reported", func(t *testing.T) {
+		result, err := AutoExtractor{}.Extract(Document{ContentType: "image/png", Body: []byte{0x89}}, targets)
+		require.NoError(t, err)
+		assert.Empty(t, result.Records)
+		assert.Len(t, result.Warnings, 1)
+	})
+}
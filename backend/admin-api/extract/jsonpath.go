@@ -0,0 +1,94 @@
+package extract
+
+import (
+	"fmt"
+
+	"admin-api/jsonpath"
+	"admin-api/models"
+
+	"github.com/bytedance/sonic"
+)
+
+// JsonPathExtractor evaluates JSONPath targets against a JSON document, such
+// as the response of an API source, without any HTML parsing. Selected
+// values keep their JSON type: strings, numbers, booleans, null, objects and
+// lists.
+//
+// Like query targets, targets without a scope are turned into rows by
+// position, and targets with a scope, the JSONPath of repeated items such as
+// $.data[*], are evaluated against each item, taking the first match, so that
+// every item produces one record.
+type JsonPathExtractor struct{}
+
+func (JsonPathExtractor) Extract(doc Document, targets []models.Target) (*Result, error) {
+	var root any
+	if err := sonic.Unmarshal(doc.Body, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse json: %w", err)
+	}
+
+	result := &Result{}
+	var pageFields []field
+	var scoped []models.Target
+	var scope string
+	for _, target := range targets {
+		if target.Scope != "" {
+			scoped = append(scoped, target)
+			scope = target.Scope
+			continue
+		}
+
+		path, err := jsonpath.Compile(target.Value)
+		if err != nil {
+			return nil, err
+		}
+		values := path.Select(root)
+		if len(values) == 0 {
+			result.Warnings = append(result.Warnings, noMatchWarning(target))
+		}
+		pageFields = append(pageFields, field{name: target.Name, values: process(values, target.Process)})
+	}
+
+	if len(scoped) == 0 {
+		result.Records = zipFields(pageFields)
+		return result, nil
+	}
+
+	scopePath, err := jsonpath.Compile(scope)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scope %q: %w", scope, err)
+	}
+	paths := make([]*jsonpath.Path, len(scoped))
+	processors := make([]processor, len(scoped))
+	for i, target := range scoped {
+		if paths[i], err = jsonpath.Compile(target.Value); err != nil {
+			return nil, err
+		}
+		processors[i] = compileSteps(target.Process)
+	}
+
+	var records []Record
+	matched := map[string]bool{}
+	for _, item := range scopePath.Select(root) {
+		record := Record{}
+		for i, target := range scoped {
+			values := paths[i].Select(item)
+			if len(values) > 0 {
+				record[target.Name] = processors[i].applyOne(values[0])
+				matched[target.Name] = true
+			}
+		}
+		if len(record) > 0 {
+			records = append(records, record)
+		}
+	}
+
+	for _, target := range scoped {
+		if !matched[target.Name] {
+			result.Warnings = append(result.Warnings, noMatchWarning(target))
+		}
+	}
+
+	addFields(records, pageFields)
+	result.Records = records
+	return result, nil
+}
@@ -0,0 +1,68 @@
+package extract
+
+import (
+	"testing"
+
+	"admin-api/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const listingsResponse = `{
+  "meta": {"total": 3, "currency": "EUR"},
+  "data": [
+    {"id": 1, "title": "Studio", "price": {"amount": 750}, "tags": ["furnished"]},
+    {"id": 2, "title": "Loft", "price": {"amount": 1200}, "available": false},
+    {"id": 3, "title": "House"}
+  ]
+}`
+
+func TestJsonPathExtractor(t *testing.T) {
+	doc := Document{URL: "https://example.com/api/listings", ContentType: "application/json", Body: []byte(listingsResponse)}
+
+	t.Run("Targets without a scope are combined by position", func(t *testing.T) {
+		result, err := JsonPathExtractor{}.Extract(doc, []models.Target{
+			{Type: models.TargetTypeJsonPath, Name: "id", Value: "$.data[*].id"},
+			{Type: models.TargetTypeJsonPath, Name: "title", Value: "$.data[*].title"},
+			{Type: models.TargetTypeJsonPath, Name: "currency", Value: "meta.currency"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []Record{
+			{"id": 1.0, "title": "Studio", "currency": "EUR"},
+			{"id": 2.0, "title": "Loft", "currency": "EUR"},
+			{"id": 3.0, "title": "House", "currency": "EUR"},
+		}, result.Records)
+		assert.Empty(t, result.Warnings)
+	})
+
+	t.Run("Scoped targets produce one record per item", func(t *testing.T) {
+		result, err := JsonPathExtractor{}.Extract(doc, []models.Target{
+			{Type: models.TargetTypeJsonPath, Name: "title", Value: "$.title", Scope: "$.data[*]", Process: []models.ProcessStep{{Op: models.ProcessTrim}}},
+			{Type: models.TargetTypeJsonPath, Name: "price", Value: "$.price.amount", Scope: "$.data[*]"},
+			{Type: models.TargetTypeJsonPath, Name: "tags", Value: "$.tags", Scope: "$.data[*]"},
+			{Type: models.TargetTypeJsonPath, Name: "total", Value: "$.meta.total"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []Record{
+			{"title": "Studio", "price": 750.0, "tags": []any{"furnished"}, "total": 3.0},
+			{"title": "Loft", "price": 1200.0, "total": 3.0},
+			{"title": "House", "total": 3.0},
+		}, result.Records)
+	})
+
+	t.Run("Filters and missing fields", func(t *testing.T) {
+		result, err := JsonPathExtractor{}.Extract(doc, []models.Target{
+			{Type: models.TargetTypeJsonPath, Name: "expensive", Value: "$.data[?(@.price.amount > 1000)].title"},
+			{Type: models.TargetTypeJsonPath, Name: "rating", Value: "$.data[*].rating"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []Record{{"expensive": "Loft"}}, result.Records)
+		assert.Equal(t, []string{`target "rating" matched nothing`}, result.Warnings)
+	})
+
+	t.Run("Invalid JSON", func(t *testing.T) {
+		_, err := JsonPathExtractor{}.Extract(Document{Body: []byte("<html></html>")}, []models.Target{{Type: models.TargetTypeJsonPath, Name: "id", Value: "$.id"}})
+		assert.Error(t, err)
+	})
+}
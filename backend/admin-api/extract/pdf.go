@@ -0,0 +1,84 @@
+package extract
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// maxPdfPages caps the pages of a PDF whose text is extracted.
+const maxPdfPages = 1000
+
+// textPage is the text of a page of a document, numbered from 1.
+type textPage struct {
+	number int
+	text   string
+}
+
+// pdfText returns the text of the pages of a PDF, one line per row of text,
+// and its page count. Pages past maxPdfPages are left out.
+func pdfText(body []byte) (pages []textPage, count int, err error) {
+	// The parser panics on some malformed files
+	defer func() {
+		if r := recover(); r != nil {
+			pages, count, err = nil, 0, fmt.Errorf("invalid pdf: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid pdf: %w", err)
+	}
+
+	count = reader.NumPage()
+	for i := 1; i <= min(count, maxPdfPages); i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		lines := pdfLines(page.Content().Text)
+		pages = append(pages, textPage{number: i, text: strings.Join(lines, "\n")})
+	}
+	return pages, count, nil
+}
+
+// pdfLines groups the glyphs of a page into lines of text, from the top of
+// the page down. A gap wider than a fraction of the font size between two
+// glyphs of a line becomes a space.
+func pdfLines(glyphs []pdf.Text) []string {
+	byRow := map[float64][]pdf.Text{}
+	var rows []float64
+	for _, glyph := range glyphs {
+		y := math.Round(glyph.Y)
+		if _, ok := byRow[y]; !ok {
+			rows = append(rows, y)
+		}
+		byRow[y] = append(byRow[y], glyph)
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(rows)))
+
+	var lines []string
+	for _, y := range rows {
+		row := byRow[y]
+		sort.SliceStable(row, func(i, j int) bool { return row[i].X < row[j].X })
+
+		var line strings.Builder
+		for i, glyph := range row {
+			if i > 0 {
+				previous := row[i-1]
+				if glyph.X-(previous.X+previous.W) > 0.2*max(glyph.FontSize, 1) {
+					line.WriteByte(' ')
+				}
+			}
+			line.WriteString(glyph.S)
+		}
+		if text := normalizeSpace(line.String()); text != "" {
+			lines = append(lines, text)
+		}
+	}
+	return lines
+}
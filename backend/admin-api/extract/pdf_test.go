@@ -0,0 +1,111 @@
+package extract
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"admin-api/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildPdf returns a PDF with a page per element of pages, each showing its
+// lines from the top of the page down.
+func buildPdf(pages [][]string) []byte {
+	var objects []string
+	// 1 is the catalog, 2 the page tree and 3 the font; each page is
+	// followed by its content stream
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	)
+	for i, lines := range pages {
+		var content strings.Builder
+		for j, line := range lines {
+			fmt.Fprintf(&content, "BT /F1 12 Tf 72 %d Td (%s) Tj ET\n", 720-20*j, line)
+		}
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", 5+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+		)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+var priceList = buildPdf([][]string{
+	{"Price list 2026", "Widget A 12.50 EUR", "Widget B 8.00 EUR"},
+	{},
+	{"Gadget C 99.90 EUR"},
+})
+
+func TestAutoExtractorDocuments(t *testing.T) {
+	targets := []models.Target{{Type: models.TargetTypeAuto, Value: "prices"}}
+
+	t.Run("PDF pages become records with their page number", func(t *testing.T) {
+		result, err := AutoExtractor{}.Extract(Document{URL: "https://example.com/prices.pdf", ContentType: "application/pdf", Body: priceList}, targets)
+		require.NoError(t, err)
+		assert.Equal(t, []Record{
+			{"content": "Price list 2026\nWidget A 12.50 EUR\nWidget B 8.00 EUR", "images": []any{}, "targets": []any{"prices"}, "page": 1},
+			{"content": "Gadget C 99.90 EUR", "images": []any{}, "targets": []any{"prices"}, "page": 3},
+		}, result.Records)
+		assert.Empty(t, result.Warnings)
+	})
+
+	t.Run("PDFs served as binary downloads are detected", func(t *testing.T) {
+		result, err := AutoExtractor{}.Extract(Document{ContentType: "application/octet-stream", Body: priceList}, targets)
+		require.NoError(t, err)
+		assert.Len(t, result.Records, 2)
+	})
+
+	t.Run("PDFs without text", func(t *testing.T) {
+		result, err := AutoExtractor{}.Extract(Document{ContentType: "application/pdf", Body: buildPdf([][]string{{}})}, targets)
+		require.NoError(t, err)
+		assert.Empty(t, result.Records)
+		assert.Equal(t, []string{"pdf has no text, it may be scanned"}, result.Warnings)
+	})
+
+	t.Run("Invalid PDFs", func(t *testing.T) {
+		_, err := AutoExtractor{}.Extract(Document{ContentType: "application/pdf", Body: []byte("%PDF-1.4\nnot really")}, targets)
+		assert.Error(t, err)
+	})
+
+	t.Run("CSV is kept as text", func(t *testing.T) {
+		result, err := AutoExtractor{}.Extract(Document{ContentType: "text/csv; charset=utf-8", Body: []byte("\uFEFFsku,price\nA,12.50\n")}, targets)
+		require.NoError(t, err)
+		assert.Equal(t, []Record{{"content": "sku,price\nA,12.50", "images": []any{}, "targets": []any{"prices"}}}, result.Records)
+	})
+}
+
+func TestRegexExtractorPdf(t *testing.T) {
+	result, err := RegexExtractor{}.Extract(Document{ContentType: "application/pdf", Body: priceList}, []models.Target{
+		{Type: models.TargetTypeRegex, Value: `(?P<product>\w+ \w) (?P<price>[\d.]+) EUR`},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []Record{
+		{"product": "Widget A", "price": "12.50"},
+		{"product": "Widget B", "price": "8.00"},
+		{"product": "Gadget C", "price": "99.90"},
+	}, result.Records)
+}
@@ -0,0 +1,137 @@
+package extract
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"admin-api/models"
+)
+
+// process applies the post-processing steps of a target to each of its
+// values. Values that a step cannot handle, e.g. text that does not match a
+// regex step, become nil so that the rows of the other fields stay aligned.
+func process(values []any, steps []models.ProcessStep) []any {
+	return compileSteps(steps).apply(values)
+}
+
+// processStep is a post-processing step with its pattern compiled.
+type processStep struct {
+	models.ProcessStep
+	re *regexp.Regexp
+}
+
+// processor applies compiled post-processing steps. Extractors that process
+// the values of a target one by one compile its steps once up front.
+type processor []processStep
+
+func compileSteps(steps []models.ProcessStep) processor {
+	compiled := make(processor, len(steps))
+	for i, step := range steps {
+		compiled[i] = processStep{ProcessStep: step}
+		if step.Op == models.ProcessRegex {
+			// Invalid patterns are rejected by the validation of the target;
+			// a nil regex fails every value
+			compiled[i].re, _ = regexp.Compile(step.Pattern)
+		}
+	}
+	return compiled
+}
+
+func (p processor) apply(values []any) []any {
+	if len(p) == 0 {
+		return values
+	}
+
+	processed := make([]any, len(values))
+	for i, value := range values {
+		processed[i] = p.applyOne(value)
+	}
+	return processed
+}
+
+func (p processor) applyOne(value any) any {
+	for _, step := range p {
+		value = step.apply(value)
+		if value == nil {
+			break
+		}
+	}
+	return value
+}
+
+func (step processStep) apply(value any) any {
+	text, ok := value.(string)
+	if !ok {
+		return value
+	}
+
+	switch step.Op {
+	case models.ProcessTrim:
+		if step.Pattern != "" {
+			return strings.Trim(text, step.Pattern)
+		}
+		return strings.TrimSpace(text)
+	case models.ProcessRegex:
+		if step.re == nil {
+			return nil
+		}
+		match := step.re.FindStringSubmatch(text)
+		switch {
+		case match == nil:
+			return nil
+		case len(match) > 1:
+			return match[1]
+		default:
+			return match[0]
+		}
+	case models.ProcessNumber:
+		number, ok := parseNumber(text)
+		if !ok {
+			return nil
+		}
+		return number
+	}
+	return value
+}
+
+// parseNumber parses numbers as they are written on web pages, such as
+// "$1,299.00", "1.299,00 €" or "-12". When both separators are present the
+// last one is the decimal separator; a lone separator followed by exactly
+// three digits is a thousands separator.
+func parseNumber(text string) (float64, bool) {
+	var digits strings.Builder
+	for _, r := range text {
+		if (r >= '0' && r <= '9') || r == '.' || r == ',' || r == '-' {
+			digits.WriteRune(r)
+		}
+	}
+	number := strings.Trim(digits.String(), ".,")
+
+	lastDot, lastComma := strings.LastIndex(number, "."), strings.LastIndex(number, ",")
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		if lastComma > lastDot {
+			number = strings.ReplaceAll(number, ".", "")
+			number = strings.Replace(number, ",", ".", 1)
+		} else {
+			number = strings.ReplaceAll(number, ",", "")
+		}
+	case lastComma >= 0:
+		number = normalizeSeparator(number, ",")
+	case lastDot >= 0:
+		number = normalizeSeparator(number, ".")
+	}
+
+	value, err := strconv.ParseFloat(number, 64)
+	return value, err == nil
+}
+
+// normalizeSeparator handles numbers with a single kind of separator.
+func normalizeSeparator(number string, separator string) string {
+	parts := strings.Split(number, separator)
+	if len(parts) > 2 || len(parts[len(parts)-1]) == 3 {
+		return strings.Join(parts, "")
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,138 @@
+package extract
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"admin-api/models"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+)
+
+// QueryExtractor evaluates CSS selector targets against an HTML document. A
+// selector yields the text of each matched element, its own text with the
+// ::text suffix or an attribute with the ::attr(name) suffix.
+//
+// Targets without a scope are evaluated on the whole page and are turned into
+// rows like XPath targets. Targets with a scope are evaluated within each
+// block the scope matches, taking the first match, and every block produces
+// one record; page level values are added to these records.
+type QueryExtractor struct{}
+
+func (QueryExtractor) Extract(doc Document, targets []models.Target) (*Result, error) {
+	root, err := goquery.NewDocumentFromReader(bytes.NewReader(doc.Body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse html: %w", err)
+	}
+	base, _ := url.Parse(doc.URL)
+
+	result := &Result{}
+	var pageFields []field
+	var scoped []models.Target
+	var scope string
+	for _, target := range targets {
+		if target.Scope != "" {
+			scoped = append(scoped, target)
+			scope = target.Scope
+			continue
+		}
+
+		query, err := models.ParseQuerySelector(target.Value)
+		if err != nil {
+			return nil, err
+		}
+		values := selectValues(root.Selection, query, compileSteps(target.Process), base)
+		if len(values) == 0 {
+			result.Warnings = append(result.Warnings, noMatchWarning(target))
+		}
+		pageFields = append(pageFields, field{name: target.Name, values: values})
+	}
+
+	if len(scoped) == 0 {
+		result.Records = zipFields(pageFields)
+		return result, nil
+	}
+
+	scopeSelector, err := cascadia.Compile(scope)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scope %q: %w", scope, err)
+	}
+
+	queries := make([]*models.QuerySelector, len(scoped))
+	processors := make([]processor, len(scoped))
+	for i, target := range scoped {
+		if queries[i], err = models.ParseQuerySelector(target.Value); err != nil {
+			return nil, err
+		}
+		processors[i] = compileSteps(target.Process)
+	}
+
+	var records []Record
+	matched := map[string]bool{}
+	root.FindMatcher(scopeSelector).Each(func(_ int, block *goquery.Selection) {
+		record := Record{}
+		for i, target := range scoped {
+			values := selectValues(block, queries[i], processors[i], base)
+			if len(values) > 0 {
+				record[target.Name] = values[0]
+				matched[target.Name] = true
+			}
+		}
+		if len(record) > 0 {
+			records = append(records, record)
+		}
+	})
+
+	for _, target := range scoped {
+		if !matched[target.Name] {
+			result.Warnings = append(result.Warnings, noMatchWarning(target))
+		}
+	}
+
+	addFields(records, pageFields)
+	result.Records = records
+	return result, nil
+}
+
+// selectValues returns the processed values the query selects within the
+// selection.
+func selectValues(selection *goquery.Selection, query *models.QuerySelector, steps processor, base *url.URL) []any {
+	var values []any
+	selection.FindMatcher(query.Selector).Each(func(i int, match *goquery.Selection) {
+		switch query.Accessor {
+		case models.QueryAccessorAttr:
+			value, ok := match.Attr(query.Attr)
+			if !ok {
+				values = append(values, nil)
+				return
+			}
+			if isLinkAttribute(query.Attr) {
+				value = resolveURL(base, value)
+			}
+			values = append(values, value)
+		case models.QueryAccessorOwnText:
+			values = append(values, normalizeSpace(ownText(match)))
+		default:
+			values = append(values, normalizeSpace(match.Text()))
+		}
+	})
+	return steps.apply(values)
+}
+
+// ownText returns the text of the element's direct text children.
+func ownText(selection *goquery.Selection) string {
+	var text strings.Builder
+	for _, node := range selection.Nodes {
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type == html.TextNode {
+				text.WriteString(child.Data)
+				text.WriteString(" ")
+			}
+		}
+	}
+	return text.String()
+}
@@ -0,0 +1,111 @@
+package extract
+
+import (
+	"testing"
+
+	"admin-api/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const productsHTML = `<html>
+<body>
+  <h1>Shop</h1>
+  <div class="product">
+    <h2><a href="/p/1">Lamp</a> <small>new</small></h2>
+    <span class="price">$1,299.00</span>
+    <span class="sku">SKU: A-100</span>
+  </div>
+  <div class="product">
+    <h2><a href="/p/2">Chair</a></h2>
+    <span class="price">1.050,50 €</span>
+  </div>
+  <div class="product">
+    <h2><a href="https://other.example.com/p/3">Table</a></h2>
+  </div>
+</body>
+</html>`
+
+func TestExtractQuery(t *testing.T) {
+	doc := Document{URL: "https://example.com/shop", ContentType: "text/html", Body: []byte(productsHTML)}
+
+	t.Run("Unscoped selectors become rows", func(t *testing.T) {
+		result, err := QueryExtractor{}.Extract(doc, []models.Target{
+			{Type: models.TargetTypeQuery, Name: "shop", Value: "h1"},
+			{Type: models.TargetTypeQuery, Name: "name", Value: ".product h2 a"},
+			{Type: models.TargetTypeQuery, Name: "link", Value: ".product h2 a::attr(href)"},
+		})
+		require.NoError(t, err)
+		require.Len(t, result.Records, 3)
+		assert.Equal(t, Record{"shop": "Shop", "name": "Lamp", "link": "https://example.com/p/1"}, result.Records[0])
+		assert.Equal(t, "https://other.example.com/p/3", result.Records[2]["link"])
+	})
+
+	t.Run("Text accessors", func(t *testing.T) {
+		result, err := QueryExtractor{}.Extract(doc, []models.Target{
+			{Type: models.TargetTypeQuery, Name: "text", Value: ".product:first-of-type h2"},
+			{Type: models.TargetTypeQuery, Name: "own", Value: ".product:first-of-type h2::text"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []Record{{"text": "Lamp new", "own": ""}}, result.Records)
+	})
+
+	t.Run("Scoped selectors produce a record per block", func(t *testing.T) {
+		result, err := QueryExtractor{}.Extract(doc, []models.Target{
+			{Type: models.TargetTypeQuery, Name: "shop", Value: "h1"},
+			{Type: models.TargetTypeQuery, Name: "name", Value: "h2 a", Scope: ".product"},
+			{Type: models.TargetTypeQuery, Name: "price", Value: ".price", Scope: ".product", Process: []models.ProcessStep{{Op: models.ProcessNumber}}},
+			{Type: models.TargetTypeQuery, Name: "sku", Value: ".sku", Scope: ".product", Process: []models.ProcessStep{{Op: models.ProcessRegex, Pattern: `SKU:\s*(\S+)`}}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []Record{
+			{"shop": "Shop", "name": "Lamp", "price": 1299.0, "sku": "A-100"},
+			{"shop": "Shop", "name": "Chair", "price": 1050.5},
+			{"shop": "Shop", "name": "Table"},
+		}, result.Records)
+		assert.Empty(t, result.Warnings)
+	})
+
+	t.Run("Targets without matches are reported", func(t *testing.T) {
+		result, err := QueryExtractor{}.Extract(doc, []models.Target{
+			{Type: models.TargetTypeQuery, Name: "name", Value: "h2 a", Scope: ".product"},
+			{Type: models.TargetTypeQuery, Name: "rating", Value: ".rating", Scope: ".product"},
+		})
+		require.NoError(t, err)
+		assert.Len(t, result.Records, 3)
+		assert.Equal(t, []string{`target "rating" matched nothing`}, result.Warnings)
+	})
+
+	t.Run("Invalid selector", func(t *testing.T) {
+		_, err := QueryExtractor{}.Extract(doc, []models.Target{{Type: models.TargetTypeQuery, Name: "broken", Value: "div["}})
+		assert.Error(t, err)
+	})
+}
+
+func TestProcess(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		steps []models.ProcessStep
+		want  any
+	}{
+		{"Trim whitespace", "  a b  ", []models.ProcessStep{{Op: models.ProcessTrim}}, "a b"},
+		{"Trim characters", "--a--", []models.ProcessStep{{Op: models.ProcessTrim, Pattern: "-"}}, "a"},
+		{"Regex capture group", "Rooms: 3", []models.ProcessStep{{Op: models.ProcessRegex, Pattern: `(\d+)`}}, "3"},
+		{"Regex without match", "none", []models.ProcessStep{{Op: models.ProcessRegex, Pattern: `\d+`}}, nil},
+		{"Number with currency", "$1,299.99", []models.ProcessStep{{Op: models.ProcessNumber}}, 1299.99},
+		{"Number with decimal comma", "12,5 kg", []models.ProcessStep{{Op: models.ProcessNumber}}, 12.5},
+		{"Number with thousands comma", "12,500", []models.ProcessStep{{Op: models.ProcessNumber}}, 12500.0},
+		{"Number with thousands dot", "1.050,50 €", []models.ProcessStep{{Op: models.ProcessNumber}}, 1050.5},
+		{"Negative number", "-3", []models.ProcessStep{{Op: models.ProcessNumber}}, -3.0},
+		{"Not a number", "n/a", []models.ProcessStep{{Op: models.ProcessNumber}}, nil},
+		{"Steps are chained", "Price: 1,200 EUR", []models.ProcessStep{{Op: models.ProcessRegex, Pattern: `Price: (.*)`}, {Op: models.ProcessNumber}}, 1200.0},
+		{"Non-text values are kept", 3.0, []models.ProcessStep{{Op: models.ProcessTrim}}, 3.0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, []any{tt.want}, process([]any{tt.value}, tt.steps))
+		})
+	}
+}
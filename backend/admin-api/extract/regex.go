@@ -0,0 +1,60 @@
+package extract
+
+import (
+	"admin-api/models"
+)
+
+// RegexExtractor matches regex targets against the document body as text,
+// which suits plain text sources and logs, or against the text of the pages
+// of PDFs. Every match of a pattern is a row: named groups become fields
+// named after the group, and a pattern without named groups yields a field
+// named after the target holding its first group or, without groups, the
+// whole match.
+//
+// The rows of several targets are combined by position, and targets matching
+// once, such as a report date, are repeated in every row.
+type RegexExtractor struct{}
+
+func (RegexExtractor) Extract(doc Document, targets []models.Target) (*Result, error) {
+	text, err := documentText(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	var fields []field
+	for _, target := range targets {
+		re, err := models.CompileRegexTarget(target.Value, target.Flags)
+		if err != nil {
+			return nil, err
+		}
+
+		matches := re.FindAllStringSubmatch(text, -1)
+		if len(matches) == 0 {
+			result.Warnings = append(result.Warnings, noMatchWarning(target))
+		}
+
+		if !models.HasNamedGroups(re) {
+			values := make([]any, len(matches))
+			for i, match := range matches {
+				values[i] = match[min(1, len(match)-1)]
+			}
+			fields = append(fields, field{name: target.Name, values: process(values, target.Process)})
+			continue
+		}
+
+		for group, name := range re.SubexpNames() {
+			if name == "" {
+				continue
+			}
+			values := make([]any, len(matches))
+			for i, match := range matches {
+				values[i] = match[group]
+			}
+			fields = append(fields, field{name: name, values: process(values, target.Process)})
+		}
+	}
+
+	result.Records = zipFields(fields)
+	return result, nil
+}
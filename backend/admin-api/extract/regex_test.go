@@ -0,0 +1,64 @@
+package extract
+
+import (
+	"testing"
+
+	"admin-api/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const accessLog = `Report: 2026-03-01
+GET /index.html 200 512
+post /login 302 0
+GET /missing 404 128
+`
+
+func TestRegexExtractor(t *testing.T) {
+	doc := Document{URL: "https://example.com/access.log", ContentType: "text/plain", Body: []byte(accessLog)}
+
+	t.Run("Named groups become fields of every match", func(t *testing.T) {
+		result, err := RegexExtractor{}.Extract(doc, []models.Target{
+			{Type: models.TargetTypeRegex, Value: `Report: (?P<date>\S+)`},
+			{
+				Type:    models.TargetTypeRegex,
+				Value:   `^(?P<method>get|post) (?P<path>\S+) (?P<status>\d+)`,
+				Flags:   "im",
+				Process: []models.ProcessStep{{Op: models.ProcessTrim}},
+			},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []Record{
+			{"date": "2026-03-01", "method": "GET", "path": "/index.html", "status": "200"},
+			{"date": "2026-03-01", "method": "post", "path": "/login", "status": "302"},
+			{"date": "2026-03-01", "method": "GET", "path": "/missing", "status": "404"},
+		}, result.Records)
+		assert.Empty(t, result.Warnings)
+	})
+
+	t.Run("Unnamed patterns use the target name", func(t *testing.T) {
+		result, err := RegexExtractor{}.Extract(doc, []models.Target{
+			{Type: models.TargetTypeRegex, Name: "bytes", Value: `\d{3} (\d+)$`, Flags: "m", Process: []models.ProcessStep{{Op: models.ProcessNumber}}},
+			{Type: models.TargetTypeRegex, Name: "line", Value: `GET \S+`},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []Record{
+			{"bytes": 512.0, "line": "GET /index.html"},
+			{"bytes": 0.0, "line": "GET /missing"},
+			{"bytes": 128.0},
+		}, result.Records)
+	})
+
+	t.Run("Flags change the matching", func(t *testing.T) {
+		result, err := RegexExtractor{}.Extract(doc, []models.Target{{Type: models.TargetTypeRegex, Name: "post", Value: `^POST \S+`}})
+		require.NoError(t, err)
+		assert.Empty(t, result.Records)
+		assert.Equal(t, []string{`target "post" matched nothing`}, result.Warnings)
+	})
+
+	t.Run("Invalid pattern", func(t *testing.T) {
+		_, err := RegexExtractor{}.Extract(doc, []models.Target{{Type: models.TargetTypeRegex, Name: "broken", Value: `(\d+`}})
+		assert.Error(t, err)
+	})
+}
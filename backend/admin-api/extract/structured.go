@@ -0,0 +1,318 @@
+package extract
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"admin-api/models"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/bytedance/sonic"
+	"golang.org/x/net/html"
+)
+
+// openGraphType is the @type of the item made of a page's OpenGraph tags.
+const openGraphType = "OpenGraph"
+
+// StructuredExtractor reads the structured data embedded in an HTML page:
+// schema.org JSON-LD blocks, microdata items and OpenGraph meta tags. Every
+// object with a @type, including nested ones such as the Offer of a Product,
+// is an item, and the OpenGraph tags form one item of type OpenGraph keyed by
+// property, e.g. og:title.
+//
+// Targets with the same schema type produce one record per item of that type,
+// or per item of any type without a schema type. The value of a target is the
+// dotted path of its field in the item, e.g. offers.price; a path step into a
+// list takes the element at a numeric step, or else the first element.
+type StructuredExtractor struct{}
+
+func (StructuredExtractor) Extract(doc Document, targets []models.Target) (*Result, error) {
+	root, err := goquery.NewDocumentFromReader(bytes.NewReader(doc.Body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse html: %w", err)
+	}
+	base, _ := url.Parse(doc.URL)
+
+	result := &Result{}
+	items := jsonLdItems(root, result)
+	items = append(items, microdataItems(root, base)...)
+	if item := openGraphItem(root); item != nil {
+		items = append(items, item)
+	}
+
+	var flattened []map[string]any
+	for _, item := range items {
+		flattened = appendTypedItems(flattened, item)
+	}
+
+	var schemaTypes []string
+	bySchemaType := map[string][]models.Target{}
+	for _, target := range targets {
+		schemaType := strings.ToLower(schemaTypeName(target.SchemaType))
+		if _, ok := bySchemaType[schemaType]; !ok {
+			schemaTypes = append(schemaTypes, schemaType)
+		}
+		bySchemaType[schemaType] = append(bySchemaType[schemaType], target)
+	}
+
+	for _, schemaType := range schemaTypes {
+		group := bySchemaType[schemaType]
+		processors := make([]processor, len(group))
+		for i, target := range group {
+			processors[i] = compileSteps(target.Process)
+		}
+
+		matched := map[string]bool{}
+		for _, item := range flattened {
+			if schemaType != "" && !hasSchemaType(item, schemaType) {
+				continue
+			}
+
+			record := Record{}
+			for i, target := range group {
+				value, ok := lookupPath(item, strings.Split(target.Value, "."))
+				if !ok {
+					continue
+				}
+				record[target.Name] = processors[i].applyOne(value)
+				matched[target.Name] = true
+			}
+			if len(record) > 0 {
+				result.Records = append(result.Records, record)
+			}
+		}
+
+		for _, target := range group {
+			if !matched[target.Name] {
+				result.Warnings = append(result.Warnings, noMatchWarning(target))
+			}
+		}
+	}
+	return result, nil
+}
+
+// jsonLdItems parses the JSON-LD blocks of the page. Blocks that are not
+// valid JSON are skipped with a warning.
+func jsonLdItems(root *goquery.Document, result *Result) []any {
+	var items []any
+	root.Find(`script[type="application/ld+json"]`).Each(func(i int, script *goquery.Selection) {
+		var item any
+		if err := sonic.UnmarshalString(strings.TrimSpace(script.Text()), &item); err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("invalid JSON-LD block %d: %v", i, err))
+			return
+		}
+		items = append(items, item)
+	})
+	return items
+}
+
+// microdataItems returns the top level microdata items of the page, with
+// their nested items as property values.
+func microdataItems(root *goquery.Document, base *url.URL) []any {
+	var items []any
+	root.Find("[itemscope]").Not("[itemprop]").Each(func(i int, scope *goquery.Selection) {
+		items = append(items, microdataItem(scope.Nodes[0], base))
+	})
+	return items
+}
+
+func microdataItem(scope *html.Node, base *url.URL) map[string]any {
+	item := map[string]any{}
+	// Item types are URLs such as https://schema.org/Product; keep their
+	// names like JSON-LD does
+	var types []any
+	for _, itemType := range strings.Fields(attr(scope, "itemtype")) {
+		types = append(types, schemaTypeName(itemType))
+	}
+	switch len(types) {
+	case 0:
+	case 1:
+		item["@type"] = types[0]
+	default:
+		item["@type"] = types
+	}
+	if itemID := attr(scope, "itemid"); itemID != "" {
+		item["@id"] = itemID
+	}
+	addMicrodataProperties(item, scope, base)
+	return item
+}
+
+// addMicrodataProperties adds the properties below node to the item, without
+// descending into nested items.
+func addMicrodataProperties(item map[string]any, node *html.Node, base *url.URL) {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != html.ElementNode {
+			continue
+		}
+
+		_, nested := attrValue(child, "itemscope")
+		if props := strings.Fields(attr(child, "itemprop")); len(props) > 0 {
+			var value any
+			if nested {
+				value = microdataItem(child, base)
+			} else {
+				value = microdataValue(child, base)
+			}
+			for _, prop := range props {
+				switch existing := item[prop].(type) {
+				case nil:
+					item[prop] = value
+				case []any:
+					item[prop] = append(existing, value)
+				default:
+					item[prop] = []any{existing, value}
+				}
+			}
+		}
+		if !nested {
+			addMicrodataProperties(item, child, base)
+		}
+	}
+}
+
+// microdataValue returns the value of a microdata property element, which
+// depends on the element as in the HTML specification.
+func microdataValue(node *html.Node, base *url.URL) string {
+	switch node.Data {
+	case "meta":
+		return attr(node, "content")
+	case "a", "area", "link":
+		return resolveURL(base, attr(node, "href"))
+	case "img", "audio", "video", "source", "iframe", "embed", "track":
+		return resolveURL(base, attr(node, "src"))
+	case "object":
+		return resolveURL(base, attr(node, "data"))
+	case "data", "meter":
+		return attr(node, "value")
+	case "time":
+		if datetime, ok := attrValue(node, "datetime"); ok {
+			return datetime
+		}
+	}
+	if content, ok := attrValue(node, "content"); ok {
+		return content
+	}
+	return normalizeSpace(goquery.NewDocumentFromNode(node).Text())
+}
+
+// openGraphItem returns the OpenGraph tags of the page, such as og:title and
+// product:price:amount, or nil if it has none.
+func openGraphItem(root *goquery.Document) map[string]any {
+	item := map[string]any{}
+	root.Find("meta[property][content]").Each(func(i int, meta *goquery.Selection) {
+		property, _ := meta.Attr("property")
+		content, _ := meta.Attr("content")
+		if !strings.Contains(property, ":") {
+			return
+		}
+		// Repeated tags, such as several og:image, keep the first one
+		if _, ok := item[property]; !ok {
+			item[property] = content
+		}
+	})
+	if len(item) == 0 {
+		return nil
+	}
+	item["@type"] = openGraphType
+	return item
+}
+
+// appendTypedItems appends every object with a @type found in value, parents
+// before the items nested in them. JSON-LD @graph lists are walked as well.
+func appendTypedItems(items []map[string]any, value any) []map[string]any {
+	switch v := value.(type) {
+	case map[string]any:
+		if _, ok := v["@type"]; ok {
+			items = append(items, v)
+		}
+		for _, key := range sortedKeys(v) {
+			items = appendTypedItems(items, v[key])
+		}
+	case []any:
+		for _, element := range v {
+			items = appendTypedItems(items, element)
+		}
+	}
+	return items
+}
+
+// hasSchemaType reports whether the item has the schema type, ignoring case
+// and the schema.org prefix of types written as URLs.
+func hasSchemaType(item map[string]any, schemaType string) bool {
+	var types []any
+	switch t := item["@type"].(type) {
+	case string:
+		types = []any{t}
+	case []any:
+		types = t
+	}
+	for _, t := range types {
+		if name, ok := t.(string); ok && strings.EqualFold(schemaTypeName(name), schemaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaTypeName returns the name of a schema type written as a URL.
+func schemaTypeName(schemaType string) string {
+	if i := strings.LastIndexAny(schemaType, "/#"); i >= 0 {
+		return schemaType[i+1:]
+	}
+	return schemaType
+}
+
+func lookupPath(value any, path []string) (any, bool) {
+	for i := 0; i < len(path); i++ {
+		switch v := value.(type) {
+		case map[string]any:
+			next, ok := v[path[i]]
+			if !ok {
+				return nil, false
+			}
+			value = next
+		case []any:
+			index, err := strconv.Atoi(path[i])
+			if err != nil {
+				// Look the step up in the first element instead
+				index = 0
+				i--
+			}
+			if index < 0 || index >= len(v) {
+				return nil, false
+			}
+			value = v[index]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func attr(node *html.Node, name string) string {
+	value, _ := attrValue(node, name)
+	return value
+}
+
+func attrValue(node *html.Node, name string) (string, bool) {
+	for _, a := range node.Attr {
+		if a.Key == name {
+			return strings.TrimSpace(a.Val), true
+		}
+	}
+	return "", false
+}
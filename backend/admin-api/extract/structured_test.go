@@ -0,0 +1,91 @@
+package extract
+
+import (
+	"testing"
+
+	"admin-api/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const productHTML = `<html><head>
+<meta property="og:title" content="Desk lamp">
+<meta property="og:image" content="https://example.com/lamp.jpg">
+<meta property="og:image" content="https://example.com/lamp-2.jpg">
+<meta name="description" content="Not OpenGraph">
+<script type="application/ld+json">
+{"@context": "https://schema.org", "@graph": [
+  {"@type": "Product", "name": "Desk lamp", "sku": "L-1",
+   "offers": [{"@type": "Offer", "price": "39.90", "priceCurrency": "EUR"},
+              {"@type": "Offer", "price": "35.00", "priceCurrency": "EUR"}]},
+  {"@type": "BreadcrumbList", "name": "Lighting"}
+]}
+</script>
+<script type="application/ld+json">{broken</script>
+</head><body>
+<div itemscope itemtype="https://schema.org/Product">
+  <h1 itemprop="name">Floor lamp</h1>
+  <a itemprop="url" href="/floor-lamp">Details</a>
+  <div itemprop="offers" itemscope itemtype="https://schema.org/Offer">
+    <span itemprop="price" content="120">120 €</span>
+    <meta itemprop="priceCurrency" content="EUR">
+  </div>
+</div>
+</body></html>`
+
+func TestStructuredExtractor(t *testing.T) {
+	doc := Document{URL: "https://example.com/lamps", ContentType: "text/html", Body: []byte(productHTML)}
+
+	t.Run("Items are filtered by schema type", func(t *testing.T) {
+		result, err := StructuredExtractor{}.Extract(doc, []models.Target{
+			{Type: models.TargetTypeStructured, Name: "name", Value: "name", SchemaType: "Product"},
+			{Type: models.TargetTypeStructured, Name: "price", Value: "offers.price", SchemaType: "Product", Process: []models.ProcessStep{{Op: models.ProcessNumber}}},
+			{Type: models.TargetTypeStructured, Name: "second_price", Value: "offers.1.price", SchemaType: "product"},
+			{Type: models.TargetTypeStructured, Name: "url", Value: "url", SchemaType: "Product"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []Record{
+			{"name": "Desk lamp", "price": 39.9, "second_price": "35.00"},
+			{"name": "Floor lamp", "price": 120.0, "url": "https://example.com/floor-lamp"},
+		}, result.Records)
+		assert.Len(t, result.Warnings, 1)
+		assert.Contains(t, result.Warnings[0], "invalid JSON-LD block 1")
+	})
+
+	t.Run("Nested items can be selected", func(t *testing.T) {
+		result, err := StructuredExtractor{}.Extract(doc, []models.Target{
+			{Type: models.TargetTypeStructured, Name: "price", Value: "price", SchemaType: "Offer"},
+			{Type: models.TargetTypeStructured, Name: "currency", Value: "priceCurrency", SchemaType: "Offer"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []Record{
+			{"price": "39.90", "currency": "EUR"},
+			{"price": "35.00", "currency": "EUR"},
+			{"price": "120", "currency": "EUR"},
+		}, result.Records)
+	})
+
+	t.Run("OpenGraph tags", func(t *testing.T) {
+		result, err := StructuredExtractor{}.Extract(doc, []models.Target{
+			{Type: models.TargetTypeStructured, Name: "title", Value: "og:title", SchemaType: "OpenGraph"},
+			{Type: models.TargetTypeStructured, Name: "image", Value: "og:image", SchemaType: "OpenGraph"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []Record{{"title": "Desk lamp", "image": "https://example.com/lamp.jpg"}}, result.Records)
+	})
+
+	t.Run("Targets without a schema type match any item", func(t *testing.T) {
+		result, err := StructuredExtractor{}.Extract(doc, []models.Target{
+			{Type: models.TargetTypeStructured, Name: "type", Value: "@type"},
+			{Type: models.TargetTypeStructured, Name: "missing", Value: "gtin13"},
+		})
+		require.NoError(t, err)
+		var types []any
+		for _, record := range result.Records {
+			types = append(types, record["type"])
+		}
+		assert.Equal(t, []any{"Product", "Offer", "Offer", "BreadcrumbList", "Product", "Offer", "OpenGraph"}, types)
+		assert.Contains(t, result.Warnings, `target "missing" matched nothing`)
+	})
+}
@@ -0,0 +1,343 @@
+package extract
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"admin-api/models"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	// maxTableSpan caps colspan and rowspan so that a broken table cannot
+	// make the grid explode.
+	maxTableSpan = 1000
+	// maxTableCells caps the cells of the expanded grid, as spans alone can
+	// still multiply a few cells into millions.
+	maxTableCells = 100_000
+)
+
+// TableExtractor converts an HTML table into records, one per data row, keyed
+// by column name. The table is the one at the target's index among the
+// tables matched by its selector, "table" by default, and whose caption
+// contains the target's caption. Cells spanning several columns or rows are
+// repeated in each of them.
+//
+// Records of several table targets are appended in target order.
+type TableExtractor struct{}
+
+func (TableExtractor) Extract(doc Document, targets []models.Target) (*Result, error) {
+	root, err := goquery.NewDocumentFromReader(bytes.NewReader(doc.Body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse html: %w", err)
+	}
+
+	result := &Result{}
+	for _, target := range targets {
+		options := models.TableOptions{}
+		if target.Table != nil {
+			options = *target.Table
+		}
+
+		table := findTable(root, target.Value, options)
+		if table == nil {
+			result.Warnings = append(result.Warnings, noMatchWarning(target))
+			continue
+		}
+
+		records, warnings := tableRecords(table, options, target.Process)
+		result.Records = append(result.Records, records...)
+		result.Warnings = append(result.Warnings, warnings...)
+	}
+	return result, nil
+}
+
+func findTable(root *goquery.Document, selector string, options models.TableOptions) *html.Node {
+	if selector == "" {
+		selector = "table"
+	}
+
+	var tables []*html.Node
+	root.Find(selector).Each(func(i int, match *goquery.Selection) {
+		if goquery.NodeName(match) != "table" {
+			return
+		}
+		if options.Caption != "" {
+			caption := normalizeSpace(match.ChildrenFiltered("caption").Text())
+			if !strings.Contains(strings.ToLower(caption), strings.ToLower(options.Caption)) {
+				return
+			}
+		}
+		tables = append(tables, match.Nodes[0])
+	})
+
+	if options.Index >= len(tables) {
+		return nil
+	}
+	return tables[options.Index]
+}
+
+// tableCell is a cell of the expanded table grid.
+type tableCell struct {
+	text   string
+	header bool
+}
+
+func tableRecords(table *html.Node, options models.TableOptions, steps []models.ProcessStep) ([]Record, []string) {
+	grid, truncated := tableGrid(table)
+	headerRows := countHeaderRows(table, grid, options.Header)
+
+	width := 0
+	for _, row := range grid {
+		width = max(width, len(row))
+	}
+	names := columnNames(grid[:headerRows], width)
+
+	columns, warnings := mapColumns(names, options.Columns)
+	if truncated {
+		warnings = append(warnings, fmt.Sprintf("table has more than %d cells, only the first %d rows were read", maxTableCells, len(grid)))
+	}
+
+	compiled := compileSteps(steps)
+	var fields []field
+	for _, column := range columns {
+		values := make([]any, 0, len(grid)-headerRows)
+		for _, row := range grid[headerRows:] {
+			if column.index < len(row) {
+				values = append(values, row[column.index].text)
+			} else {
+				values = append(values, "")
+			}
+		}
+		fields = append(fields, field{name: column.name, values: compiled.apply(values)})
+	}
+
+	var records []Record
+	for i := range len(grid) - headerRows {
+		if isEmptyRow(grid[headerRows+i]) {
+			continue
+		}
+		record := Record{}
+		for _, f := range fields {
+			record[f.name] = f.values[i]
+		}
+		records = append(records, record)
+	}
+	return records, warnings
+}
+
+// tableGrid lays the cells of the table out on a grid, repeating cells that
+// span several columns or rows. It stops after the row in which the grid
+// exceeds maxTableCells and reports that it was truncated.
+func tableGrid(table *html.Node) ([][]tableCell, bool) {
+	var grid [][]tableCell
+	// pending holds the cells of rowspans that reach into later rows
+	pending := map[[2]int]tableCell{}
+	// cells counts the cells laid out so far, including pending ones
+	cells := 0
+
+	rows := tableRows(table)
+	for r, tr := range rows {
+		var row []tableCell
+		col := 0
+		fill := func() {
+			for {
+				cell, ok := pending[[2]int{r, col}]
+				if !ok {
+					return
+				}
+				row = append(row, cell)
+				delete(pending, [2]int{r, col})
+				col++
+			}
+		}
+
+		for td := tr.FirstChild; td != nil; td = td.NextSibling {
+			if td.Type != html.ElementNode || (td.DataAtom != atom.Td && td.DataAtom != atom.Th) {
+				continue
+			}
+			fill()
+
+			cell := tableCell{text: normalizeSpace(goquery.NewDocumentFromNode(td).Text()), header: td.DataAtom == atom.Th}
+			// Rowspans do not reach past the last row of the table
+			colspan, rowspan := cellSpan(td, "colspan"), min(cellSpan(td, "rowspan"), len(rows)-r)
+			for c := 0; c < colspan && cells <= maxTableCells; c++ {
+				row = append(row, cell)
+				for rs := 1; rs < rowspan; rs++ {
+					pending[[2]int{r + rs, col}] = cell
+				}
+				cells += rowspan
+				col++
+			}
+		}
+		fill()
+		grid = append(grid, row)
+		if cells > maxTableCells {
+			return grid, true
+		}
+	}
+	return grid, false
+}
+
+// tableRows returns the rows of the table, without the rows of nested tables.
+func tableRows(table *html.Node) []*html.Node {
+	var rows []*html.Node
+	for child := table.FirstChild; child != nil; child = child.NextSibling {
+		switch child.DataAtom {
+		case atom.Tr:
+			rows = append(rows, child)
+		case atom.Thead, atom.Tbody, atom.Tfoot:
+			for tr := child.FirstChild; tr != nil; tr = tr.NextSibling {
+				if tr.DataAtom == atom.Tr {
+					rows = append(rows, tr)
+				}
+			}
+		}
+	}
+	return rows
+}
+
+func cellSpan(cell *html.Node, name string) int {
+	for _, attr := range cell.Attr {
+		if attr.Key == name {
+			span, err := strconv.Atoi(strings.TrimSpace(attr.Val))
+			if err != nil || span < 1 {
+				return 1
+			}
+			return min(span, maxTableSpan)
+		}
+	}
+	return 1
+}
+
+// countHeaderRows returns how many leading rows of the grid hold column names.
+func countHeaderRows(table *html.Node, grid [][]tableCell, header models.TableHeader) int {
+	switch header {
+	case models.TableHeaderNone:
+		return 0
+	case models.TableHeaderFirst:
+		return min(1, len(grid))
+	}
+
+	for child := table.FirstChild; child != nil; child = child.NextSibling {
+		if child.DataAtom == atom.Thead {
+			rows := 0
+			for tr := child.FirstChild; tr != nil; tr = tr.NextSibling {
+				if tr.DataAtom == atom.Tr {
+					rows++
+				}
+			}
+			if rows > 0 {
+				return min(rows, len(grid))
+			}
+		}
+	}
+
+	rows := 0
+	for _, row := range grid {
+		if len(row) == 0 || !isHeaderRow(row) {
+			break
+		}
+		rows++
+	}
+	// A table made only of th cells has no data rows to name
+	if rows == len(grid) {
+		return min(1, rows)
+	}
+	return rows
+}
+
+func isHeaderRow(row []tableCell) bool {
+	for _, cell := range row {
+		if !cell.header {
+			return false
+		}
+	}
+	return true
+}
+
+func isEmptyRow(row []tableCell) bool {
+	for _, cell := range row {
+		if cell.text != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// columnNames names each column after the text of its header cells. Columns
+// without a name are numbered and repeated names get a suffix.
+func columnNames(headerRows [][]tableCell, width int) []string {
+	names := make([]string, width)
+	seen := map[string]int{}
+	for col := range names {
+		var parts []string
+		for _, row := range headerRows {
+			if col < len(row) && row[col].text != "" && (len(parts) == 0 || parts[len(parts)-1] != row[col].text) {
+				parts = append(parts, row[col].text)
+			}
+		}
+
+		name := strings.Join(parts, " ")
+		if name == "" {
+			name = fmt.Sprintf("column_%d", col+1)
+		}
+		seen[name]++
+		if seen[name] > 1 {
+			name = fmt.Sprintf("%s_%d", name, seen[name])
+		}
+		names[col] = name
+	}
+	return names
+}
+
+type tableColumn struct {
+	index int
+	name  string
+}
+
+// mapColumns picks the columns to keep and the field name of each. Without a
+// mapping every column is kept under its own name.
+func mapColumns(names []string, mapping map[string]string) ([]tableColumn, []string) {
+	if len(mapping) == 0 {
+		columns := make([]tableColumn, len(names))
+		for i, name := range names {
+			columns[i] = tableColumn{index: i, name: name}
+		}
+		return columns, nil
+	}
+
+	keys := make([]string, 0, len(mapping))
+	for column := range mapping {
+		keys = append(keys, column)
+	}
+	sort.Strings(keys)
+
+	var columns []tableColumn
+	var warnings []string
+	for _, column := range keys {
+		fieldName := mapping[column]
+		index := -1
+		for i, name := range names {
+			if strings.EqualFold(name, normalizeSpace(column)) {
+				index = i
+				break
+			}
+		}
+		if n, err := strconv.Atoi(column); index < 0 && err == nil && n >= 1 && n <= len(names) {
+			index = n - 1
+		}
+		if index < 0 {
+			warnings = append(warnings, fmt.Sprintf("table has no column %q", column))
+			continue
+		}
+		columns = append(columns, tableColumn{index: index, name: fieldName})
+	}
+	return columns, warnings
+}
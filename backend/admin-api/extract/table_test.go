@@ -0,0 +1,118 @@
+package extract
+
+import (
+	"strings"
+	"testing"
+
+	"admin-api/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const tablesHTML = `<html><body>
+<table id="nav"><tr><td>Home</td><td>About</td></tr></table>
+<table class="data">
+  <caption>Rents by city</caption>
+  <thead>
+    <tr><th rowspan="2">City</th><th colspan="2">Rent</th></tr>
+    <tr><th>Min</th><th>Max</th></tr>
+  </thead>
+  <tbody>
+    <tr><td rowspan="2">Paris</td><td>900</td><td>2,400</td></tr>
+    <tr><td>950</td><td>2,500</td></tr>
+    <tr><td></td><td></td><td></td></tr>
+    <tr><td>Lyon</td><td colspan="2">700</td></tr>
+  </tbody>
+</table>
+<table class="data">
+  <caption>Sales</caption>
+  <tr><th>Month</th><th>Total</th></tr>
+  <tr><td>Jan</td><td>10 <table><tr><td>nested</td></tr></table></td></tr>
+</table>
+</body></html>`
+
+func TestTableExtractor(t *testing.T) {
+	doc := Document{URL: "https://example.com/rents", ContentType: "text/html", Body: []byte(tablesHTML)}
+
+	t.Run("Spanning cells are expanded", func(t *testing.T) {
+		result, err := TableExtractor{}.Extract(doc, []models.Target{
+			{Type: models.TargetTypeTable, Name: "rents", Value: "table.data"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []Record{
+			{"City": "Paris", "Rent Min": "900", "Rent Max": "2,400"},
+			{"City": "Paris", "Rent Min": "950", "Rent Max": "2,500"},
+			{"City": "Lyon", "Rent Min": "700", "Rent Max": "700"},
+		}, result.Records)
+		assert.Empty(t, result.Warnings)
+	})
+
+	t.Run("Tables are located by caption and columns are mapped", func(t *testing.T) {
+		result, err := TableExtractor{}.Extract(doc, []models.Target{{
+			Type:  models.TargetTypeTable,
+			Name:  "rents",
+			Value: "table",
+			Table: &models.TableOptions{Caption: "rents", Columns: map[string]string{"city": "city", "3": "max", "Average": "avg"}},
+		}})
+		require.NoError(t, err)
+		require.Len(t, result.Records, 3)
+		assert.Equal(t, Record{"city": "Paris", "max": "2,400"}, result.Records[0])
+		assert.Equal(t, []string{`table has no column "Average"`}, result.Warnings)
+	})
+
+	t.Run("Header rows of th cells are detected", func(t *testing.T) {
+		result, err := TableExtractor{}.Extract(doc, []models.Target{
+			{Type: models.TargetTypeTable, Name: "sales", Table: &models.TableOptions{Caption: "sales"}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []Record{{"Month": "Jan", "Total": "10 nested"}}, result.Records)
+	})
+
+	t.Run("Tables are located by index without a header", func(t *testing.T) {
+		result, err := TableExtractor{}.Extract(doc, []models.Target{
+			{Type: models.TargetTypeTable, Name: "nav", Table: &models.TableOptions{Index: 0, Header: models.TableHeaderNone}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []Record{{"column_1": "Home", "column_2": "About"}}, result.Records)
+	})
+
+	t.Run("First row as header", func(t *testing.T) {
+		result, err := TableExtractor{}.Extract(doc, []models.Target{
+			{Type: models.TargetTypeTable, Name: "nav", Value: "#nav", Table: &models.TableOptions{Header: models.TableHeaderFirst}},
+		})
+		require.NoError(t, err)
+		assert.Empty(t, result.Records)
+	})
+
+	t.Run("Missing tables are reported", func(t *testing.T) {
+		result, err := TableExtractor{}.Extract(doc, []models.Target{
+			{Type: models.TargetTypeTable, Name: "missing", Table: &models.TableOptions{Index: 5}},
+		})
+		require.NoError(t, err)
+		assert.Empty(t, result.Records)
+		assert.Equal(t, []string{`target "missing" matched nothing`}, result.Warnings)
+	})
+
+	t.Run("Spans do not reach past the table", func(t *testing.T) {
+		huge := Document{ContentType: "text/html", Body: []byte(`<table>
+<tr><th>Name</th></tr>
+<tr><td colspan="1000" rowspan="1000">x</td></tr>
+<tr><td>y</td></tr>
+</table>`)}
+		result, err := TableExtractor{}.Extract(huge, []models.Target{{Type: models.TargetTypeTable, Name: "huge"}})
+		require.NoError(t, err)
+		require.Len(t, result.Records, 2)
+		assert.Equal(t, "x", result.Records[1]["Name"])
+		assert.Empty(t, result.Warnings)
+	})
+
+	t.Run("Oversized grids are truncated", func(t *testing.T) {
+		rows := strings.Repeat(`<tr><td colspan="1000">x</td></tr>`, 200)
+		huge := Document{ContentType: "text/html", Body: []byte(`<table><tr><th>Name</th></tr>` + rows + `</table>`)}
+		result, err := TableExtractor{}.Extract(huge, []models.Target{{Type: models.TargetTypeTable, Name: "huge"}})
+		require.NoError(t, err)
+		assert.Len(t, result.Records, 100)
+		assert.Equal(t, []string{"table has more than 100000 cells, only the first 101 rows were read"}, result.Warnings)
+	})
+}
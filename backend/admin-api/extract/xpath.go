@@ -0,0 +1,73 @@
+package extract
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+
+	"admin-api/models"
+
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xpath"
+)
+
+// XpathExtractor evaluates XPath targets against an HTML document. Each
+// target becomes a field of the records:
+//
+//   - element and text nodes yield their text with whitespace normalized
+//   - attribute nodes, e.g. //a/@href, yield the attribute value, with links
+//     resolved against the document URL
+//   - expressions that do not select nodes, e.g. count(//li), yield their
+//     number, string or boolean result
+//
+// A target matching several nodes produces one record per match.
+type XpathExtractor struct{}
+
+func (XpathExtractor) Extract(doc Document, targets []models.Target) (*Result, error) {
+	root, err := htmlquery.Parse(bytes.NewReader(doc.Body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse html: %w", err)
+	}
+	base, _ := url.Parse(doc.URL)
+
+	result := &Result{}
+	fields := make([]field, 0, len(targets))
+	for _, target := range targets {
+		expr, err := xpath.Compile(target.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid xpath %q of target %q: %w", target.Value, target.Name, err)
+		}
+
+		values := evaluateXpath(expr, htmlquery.CreateXPathNavigator(root), base)
+		if len(values) == 0 {
+			result.Warnings = append(result.Warnings, noMatchWarning(target))
+		}
+		fields = append(fields, field{name: target.Name, values: process(values, target.Process)})
+	}
+	result.Records = zipFields(fields)
+	return result, nil
+}
+
+func evaluateXpath(expr *xpath.Expr, nav xpath.NodeNavigator, base *url.URL) []any {
+	switch result := expr.Evaluate(nav).(type) {
+	case *xpath.NodeIterator:
+		var values []any
+		for result.MoveNext() {
+			current := result.Current()
+			if current.NodeType() == xpath.AttributeNode {
+				value := current.Value()
+				if isLinkAttribute(current.LocalName()) {
+					value = resolveURL(base, value)
+				}
+				values = append(values, value)
+				continue
+			}
+			values = append(values, normalizeSpace(current.Value()))
+		}
+		return values
+	case string:
+		return []any{normalizeSpace(result)}
+	default:
+		return []any{result}
+	}
+}
@@ -0,0 +1,65 @@
+package extract
+
+import (
+	"testing"
+
+	"admin-api/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const listingHTML = `<html>
+<head><title>Listings</title></head>
+<body>
+  <h1>  Flats   for rent </h1>
+  <ul>
+    <li class="listing"><a href="/listing/1">Flat one</a><span class="price">1200</span></li>
+    <li class="listing"><a href="/listing/2">Flat two</a><span class="price">950</span></li>
+    <li class="listing"><a href="https://other.example.com/3">Flat three</a><span class="price">1100</span></li>
+  </ul>
+</body>
+</html>`
+
+func TestExtractXpath(t *testing.T) {
+	doc := Document{URL: "https://example.com/flats", ContentType: "text/html", Body: []byte(listingHTML)}
+
+	t.Run("Multiple matches become rows", func(t *testing.T) {
+		result, err := XpathExtractor{}.Extract(doc, []models.Target{
+			{Type: models.TargetTypeXpath, Name: "heading", Value: "//h1"},
+			{Type: models.TargetTypeXpath, Name: "name", Value: "//li[@class='listing']/a/text()"},
+			{Type: models.TargetTypeXpath, Name: "link", Value: "//li[@class='listing']/a/@href"},
+			{Type: models.TargetTypeXpath, Name: "price", Value: "//li/span[@class='price']"},
+		})
+		require.NoError(t, err)
+		require.Len(t, result.Records, 3)
+		assert.Equal(t, Record{
+			"heading": "Flats for rent",
+			"name":    "Flat one",
+			"link":    "https://example.com/listing/1",
+			"price":   "1200",
+		}, result.Records[0])
+		assert.Equal(t, "https://other.example.com/3", result.Records[2]["link"])
+	})
+
+	t.Run("Expressions without nodes yield their value", func(t *testing.T) {
+		result, err := XpathExtractor{}.Extract(doc, []models.Target{
+			{Type: models.TargetTypeXpath, Name: "count", Value: "count(//li)"},
+			{Type: models.TargetTypeXpath, Name: "title", Value: "string(//title)"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []Record{{"count": float64(3), "title": "Listings"}}, result.Records)
+	})
+
+	t.Run("No matches produce no records", func(t *testing.T) {
+		result, err := XpathExtractor{}.Extract(doc, []models.Target{{Type: models.TargetTypeXpath, Name: "missing", Value: "//table"}})
+		require.NoError(t, err)
+		assert.Empty(t, result.Records)
+		assert.Equal(t, []string{`target "missing" matched nothing`}, result.Warnings)
+	})
+
+	t.Run("Invalid expression", func(t *testing.T) {
+		_, err := XpathExtractor{}.Extract(doc, []models.Target{{Type: models.TargetTypeXpath, Name: "broken", Value: "//li["}})
+		assert.Error(t, err)
+	})
+}
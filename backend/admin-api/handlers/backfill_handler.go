@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"admin-api/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BackfillService interface {
+	CreateBackfill(ctx context.Context, taskID string, request models.CreateBackfillRequest, createdBy string) (*models.BackfillDto, error)
+	ListBackfills(ctx context.Context, taskID string) ([]*models.BackfillDto, error)
+	GetBackfill(ctx context.Context, taskID string, backfillID string) (*models.BackfillDto, error)
+}
+
+type BackfillHandler struct {
+	service BackfillService
+}
+
+func SetupBackfillRoutes(r *gin.RouterGroup, service BackfillService) {
+	handler := &BackfillHandler{service: service}
+
+	backfills := r.Group("/user/:userId/task/:taskId/backfill")
+	{
+		backfills.GET("", handler.ListBackfills)
+		backfills.POST("", handler.CreateBackfill)
+		backfills.GET("/:backfillId", handler.GetBackfill)
+	}
+}
+
+func (h *BackfillHandler) CreateBackfill(c *gin.Context) {
+	var request models.CreateBackfillRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	backfill, err := h.service.CreateBackfill(c.Request.Context(), c.Param("taskId"), request, requestUserID(c))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, backfill)
+}
+
+func (h *BackfillHandler) ListBackfills(c *gin.Context) {
+	backfills, err := h.service.ListBackfills(c.Request.Context(), c.Param("taskId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, backfills)
+}
+
+func (h *BackfillHandler) GetBackfill(c *gin.Context) {
+	backfill, err := h.service.GetBackfill(c.Request.Context(), c.Param("taskId"), c.Param("backfillId"))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, backfill)
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	apperrors "admin-api/errors"
+	"admin-api/models"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockBackfillService struct {
+	mock.Mock
+}
+
+func (m *MockBackfillService) CreateBackfill(ctx context.Context, taskID string, request models.CreateBackfillRequest, createdBy string) (*models.BackfillDto, error) {
+	args := m.Called(ctx, taskID, request, createdBy)
+	return args.Get(0).(*models.BackfillDto), args.Error(1)
+}
+
+func (m *MockBackfillService) ListBackfills(ctx context.Context, taskID string) ([]*models.BackfillDto, error) {
+	args := m.Called(ctx, taskID)
+	return args.Get(0).([]*models.BackfillDto), args.Error(1)
+}
+
+func (m *MockBackfillService) GetBackfill(ctx context.Context, taskID string, backfillID string) (*models.BackfillDto, error) {
+	args := m.Called(ctx, taskID, backfillID)
+	return args.Get(0).(*models.BackfillDto), args.Error(1)
+}
+
+func setupBackfillTestRouter() (*gin.Engine, *MockBackfillService) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	mockService := new(MockBackfillService)
+	SetupBackfillRoutes(r.Group("/"), mockService)
+	return r, mockService
+}
+
+func TestCreateBackfill(t *testing.T) {
+	r, mockService := setupBackfillTestRouter()
+
+	t.Run("Successful creation", func(t *testing.T) {
+		backfill := &models.BackfillDto{ID: "1", TaskID: "1", Progress: models.BackfillProgressDto{Total: 3}}
+		mockService.On("CreateBackfill", mock.Anything, "1", mock.AnythingOfType("models.CreateBackfillRequest"), "user1").Return(backfill, nil).Once()
+
+		req, _ := http.NewRequest("POST", "/user/user1/task/1/backfill", bytes.NewBufferString(`{"start":"2026-01-01T00:00:00Z","end":"2026-01-04T00:00:00Z","step":"24h"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var response models.BackfillDto
+		assert.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, 3, response.Progress.Total)
+	})
+
+	t.Run("Invalid backfill", func(t *testing.T) {
+		mockService.On("CreateBackfill", mock.Anything, "2", mock.Anything, "user1").Return((*models.BackfillDto)(nil), apperrors.ErrInvalidBackfill).Once()
+
+		req, _ := http.NewRequest("POST", "/user/user1/task/2/backfill", bytes.NewBufferString(`{"step":"daily"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestGetBackfill(t *testing.T) {
+	r, mockService := setupBackfillTestRouter()
+
+	t.Run("Successful retrieval", func(t *testing.T) {
+		backfill := &models.BackfillDto{ID: "1", Windows: []models.BackfillWindowDto{{RunID: "5", Status: models.TaskStatusRunning}}}
+		mockService.On("GetBackfill", mock.Anything, "1", "1").Return(backfill, nil).Once()
+
+		req, _ := http.NewRequest("GET", "/user/user1/task/1/backfill/1", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response models.BackfillDto
+		assert.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, backfill.Windows, response.Windows)
+	})
+
+	t.Run("Backfill not found", func(t *testing.T) {
+		mockService.On("GetBackfill", mock.Anything, "1", "2").Return((*models.BackfillDto)(nil), apperrors.ErrBackfillNotFound).Once()
+
+		req, _ := http.NewRequest("GET", "/user/user1/task/1/backfill/2", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestListBackfills(t *testing.T) {
+	r, mockService := setupBackfillTestRouter()
+
+	backfills := []*models.BackfillDto{{ID: "1"}, {ID: "2"}}
+	mockService.On("ListBackfills", mock.Anything, "1").Return(backfills, nil).Once()
+
+	req, _ := http.NewRequest("GET", "/user/user1/task/1/backfill", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response []*models.BackfillDto
+	assert.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response, 2)
+}
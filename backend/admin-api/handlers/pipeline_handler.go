@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"admin-api/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PipelineService interface {
+	CreatePipeline(ctx context.Context, request models.CreatePipelineRequest, owner string) (*models.PipelineDto, error)
+	ListPipelines(ctx context.Context, owner string) ([]*models.PipelineDto, error)
+	GetPipeline(ctx context.Context, pipelineID string, owner string) (*models.PipelineDto, error)
+	DeletePipeline(ctx context.Context, pipelineID string, owner string) error
+	StartPipelineRun(ctx context.Context, pipelineID string, owner string, triggeredBy string) (*models.PipelineRunDto, error)
+	ListPipelineRuns(ctx context.Context, pipelineID string, owner string) ([]*models.PipelineRunDto, error)
+	GetPipelineRun(ctx context.Context, pipelineID string, pipelineRunID string, owner string) (*models.PipelineRunDto, error)
+}
+
+type PipelineHandler struct {
+	service PipelineService
+}
+
+func SetupPipelineRoutes(r *gin.RouterGroup, service PipelineService) {
+	handler := &PipelineHandler{service: service}
+
+	pipelines := r.Group("/user/:userId/pipeline")
+	{
+		pipelines.GET("", handler.ListPipelines)
+		pipelines.POST("", handler.CreatePipeline)
+		pipelines.GET("/:pipelineId", handler.GetPipeline)
+		pipelines.DELETE("/:pipelineId", handler.DeletePipeline)
+		pipelines.GET("/:pipelineId/run", handler.ListPipelineRuns)
+		pipelines.POST("/:pipelineId/run", handler.StartPipelineRun)
+		pipelines.GET("/:pipelineId/run/:pipelineRunId", handler.GetPipelineRun)
+	}
+}
+
+func (h *PipelineHandler) CreatePipeline(c *gin.Context) {
+	var request models.CreatePipelineRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pipeline, err := h.service.CreatePipeline(c.Request.Context(), request, c.Param("userId"))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, pipeline)
+}
+
+func (h *PipelineHandler) ListPipelines(c *gin.Context) {
+	pipelines, err := h.service.ListPipelines(c.Request.Context(), c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, pipelines)
+}
+
+func (h *PipelineHandler) GetPipeline(c *gin.Context) {
+	pipeline, err := h.service.GetPipeline(c.Request.Context(), c.Param("pipelineId"), c.Param("userId"))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, pipeline)
+}
+
+func (h *PipelineHandler) DeletePipeline(c *gin.Context) {
+	if err := h.service.DeletePipeline(c.Request.Context(), c.Param("pipelineId"), c.Param("userId")); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func (h *PipelineHandler) StartPipelineRun(c *gin.Context) {
+	pipelineRun, err := h.service.StartPipelineRun(c.Request.Context(), c.Param("pipelineId"), c.Param("userId"), requestUserID(c))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, pipelineRun)
+}
+
+func (h *PipelineHandler) ListPipelineRuns(c *gin.Context) {
+	pipelineRuns, err := h.service.ListPipelineRuns(c.Request.Context(), c.Param("pipelineId"), c.Param("userId"))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, pipelineRuns)
+}
+
+func (h *PipelineHandler) GetPipelineRun(c *gin.Context) {
+	pipelineRun, err := h.service.GetPipelineRun(c.Request.Context(), c.Param("pipelineId"), c.Param("pipelineRunId"), c.Param("userId"))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, pipelineRun)
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	apperrors "admin-api/errors"
+	"admin-api/models"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockPipelineService struct {
+	mock.Mock
+}
+
+func (m *MockPipelineService) CreatePipeline(ctx context.Context, request models.CreatePipelineRequest, owner string) (*models.PipelineDto, error) {
+	args := m.Called(ctx, request, owner)
+	return args.Get(0).(*models.PipelineDto), args.Error(1)
+}
+
+func (m *MockPipelineService) ListPipelines(ctx context.Context, owner string) ([]*models.PipelineDto, error) {
+	args := m.Called(ctx, owner)
+	return args.Get(0).([]*models.PipelineDto), args.Error(1)
+}
+
+func (m *MockPipelineService) GetPipeline(ctx context.Context, pipelineID string, owner string) (*models.PipelineDto, error) {
+	args := m.Called(ctx, pipelineID, owner)
+	return args.Get(0).(*models.PipelineDto), args.Error(1)
+}
+
+func (m *MockPipelineService) DeletePipeline(ctx context.Context, pipelineID string, owner string) error {
+	args := m.Called(ctx, pipelineID, owner)
+	return args.Error(0)
+}
+
+func (m *MockPipelineService) StartPipelineRun(ctx context.Context, pipelineID string, owner string, triggeredBy string) (*models.PipelineRunDto, error) {
+	args := m.Called(ctx, pipelineID, owner, triggeredBy)
+	return args.Get(0).(*models.PipelineRunDto), args.Error(1)
+}
+
+func (m *MockPipelineService) ListPipelineRuns(ctx context.Context, pipelineID string, owner string) ([]*models.PipelineRunDto, error) {
+	args := m.Called(ctx, pipelineID, owner)
+	return args.Get(0).([]*models.PipelineRunDto), args.Error(1)
+}
+
+func (m *MockPipelineService) GetPipelineRun(ctx context.Context, pipelineID string, pipelineRunID string, owner string) (*models.PipelineRunDto, error) {
+	args := m.Called(ctx, pipelineID, pipelineRunID, owner)
+	return args.Get(0).(*models.PipelineRunDto), args.Error(1)
+}
+
+func setupPipelineTestRouter() (*gin.Engine, *MockPipelineService) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	mockService := new(MockPipelineService)
+	SetupPipelineRoutes(r.Group("/"), mockService)
+	return r, mockService
+}
+
+func TestCreatePipeline(t *testing.T) {
+	r, mockService := setupPipelineTestRouter()
+
+	t.Run("Successful creation", func(t *testing.T) {
+		pipeline := &models.PipelineDto{ID: "1", Name: "Listings", Nodes: []models.PipelineNodeDto{{Key: "discover", TaskID: "1"}}}
+		mockService.On("CreatePipeline", mock.Anything, mock.AnythingOfType("models.CreatePipelineRequest"), "user1").Return(pipeline, nil).Once()
+
+		req, _ := http.NewRequest("POST", "/user/user1/pipeline", bytes.NewBufferString(`{"name":"Listings","nodes":[{"key":"discover","task_id":"1"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var response models.PipelineDto
+		assert.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, pipeline.Nodes, response.Nodes)
+	})
+
+	t.Run("Invalid pipeline", func(t *testing.T) {
+		mockService.On("CreatePipeline", mock.Anything, mock.Anything, "user2").Return((*models.PipelineDto)(nil), apperrors.ErrInvalidPipeline).Once()
+
+		req, _ := http.NewRequest("POST", "/user/user2/pipeline", bytes.NewBufferString(`{"name":"Cycle"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestStartPipelineRun(t *testing.T) {
+	r, mockService := setupPipelineTestRouter()
+
+	pipelineRun := &models.PipelineRunDto{ID: "1", PipelineID: "1", Status: models.TaskStatusRunning}
+	mockService.On("StartPipelineRun", mock.Anything, "1", "user1", "user1").Return(pipelineRun, nil).Once()
+
+	req, _ := http.NewRequest("POST", "/user/user1/pipeline/1/run", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	var response models.PipelineRunDto
+	assert.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, models.TaskStatusRunning, response.Status)
+}
+
+func TestGetPipelineRun(t *testing.T) {
+	r, mockService := setupPipelineTestRouter()
+
+	t.Run("Successful retrieval", func(t *testing.T) {
+		pipelineRun := &models.PipelineRunDto{
+			ID:    "1",
+			Nodes: []models.PipelineRunNodeDto{{Key: "discover", TaskID: "1", Status: models.PipelineNodeSucceeded, TaskRunID: "3"}},
+			Edges: []models.PipelineEdgeDto{{From: "discover", To: "scrape", Condition: models.PipelineEdgeOnSuccess}},
+		}
+		mockService.On("GetPipelineRun", mock.Anything, "1", "1", "user1").Return(pipelineRun, nil).Once()
+
+		req, _ := http.NewRequest("GET", "/user/user1/pipeline/1/run/1", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response models.PipelineRunDto
+		assert.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, pipelineRun.Nodes, response.Nodes)
+		assert.Equal(t, pipelineRun.Edges, response.Edges)
+	})
+
+	t.Run("Pipeline run not found", func(t *testing.T) {
+		mockService.On("GetPipelineRun", mock.Anything, "1", "2", "user1").Return((*models.PipelineRunDto)(nil), apperrors.ErrPipelineRunNotFound).Once()
+
+		req, _ := http.NewRequest("GET", "/user/user1/pipeline/1/run/2", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"admin-api/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type QueueService interface {
+	GetQueueStats(ctx context.Context) (*models.RunQueueStats, error)
+	ListDeadLetters(ctx context.Context, count int64) ([]models.DeadLetter, error)
+	RequeueDeadLetter(ctx context.Context, messageID string) (*models.DeadLetter, error)
+	DiscardDeadLetter(ctx context.Context, messageID string) error
+}
+
+type QueueHandler struct {
+	service QueueService
+}
+
+func SetupQueueRoutes(r *gin.RouterGroup, service QueueService) {
+	handler := &QueueHandler{service: service}
+
+	queue := r.Group("/queue")
+	{
+		queue.GET("", handler.GetQueueStats)
+		queue.GET("/dead", handler.ListDeadLetters)
+		queue.POST("/dead/:messageId/requeue", handler.RequeueDeadLetter)
+		queue.DELETE("/dead/:messageId", handler.DiscardDeadLetter)
+	}
+}
+
+func (h *QueueHandler) GetQueueStats(c *gin.Context) {
+	stats, err := h.service.GetQueueStats(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+func (h *QueueHandler) ListDeadLetters(c *gin.Context) {
+	count, err := strconv.ParseInt(c.DefaultQuery("count", "100"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	deadLetters, err := h.service.ListDeadLetters(c.Request.Context(), count)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, deadLetters)
+}
+
+func (h *QueueHandler) RequeueDeadLetter(c *gin.Context) {
+	deadLetter, err := h.service.RequeueDeadLetter(c.Request.Context(), c.Param("messageId"))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, deadLetter)
+}
+
+func (h *QueueHandler) DiscardDeadLetter(c *gin.Context) {
+	err := h.service.DiscardDeadLetter(c.Request.Context(), c.Param("messageId"))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	apperrors "admin-api/errors"
+	"admin-api/models"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockQueueService struct {
+	mock.Mock
+}
+
+func (m *MockQueueService) GetQueueStats(ctx context.Context) (*models.RunQueueStats, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(*models.RunQueueStats), args.Error(1)
+}
+
+func (m *MockQueueService) ListDeadLetters(ctx context.Context, count int64) ([]models.DeadLetter, error) {
+	args := m.Called(ctx, count)
+	return args.Get(0).([]models.DeadLetter), args.Error(1)
+}
+
+func (m *MockQueueService) RequeueDeadLetter(ctx context.Context, messageID string) (*models.DeadLetter, error) {
+	args := m.Called(ctx, messageID)
+	return args.Get(0).(*models.DeadLetter), args.Error(1)
+}
+
+func (m *MockQueueService) DiscardDeadLetter(ctx context.Context, messageID string) error {
+	args := m.Called(ctx, messageID)
+	return args.Error(0)
+}
+
+func setupQueueTestRouter() (*gin.Engine, *MockQueueService) {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	mockService := new(MockQueueService)
+	SetupQueueRoutes(r.Group("/"), mockService)
+	return r, mockService
+}
+
+func TestGetQueueStats(t *testing.T) {
+	r, mockService := setupQueueTestRouter()
+
+	t.Run("Successful retrieval", func(t *testing.T) {
+		stats := &models.RunQueueStats{Waiting: 3, InFlight: 1, DeadLetters: 2}
+		mockService.On("GetQueueStats", mock.Anything).Return(stats, nil).Once()
+
+		req, _ := http.NewRequest("GET", "/queue", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response models.RunQueueStats
+		err := sonic.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Equal(t, *stats, response)
+	})
+
+	t.Run("Error retrieval", func(t *testing.T) {
+		mockService.On("GetQueueStats", mock.Anything).Return((*models.RunQueueStats)(nil), errors.New("redis error")).Once()
+
+		req, _ := http.NewRequest("GET", "/queue", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
+
+func TestListDeadLetters(t *testing.T) {
+	r, mockService := setupQueueTestRouter()
+
+	t.Run("Successful retrieval", func(t *testing.T) {
+		deadLetters := []models.DeadLetter{{MessageID: "1-0", TaskRunID: 7, Reason: "exceeded 5 deliveries"}}
+		mockService.On("ListDeadLetters", mock.Anything, int64(20)).Return(deadLetters, nil).Once()
+
+		req, _ := http.NewRequest("GET", "/queue/dead?count=20", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response []models.DeadLetter
+		err := sonic.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Equal(t, deadLetters, response)
+	})
+
+	t.Run("Invalid count", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/queue/dead?count=abc", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestRequeueDeadLetter(t *testing.T) {
+	r, mockService := setupQueueTestRouter()
+
+	t.Run("Successful requeue", func(t *testing.T) {
+		deadLetter := &models.DeadLetter{MessageID: "1-0", TaskRunID: 7}
+		mockService.On("RequeueDeadLetter", mock.Anything, "1-0").Return(deadLetter, nil).Once()
+
+		req, _ := http.NewRequest("POST", "/queue/dead/1-0/requeue", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Dead letter not found", func(t *testing.T) {
+		mockService.On("RequeueDeadLetter", mock.Anything, "2-0").Return((*models.DeadLetter)(nil), apperrors.ErrDeadLetterNotFound).Once()
+
+		req, _ := http.NewRequest("POST", "/queue/dead/2-0/requeue", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestDiscardDeadLetter(t *testing.T) {
+	r, mockService := setupQueueTestRouter()
+
+	t.Run("Successful discard", func(t *testing.T) {
+		mockService.On("DiscardDeadLetter", mock.Anything, "1-0").Return(nil).Once()
+
+		req, _ := http.NewRequest("DELETE", "/queue/dead/1-0", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Dead letter not found", func(t *testing.T) {
+		mockService.On("DiscardDeadLetter", mock.Anything, "2-0").Return(apperrors.ErrDeadLetterNotFound).Once()
+
+		req, _ := http.NewRequest("DELETE", "/queue/dead/2-0", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
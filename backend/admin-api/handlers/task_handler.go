@@ -2,11 +2,17 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
+	"time"
 
+	apperrors "admin-api/errors"
 	"admin-api/models"
 
+	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
+	"github.com/auth0/go-jwt-middleware/v2/validator"
 	"github.com/gin-gonic/gin"
 )
 
@@ -17,12 +23,20 @@ type TaskService interface {
 	CreateTask(ctx context.Context, task models.Task, userID string) (*models.Task, error)
 	UpdateTask(ctx context.Context, task models.Task, userID string, taskID string) (*models.Task, error)
 	DeleteTask(ctx context.Context, taskID string) error
+	PauseTask(ctx context.Context, taskID string, resumeAt *time.Time) (*models.TaskDto, error)
+	ResumeTask(ctx context.Context, taskID string) (*models.TaskDto, error)
+	PreviewSchedule(ctx context.Context, request models.SchedulePreviewRequest) ([]time.Time, error)
 	ListTaskRuns(ctx context.Context, taskID string) ([]*models.TaskRunDto, error)
 	GetTaskRun(ctx context.Context, taskRunID string) (*models.TaskRunDto, error)
-	CreateTaskRun(ctx context.Context, taskRun models.TaskRun) (*models.TaskRun, error)
+	CreateTaskRunFromRequest(ctx context.Context, request models.CreateTaskRunRequest) (*models.TaskRun, error)
+	TriggerTaskRun(ctx context.Context, taskID string, overrides *models.TaskRunOverrides) (*models.TaskRun, error)
 	UpdateTaskRun(ctx context.Context, taskRun models.TaskRun, taskRunID string) (*models.TaskRun, error)
+	HeartbeatTaskRun(ctx context.Context, taskRunID string) error
+	CancelTaskRun(ctx context.Context, taskRunID string, cancelledBy string) (*models.TaskRunDto, error)
 	GetTaskRunArtifacts(ctx context.Context, taskRunID string, page int, pageSize int) ([]*models.TaskRunArtifactDto, error)
 	CreateTaskRunArtifact(ctx context.Context, artifact *models.CreateTaskRunArtifactDto) (*models.TaskRunArtifact, error)
+	UploadTaskFile(ctx context.Context, taskID string, filename string, contentType string, body io.Reader) (*models.TaskRunArtifactDto, error)
+	ListTaskUploads(ctx context.Context, taskID string, page int, pageSize int) ([]*models.TaskRunArtifactDto, error)
 }
 
 type TaskHandler struct {
@@ -41,12 +55,20 @@ func SetupTaskRoutes(r *gin.RouterGroup, service TaskService) {
 		userTasks.POST("", handler.CreateTask)
 		userTasks.PUT("/:taskId", handler.UpdateTask)
 		userTasks.DELETE("/:taskId", handler.DeleteTask)
+		userTasks.POST("/:taskId/pause", handler.PauseTask)
+		userTasks.POST("/:taskId/resume", handler.ResumeTask)
+		userTasks.POST("/:taskId/trigger", handler.TriggerTaskRun)
+		userTasks.POST("/schedule/preview", handler.PreviewSchedule)
 		userTasks.GET("/:taskId/run", handler.ListTaskRuns)
 		userTasks.POST("/:taskId/run", handler.CreateTaskRun)
 		userTasks.GET("/:taskId/run/:runId", handler.GetTaskRun)
 		userTasks.PUT("/:taskId/run/:runId", handler.UpdateTaskRun)
+		userTasks.POST("/:taskId/run/:runId/heartbeat", handler.HeartbeatTaskRun)
+		userTasks.POST("/:taskId/run/:runId/cancel", handler.CancelTaskRun)
 		userTasks.GET("/:taskId/run/:runId/artifact", handler.GetTaskRunArtifacts)
 		userTasks.POST("/:taskId/run/:runId/artifact", handler.CreateTaskRunArtifact)
+		userTasks.GET("/:taskId/upload", handler.ListTaskUploads)
+		userTasks.POST("/:taskId/upload", handler.UploadTaskFile)
 	}
 }
 
@@ -89,7 +111,7 @@ func (h *TaskHandler) CreateTask(c *gin.Context) {
 
 	createdTask, err := h.service.CreateTask(c.Request.Context(), task, c.Param("userId"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -105,7 +127,7 @@ func (h *TaskHandler) UpdateTask(c *gin.Context) {
 
 	updatedTask, err := h.service.UpdateTask(c.Request.Context(), task, c.Param("userId"), c.Param("taskId"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -120,6 +142,50 @@ func (h *TaskHandler) DeleteTask(c *gin.Context) {
 	}
 }
 
+func (h *TaskHandler) PauseTask(c *gin.Context) {
+	var request models.PauseTaskRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	task, err := h.service.PauseTask(c.Request.Context(), c.Param("taskId"), request.ResumeAt)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, task)
+}
+
+func (h *TaskHandler) ResumeTask(c *gin.Context) {
+	task, err := h.service.ResumeTask(c.Request.Context(), c.Param("taskId"))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, task)
+}
+
+func (h *TaskHandler) PreviewSchedule(c *gin.Context) {
+	var request models.SchedulePreviewRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fireTimes, err := h.service.PreviewSchedule(c.Request.Context(), request)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SchedulePreviewResponse{FireTimes: fireTimes})
+}
+
 func (h *TaskHandler) ListTaskRuns(c *gin.Context) {
 	taskRuns, err := h.service.ListTaskRuns(c.Request.Context(), c.Param("taskId"))
 	if err != nil {
@@ -141,21 +207,39 @@ func (h *TaskHandler) GetTaskRun(c *gin.Context) {
 }
 
 func (h *TaskHandler) CreateTaskRun(c *gin.Context) {
-	var taskRun models.TaskRun
-	if err := c.ShouldBindJSON(&taskRun); err != nil {
+	var request models.CreateTaskRunRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	createdTaskRun, err := h.service.CreateTaskRun(c.Request.Context(), taskRun)
+	createdTaskRun, err := h.service.CreateTaskRunFromRequest(c.Request.Context(), request)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, createdTaskRun)
 }
 
+func (h *TaskHandler) TriggerTaskRun(c *gin.Context) {
+	var request models.TriggerTaskRunRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	taskRun, err := h.service.TriggerTaskRun(c.Request.Context(), c.Param("taskId"), request.Overrides)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, models.TriggerTaskRunResponse{RunID: strconv.FormatUint(uint64(taskRun.ID), 10)})
+}
+
 func (h *TaskHandler) UpdateTaskRun(c *gin.Context) {
 	var taskRun models.TaskRun
 	if err := c.ShouldBindJSON(&taskRun); err != nil {
@@ -172,6 +256,24 @@ func (h *TaskHandler) UpdateTaskRun(c *gin.Context) {
 	c.JSON(http.StatusOK, createdTaskRun)
 }
 
+func (h *TaskHandler) HeartbeatTaskRun(c *gin.Context) {
+	err := h.service.HeartbeatTaskRun(c.Request.Context(), c.Param("runId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+}
+
+func (h *TaskHandler) CancelTaskRun(c *gin.Context) {
+	taskRun, err := h.service.CancelTaskRun(c.Request.Context(), c.Param("runId"), requestUserID(c))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, taskRun)
+}
+
 func (h *TaskHandler) GetTaskRunArtifacts(c *gin.Context) {
 	page, err := strconv.ParseInt(c.DefaultQuery("page", "1"), 10, 64)
 	if err != nil {
@@ -208,3 +310,77 @@ func (h *TaskHandler) CreateTaskRunArtifact(c *gin.Context) {
 
 	c.JSON(http.StatusOK, createdTaskRunArtifact)
 }
+
+// UploadTaskFile stores the file of the "file" field of a multipart form as
+// an upload of the task.
+func (h *TaskHandler) UploadTaskFile(c *gin.Context) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	upload, err := h.service.UploadTaskFile(c.Request.Context(), c.Param("taskId"), fileHeader.Filename, fileHeader.Header.Get("Content-Type"), file)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, upload)
+}
+
+func (h *TaskHandler) ListTaskUploads(c *gin.Context) {
+	page, err := strconv.ParseInt(c.DefaultQuery("page", "1"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	pageSize, err := strconv.ParseInt(c.DefaultQuery("pageSize", "10"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	uploads, err := h.service.ListTaskUploads(c.Request.Context(), c.Param("taskId"), int(page), int(pageSize))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, uploads)
+}
+
+// errorStatus maps errors returned by the services to HTTP status codes.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, apperrors.ErrInvalidTaskDefinition), errors.Is(err, apperrors.ErrInvalidRunOverrides), errors.Is(err, apperrors.ErrInvalidResumeTime),
+		errors.Is(err, apperrors.ErrInvalidBackfill), errors.Is(err, apperrors.ErrInvalidPipeline), errors.Is(err, apperrors.ErrInvalidUpload):
+		return http.StatusBadRequest
+	case errors.Is(err, apperrors.ErrDeadLetterNotFound), errors.Is(err, apperrors.ErrBackfillNotFound),
+		errors.Is(err, apperrors.ErrPipelineNotFound), errors.Is(err, apperrors.ErrPipelineRunNotFound), errors.Is(err, apperrors.ErrUploadNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, apperrors.ErrTaskRunFinished), errors.Is(err, apperrors.ErrTaskPaused), errors.Is(err, apperrors.ErrConcurrentRun):
+		return http.StatusConflict
+	case errors.Is(err, apperrors.ErrConcurrencyLimit):
+		return http.StatusTooManyRequests
+	case errors.Is(err, apperrors.ErrLockTimeout):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// requestUserID returns the subject of the caller's access token, falling back
+// to the user in the path when the request is not authenticated.
+func requestUserID(c *gin.Context) string {
+	if claims, ok := c.Request.Context().Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims); ok {
+		return claims.RegisteredClaims.Subject
+	}
+	return c.Param("userId")
+}
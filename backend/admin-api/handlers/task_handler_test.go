@@ -1,13 +1,17 @@
 package handlers
 
 import (
+	apperrors "admin-api/errors"
 	"admin-api/models"
 	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/textproto"
 	"testing"
 	"time"
 
@@ -16,6 +20,7 @@ import (
 	"github.com/gocql/gocql"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
 )
 
 type MockTaskService struct {
@@ -55,6 +60,24 @@ func (m *MockTaskService) DeleteTask(ctx context.Context, taskID string) error {
 	return args.Error(0)
 }
 
+func (m *MockTaskService) PauseTask(ctx context.Context, taskID string, resumeAt *time.Time) (*models.TaskDto, error) {
+	args := m.Called(ctx, taskID, resumeAt)
+	return args.Get(0).(*models.TaskDto), args.Error(1)
+}
+
+func (m *MockTaskService) ResumeTask(ctx context.Context, taskID string) (*models.TaskDto, error) {
+	args := m.Called(ctx, taskID)
+	return args.Get(0).(*models.TaskDto), args.Error(1)
+}
+
+func (m *MockTaskService) PreviewSchedule(ctx context.Context, request models.SchedulePreviewRequest) ([]time.Time, error) {
+	args := m.Called(ctx, request)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]time.Time), args.Error(1)
+}
+
 func (m *MockTaskService) ListTaskRuns(ctx context.Context, taskID string) ([]*models.TaskRunDto, error) {
 	args := m.Called(ctx, taskID)
 	return args.Get(0).([]*models.TaskRunDto), args.Error(1)
@@ -65,8 +88,8 @@ func (m *MockTaskService) GetTaskRunArtifacts(ctx context.Context, taskRunID str
 	return args.Get(0).([]*models.TaskRunArtifactDto), args.Error(1)
 }
 
-func (m *MockTaskService) CreateTaskRun(ctx context.Context, taskRun models.TaskRun) (*models.TaskRun, error) {
-	args := m.Called(ctx, taskRun)
+func (m *MockTaskService) CreateTaskRunFromRequest(ctx context.Context, request models.CreateTaskRunRequest) (*models.TaskRun, error) {
+	args := m.Called(ctx, request)
 	return args.Get(0).(*models.TaskRun), args.Error(1)
 }
 
@@ -75,11 +98,42 @@ func (m *MockTaskService) UpdateTaskRun(ctx context.Context, taskRun models.Task
 	return args.Get(0).(*models.TaskRun), args.Error(1)
 }
 
+func (m *MockTaskService) HeartbeatTaskRun(ctx context.Context, taskRunID string) error {
+	args := m.Called(ctx, taskRunID)
+	return args.Error(0)
+}
+
+func (m *MockTaskService) TriggerTaskRun(ctx context.Context, taskID string, overrides *models.TaskRunOverrides) (*models.TaskRun, error) {
+	args := m.Called(ctx, taskID, overrides)
+	return args.Get(0).(*models.TaskRun), args.Error(1)
+}
+
+func (m *MockTaskService) CancelTaskRun(ctx context.Context, taskRunID string, cancelledBy string) (*models.TaskRunDto, error) {
+	args := m.Called(ctx, taskRunID, cancelledBy)
+	return args.Get(0).(*models.TaskRunDto), args.Error(1)
+}
+
 func (m *MockTaskService) CreateTaskRunArtifact(ctx context.Context, artifact *models.CreateTaskRunArtifactDto) (*models.TaskRunArtifact, error) {
 	args := m.Called(ctx, artifact)
 	return args.Get(0).(*models.TaskRunArtifact), args.Error(1)
 }
 
+// UploadTaskFile records the uploaded body as a string, so that expectations
+// can match it.
+func (m *MockTaskService) UploadTaskFile(ctx context.Context, taskID string, filename string, contentType string, body io.Reader) (*models.TaskRunArtifactDto, error) {
+	content, _ := io.ReadAll(body)
+	args := m.Called(ctx, taskID, filename, contentType, string(content))
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.TaskRunArtifactDto), args.Error(1)
+}
+
+func (m *MockTaskService) ListTaskUploads(ctx context.Context, taskID string, page int, pageSize int) ([]*models.TaskRunArtifactDto, error) {
+	args := m.Called(ctx, taskID, page, pageSize)
+	return args.Get(0).([]*models.TaskRunArtifactDto), args.Error(1)
+}
+
 // Add this method to the MockTaskService
 func (m *MockTaskService) GetTaskRun(ctx context.Context, taskRunID string) (*models.TaskRunDto, error) {
 	args := m.Called(ctx, taskRunID)
@@ -220,6 +274,75 @@ func TestUpdateTask(t *testing.T) {
 	})
 }
 
+func TestPauseTask(t *testing.T) {
+	r, mockService := setupTestRouter()
+
+	t.Run("Pause indefinitely", func(t *testing.T) {
+		mockTask := &models.TaskDto{ID: "1", Paused: true}
+		mockService.On("PauseTask", mock.Anything, "1", (*time.Time)(nil)).Return(mockTask, nil).Once()
+
+		req, _ := http.NewRequest("POST", "/user/user1/task/1/pause", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response models.TaskDto
+		err := sonic.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.True(t, response.Paused)
+	})
+
+	t.Run("Pause until a resume time", func(t *testing.T) {
+		resumeAt := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+		mockTask := &models.TaskDto{ID: "1", Paused: true, ResumeAt: &resumeAt}
+		mockService.On("PauseTask", mock.Anything, "1", mock.MatchedBy(func(at *time.Time) bool {
+			return at != nil && at.Equal(resumeAt)
+		})).Return(mockTask, nil).Once()
+
+		req, _ := http.NewRequest("POST", "/user/user1/task/1/pause", bytes.NewBufferString(`{"resume_at":"2026-01-01T09:00:00Z"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Resume time in the past", func(t *testing.T) {
+		mockService.On("PauseTask", mock.Anything, "2", mock.Anything).Return((*models.TaskDto)(nil), apperrors.ErrInvalidResumeTime).Once()
+
+		req, _ := http.NewRequest("POST", "/user/user1/task/2/pause", bytes.NewBufferString(`{"resume_at":"2020-01-01T09:00:00Z"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestResumeTask(t *testing.T) {
+	r, mockService := setupTestRouter()
+
+	t.Run("Successful resume", func(t *testing.T) {
+		mockService.On("ResumeTask", mock.Anything, "1").Return(&models.TaskDto{ID: "1"}, nil).Once()
+
+		req, _ := http.NewRequest("POST", "/user/user1/task/1/resume", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Error resume", func(t *testing.T) {
+		mockService.On("ResumeTask", mock.Anything, "2").Return((*models.TaskDto)(nil), errors.New("no task found with the given ID")).Once()
+
+		req, _ := http.NewRequest("POST", "/user/user1/task/2/resume", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
+
 func TestListTaskRuns(t *testing.T) {
 	r, mockService := setupTestRouter()
 
@@ -298,11 +421,12 @@ func TestCreateTaskRun(t *testing.T) {
 	r, mockService := setupTestRouter()
 
 	t.Run("Successful creation", func(t *testing.T) {
-		taskRun := models.TaskRun{TaskID: uint(1), Status: models.TaskStatusComplete}
-		mockService.On("CreateTaskRun", mock.Anything, taskRun).Return(&taskRun, nil).Once()
+		taskRun := models.TaskRun{TaskID: uint(1), Status: models.TaskStatusCreated}
+		mockService.On("CreateTaskRunFromRequest", mock.Anything, models.CreateTaskRunRequest{TaskID: 1}).Return(&taskRun, nil).Once()
 
-		taskRunJSON, _ := sonic.Marshal(taskRun)
-		req, _ := http.NewRequest("POST", "/user/user1/task/1/run", bytes.NewBuffer(taskRunJSON))
+		// Fields that retries, backfills and pipelines set are ignored
+		body := `{"task_id": 1, "status": 3, "attempt": 4, "pipeline_run_id": 2, "backfill_id": 3, "parent_run_id": 5}`
+		req, _ := http.NewRequest("POST", "/user/user1/task/1/run", bytes.NewBufferString(body))
 		req.Header.Set("Content-Type", "application/json")
 		w := httptest.NewRecorder()
 		r.ServeHTTP(w, req)
@@ -323,12 +447,21 @@ func TestCreateTaskRun(t *testing.T) {
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
 
+	t.Run("Missing task", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/user/user1/task/1/run", bytes.NewBufferString(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
 	t.Run("Service error", func(t *testing.T) {
-		taskRun := models.TaskRun{TaskID: uint(1), Status: models.TaskStatusComplete}
-		mockService.On("CreateTaskRun", mock.Anything, taskRun).Return((*models.TaskRun)(nil), errors.New("service error")).Once()
+		request := models.CreateTaskRunRequest{TaskID: 1}
+		mockService.On("CreateTaskRunFromRequest", mock.Anything, request).Return((*models.TaskRun)(nil), errors.New("service error")).Once()
 
-		taskRunJSON, _ := sonic.Marshal(taskRun)
-		req, _ := http.NewRequest("POST", "/user/user1/task/1/run", bytes.NewBuffer(taskRunJSON))
+		requestJSON, _ := sonic.Marshal(request)
+		req, _ := http.NewRequest("POST", "/user/user1/task/1/run", bytes.NewBuffer(requestJSON))
 		req.Header.Set("Content-Type", "application/json")
 		w := httptest.NewRecorder()
 		r.ServeHTTP(w, req)
@@ -337,6 +470,48 @@ func TestCreateTaskRun(t *testing.T) {
 	})
 }
 
+func TestTriggerTaskRun(t *testing.T) {
+	r, mockService := setupTestRouter()
+
+	t.Run("Trigger without overrides", func(t *testing.T) {
+		taskRun := &models.TaskRun{Model: gorm.Model{ID: 7}, TaskID: 1, Type: models.TaskRunTypeSingle}
+		mockService.On("TriggerTaskRun", mock.Anything, "1", (*models.TaskRunOverrides)(nil)).Return(taskRun, nil).Once()
+
+		req, _ := http.NewRequest("POST", "/user/user1/task/1/trigger", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.JSONEq(t, `{"run_id":"7"}`, w.Body.String())
+	})
+
+	t.Run("Trigger with overrides", func(t *testing.T) {
+		overrides := &models.TaskRunOverrides{Source: []models.UrlSource{{Type: models.SourceTypeUrl, URL: "https://example.org"}}}
+		taskRun := &models.TaskRun{Model: gorm.Model{ID: 8}, TaskID: 1, Type: models.TaskRunTypeSingle}
+		mockService.On("TriggerTaskRun", mock.Anything, "1", overrides).Return(taskRun, nil).Once()
+
+		body, _ := sonic.Marshal(models.TriggerTaskRunRequest{Overrides: overrides})
+		req, _ := http.NewRequest("POST", "/user/user1/task/1/trigger", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.JSONEq(t, `{"run_id":"8"}`, w.Body.String())
+	})
+
+	t.Run("Invalid overrides", func(t *testing.T) {
+		mockService.On("TriggerTaskRun", mock.Anything, "2", mock.Anything).Return((*models.TaskRun)(nil), apperrors.ErrInvalidRunOverrides).Once()
+
+		req, _ := http.NewRequest("POST", "/user/user1/task/2/trigger", bytes.NewBufferString(`{"overrides":{"source":[{"url":"nope"}]}}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
 func TestUpdateTaskRun(t *testing.T) {
 	r, mockService := setupTestRouter()
 
@@ -403,6 +578,110 @@ func TestCreateTaskRunArtifact(t *testing.T) {
 	})
 }
 
+func TestUploadTaskFile(t *testing.T) {
+	r, mockService := setupTestRouter()
+
+	upload := func(fieldName string, contentType string, content string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", `form-data; name="`+fieldName+`"; filename="listings.csv"`)
+		header.Set("Content-Type", contentType)
+		part, _ := writer.CreatePart(header)
+		part.Write([]byte(content))
+		writer.Close()
+
+		req, _ := http.NewRequest("POST", "/user/user1/task/1/upload", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Successful upload", func(t *testing.T) {
+		created := &models.TaskRunArtifactDto{ArtifactID: gocql.TimeUUID().String(), ArtifactType: models.ArtifactTypeUpload, ContentType: "text/csv"}
+		mockService.On("UploadTaskFile", mock.Anything, "1", "listings.csv", "text/csv", "name,price\nflat,100\n").Return(created, nil).Once()
+
+		w := upload("file", "text/csv", "name,price\nflat,100\n")
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var response models.TaskRunArtifactDto
+		assert.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, created.ArtifactID, response.ArtifactID)
+	})
+
+	t.Run("Missing file", func(t *testing.T) {
+		w := upload("document", "text/csv", "name\n")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Empty file", func(t *testing.T) {
+		mockService.On("UploadTaskFile", mock.Anything, "1", "listings.csv", "text/csv", "").Return(nil, apperrors.ErrInvalidUpload).Once()
+
+		w := upload("file", "text/csv", "")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestListTaskUploads(t *testing.T) {
+	r, mockService := setupTestRouter()
+
+	uploads := []*models.TaskRunArtifactDto{
+		{ArtifactID: gocql.TimeUUID().String(), ArtifactType: models.ArtifactTypeUpload, AdditionalData: map[string]string{models.ArtifactDataFilename: "listings.csv"}},
+		{ArtifactID: gocql.TimeUUID().String(), ArtifactType: models.ArtifactTypeUpload, AdditionalData: map[string]string{models.ArtifactDataFilename: "prices.html"}},
+	}
+	mockService.On("ListTaskUploads", mock.Anything, "1", 2, 5).Return(uploads, nil).Once()
+
+	req, _ := http.NewRequest("GET", "/user/user1/task/1/upload?page=2&pageSize=5", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response []*models.TaskRunArtifactDto
+	assert.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, uploads, response)
+	mockService.AssertExpectations(t)
+}
+
+func TestPreviewSchedule(t *testing.T) {
+	r, mockService := setupTestRouter()
+
+	t.Run("Successful preview", func(t *testing.T) {
+		request := models.SchedulePreviewRequest{Cron: "0 9 * * 1-5", Timezone: "Europe/London", Count: 2}
+		fireTimes := []time.Time{
+			time.Date(2026, 3, 27, 9, 0, 0, 0, time.UTC),
+			time.Date(2026, 3, 30, 8, 0, 0, 0, time.UTC),
+		}
+		mockService.On("PreviewSchedule", mock.Anything, request).Return(fireTimes, nil).Once()
+
+		body, _ := sonic.Marshal(request)
+		req, _ := http.NewRequest("POST", "/user/user1/task/schedule/preview", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response models.SchedulePreviewResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Len(t, response.FireTimes, 2)
+		assert.True(t, fireTimes[1].Equal(response.FireTimes[1]))
+	})
+
+	t.Run("Invalid schedule", func(t *testing.T) {
+		request := models.SchedulePreviewRequest{Cron: "not a cron"}
+		mockService.On("PreviewSchedule", mock.Anything, request).Return(nil, apperrors.ErrInvalidTaskDefinition).Once()
+
+		body, _ := sonic.Marshal(request)
+		req, _ := http.NewRequest("POST", "/user/user1/task/schedule/preview", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
 func TestGetTaskRun(t *testing.T) {
 	r, mockService := setupTestRouter()
 
@@ -432,6 +711,59 @@ func TestGetTaskRun(t *testing.T) {
 	})
 }
 
+func TestHeartbeatTaskRun(t *testing.T) {
+	r, mockService := setupTestRouter()
+
+	t.Run("Successful heartbeat", func(t *testing.T) {
+		mockService.On("HeartbeatTaskRun", mock.Anything, "1").Return(nil).Once()
+
+		req, _ := http.NewRequest("POST", "/user/user1/task/task1/run/1/heartbeat", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Error heartbeat", func(t *testing.T) {
+		mockService.On("HeartbeatTaskRun", mock.Anything, "2").Return(errors.New("no task run found with the given ID")).Once()
+
+		req, _ := http.NewRequest("POST", "/user/user1/task/task1/run/2/heartbeat", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
+
+func TestCancelTaskRun(t *testing.T) {
+	r, mockService := setupTestRouter()
+
+	t.Run("Successful cancellation", func(t *testing.T) {
+		mockTaskRun := &models.TaskRunDto{ID: "1", Status: models.TaskStatusCancelled, CancelledBy: "user1"}
+		mockService.On("CancelTaskRun", mock.Anything, "1", "user1").Return(mockTaskRun, nil).Once()
+
+		req, _ := http.NewRequest("POST", "/user/user1/task/task1/run/1/cancel", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response models.TaskRunDto
+		err := sonic.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Equal(t, mockTaskRun, &response)
+	})
+
+	t.Run("Run already finished", func(t *testing.T) {
+		mockService.On("CancelTaskRun", mock.Anything, "2", "user1").Return((*models.TaskRunDto)(nil), apperrors.ErrTaskRunFinished).Once()
+
+		req, _ := http.NewRequest("POST", "/user/user1/task/task1/run/2/cancel", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+}
+
 func TestDeleteTask(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
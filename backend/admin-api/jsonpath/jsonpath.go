@@ -0,0 +1,550 @@
+// Package jsonpath evaluates JSONPath expressions against decoded JSON, the
+// map[string]any, []any, string, float64, bool and nil values produced by
+// encoding/json and sonic.
+//
+// It supports the common subset of JSONPath:
+//
+//   - the root $, and @ for the current value in filters
+//   - child names .name, ['name'] and ["name"], and unions such as ['a','b']
+//   - wildcards .* and [*]
+//   - array indexes [0] and [-1], unions such as [0,2] and slices [1:3]
+//   - recursive descent ..name, ..* and ..[0]
+//   - filters [?(@.price < 10)], [?(@.tags)] comparing with ==, !=, <, <=,
+//     > and >= to a string, number, true, false or null
+//
+// A path that does not start with $ is relative to the root, e.g. items[0].id
+// is $.items[0].id.
+package jsonpath
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Path is a compiled JSONPath expression.
+type Path struct {
+	expr     string
+	segments []segment
+}
+
+type segment struct {
+	// descendant segments apply their selectors to the value and to every
+	// value nested in it.
+	descendant bool
+	selectors  []selector
+}
+
+type selectorKind int
+
+const (
+	nameSelector selectorKind = iota
+	wildcardSelector
+	indexSelector
+	sliceSelector
+	filterSelector
+)
+
+type selector struct {
+	kind       selectorKind
+	name       string
+	index      int
+	start, end *int
+	filter     *filter
+}
+
+// filter keeps the values for which its path, relative to the value, selects
+// something, or selects a value that compares to value with op.
+type filter struct {
+	path  *Path
+	op    string
+	value any
+}
+
+// Compile parses a JSONPath expression.
+func Compile(expr string) (*Path, error) {
+	source := strings.TrimSpace(expr)
+	if source == "" {
+		return nil, fmt.Errorf("empty jsonpath")
+	}
+	switch {
+	case source[0] == '$':
+	case source[0] == '[' || source[0] == '.':
+		source = "$" + source
+	default:
+		source = "$." + source
+	}
+
+	p := &parser{src: source}
+	path, err := p.path('$')
+	if err != nil {
+		return nil, fmt.Errorf("invalid jsonpath %q: %w", expr, err)
+	}
+	if p.pos < len(p.src) {
+		return nil, fmt.Errorf("invalid jsonpath %q: unexpected %q at %d", expr, p.src[p.pos], p.pos)
+	}
+	path.expr = expr
+	return path, nil
+}
+
+// MustCompile is like Compile but panics if the expression is invalid.
+func MustCompile(expr string) *Path {
+	path, err := Compile(expr)
+	if err != nil {
+		panic(err)
+	}
+	return path
+}
+
+func (p *Path) String() string {
+	return p.expr
+}
+
+// Select returns the values the path selects in value, in document order.
+// Object members are visited in key order.
+func (p *Path) Select(value any) []any {
+	nodes := []any{value}
+	for _, seg := range p.segments {
+		var next []any
+		for _, node := range nodes {
+			if seg.descendant {
+				for _, d := range descendants(node, nil) {
+					next = seg.apply(next, d)
+				}
+				continue
+			}
+			next = seg.apply(next, node)
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+func (s segment) apply(out []any, node any) []any {
+	for _, sel := range s.selectors {
+		out = sel.apply(out, node)
+	}
+	return out
+}
+
+func (s selector) apply(out []any, node any) []any {
+	switch s.kind {
+	case nameSelector:
+		if object, ok := node.(map[string]any); ok {
+			if value, ok := object[s.name]; ok {
+				out = append(out, value)
+			}
+		}
+	case wildcardSelector:
+		out = append(out, children(node)...)
+	case indexSelector:
+		if list, ok := node.([]any); ok {
+			index := s.index
+			if index < 0 {
+				index += len(list)
+			}
+			if index >= 0 && index < len(list) {
+				out = append(out, list[index])
+			}
+		}
+	case sliceSelector:
+		if list, ok := node.([]any); ok {
+			start, end := 0, len(list)
+			if s.start != nil {
+				start = clampIndex(*s.start, len(list))
+			}
+			if s.end != nil {
+				end = clampIndex(*s.end, len(list))
+			}
+			for i := start; i < end; i++ {
+				out = append(out, list[i])
+			}
+		}
+	case filterSelector:
+		for _, child := range children(node) {
+			if s.filter.matches(child) {
+				out = append(out, child)
+			}
+		}
+	}
+	return out
+}
+
+func clampIndex(index, length int) int {
+	if index < 0 {
+		index += length
+	}
+	return min(max(index, 0), length)
+}
+
+// children returns the elements of a list or the member values of an object
+// in key order.
+func children(node any) []any {
+	switch v := node.(type) {
+	case []any:
+		return v
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		values := make([]any, 0, len(v))
+		for _, key := range keys {
+			values = append(values, v[key])
+		}
+		return values
+	}
+	return nil
+}
+
+// descendants returns the node and every value nested in it, parents first.
+func descendants(node any, out []any) []any {
+	out = append(out, node)
+	for _, child := range children(node) {
+		out = descendants(child, out)
+	}
+	return out
+}
+
+func (f *filter) matches(node any) bool {
+	values := f.path.Select(node)
+	if f.op == "" {
+		return len(values) > 0
+	}
+	for _, value := range values {
+		if compare(value, f.op, f.value) {
+			return true
+		}
+	}
+	return false
+}
+
+func compare(left any, op string, right any) bool {
+	if l, ok := toNumber(left); ok {
+		if r, ok := toNumber(right); ok {
+			switch op {
+			case "==":
+				return l == r
+			case "!=":
+				return l != r
+			case "<":
+				return l < r
+			case "<=":
+				return l <= r
+			case ">":
+				return l > r
+			case ">=":
+				return l >= r
+			}
+		}
+	}
+	if l, ok := left.(string); ok {
+		if r, ok := right.(string); ok {
+			switch op {
+			case "==":
+				return l == r
+			case "!=":
+				return l != r
+			case "<":
+				return l < r
+			case "<=":
+				return l <= r
+			case ">":
+				return l > r
+			case ">=":
+				return l >= r
+			}
+		}
+	}
+	switch op {
+	case "==":
+		return left == right
+	case "!=":
+		return left != right
+	}
+	return false
+}
+
+func toNumber(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+type parser struct {
+	src string
+	pos int
+}
+
+func (p *parser) peek() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *parser) expect(c byte) error {
+	if p.peek() != c {
+		if p.pos >= len(p.src) {
+			return fmt.Errorf("expected %q at end", c)
+		}
+		return fmt.Errorf("expected %q at %d", c, p.pos)
+	}
+	p.pos++
+	return nil
+}
+
+// path parses a path starting with root, stopping at the first character
+// that cannot continue it, such as the operator of a filter.
+func (p *parser) path(root byte) (*Path, error) {
+	if err := p.expect(root); err != nil {
+		return nil, err
+	}
+
+	path := &Path{}
+	for {
+		switch p.peek() {
+		case '.':
+			p.pos++
+			seg := segment{}
+			if p.peek() == '.' {
+				p.pos++
+				seg.descendant = true
+			}
+			if seg.descendant && p.peek() == '[' {
+				selectors, err := p.bracket()
+				if err != nil {
+					return nil, err
+				}
+				seg.selectors = selectors
+			} else if p.peek() == '*' {
+				p.pos++
+				seg.selectors = []selector{{kind: wildcardSelector}}
+			} else {
+				name := p.name()
+				if name == "" {
+					return nil, fmt.Errorf("expected a name at %d", p.pos)
+				}
+				seg.selectors = []selector{{kind: nameSelector, name: name}}
+			}
+			path.segments = append(path.segments, seg)
+		case '[':
+			selectors, err := p.bracket()
+			if err != nil {
+				return nil, err
+			}
+			path.segments = append(path.segments, segment{selectors: selectors})
+		default:
+			return path, nil
+		}
+	}
+}
+
+func (p *parser) name() string {
+	start := p.pos
+	for p.pos < len(p.src) && !strings.ContainsRune(".[]()=!<>,'\" \t", rune(p.src[p.pos])) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// bracket parses a bracketed selector list, such as ['a','b'], [0:2] or a
+// filter.
+func (p *parser) bracket() ([]selector, error) {
+	if err := p.expect('['); err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+
+	if p.peek() == '?' {
+		p.pos++
+		f, err := p.filter()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if err := p.expect(']'); err != nil {
+			return nil, err
+		}
+		return []selector{{kind: filterSelector, filter: f}}, nil
+	}
+
+	var selectors []selector
+	for {
+		p.skipSpace()
+		sel, err := p.selector()
+		if err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, sel)
+		p.skipSpace()
+		if p.peek() == ',' {
+			p.pos++
+			continue
+		}
+		if err := p.expect(']'); err != nil {
+			return nil, err
+		}
+		return selectors, nil
+	}
+}
+
+func (p *parser) selector() (selector, error) {
+	switch c := p.peek(); {
+	case c == '*':
+		p.pos++
+		return selector{kind: wildcardSelector}, nil
+	case c == '\'' || c == '"':
+		name, err := p.quoted()
+		if err != nil {
+			return selector{}, err
+		}
+		return selector{kind: nameSelector, name: name}, nil
+	case c == '-' || c == ':' || (c >= '0' && c <= '9'):
+		start, hasStart, err := p.integer()
+		if err != nil {
+			return selector{}, err
+		}
+		if p.peek() != ':' {
+			if !hasStart {
+				return selector{}, fmt.Errorf("expected an index at %d", p.pos)
+			}
+			return selector{kind: indexSelector, index: start}, nil
+		}
+		p.pos++
+		end, hasEnd, err := p.integer()
+		if err != nil {
+			return selector{}, err
+		}
+		sel := selector{kind: sliceSelector}
+		if hasStart {
+			sel.start = &start
+		}
+		if hasEnd {
+			sel.end = &end
+		}
+		return sel, nil
+	default:
+		return selector{}, fmt.Errorf("unexpected %q at %d", c, p.pos)
+	}
+}
+
+func (p *parser) integer() (int, bool, error) {
+	start := p.pos
+	if p.peek() == '-' {
+		p.pos++
+	}
+	for p.pos < len(p.src) && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+		p.pos++
+	}
+	if p.pos == start {
+		return 0, false, nil
+	}
+	n, err := strconv.Atoi(p.src[start:p.pos])
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid index %q", p.src[start:p.pos])
+	}
+	return n, true, nil
+}
+
+func (p *parser) quoted() (string, error) {
+	quote := p.peek()
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		p.pos++
+		switch {
+		case c == '\\' && p.pos < len(p.src):
+			b.WriteByte(p.src[p.pos])
+			p.pos++
+		case c == quote:
+			return b.String(), nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("unterminated string")
+}
+
+// filter parses the expression of a filter selector, with or without
+// parentheses.
+func (p *parser) filter() (*filter, error) {
+	p.skipSpace()
+	parenthesized := p.peek() == '('
+	if parenthesized {
+		p.pos++
+		p.skipSpace()
+	}
+
+	path, err := p.path('@')
+	if err != nil {
+		return nil, err
+	}
+	f := &filter{path: path}
+
+	p.skipSpace()
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if strings.HasPrefix(p.src[p.pos:], op) {
+			f.op = op
+			p.pos += len(op)
+			break
+		}
+	}
+	if f.op != "" {
+		p.skipSpace()
+		if f.value, err = p.literal(); err != nil {
+			return nil, err
+		}
+	}
+
+	if parenthesized {
+		p.skipSpace()
+		if err := p.expect(')'); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (p *parser) literal() (any, error) {
+	if c := p.peek(); c == '\'' || c == '"' {
+		return p.quoted()
+	}
+	start := p.pos
+	for p.pos < len(p.src) && !strings.ContainsRune(" \t)]", rune(p.src[p.pos])) {
+		p.pos++
+	}
+	switch word := p.src[start:p.pos]; word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	default:
+		number, err := strconv.ParseFloat(word, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid literal %q", word)
+		}
+		return number, nil
+	}
+}
@@ -0,0 +1,67 @@
+package jsonpath
+
+import (
+	"testing"
+
+	"github.com/bytedance/sonic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const store = `{
+  "store": {
+    "name": "Corner Books",
+    "books": [
+      {"title": "Dune", "price": 9.5, "tags": ["scifi"], "isbn": "0441013597"},
+      {"title": "Emma", "price": 12, "author": {"name": "Jane Austen"}},
+      {"title": "Ulysses", "price": 15.25, "author": {"name": "James Joyce"}}
+    ],
+    "content-type": "books"
+  },
+  "next": null
+}`
+
+func TestSelect(t *testing.T) {
+	var doc any
+	require.NoError(t, sonic.UnmarshalString(store, &doc))
+
+	tests := []struct {
+		expr     string
+		expected []any
+	}{
+		{"$.store.name", []any{"Corner Books"}},
+		{"store.name", []any{"Corner Books"}},
+		{"$['store']['content-type']", []any{"books"}},
+		{"$.store.content-type", []any{"books"}},
+		{"$.store.books[0].title", []any{"Dune"}},
+		{"$.store.books[-1].title", []any{"Ulysses"}},
+		{"$.store.books[*].price", []any{9.5, float64(12), 15.25}},
+		{"$.store.books[0,2].title", []any{"Dune", "Ulysses"}},
+		{"$.store.books[1:].title", []any{"Emma", "Ulysses"}},
+		{"$.store.books[:-2].title", []any{"Dune"}},
+		{"$..author.name", []any{"Jane Austen", "James Joyce"}},
+		{"$.store.books[?(@.price < 13)].title", []any{"Dune", "Emma"}},
+		{"$.store.books[?(@.author.name == 'James Joyce')].title", []any{"Ulysses"}},
+		{"$.store.books[?@.tags].title", []any{"Dune"}},
+		{"$.store.books[?(@.isbn != null)].title", []any{"Dune"}},
+		{"$.store.books[0]['title','price']", []any{"Dune", 9.5}},
+		{"$.next", []any{nil}},
+		{"$.missing", nil},
+		{"$.store.books[9]", nil},
+	}
+	for _, test := range tests {
+		path, err := Compile(test.expr)
+		require.NoError(t, err, test.expr)
+		assert.Equal(t, test.expected, path.Select(doc), test.expr)
+	}
+
+	assert.Len(t, MustCompile("$.store.books[*]").Select(doc), 3)
+	assert.Len(t, MustCompile("$..title").Select(doc), 3)
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, expr := range []string{"", "$.", "$[", "$['name", "$[?(@.price <)]", "$.books[?(@.price < 1]", "$.a b", "$[a]"} {
+		_, err := Compile(expr)
+		assert.Error(t, err, expr)
+	}
+}
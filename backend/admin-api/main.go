@@ -16,7 +16,9 @@ import (
 	"admin-api/handlers"
 	"admin-api/middleware"
 	"admin-api/models"
+	"admin-api/scheduler"
 	"admin-api/services"
+	"admin-api/worker"
 
 	"github.com/gin-contrib/cors"
 	ginzap "github.com/gin-contrib/zap"
@@ -79,6 +81,12 @@ func main() {
 		logger.Fatal("Failed to initialize database connections", zap.Error(err))
 	}
 
+	// Execute queued task runs instead of serving the API
+	if len(os.Args) > 1 && os.Args[1] == "worker" {
+		runWorker(ctx, logger, cfg, httpClient)
+		return
+	}
+
 	// Initialize router
 	if cfg.Server.IsProd() {
 		gin.SetMode(gin.ReleaseMode)
@@ -125,10 +133,29 @@ func main() {
 		logger.Fatal("Failed to initialize Auth0 client", zap.Error(err))
 	}
 
+	blobStore, err := clients.NewFileBlobStore(cfg.BlobStore)
+	if err != nil {
+		logger.Fatal("Failed to initialize blob store", zap.Error(err))
+	}
+
 	taskRunArtifactRepository := models.NewTaskRunArtifactRepository(models.GetScylla())
 
-	taskService := services.NewTaskService(logger, taskRunArtifactRepository)
+	taskService := services.NewTaskService(logger, taskRunArtifactRepository, blobStore, cfg.Concurrency)
 	userService := services.NewUserService(logger, auth0Client)
+	queueService := services.NewQueueService(logger, cfg.Queue)
+	backfillService := services.NewBackfillService(logger, taskService)
+	pipelineService := services.NewPipelineService(logger, taskService)
+	taskService.SetPipelineHook(pipelineService)
+
+	// Start background jobs
+	if cfg.Scheduler.Enabled {
+		taskScheduler := scheduler.NewScheduler(logger, taskService, cfg.Scheduler)
+		go taskScheduler.Run(ctx)
+	}
+	if cfg.Reaper.Enabled {
+		taskRunReaper := scheduler.NewReaper(logger, taskService, cfg.Reaper)
+		go taskRunReaper.Run(ctx)
+	}
 
 	// Setup routes
 	api := r.Group("/api")
@@ -138,6 +165,9 @@ func main() {
 
 	handlers.SetupUserRoutes(api, userService)
 	handlers.SetupTaskRoutes(api, taskService)
+	handlers.SetupQueueRoutes(api, queueService)
+	handlers.SetupBackfillRoutes(api, backfillService)
+	handlers.SetupPipelineRoutes(api, pipelineService)
 
 	// Start server
 	logger.Info("Starting server", zap.String("address", cfg.Server.Address))
@@ -146,6 +176,23 @@ func main() {
 	}
 }
 
+func runWorker(ctx context.Context, logger *otelzap.Logger, cfg *config.Config, httpClient *http.Client) {
+	blobStore, err := clients.NewFileBlobStore(cfg.BlobStore)
+	if err != nil {
+		logger.Fatal("Failed to initialize blob store", zap.Error(err))
+	}
+
+	taskRunArtifactRepository := models.NewTaskRunArtifactRepository(models.GetScylla())
+
+	taskService := services.NewTaskService(logger, taskRunArtifactRepository, blobStore, cfg.Concurrency)
+	queueService := services.NewQueueService(logger, cfg.Queue)
+	// Runs finished by the worker trigger the downstream runs of their pipeline
+	taskService.SetPipelineHook(services.NewPipelineService(logger, taskService))
+
+	fetcher := worker.NewFetcher(httpClient, cfg.Worker.Fetcher)
+	worker.NewWorker(logger, queueService, taskService, fetcher, blobStore, cfg.Worker).Run(ctx)
+}
+
 func initTelemetry(ctx context.Context, cfg *config.Config) (*otelzap.Logger, func()) {
 	grpcClient, err := initGrpcConn(cfg.Otel)
 	if err != nil {
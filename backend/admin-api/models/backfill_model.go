@@ -0,0 +1,138 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"text/template"
+	"time"
+
+	apperrors "admin-api/errors"
+
+	"gorm.io/gorm"
+)
+
+// Backfill is a batch of runs of a task over consecutive historical windows.
+// Its runs are created as pending and promoted MaxConcurrency at a time.
+type Backfill struct {
+	gorm.Model
+	TaskID         uint      `json:"task_id" gorm:"index:idx_backfill_task_id"`
+	Start          time.Time `json:"start"`
+	End            time.Time `json:"end"`
+	StepSeconds    int64     `json:"step_seconds"`
+	MaxConcurrency int       `json:"max_concurrency"`
+	CreatedBy      string    `json:"created_by"`
+}
+
+// BackfillWindow is a time range a backfill run covers. Templated source URLs
+// are rendered with it, e.g. `?date={{.Start.Format "2006-01-02"}}`.
+type BackfillWindow struct {
+	Start time.Time
+	End   time.Time
+}
+
+// sourceURLFuncs are the functions available to source URL templates. Values
+// are written into the URL as they are, so values that may contain reserved
+// characters, such as the "+" of a time zone offset, must be piped to query,
+// e.g. `?since={{.Start.Format "2006-01-02T15:04:05Z07:00" | query}}`.
+var sourceURLFuncs = template.FuncMap{
+	"query": url.QueryEscape,
+}
+
+// BackfillWindows splits [start, end) into consecutive windows of the given
+// step. The last window is cut short at end.
+func BackfillWindows(start time.Time, end time.Time, step time.Duration) []BackfillWindow {
+	var windows []BackfillWindow
+	for windowStart := start; windowStart.Before(end); windowStart = windowStart.Add(step) {
+		windowEnd := windowStart.Add(step)
+		if windowEnd.After(end) {
+			windowEnd = end
+		}
+		windows = append(windows, BackfillWindow{Start: windowStart, End: windowEnd})
+	}
+	return windows
+}
+
+// RenderSourceURLs returns a copy of the sources with their URLs executed as
+// templates over the window.
+func RenderSourceURLs(sources []UrlSource, window BackfillWindow) ([]UrlSource, error) {
+	rendered := make([]UrlSource, 0, len(sources))
+	for _, source := range sources {
+		tmpl, err := template.New("url").Option("missingkey=error").Funcs(sourceURLFuncs).Parse(source.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid source url template %q: %w", source.URL, err)
+		}
+
+		var sourceURL bytes.Buffer
+		if err := tmpl.Execute(&sourceURL, window); err != nil {
+			return nil, fmt.Errorf("failed to render source url %q: %w", source.URL, err)
+		}
+
+		source.URL = sourceURL.String()
+		rendered = append(rendered, source)
+	}
+	return rendered, nil
+}
+
+// CreateBackfill stores the backfill together with one run per window.
+func CreateBackfill(ctx context.Context, backfill Backfill, taskRuns []TaskRun) (*Backfill, error) {
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&backfill).Error; err != nil {
+			return err
+		}
+
+		for i := range taskRuns {
+			taskRuns[i].BackfillID = &backfill.ID
+		}
+		return tx.CreateInBatches(taskRuns, 100).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &backfill, nil
+}
+
+func GetBackfill(ctx context.Context, backfillID uint64) (*Backfill, error) {
+	var backfill *Backfill
+	result := db.WithContext(ctx).Where("id = ?", backfillID).First(&backfill)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, apperrors.ErrBackfillNotFound
+		}
+		return nil, result.Error
+	}
+	return backfill, nil
+}
+
+func ListBackfillsForTask(ctx context.Context, taskID uint64) ([]Backfill, error) {
+	var backfills []Backfill
+	result := db.WithContext(ctx).Where("task_id = ?", taskID).Order("id").Find(&backfills)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return backfills, nil
+}
+
+// ListBackfillRuns returns all runs of a backfill, including retries, in the
+// order they were created.
+func ListBackfillRuns(ctx context.Context, backfillID uint64) ([]TaskRun, error) {
+	var taskRuns []TaskRun
+	result := db.WithContext(ctx).Where("backfill_id = ?", backfillID).Order("id").Find(&taskRuns)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return taskRuns, nil
+}
+
+func CountActiveBackfillRuns(ctx context.Context, backfillID uint64) (int64, error) {
+	var count int64
+	result := db.WithContext(ctx).Model(&TaskRun{}).
+		Where("backfill_id = ? AND status IN ?", backfillID, ActiveTaskRunStatuses).
+		Count(&count)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return count, nil
+}
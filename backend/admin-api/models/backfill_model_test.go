@@ -0,0 +1,70 @@
+package models
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackfillWindows(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Range is split into steps", func(t *testing.T) {
+		windows := BackfillWindows(start, start.AddDate(0, 0, 3), 24*time.Hour)
+		require.Len(t, windows, 3)
+		assert.Equal(t, start, windows[0].Start)
+		assert.Equal(t, start.AddDate(0, 0, 1), windows[0].End)
+		assert.Equal(t, start.AddDate(0, 0, 2), windows[2].Start)
+	})
+
+	t.Run("Last window is cut short at the end", func(t *testing.T) {
+		windows := BackfillWindows(start, start.Add(36*time.Hour), 24*time.Hour)
+		require.Len(t, windows, 2)
+		assert.Equal(t, start.Add(36*time.Hour), windows[1].End)
+	})
+}
+
+func TestRenderSourceURLs(t *testing.T) {
+	window := BackfillWindow{
+		Start: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+
+	t.Run("Window is substituted into the url", func(t *testing.T) {
+		sources := []UrlSource{
+			{Type: SourceTypeUrl, URL: `https://example.com/?from={{.Start.Format "2006-01-02"}}&to={{.End.Format "2006-01-02"}}`},
+			{Type: SourceTypeUrl, URL: "https://example.com/static"},
+		}
+
+		rendered, err := RenderSourceURLs(sources, window)
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com/?from=2026-01-01&to=2026-01-02", rendered[0].URL)
+		assert.Equal(t, "https://example.com/static", rendered[1].URL)
+		assert.Contains(t, sources[0].URL, "{{")
+	})
+
+	t.Run("Values are escaped for query strings", func(t *testing.T) {
+		paris := time.FixedZone("CET", 3600)
+		window := BackfillWindow{Start: time.Date(2026, 1, 1, 0, 0, 0, 0, paris), End: time.Date(2026, 1, 2, 0, 0, 0, 0, paris)}
+		sources := []UrlSource{{Type: SourceTypeUrl, URL: `https://example.com/?since={{.Start.Format "2006-01-02T15:04:05Z07:00" | query}}&until={{query (.End.Format "2006-01-02T15:04:05Z07:00")}}`}}
+
+		rendered, err := RenderSourceURLs(sources, window)
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com/?since=2026-01-01T00%3A00%3A00%2B01%3A00&until=2026-01-02T00%3A00%3A00%2B01%3A00", rendered[0].URL)
+
+		parsed, err := url.Parse(rendered[0].URL)
+		require.NoError(t, err)
+		assert.Equal(t, "2026-01-01T00:00:00+01:00", parsed.Query().Get("since"))
+	})
+
+	t.Run("Invalid templates", func(t *testing.T) {
+		_, err := RenderSourceURLs([]UrlSource{{URL: "https://example.com/{{.Start"}}, window)
+		assert.Error(t, err)
+
+		_, err = RenderSourceURLs([]UrlSource{{URL: "https://example.com/{{.Day}}"}}, window)
+		assert.Error(t, err)
+	})
+}
@@ -109,3 +109,32 @@ func GetUserRolesFromCache(ctx context.Context, userID string) ([]UserRole, erro
 
 	return roles, nil
 }
+
+// SetRobotsCache caches the robots.txt of an origin, such as
+// https://example.com, for ttl.
+func SetRobotsCache(ctx context.Context, origin string, robots *RobotsFile, ttl time.Duration) error {
+	robotsJSON, err := sonic.Marshal(robots)
+	if err != nil {
+		return err
+	}
+
+	return redisClient.Set(ctx, fmt.Sprintf("robots:%s", origin), robotsJSON, ttl).Err()
+}
+
+func GetRobotsFromCache(ctx context.Context, origin string) (*RobotsFile, error) {
+	robotsJSON, err := redisClient.Get(ctx, fmt.Sprintf("robots:%s", origin)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil // robots.txt not found in cache
+		}
+		return nil, err
+	}
+
+	var robots RobotsFile
+	err = sonic.UnmarshalString(robotsJSON, &robots)
+	if err != nil {
+		return nil, err
+	}
+
+	return &robots, nil
+}
@@ -0,0 +1,27 @@
+package models
+
+type ConcurrencyPolicy string
+
+const (
+	// ConcurrencyPolicyAllow lets runs of the same task overlap.
+	ConcurrencyPolicyAllow ConcurrencyPolicy = ""
+	// ConcurrencyPolicyForbid skips a new run while another one is active.
+	ConcurrencyPolicyForbid ConcurrencyPolicy = "forbid"
+	// ConcurrencyPolicyReplace cancels the active runs in favour of the new one.
+	ConcurrencyPolicyReplace ConcurrencyPolicy = "replace"
+	// ConcurrencyPolicyQueue holds a new run as pending until the active run
+	// has finished.
+	ConcurrencyPolicyQueue ConcurrencyPolicy = "queue"
+)
+
+func (p ConcurrencyPolicy) IsValid() bool {
+	switch p {
+	case ConcurrencyPolicyAllow, ConcurrencyPolicyForbid, ConcurrencyPolicyReplace, ConcurrencyPolicyQueue:
+		return true
+	}
+	return false
+}
+
+// ActiveTaskRunStatuses are the statuses of runs that are queued or running
+// and count towards concurrency limits.
+var ActiveTaskRunStatuses = []TaskStatus{TaskStatusCreated, TaskStatusRunning}
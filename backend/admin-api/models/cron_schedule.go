@@ -0,0 +1,72 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/robfig/cron/v3"
+)
+
+// cronParser accepts standard 5-field cron expressions, an optional leading
+// seconds field, and descriptors such as @daily.
+var cronParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+type cronSchedule struct {
+	expression string
+	location   *time.Location
+	schedule   cron.Schedule
+}
+
+// ParseCronSchedule parses a cron expression evaluated in the given IANA
+// timezone. An empty timezone means UTC.
+func ParseCronSchedule(expression string, timezone string) (Schedule, error) {
+	expression = strings.TrimSpace(expression)
+	if expression == "" {
+		return nil, errors.New("cron expression is empty")
+	}
+	if strings.HasPrefix(expression, "TZ=") || strings.HasPrefix(expression, "CRON_TZ=") {
+		return nil, errors.New("cron expression must not contain a timezone, use the timezone field instead")
+	}
+
+	location, err := LoadTimezone(timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule, err := cronParser.Parse(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", expression, err)
+	}
+
+	return cronSchedule{expression: expression, location: location, schedule: schedule}, nil
+}
+
+// LoadTimezone resolves an IANA timezone name. An empty name means UTC.
+func LoadTimezone(timezone string) (*time.Location, error) {
+	if timezone == "" {
+		return time.UTC, nil
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", timezone, err)
+	}
+	return location, nil
+}
+
+// Next evaluates the expression on the wall clock of the schedule's timezone,
+// so that "0 9 * * *" keeps firing at 09:00 local time across DST changes.
+func (s cronSchedule) Next(t time.Time) time.Time {
+	return s.schedule.Next(t.In(s.location)).UTC()
+}
+
+func (s cronSchedule) String() string {
+	return fmt.Sprintf("cron:%s@%s", s.expression, s.location)
+}
+
+// Location returns the timezone the schedule is evaluated in.
+func (s cronSchedule) Location() *time.Location {
+	return s.location
+}
@@ -70,6 +70,11 @@ func InitDB(ctx context.Context, logger *otelzap.Logger, postgresConfig config.P
 		return err
 	}
 
+	if err := EnsureRunQueue(ctx); err != nil {
+		logger.Ctx(ctx).Error("Failed to initialize run queue", zap.Error(err))
+		return err
+	}
+
 	logger.Ctx(ctx).Info("Database connections initialized successfully")
 	return nil
 }
@@ -105,5 +110,14 @@ func migrateSchemas() error {
 	if err := db.AutoMigrate(&TaskRun{}); err != nil {
 		return errors.Wrap(err, "Failed to auto migrate TaskRun schema")
 	}
+	if err := db.AutoMigrate(&TaskSchedule{}); err != nil {
+		return errors.Wrap(err, "Failed to auto migrate TaskSchedule schema")
+	}
+	if err := db.AutoMigrate(&Backfill{}); err != nil {
+		return errors.Wrap(err, "Failed to auto migrate Backfill schema")
+	}
+	if err := db.AutoMigrate(&Pipeline{}, &PipelineNode{}, &PipelineEdge{}, &PipelineRun{}, &PipelineNodeRun{}); err != nil {
+		return errors.Wrap(err, "Failed to auto migrate Pipeline schema")
+	}
 	return nil
 }
@@ -25,17 +25,37 @@ type TaskDto struct {
 	TaskDefinition string     `json:"task_definition"`
 	Status         TaskStatus `json:"status"`
 	Owner          string     `json:"owner"`
+	Paused         bool       `json:"paused"`
+	ResumeAt       *time.Time `json:"resume_at,omitempty"`
 	CreatedAt      time.Time  `json:"created_at"`
 	UpdatedAt      time.Time  `json:"updated_at"`
 	DeletedAt      time.Time  `json:"deleted_at"`
 }
 
 type TaskRunDto struct {
-	TaskID       string     `json:"task_id"`
-	Status       TaskStatus `json:"status"`
-	StartTime    time.Time  `json:"start_time"`
-	EndTime      time.Time  `json:"end_time"`
-	ErrorMessage string     `json:"error_message"`
+	ID              string      `json:"id"`
+	TaskID          string      `json:"task_id"`
+	Type            TaskRunType `json:"type"`
+	Status          TaskStatus  `json:"status"`
+	StartTime       time.Time   `json:"start_time"`
+	EndTime         time.Time   `json:"end_time"`
+	ErrorMessage    string      `json:"error_message"`
+	ErrorClass      ErrorClass  `json:"error_class"`
+	Attempt         int         `json:"attempt"`
+	ParentRunID     string      `json:"parent_run_id,omitempty"`
+	HeartbeatAt     time.Time   `json:"heartbeat_at"`
+	CancelledBy     string      `json:"cancelled_by,omitempty"`
+	CancelledAt     time.Time   `json:"cancelled_at"`
+	Overrides       string      `json:"overrides,omitempty"`
+	BackfillID      string      `json:"backfill_id,omitempty"`
+	PipelineRunID   string      `json:"pipeline_run_id,omitempty"`
+	PipelineNodeKey string      `json:"pipeline_node_key,omitempty"`
+	// SourcesSucceeded, SourcesFailed and SourcesSkipped count the sources
+	// processed by the worker; SourceErrors describes the failed ones.
+	SourcesSucceeded int           `json:"sources_succeeded"`
+	SourcesFailed    int           `json:"sources_failed"`
+	SourcesSkipped   int           `json:"sources_skipped"`
+	SourceErrors     []SourceError `json:"source_errors,omitempty"`
 }
 
 type TaskRunArtifactDto struct {
@@ -65,3 +85,122 @@ type CreateTaskRunArtifactDto struct {
 	S3Bucket          string            `json:"s3_bucket"`
 	S3Key             string            `json:"s3_key"`
 }
+
+// CreateTaskRunRequest creates a run of a task. Retries, backfills and
+// pipelines set the other fields of their runs themselves.
+type CreateTaskRunRequest struct {
+	TaskID    uint              `json:"task_id" binding:"required"`
+	Overrides *TaskRunOverrides `json:"overrides"`
+}
+
+type TriggerTaskRunRequest struct {
+	Overrides *TaskRunOverrides `json:"overrides"`
+}
+
+type TriggerTaskRunResponse struct {
+	RunID string `json:"run_id"`
+}
+
+type CreateBackfillRequest struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Step is the length of each window as a Go duration, e.g. "24h".
+	Step           string `json:"step"`
+	MaxConcurrency int    `json:"max_concurrency"`
+}
+
+type BackfillDto struct {
+	ID             string              `json:"id"`
+	TaskID         string              `json:"task_id"`
+	Start          time.Time           `json:"start"`
+	End            time.Time           `json:"end"`
+	Step           string              `json:"step"`
+	MaxConcurrency int                 `json:"max_concurrency"`
+	CreatedBy      string              `json:"created_by"`
+	CreatedAt      time.Time           `json:"created_at"`
+	Progress       BackfillProgressDto `json:"progress"`
+	Windows        []BackfillWindowDto `json:"windows,omitempty"`
+}
+
+// BackfillProgressDto counts the windows of a backfill by the status of their
+// latest run.
+type BackfillProgressDto struct {
+	Total     int `json:"total"`
+	Pending   int `json:"pending"`
+	Active    int `json:"active"`
+	Complete  int `json:"complete"`
+	Failed    int `json:"failed"`
+	Cancelled int `json:"cancelled"`
+}
+
+type BackfillWindowDto struct {
+	Start   time.Time  `json:"start"`
+	End     time.Time  `json:"end"`
+	RunID   string     `json:"run_id"`
+	Status  TaskStatus `json:"status"`
+	Attempt int        `json:"attempt"`
+}
+
+type PauseTaskRequest struct {
+	ResumeAt *time.Time `json:"resume_at"`
+}
+
+type SchedulePreviewRequest struct {
+	Cron     string     `json:"cron"`
+	Timezone string     `json:"timezone"`
+	Period   TaskPeriod `json:"period"`
+	From     time.Time  `json:"from"`
+	Count    int        `json:"count"`
+}
+
+type SchedulePreviewResponse struct {
+	FireTimes []time.Time `json:"fire_times"`
+}
+
+type CreatePipelineRequest struct {
+	Name  string            `json:"name"`
+	Nodes []PipelineNodeDto `json:"nodes"`
+	Edges []PipelineEdgeDto `json:"edges"`
+}
+
+type PipelineDto struct {
+	ID        string            `json:"id"`
+	Owner     string            `json:"owner"`
+	Name      string            `json:"name"`
+	Nodes     []PipelineNodeDto `json:"nodes"`
+	Edges     []PipelineEdgeDto `json:"edges"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+type PipelineNodeDto struct {
+	Key    string `json:"key"`
+	TaskID string `json:"task_id"`
+}
+
+type PipelineEdgeDto struct {
+	From      string                `json:"from"`
+	To        string                `json:"to"`
+	Condition PipelineEdgeCondition `json:"condition"`
+	Input     PipelineEdgeInput     `json:"input,omitempty"`
+}
+
+// PipelineRunDto is the state of a pipeline run, with its nodes in dependency
+// order and its edges so that it can be drawn as a graph.
+type PipelineRunDto struct {
+	ID          string               `json:"id"`
+	PipelineID  string               `json:"pipeline_id"`
+	Status      TaskStatus           `json:"status"`
+	StartTime   time.Time            `json:"start_time"`
+	EndTime     time.Time            `json:"end_time"`
+	TriggeredBy string               `json:"triggered_by"`
+	Nodes       []PipelineRunNodeDto `json:"nodes"`
+	Edges       []PipelineEdgeDto    `json:"edges"`
+}
+
+type PipelineRunNodeDto struct {
+	Key       string             `json:"key"`
+	TaskID    string             `json:"task_id"`
+	Status    PipelineNodeStatus `json:"status"`
+	TaskRunID string             `json:"task_run_id,omitempty"`
+	Message   string             `json:"message,omitempty"`
+}
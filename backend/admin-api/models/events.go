@@ -0,0 +1,56 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+// TaskRunEventsChannel is the Redis channel task run lifecycle events are
+// published on.
+const TaskRunEventsChannel = "task-runs:events"
+
+type TaskRunEventType string
+
+const (
+	TaskRunEventTimedOut  TaskRunEventType = "timed_out"
+	TaskRunEventCancelled TaskRunEventType = "cancelled"
+)
+
+// cancelledTaskRunTTL is how long the cancellation flag of a task run is kept
+// for workers that poll for it instead of subscribing to events.
+const cancelledTaskRunTTL = 24 * time.Hour
+
+type TaskRunEvent struct {
+	Type      TaskRunEventType `json:"type"`
+	TaskID    uint             `json:"task_id"`
+	TaskRunID uint             `json:"task_run_id"`
+	Status    TaskStatus       `json:"status"`
+	Message   string           `json:"message,omitempty"`
+	Time      time.Time        `json:"time"`
+}
+
+func PublishTaskRunEvent(ctx context.Context, event TaskRunEvent) error {
+	eventJSON, err := sonic.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return redisClient.Publish(ctx, TaskRunEventsChannel, eventJSON).Err()
+}
+
+// SignalTaskRunCancelled flags the task run as cancelled for workers polling
+// IsTaskRunCancelled.
+func SignalTaskRunCancelled(ctx context.Context, taskRunID uint) error {
+	return redisClient.Set(ctx, fmt.Sprintf("task-run:cancelled:%d", taskRunID), 1, cancelledTaskRunTTL).Err()
+}
+
+func IsTaskRunCancelled(ctx context.Context, taskRunID uint) (bool, error) {
+	count, err := redisClient.Exists(ctx, fmt.Sprintf("task-run:cancelled:%d", taskRunID)).Result()
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	apperrors "admin-api/errors"
+
+	"github.com/gocql/gocql"
+	"github.com/redis/go-redis/v9"
+)
+
+const lockPollInterval = 20 * time.Millisecond
+
+// acquireLockScript takes the lock if it is free, or extends it if it is
+// already held by the same owner.
+var acquireLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return 1
+end
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+// extendLockScript extends the lock only if it is still held by the owner.
+var extendLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// AcquireLock tries to take the lock identified by key on behalf of owner for
+// the given ttl. Calling it again before the ttl expires renews the lock.
+func AcquireLock(ctx context.Context, key string, owner string, ttl time.Duration) (bool, error) {
+	acquired, err := acquireLockScript.Run(ctx, redisClient, []string{lockKey(key)}, owner, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return acquired == 1, nil
+}
+
+// ReleaseLock releases the lock if it is still held by owner.
+func ReleaseLock(ctx context.Context, key string, owner string) error {
+	return releaseLockScript.Run(ctx, redisClient, []string{lockKey(key)}, owner).Err()
+}
+
+// WithLock runs fn while holding the lock identified by key, waiting up to
+// wait for another holder to release it. The lock is renewed every third of
+// its ttl until fn returns, so that fn may take longer than the ttl while the
+// lock still expires soon after a holder dies.
+func WithLock(ctx context.Context, key string, ttl time.Duration, wait time.Duration, fn func() error) error {
+	owner := gocql.TimeUUID().String()
+	deadline := time.Now().Add(wait)
+	for {
+		acquired, err := AcquireLock(ctx, key, owner, ttl)
+		if err != nil {
+			return err
+		}
+		if acquired {
+			break
+		}
+		if time.Now().After(deadline) {
+			return apperrors.ErrLockTimeout
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+	defer ReleaseLock(context.Background(), key, owner)
+
+	done := make(chan struct{})
+	defer close(done)
+	go renewLock(ctx, key, owner, ttl, done)
+
+	return fn()
+}
+
+// renewLock extends the lock held by owner until done is closed or the lock
+// is lost.
+func renewLock(ctx context.Context, key string, owner string, ttl time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(max(ttl/3, time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		extended, err := extendLockScript.Run(context.WithoutCancel(ctx), redisClient, []string{lockKey(key)}, owner, ttl.Milliseconds()).Int()
+		if err == nil && extended == 0 {
+			return
+		}
+	}
+}
+
+func lockKey(key string) string {
+	return "lock:" + key
+}
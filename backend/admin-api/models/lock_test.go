@@ -0,0 +1,113 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apperrors "admin-api/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquireLock(t *testing.T) {
+	mr, client := setupMiniRedis(t)
+	defer mr.Close()
+	redisClient = client
+
+	ctx := context.Background()
+
+	t.Run("Free lock is acquired", func(t *testing.T) {
+		acquired, err := AcquireLock(ctx, "test", "owner1", time.Minute)
+		require.NoError(t, err)
+		assert.True(t, acquired)
+		assert.InDelta(t, time.Minute.Seconds(), mr.TTL("lock:test").Seconds(), 1)
+	})
+
+	t.Run("Held lock is renewed by its owner", func(t *testing.T) {
+		mr.FastForward(30 * time.Second)
+
+		acquired, err := AcquireLock(ctx, "test", "owner1", time.Minute)
+		require.NoError(t, err)
+		assert.True(t, acquired)
+		assert.InDelta(t, time.Minute.Seconds(), mr.TTL("lock:test").Seconds(), 1)
+	})
+
+	t.Run("Held lock is not acquired by another owner", func(t *testing.T) {
+		acquired, err := AcquireLock(ctx, "test", "owner2", time.Minute)
+		require.NoError(t, err)
+		assert.False(t, acquired)
+	})
+
+	t.Run("Expired lock is acquired by another owner", func(t *testing.T) {
+		mr.FastForward(2 * time.Minute)
+
+		acquired, err := AcquireLock(ctx, "test", "owner2", time.Minute)
+		require.NoError(t, err)
+		assert.True(t, acquired)
+	})
+}
+
+func TestReleaseLock(t *testing.T) {
+	mr, client := setupMiniRedis(t)
+	defer mr.Close()
+	redisClient = client
+
+	ctx := context.Background()
+
+	acquired, err := AcquireLock(ctx, "test", "owner1", time.Minute)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	// Releasing a lock held by someone else is a no-op
+	require.NoError(t, ReleaseLock(ctx, "test", "owner2"))
+	assert.True(t, mr.Exists("lock:test"))
+
+	require.NoError(t, ReleaseLock(ctx, "test", "owner1"))
+	assert.False(t, mr.Exists("lock:test"))
+}
+
+func TestWithLock(t *testing.T) {
+	mr, client := setupMiniRedis(t)
+	defer mr.Close()
+	redisClient = client
+
+	ctx := context.Background()
+
+	t.Run("Lock is held while fn runs and released after", func(t *testing.T) {
+		err := WithLock(ctx, "test", time.Minute, time.Second, func() error {
+			assert.True(t, mr.Exists("lock:test"))
+			return nil
+		})
+		require.NoError(t, err)
+		assert.False(t, mr.Exists("lock:test"))
+	})
+
+	t.Run("Lock is renewed while fn runs past its ttl", func(t *testing.T) {
+		err := WithLock(ctx, "test", 300*time.Millisecond, time.Second, func() error {
+			for range 4 {
+				time.Sleep(150 * time.Millisecond)
+				mr.FastForward(200 * time.Millisecond)
+			}
+			assert.True(t, mr.Exists("lock:test"))
+			return nil
+		})
+		require.NoError(t, err)
+		assert.False(t, mr.Exists("lock:test"))
+	})
+
+	t.Run("Held lock times out", func(t *testing.T) {
+		acquired, err := AcquireLock(ctx, "test", "owner1", time.Minute)
+		require.NoError(t, err)
+		require.True(t, acquired)
+
+		called := false
+		err = WithLock(ctx, "test", time.Minute, 50*time.Millisecond, func() error {
+			called = true
+			return nil
+		})
+		assert.ErrorIs(t, err, apperrors.ErrLockTimeout)
+		assert.False(t, called)
+	})
+}
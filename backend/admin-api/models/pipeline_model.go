@@ -0,0 +1,292 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	apperrors "admin-api/errors"
+
+	"gorm.io/gorm"
+)
+
+// PipelineEdgeCondition decides, from the final status of the upstream node,
+// whether an edge lets its downstream node run.
+type PipelineEdgeCondition string
+
+const (
+	PipelineEdgeOnSuccess PipelineEdgeCondition = "on_success"
+	PipelineEdgeOnFailure PipelineEdgeCondition = "on_failure"
+	PipelineEdgeAlways    PipelineEdgeCondition = "always"
+)
+
+// PipelineEdgeInput decides what the upstream run passes to the downstream run
+// as its sources.
+type PipelineEdgeInput string
+
+const (
+	// PipelineEdgeInputNone runs the downstream task with its own sources.
+	PipelineEdgeInputNone PipelineEdgeInput = ""
+	// PipelineEdgeInputArtifacts passes the URLs of the upstream artifacts.
+	PipelineEdgeInputArtifacts PipelineEdgeInput = "artifacts"
+	// PipelineEdgeInputUrls passes the URLs extracted into the additional
+	// data of the upstream artifacts.
+	PipelineEdgeInputUrls PipelineEdgeInput = "urls"
+)
+
+type PipelineNodeStatus string
+
+const (
+	PipelineNodeWaiting   PipelineNodeStatus = "waiting"
+	PipelineNodeRunning   PipelineNodeStatus = "running"
+	PipelineNodeSucceeded PipelineNodeStatus = "succeeded"
+	PipelineNodeFailed    PipelineNodeStatus = "failed"
+	PipelineNodeSkipped   PipelineNodeStatus = "skipped"
+)
+
+// IsFinished reports whether a node with this status will not change anymore.
+func (s PipelineNodeStatus) IsFinished() bool {
+	return s == PipelineNodeSucceeded || s == PipelineNodeFailed || s == PipelineNodeSkipped
+}
+
+// Satisfied reports whether the edge lets its downstream node run after the
+// upstream node finished with the given status. Skipped nodes satisfy no edge.
+func (c PipelineEdgeCondition) Satisfied(upstream PipelineNodeStatus) bool {
+	switch c {
+	case PipelineEdgeOnSuccess:
+		return upstream == PipelineNodeSucceeded
+	case PipelineEdgeOnFailure:
+		return upstream == PipelineNodeFailed
+	case PipelineEdgeAlways:
+		return upstream == PipelineNodeSucceeded || upstream == PipelineNodeFailed
+	}
+	return false
+}
+
+// Pipeline links tasks into a DAG. Nodes are identified by a key that is
+// unique within the pipeline.
+type Pipeline struct {
+	gorm.Model
+	Owner string         `json:"owner" gorm:"index:idx_pipeline_owner"`
+	Name  string         `json:"name"`
+	Nodes []PipelineNode `json:"nodes"`
+	Edges []PipelineEdge `json:"edges"`
+}
+
+type PipelineNode struct {
+	gorm.Model
+	PipelineID uint   `json:"pipeline_id" gorm:"index:idx_pipeline_node_pipeline_id"`
+	Key        string `json:"key"`
+	TaskID     uint   `json:"task_id"`
+}
+
+type PipelineEdge struct {
+	gorm.Model
+	PipelineID uint                  `json:"pipeline_id" gorm:"index:idx_pipeline_edge_pipeline_id"`
+	FromNode   string                `json:"from"`
+	ToNode     string                `json:"to"`
+	Condition  PipelineEdgeCondition `json:"condition"`
+	Input      PipelineEdgeInput     `json:"input"`
+}
+
+type PipelineRun struct {
+	gorm.Model
+	PipelineID  uint              `json:"pipeline_id" gorm:"index:idx_pipeline_run_pipeline_id"`
+	Status      TaskStatus        `json:"status"`
+	StartTime   time.Time         `json:"start_time"`
+	EndTime     time.Time         `json:"end_time"`
+	TriggeredBy string            `json:"triggered_by"`
+	NodeRuns    []PipelineNodeRun `json:"node_runs"`
+}
+
+// PipelineNodeRun is the state of one node within a pipeline run.
+type PipelineNodeRun struct {
+	gorm.Model
+	PipelineRunID uint               `json:"pipeline_run_id" gorm:"index:idx_pipeline_node_run_pipeline_run_id"`
+	NodeKey       string             `json:"node_key"`
+	TaskRunID     *uint              `json:"task_run_id"`
+	Status        PipelineNodeStatus `json:"status"`
+	Message       string             `json:"message"`
+}
+
+// Validate checks that the pipeline is a well formed DAG.
+func (p *Pipeline) Validate() error {
+	if len(p.Nodes) == 0 {
+		return errors.New("pipeline must have at least one node")
+	}
+
+	nodes := make(map[string]bool, len(p.Nodes))
+	for _, node := range p.Nodes {
+		if node.Key == "" {
+			return errors.New("node key must not be empty")
+		}
+		if nodes[node.Key] {
+			return fmt.Errorf("duplicate node key %q", node.Key)
+		}
+		nodes[node.Key] = true
+	}
+
+	for _, edge := range p.Edges {
+		if !nodes[edge.FromNode] || !nodes[edge.ToNode] {
+			return fmt.Errorf("edge %q -> %q refers to an unknown node", edge.FromNode, edge.ToNode)
+		}
+		if edge.FromNode == edge.ToNode {
+			return fmt.Errorf("node %q must not depend on itself", edge.FromNode)
+		}
+		switch edge.Condition {
+		case PipelineEdgeOnSuccess, PipelineEdgeOnFailure, PipelineEdgeAlways:
+		default:
+			return fmt.Errorf("unknown edge condition %q", edge.Condition)
+		}
+		switch edge.Input {
+		case PipelineEdgeInputNone, PipelineEdgeInputArtifacts, PipelineEdgeInputUrls:
+		default:
+			return fmt.Errorf("unknown edge input %q", edge.Input)
+		}
+	}
+
+	if len(p.TopologicalOrder()) != len(p.Nodes) {
+		return errors.New("pipeline must not contain cycles")
+	}
+	return nil
+}
+
+// TopologicalOrder returns the node keys so that every node comes after its
+// upstream nodes. Nodes that are part of a cycle are left out.
+func (p *Pipeline) TopologicalOrder() []string {
+	inDegree := make(map[string]int, len(p.Nodes))
+	for _, edge := range p.Edges {
+		inDegree[edge.ToNode]++
+	}
+
+	var order, ready []string
+	for _, node := range p.Nodes {
+		if inDegree[node.Key] == 0 {
+			ready = append(ready, node.Key)
+		}
+	}
+	for len(ready) > 0 {
+		key := ready[0]
+		ready = ready[1:]
+		order = append(order, key)
+
+		for _, edge := range p.Edges {
+			if edge.FromNode != key {
+				continue
+			}
+			inDegree[edge.ToNode]--
+			if inDegree[edge.ToNode] == 0 {
+				ready = append(ready, edge.ToNode)
+			}
+		}
+	}
+	return order
+}
+
+// Node returns the node with the given key, or nil if there is none.
+func (p *Pipeline) Node(key string) *PipelineNode {
+	for i := range p.Nodes {
+		if p.Nodes[i].Key == key {
+			return &p.Nodes[i]
+		}
+	}
+	return nil
+}
+
+// IncomingEdges returns the edges leading to the node with the given key.
+func (p *Pipeline) IncomingEdges(key string) []PipelineEdge {
+	var edges []PipelineEdge
+	for _, edge := range p.Edges {
+		if edge.ToNode == key {
+			edges = append(edges, edge)
+		}
+	}
+	return edges
+}
+
+func CreatePipeline(ctx context.Context, pipeline Pipeline) (*Pipeline, error) {
+	result := db.WithContext(ctx).Create(&pipeline)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &pipeline, nil
+}
+
+func GetPipeline(ctx context.Context, pipelineID uint64) (*Pipeline, error) {
+	var pipeline *Pipeline
+	result := db.WithContext(ctx).Preload("Nodes").Preload("Edges").Where("id = ?", pipelineID).First(&pipeline)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, apperrors.ErrPipelineNotFound
+		}
+		return nil, result.Error
+	}
+	return pipeline, nil
+}
+
+func ListPipelinesByOwner(ctx context.Context, owner string) ([]Pipeline, error) {
+	var pipelines []Pipeline
+	result := db.WithContext(ctx).Preload("Nodes").Preload("Edges").Where("owner = ?", owner).Order("id").Find(&pipelines)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return pipelines, nil
+}
+
+func DeletePipeline(ctx context.Context, pipelineID uint64) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("pipeline_id = ?", pipelineID).Delete(&PipelineNode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("pipeline_id = ?", pipelineID).Delete(&PipelineEdge{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Pipeline{}, pipelineID).Error
+	})
+}
+
+func CreatePipelineRun(ctx context.Context, pipelineRun PipelineRun) (*PipelineRun, error) {
+	result := db.WithContext(ctx).Create(&pipelineRun)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &pipelineRun, nil
+}
+
+func GetPipelineRun(ctx context.Context, pipelineRunID uint64) (*PipelineRun, error) {
+	var pipelineRun *PipelineRun
+	result := db.WithContext(ctx).Preload("NodeRuns").Where("id = ?", pipelineRunID).First(&pipelineRun)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, apperrors.ErrPipelineRunNotFound
+		}
+		return nil, result.Error
+	}
+	return pipelineRun, nil
+}
+
+func ListPipelineRuns(ctx context.Context, pipelineID uint64) ([]PipelineRun, error) {
+	var pipelineRuns []PipelineRun
+	result := db.WithContext(ctx).Preload("NodeRuns").Where("pipeline_id = ?", pipelineID).Order("id").Find(&pipelineRuns)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return pipelineRuns, nil
+}
+
+func UpdatePipelineNodeRun(ctx context.Context, nodeRun PipelineNodeRun) error {
+	result := db.WithContext(ctx).Model(&PipelineNodeRun{}).Where("id = ?", nodeRun.ID).
+		Updates(map[string]interface{}{
+			"status":      nodeRun.Status,
+			"task_run_id": nodeRun.TaskRunID,
+			"message":     nodeRun.Message,
+		})
+	return result.Error
+}
+
+func FinishPipelineRun(ctx context.Context, pipelineRunID uint64, status TaskStatus, endTime time.Time) error {
+	result := db.WithContext(ctx).Model(&PipelineRun{}).Where("id = ?", pipelineRunID).
+		Updates(map[string]interface{}{"status": status, "end_time": endTime})
+	return result.Error
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPipelineValidate(t *testing.T) {
+	nodes := []PipelineNode{{Key: "discover", TaskID: 1}, {Key: "scrape", TaskID: 2}, {Key: "notify", TaskID: 3}}
+
+	t.Run("Valid DAG", func(t *testing.T) {
+		pipeline := Pipeline{Nodes: nodes, Edges: []PipelineEdge{
+			{FromNode: "discover", ToNode: "scrape", Condition: PipelineEdgeOnSuccess, Input: PipelineEdgeInputUrls},
+			{FromNode: "scrape", ToNode: "notify", Condition: PipelineEdgeAlways},
+		}}
+		assert.NoError(t, pipeline.Validate())
+		assert.Equal(t, []string{"discover", "scrape", "notify"}, pipeline.TopologicalOrder())
+	})
+
+	t.Run("Invalid pipelines", func(t *testing.T) {
+		invalid := []Pipeline{
+			{},
+			{Nodes: []PipelineNode{{Key: "a"}, {Key: "a"}}},
+			{Nodes: nodes, Edges: []PipelineEdge{{FromNode: "discover", ToNode: "missing", Condition: PipelineEdgeAlways}}},
+			{Nodes: nodes, Edges: []PipelineEdge{{FromNode: "discover", ToNode: "scrape", Condition: "sometimes"}}},
+			{Nodes: nodes, Edges: []PipelineEdge{{FromNode: "discover", ToNode: "scrape", Condition: PipelineEdgeAlways, Input: "html"}}},
+			{Nodes: nodes, Edges: []PipelineEdge{
+				{FromNode: "discover", ToNode: "scrape", Condition: PipelineEdgeAlways},
+				{FromNode: "scrape", ToNode: "notify", Condition: PipelineEdgeAlways},
+				{FromNode: "notify", ToNode: "discover", Condition: PipelineEdgeAlways},
+			}},
+		}
+		for _, pipeline := range invalid {
+			assert.Error(t, pipeline.Validate())
+		}
+	})
+}
+
+func TestPipelineEdgeConditionSatisfied(t *testing.T) {
+	assert.True(t, PipelineEdgeOnSuccess.Satisfied(PipelineNodeSucceeded))
+	assert.False(t, PipelineEdgeOnSuccess.Satisfied(PipelineNodeFailed))
+	assert.True(t, PipelineEdgeOnFailure.Satisfied(PipelineNodeFailed))
+	assert.True(t, PipelineEdgeAlways.Satisfied(PipelineNodeFailed))
+	assert.False(t, PipelineEdgeAlways.Satisfied(PipelineNodeSkipped))
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RobotsFile is the outcome of fetching the robots.txt of an origin, cached so
+// that every worker fetches it once per cache period. StatusCode is 0 when the
+// robots.txt could not be fetched at all.
+type RobotsFile struct {
+	StatusCode int    `json:"status_code"`
+	Body       string `json:"body,omitempty"`
+}
+
+// reserveHostSlotScript reserves the next request slot of a host: the slot is
+// now, or the time the previous slot plus the interval ends if that is later.
+// It returns how many milliseconds the caller has to wait for its slot.
+var reserveHostSlotScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local slot = tonumber(redis.call("GET", KEYS[1]) or "0")
+if slot < now then
+	slot = now
+end
+redis.call("SET", KEYS[1], string.format("%d", slot + interval), "PX", string.format("%d", slot + interval - now + 1000))
+return slot - now
+`)
+
+// acquireHostSlotScript takes one of the concurrent request slots of a host
+// if fewer than the limit are held. Slots expire on their own, so that the
+// slots of a worker that crashed are freed.
+var acquireHostSlotScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now)
+if redis.call("ZCARD", KEYS[1]) >= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call("ZADD", KEYS[1], ARGV[3], ARGV[4])
+redis.call("PEXPIRE", KEYS[1], ARGV[5])
+return 1
+`)
+
+// ReserveHostSlot reserves the next request to host, at least interval after
+// the previous one reserved by any worker, and returns how long the caller has
+// to wait before sending it.
+func ReserveHostSlot(ctx context.Context, host string, interval time.Duration) (time.Duration, error) {
+	wait, err := reserveHostSlotScript.Run(ctx, redisClient, []string{hostIntervalKey(host)}, time.Now().UnixMilli(), interval.Milliseconds()).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(wait) * time.Millisecond, nil
+}
+
+// AcquireHostSlot tries to take one of the limit concurrent request slots of
+// host on behalf of owner for at most ttl.
+func AcquireHostSlot(ctx context.Context, host string, owner string, limit int, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	acquired, err := acquireHostSlotScript.Run(ctx, redisClient, []string{hostActiveKey(host)},
+		now.UnixMilli(), limit, now.Add(ttl).UnixMilli(), owner, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return acquired == 1, nil
+}
+
+// ReleaseHostSlot releases the request slot of host held by owner.
+func ReleaseHostSlot(ctx context.Context, host string, owner string) error {
+	return redisClient.ZRem(ctx, hostActiveKey(host), owner).Err()
+}
+
+func hostIntervalKey(host string) string {
+	return "politeness:interval:" + host
+}
+
+func hostActiveKey(host string) string {
+	return "politeness:active:" + host
+}
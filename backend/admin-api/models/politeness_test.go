@@ -0,0 +1,88 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReserveHostSlot(t *testing.T) {
+	mr, client := setupMiniRedis(t)
+	defer mr.Close()
+	redisClient = client
+
+	ctx := context.Background()
+
+	wait, err := ReserveHostSlot(ctx, "example.com", time.Second)
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+
+	// The next slots are a second apart
+	wait, err = ReserveHostSlot(ctx, "example.com", time.Second)
+	require.NoError(t, err)
+	assert.InDelta(t, time.Second.Seconds(), wait.Seconds(), 0.1)
+
+	wait, err = ReserveHostSlot(ctx, "example.com", time.Second)
+	require.NoError(t, err)
+	assert.InDelta(t, (2 * time.Second).Seconds(), wait.Seconds(), 0.1)
+
+	// Other hosts have their own slots
+	wait, err = ReserveHostSlot(ctx, "example.org", time.Second)
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+}
+
+func TestAcquireHostSlot(t *testing.T) {
+	mr, client := setupMiniRedis(t)
+	defer mr.Close()
+	redisClient = client
+
+	ctx := context.Background()
+
+	for _, owner := range []string{"owner1", "owner2"} {
+		acquired, err := AcquireHostSlot(ctx, "example.com", owner, 2, time.Minute)
+		require.NoError(t, err)
+		assert.True(t, acquired, owner)
+	}
+
+	acquired, err := AcquireHostSlot(ctx, "example.com", "owner3", 2, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+
+	require.NoError(t, ReleaseHostSlot(ctx, "example.com", "owner1"))
+	acquired, err = AcquireHostSlot(ctx, "example.com", "owner3", 2, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	// Slots that were not released expire
+	acquired, err = AcquireHostSlot(ctx, "example.org", "owner1", 1, time.Millisecond)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+	time.Sleep(5 * time.Millisecond)
+	acquired, err = AcquireHostSlot(ctx, "example.org", "owner2", 1, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+}
+
+func TestRobotsCache(t *testing.T) {
+	mr, client := setupMiniRedis(t)
+	defer mr.Close()
+	redisClient = client
+
+	ctx := context.Background()
+
+	robots, err := GetRobotsFromCache(ctx, "https://example.com")
+	require.NoError(t, err)
+	assert.Nil(t, robots)
+
+	cached := &RobotsFile{StatusCode: 200, Body: "User-agent: *\nDisallow: /private\n"}
+	require.NoError(t, SetRobotsCache(ctx, "https://example.com", cached, time.Hour))
+
+	robots, err = GetRobotsFromCache(ctx, "https://example.com")
+	require.NoError(t, err)
+	assert.Equal(t, cached, robots)
+	assert.InDelta(t, time.Hour.Seconds(), mr.TTL("robots:https://example.com").Seconds(), 1)
+}
@@ -0,0 +1,107 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ErrorClass groups the errors a task run can fail with, so that retry
+// policies can decide which failures are worth retrying.
+type ErrorClass string
+
+const (
+	ErrorClassUnknown     ErrorClass = ""
+	ErrorClassNetwork     ErrorClass = "network"
+	ErrorClassTimeout     ErrorClass = "timeout"
+	ErrorClassRateLimited ErrorClass = "rate_limited"
+	ErrorClassHttp4xx     ErrorClass = "http_4xx"
+	ErrorClassHttp5xx     ErrorClass = "http_5xx"
+	ErrorClassExtraction  ErrorClass = "extraction"
+	// ErrorClassQueue is the class of runs that were never handed to a
+	// worker, because they could not be enqueued or were lost from the queue.
+	ErrorClassQueue ErrorClass = "queue"
+)
+
+func (c ErrorClass) IsValid() bool {
+	switch c {
+	case ErrorClassUnknown, ErrorClassNetwork, ErrorClassTimeout, ErrorClassRateLimited,
+		ErrorClassHttp4xx, ErrorClassHttp5xx, ErrorClassExtraction, ErrorClassQueue:
+		return true
+	default:
+		return false
+	}
+}
+
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first run.
+	MaxAttempts           int     `json:"max_attempts"`
+	InitialBackoffSeconds int     `json:"initial_backoff_seconds"`
+	Multiplier            float64 `json:"multiplier"`
+	// MaxBackoffSeconds caps the backoff between attempts. Zero leaves the
+	// backoff uncapped.
+	MaxBackoffSeconds int `json:"max_backoff_seconds,omitempty"`
+	// RetryableErrors limits retries to failures of these classes. An empty
+	// list retries every failure.
+	RetryableErrors []ErrorClass `json:"retryable_errors,omitempty"`
+}
+
+func (p *RetryPolicy) Validate() error {
+	if p.MaxAttempts < 0 {
+		return errors.New("retry max_attempts must not be negative")
+	}
+	if p.InitialBackoffSeconds < 0 {
+		return errors.New("retry initial_backoff_seconds must not be negative")
+	}
+	if p.Multiplier != 0 && p.Multiplier < 1 {
+		return errors.New("retry multiplier must be at least 1")
+	}
+	if p.MaxBackoffSeconds < 0 {
+		return errors.New("retry max_backoff_seconds must not be negative")
+	}
+	if p.MaxBackoffSeconds > 0 && p.MaxBackoffSeconds < p.InitialBackoffSeconds {
+		return errors.New("retry max_backoff_seconds must not be less than initial_backoff_seconds")
+	}
+	for _, errorClass := range p.RetryableErrors {
+		if errorClass == ErrorClassUnknown || !errorClass.IsValid() {
+			return fmt.Errorf("unknown retryable error class %q", errorClass)
+		}
+	}
+	return nil
+}
+
+// ShouldRetry reports whether a run that failed on the given attempt with the
+// given error class should be attempted again.
+func (p *RetryPolicy) ShouldRetry(attempt int, errorClass ErrorClass) bool {
+	if attempt >= p.MaxAttempts {
+		return false
+	}
+	if len(p.RetryableErrors) == 0 {
+		return true
+	}
+	for _, retryable := range p.RetryableErrors {
+		if retryable == errorClass {
+			return true
+		}
+	}
+	return false
+}
+
+// Backoff returns how long to wait before the attempt following the given
+// one, at most MaxBackoffSeconds.
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = 1
+	}
+	backoff := float64(p.InitialBackoffSeconds) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoffSeconds > 0 {
+		backoff = min(backoff, float64(p.MaxBackoffSeconds))
+	}
+	// Without a cap, the backoff of late attempts overflows a Duration
+	if backoff*float64(time.Second) >= math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(backoff * float64(time.Second))
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:           3,
+		InitialBackoffSeconds: 10,
+		Multiplier:            2,
+		RetryableErrors:       []ErrorClass{ErrorClassNetwork, ErrorClassHttp5xx},
+	}
+
+	t.Run("Retries retryable errors until max attempts", func(t *testing.T) {
+		assert.True(t, policy.ShouldRetry(1, ErrorClassNetwork))
+		assert.True(t, policy.ShouldRetry(2, ErrorClassHttp5xx))
+		assert.False(t, policy.ShouldRetry(3, ErrorClassNetwork))
+		assert.False(t, policy.ShouldRetry(1, ErrorClassHttp4xx))
+		assert.False(t, policy.ShouldRetry(1, ErrorClassUnknown))
+	})
+
+	t.Run("Retries every error without retryable classes", func(t *testing.T) {
+		retryAll := RetryPolicy{MaxAttempts: 2}
+		assert.True(t, retryAll.ShouldRetry(1, ErrorClassUnknown))
+		assert.False(t, retryAll.ShouldRetry(2, ErrorClassUnknown))
+	})
+
+	t.Run("Backoff grows exponentially", func(t *testing.T) {
+		assert.Equal(t, 10*time.Second, policy.Backoff(1))
+		assert.Equal(t, 20*time.Second, policy.Backoff(2))
+		assert.Equal(t, 40*time.Second, policy.Backoff(3))
+
+		constant := RetryPolicy{InitialBackoffSeconds: 5}
+		assert.Equal(t, 5*time.Second, constant.Backoff(3))
+	})
+
+	t.Run("Backoff is capped", func(t *testing.T) {
+		capped := policy
+		capped.MaxBackoffSeconds = 30
+		assert.Equal(t, 20*time.Second, capped.Backoff(2))
+		assert.Equal(t, 30*time.Second, capped.Backoff(3))
+		assert.Equal(t, 30*time.Second, capped.Backoff(1000))
+
+		assert.Equal(t, time.Duration(math.MaxInt64), policy.Backoff(1000))
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		assert.NoError(t, policy.Validate())
+		assert.Error(t, (&RetryPolicy{MaxAttempts: -1}).Validate())
+		assert.Error(t, (&RetryPolicy{InitialBackoffSeconds: -1}).Validate())
+		assert.Error(t, (&RetryPolicy{Multiplier: 0.5}).Validate())
+		assert.Error(t, (&RetryPolicy{RetryableErrors: []ErrorClass{"flaky"}}).Validate())
+		assert.Error(t, (&RetryPolicy{MaxBackoffSeconds: -1}).Validate())
+		assert.Error(t, (&RetryPolicy{InitialBackoffSeconds: 60, MaxBackoffSeconds: 30}).Validate())
+	})
+}
@@ -0,0 +1,414 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"admin-api/config"
+	apperrors "admin-api/errors"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// RunQueueStream holds the task runs waiting to be executed by a worker.
+	RunQueueStream = "task-runs:queue"
+	// RunQueueDeadLetterStream holds the task runs that could not be executed
+	// and need to be inspected before they are requeued or discarded.
+	RunQueueDeadLetterStream = "task-runs:dead"
+	// RunQueueGroup is the consumer group shared by all workers.
+	RunQueueGroup = "workers"
+	// RunQueueDelayedSet holds the task runs that must not be queued before a
+	// given time, scored by that time in unix milliseconds.
+	RunQueueDelayedSet = "task-runs:delayed"
+)
+
+// QueuedTaskRun is a task run claimed from the run queue. It must be
+// acknowledged once the run has finished, otherwise it will be handed to
+// another worker after the visibility timeout.
+type QueuedTaskRun struct {
+	MessageID  string `json:"message_id"`
+	TaskRunID  uint64 `json:"task_run_id"`
+	Deliveries int64  `json:"deliveries"`
+}
+
+type DeadLetter struct {
+	MessageID  string    `json:"message_id"`
+	TaskRunID  uint64    `json:"task_run_id"`
+	Reason     string    `json:"reason"`
+	Deliveries int64     `json:"deliveries"`
+	DeadAt     time.Time `json:"dead_at"`
+}
+
+type RunQueueStats struct {
+	Waiting     int64 `json:"waiting"`
+	InFlight    int64 `json:"in_flight"`
+	Delayed     int64 `json:"delayed"`
+	DeadLetters int64 `json:"dead_letters"`
+}
+
+// EnsureRunQueue creates the run queue stream and its consumer group.
+func EnsureRunQueue(ctx context.Context) error {
+	err := redisClient.XGroupCreateMkStream(ctx, RunQueueStream, RunQueueGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+func EnqueueTaskRun(ctx context.Context, taskRunID uint) error {
+	return redisClient.XAdd(ctx, &redis.XAddArgs{
+		Stream: RunQueueStream,
+		Values: map[string]interface{}{"task_run_id": taskRunID},
+	}).Err()
+}
+
+// EnqueueTaskRunAt queues a task run once the given time has passed. Delayed
+// runs are moved to the run queue by PromoteDelayedTaskRuns.
+func EnqueueTaskRunAt(ctx context.Context, taskRunID uint, at time.Time) error {
+	return redisClient.ZAdd(ctx, RunQueueDelayedSet, redis.Z{
+		Score:  float64(at.UnixMilli()),
+		Member: strconv.FormatUint(uint64(taskRunID), 10),
+	}).Err()
+}
+
+// PromoteDelayedTaskRuns queues the delayed task runs that are due at now and
+// returns how many were queued.
+func PromoteDelayedTaskRuns(ctx context.Context, now time.Time) (int, error) {
+	due, err := redisClient.ZRangeByScore(ctx, RunQueueDelayedSet, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.UnixMilli(), 10),
+	}).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	promoted := 0
+	for _, member := range due {
+		// Only the caller that removes the entry queues it, so concurrent
+		// promoters never queue a run twice.
+		removed, err := redisClient.ZRem(ctx, RunQueueDelayedSet, member).Result()
+		if err != nil {
+			return promoted, err
+		}
+		if removed == 0 {
+			continue
+		}
+
+		err = redisClient.XAdd(ctx, &redis.XAddArgs{
+			Stream: RunQueueStream,
+			Values: map[string]interface{}{"task_run_id": member},
+		}).Err()
+		if err != nil {
+			return promoted, err
+		}
+		promoted++
+	}
+	return promoted, nil
+}
+
+// queuedTaskRunsBatch is how many stream entries ListQueuedTaskRunIDs reads
+// at a time.
+const queuedTaskRunsBatch = 1000
+
+// ListQueuedTaskRunIDs returns the ids of the task runs that are on the run
+// queue, waiting or claimed by a worker, or delayed.
+func ListQueuedTaskRunIDs(ctx context.Context) (map[uint64]bool, error) {
+	queued := map[uint64]bool{}
+
+	// Acknowledged entries are deleted, so every entry left is still queued
+	start := "-"
+	for {
+		messages, err := redisClient.XRangeN(ctx, RunQueueStream, start, "+", queuedTaskRunsBatch).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, message := range messages {
+			if queuedRun, err := parseQueuedTaskRun(message, 0); err == nil {
+				queued[queuedRun.TaskRunID] = true
+			}
+		}
+		if len(messages) < queuedTaskRunsBatch {
+			break
+		}
+		start = "(" + messages[len(messages)-1].ID
+	}
+
+	delayed, err := redisClient.ZRange(ctx, RunQueueDelayedSet, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range delayed {
+		if taskRunID, err := strconv.ParseUint(member, 10, 64); err == nil {
+			queued[taskRunID] = true
+		}
+	}
+	return queued, nil
+}
+
+// ClaimTaskRuns hands up to count task runs to consumer. Runs that another
+// worker failed to acknowledge within the visibility timeout are reclaimed
+// first; runs that have been delivered more than the configured number of
+// times are moved to the dead-letter stream instead. If nothing is available
+// it waits up to block for new runs.
+func ClaimTaskRuns(ctx context.Context, cfg config.QueueConfig, consumer string, count int64, block time.Duration) ([]QueuedTaskRun, error) {
+	reclaimed, _, err := redisClient.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   RunQueueStream,
+		Group:    RunQueueGroup,
+		Consumer: consumer,
+		MinIdle:  cfg.VisibilityTimeout,
+		Start:    "0-0",
+		Count:    count,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	claimed := []QueuedTaskRun{}
+	for _, message := range reclaimed {
+		deliveries, err := messageDeliveries(ctx, message.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		queuedRun, err := parseQueuedTaskRun(message, deliveries)
+		if err == nil && deliveries > cfg.MaxDeliveries {
+			err = fmt.Errorf("exceeded %d deliveries", cfg.MaxDeliveries)
+		}
+		if err != nil {
+			if err := DeadLetterTaskRun(ctx, queuedRun, err.Error()); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		claimed = append(claimed, queuedRun)
+	}
+
+	if int64(len(claimed)) >= count {
+		return claimed, nil
+	}
+
+	// Don't wait for new runs if we already have something to work on
+	if len(claimed) > 0 {
+		block = -1
+	}
+
+	streams, err := redisClient.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    RunQueueGroup,
+		Consumer: consumer,
+		Streams:  []string{RunQueueStream, ">"},
+		Count:    count - int64(len(claimed)),
+		Block:    block,
+	}).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return claimed, nil
+		}
+		return nil, err
+	}
+
+	for _, stream := range streams {
+		for _, message := range stream.Messages {
+			queuedRun, err := parseQueuedTaskRun(message, 1)
+			if err != nil {
+				if err := DeadLetterTaskRun(ctx, queuedRun, err.Error()); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			claimed = append(claimed, queuedRun)
+		}
+	}
+
+	return claimed, nil
+}
+
+// extendTaskRunClaimScript resets the idle time of a claimed task run if it
+// is still claimed by the consumer, so that it is not reclaimed while it runs.
+// Its delivery count is kept as it is.
+var extendTaskRunClaimScript = redis.NewScript(`
+local pending = redis.call("XPENDING", KEYS[1], ARGV[1], ARGV[3], ARGV[3], 1)
+if #pending == 0 or pending[1][2] ~= ARGV[2] then
+	return 0
+end
+redis.call("XCLAIM", KEYS[1], ARGV[1], ARGV[2], 0, ARGV[3], "RETRYCOUNT", pending[1][4], "JUSTID")
+return 1
+`)
+
+// ExtendTaskRunClaim keeps a task run claimed by consumer for another
+// visibility timeout. It reports false if the run is no longer claimed by it.
+func ExtendTaskRunClaim(ctx context.Context, consumer string, messageID string) (bool, error) {
+	extended, err := extendTaskRunClaimScript.Run(ctx, redisClient, []string{RunQueueStream}, RunQueueGroup, consumer, messageID).Int()
+	if err != nil {
+		return false, err
+	}
+	return extended == 1, nil
+}
+
+// AckTaskRun removes a claimed task run from the queue.
+func AckTaskRun(ctx context.Context, messageID string) error {
+	_, err := redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAck(ctx, RunQueueStream, RunQueueGroup, messageID)
+		pipe.XDel(ctx, RunQueueStream, messageID)
+		return nil
+	})
+	return err
+}
+
+// DeadLetterTaskRun moves a claimed task run from the queue to the
+// dead-letter stream.
+func DeadLetterTaskRun(ctx context.Context, queuedRun QueuedTaskRun, reason string) error {
+	_, err := redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: RunQueueDeadLetterStream,
+			Values: map[string]interface{}{
+				"task_run_id": queuedRun.TaskRunID,
+				"message_id":  queuedRun.MessageID,
+				"deliveries":  queuedRun.Deliveries,
+				"reason":      reason,
+			},
+		})
+		pipe.XAck(ctx, RunQueueStream, RunQueueGroup, queuedRun.MessageID)
+		pipe.XDel(ctx, RunQueueStream, queuedRun.MessageID)
+		return nil
+	})
+	return err
+}
+
+func GetRunQueueStats(ctx context.Context) (*RunQueueStats, error) {
+	length, err := redisClient.XLen(ctx, RunQueueStream).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	pending, err := redisClient.XPending(ctx, RunQueueStream, RunQueueGroup).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	delayed, err := redisClient.ZCard(ctx, RunQueueDelayedSet).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	deadLetters, err := redisClient.XLen(ctx, RunQueueDeadLetterStream).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return &RunQueueStats{
+		Waiting:     length - pending.Count,
+		InFlight:    pending.Count,
+		Delayed:     delayed,
+		DeadLetters: deadLetters,
+	}, nil
+}
+
+func ListDeadLetters(ctx context.Context, count int64) ([]DeadLetter, error) {
+	messages, err := redisClient.XRangeN(ctx, RunQueueDeadLetterStream, "-", "+", count).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	deadLetters := []DeadLetter{}
+	for _, message := range messages {
+		deadLetters = append(deadLetters, parseDeadLetter(message))
+	}
+	return deadLetters, nil
+}
+
+// RequeueDeadLetter puts a dead-lettered task run back on the run queue.
+func RequeueDeadLetter(ctx context.Context, messageID string) (*DeadLetter, error) {
+	deadLetter, err := getDeadLetter(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: RunQueueStream,
+			Values: map[string]interface{}{"task_run_id": deadLetter.TaskRunID},
+		})
+		pipe.XDel(ctx, RunQueueDeadLetterStream, messageID)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deadLetter, nil
+}
+
+func DiscardDeadLetter(ctx context.Context, messageID string) error {
+	deleted, err := redisClient.XDel(ctx, RunQueueDeadLetterStream, messageID).Result()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return apperrors.ErrDeadLetterNotFound
+	}
+	return nil
+}
+
+func getDeadLetter(ctx context.Context, messageID string) (*DeadLetter, error) {
+	messages, err := redisClient.XRangeN(ctx, RunQueueDeadLetterStream, messageID, messageID, 1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, apperrors.ErrDeadLetterNotFound
+	}
+
+	deadLetter := parseDeadLetter(messages[0])
+	return &deadLetter, nil
+}
+
+func messageDeliveries(ctx context.Context, messageID string) (int64, error) {
+	pending, err := redisClient.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: RunQueueStream,
+		Group:  RunQueueGroup,
+		Start:  messageID,
+		End:    messageID,
+		Count:  1,
+	}).Result()
+	if err != nil {
+		return 0, err
+	}
+	if len(pending) == 0 {
+		return 0, nil
+	}
+	return pending[0].RetryCount, nil
+}
+
+func parseQueuedTaskRun(message redis.XMessage, deliveries int64) (QueuedTaskRun, error) {
+	queuedRun := QueuedTaskRun{MessageID: message.ID, Deliveries: deliveries}
+
+	value, _ := message.Values["task_run_id"].(string)
+	taskRunID, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return queuedRun, fmt.Errorf("invalid task run id %q", value)
+	}
+	queuedRun.TaskRunID = taskRunID
+	return queuedRun, nil
+}
+
+func parseDeadLetter(message redis.XMessage) DeadLetter {
+	deadLetter := DeadLetter{MessageID: message.ID}
+
+	if value, ok := message.Values["task_run_id"].(string); ok {
+		deadLetter.TaskRunID, _ = strconv.ParseUint(value, 10, 64)
+	}
+	if value, ok := message.Values["deliveries"].(string); ok {
+		deadLetter.Deliveries, _ = strconv.ParseInt(value, 10, 64)
+	}
+	deadLetter.Reason, _ = message.Values["reason"].(string)
+
+	// Stream IDs start with the millisecond timestamp they were added at
+	if millis, err := strconv.ParseInt(strings.SplitN(message.ID, "-", 2)[0], 10, 64); err == nil {
+		deadLetter.DeadAt = time.UnixMilli(millis).UTC()
+	}
+	return deadLetter
+}
@@ -0,0 +1,193 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"admin-api/config"
+	apperrors "admin-api/errors"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunQueue(t *testing.T) {
+	mr, client := setupMiniRedis(t)
+	defer mr.Close()
+	redisClient = client
+
+	ctx := context.Background()
+	cfg := config.QueueConfig{VisibilityTimeout: time.Minute, MaxDeliveries: 2}
+	now := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	mr.SetTime(now)
+
+	require.NoError(t, EnsureRunQueue(ctx))
+	// Creating the queue twice is fine
+	require.NoError(t, EnsureRunQueue(ctx))
+
+	t.Run("Enqueued runs are claimed once", func(t *testing.T) {
+		require.NoError(t, EnqueueTaskRun(ctx, 1))
+		require.NoError(t, EnqueueTaskRun(ctx, 2))
+
+		claimed, err := ClaimTaskRuns(ctx, cfg, "worker1", 10, -1)
+		require.NoError(t, err)
+		require.Len(t, claimed, 2)
+		assert.Equal(t, uint64(1), claimed[0].TaskRunID)
+		assert.Equal(t, uint64(2), claimed[1].TaskRunID)
+		assert.Equal(t, int64(1), claimed[0].Deliveries)
+
+		claimed, err = ClaimTaskRuns(ctx, cfg, "worker2", 10, -1)
+		require.NoError(t, err)
+		assert.Empty(t, claimed)
+
+		stats, err := GetRunQueueStats(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, RunQueueStats{Waiting: 0, InFlight: 2, DeadLetters: 0}, *stats)
+	})
+
+	t.Run("Acknowledged runs leave the queue", func(t *testing.T) {
+		pending, err := redisClient.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: RunQueueStream, Group: RunQueueGroup, Start: "-", End: "+", Count: 10,
+		}).Result()
+		require.NoError(t, err)
+		require.Len(t, pending, 2)
+
+		require.NoError(t, AckTaskRun(ctx, pending[0].ID))
+
+		stats, err := GetRunQueueStats(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, RunQueueStats{Waiting: 0, InFlight: 1, DeadLetters: 0}, *stats)
+	})
+
+	t.Run("Unacknowledged runs are reclaimed after the visibility timeout", func(t *testing.T) {
+		mr.SetTime(now.Add(30 * time.Second))
+		claimed, err := ClaimTaskRuns(ctx, cfg, "worker2", 10, -1)
+		require.NoError(t, err)
+		assert.Empty(t, claimed)
+
+		mr.SetTime(now.Add(2 * time.Minute))
+		claimed, err = ClaimTaskRuns(ctx, cfg, "worker2", 10, -1)
+		require.NoError(t, err)
+		require.Len(t, claimed, 1)
+		assert.Equal(t, uint64(2), claimed[0].TaskRunID)
+		assert.Equal(t, int64(2), claimed[0].Deliveries)
+	})
+
+	t.Run("Extended claims are not reclaimed", func(t *testing.T) {
+		pending, err := redisClient.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: RunQueueStream, Group: RunQueueGroup, Start: "-", End: "+", Count: 10,
+		}).Result()
+		require.NoError(t, err)
+		require.Len(t, pending, 1)
+
+		// Only the consumer holding the run can extend its claim
+		extended, err := ExtendTaskRunClaim(ctx, "worker1", pending[0].ID)
+		require.NoError(t, err)
+		assert.False(t, extended)
+
+		mr.SetTime(now.Add(150 * time.Second))
+		extended, err = ExtendTaskRunClaim(ctx, "worker2", pending[0].ID)
+		require.NoError(t, err)
+		assert.True(t, extended)
+
+		mr.SetTime(now.Add(3 * time.Minute))
+		claimed, err := ClaimTaskRuns(ctx, cfg, "worker3", 10, -1)
+		require.NoError(t, err)
+		assert.Empty(t, claimed)
+	})
+
+	t.Run("Poison runs are dead-lettered", func(t *testing.T) {
+		mr.SetTime(now.Add(4 * time.Minute))
+		claimed, err := ClaimTaskRuns(ctx, cfg, "worker3", 10, -1)
+		require.NoError(t, err)
+		assert.Empty(t, claimed)
+
+		stats, err := GetRunQueueStats(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, RunQueueStats{Waiting: 0, InFlight: 0, DeadLetters: 1}, *stats)
+
+		deadLetters, err := ListDeadLetters(ctx, 10)
+		require.NoError(t, err)
+		require.Len(t, deadLetters, 1)
+		assert.Equal(t, uint64(2), deadLetters[0].TaskRunID)
+		assert.Equal(t, int64(3), deadLetters[0].Deliveries)
+		assert.Equal(t, "exceeded 2 deliveries", deadLetters[0].Reason)
+		assert.Equal(t, now.Add(4*time.Minute), deadLetters[0].DeadAt)
+	})
+
+	t.Run("Dead letters can be requeued", func(t *testing.T) {
+		deadLetters, err := ListDeadLetters(ctx, 10)
+		require.NoError(t, err)
+		require.Len(t, deadLetters, 1)
+
+		requeued, err := RequeueDeadLetter(ctx, deadLetters[0].MessageID)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), requeued.TaskRunID)
+
+		claimed, err := ClaimTaskRuns(ctx, cfg, "worker1", 10, -1)
+		require.NoError(t, err)
+		require.Len(t, claimed, 1)
+		assert.Equal(t, uint64(2), claimed[0].TaskRunID)
+		assert.Equal(t, int64(1), claimed[0].Deliveries)
+
+		_, err = RequeueDeadLetter(ctx, deadLetters[0].MessageID)
+		assert.ErrorIs(t, err, apperrors.ErrDeadLetterNotFound)
+	})
+
+	t.Run("Dead letters can be discarded", func(t *testing.T) {
+		require.NoError(t, redisClient.XAdd(ctx, &redis.XAddArgs{
+			Stream: RunQueueStream,
+			Values: map[string]interface{}{"task_run_id": "not-a-number"},
+		}).Err())
+
+		// Malformed entries are dead-lettered as soon as they are read
+		claimed, err := ClaimTaskRuns(ctx, cfg, "worker1", 10, -1)
+		require.NoError(t, err)
+		assert.Empty(t, claimed)
+
+		deadLetters, err := ListDeadLetters(ctx, 10)
+		require.NoError(t, err)
+		require.Len(t, deadLetters, 1)
+		assert.Contains(t, deadLetters[0].Reason, "invalid task run id")
+
+		require.NoError(t, DiscardDeadLetter(ctx, deadLetters[0].MessageID))
+		assert.ErrorIs(t, DiscardDeadLetter(ctx, deadLetters[0].MessageID), apperrors.ErrDeadLetterNotFound)
+	})
+}
+
+func TestPromoteDelayedTaskRuns(t *testing.T) {
+	mr, client := setupMiniRedis(t)
+	defer mr.Close()
+	redisClient = client
+
+	ctx := context.Background()
+	cfg := config.QueueConfig{VisibilityTimeout: time.Minute, MaxDeliveries: 2}
+	now := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	require.NoError(t, EnsureRunQueue(ctx))
+
+	require.NoError(t, EnqueueTaskRunAt(ctx, 1, now.Add(time.Minute)))
+	require.NoError(t, EnqueueTaskRunAt(ctx, 2, now.Add(time.Hour)))
+
+	stats, err := GetRunQueueStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, RunQueueStats{Delayed: 2}, *stats)
+
+	promoted, err := PromoteDelayedTaskRuns(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, 0, promoted)
+
+	promoted, err = PromoteDelayedTaskRuns(ctx, now.Add(2*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, promoted)
+
+	claimed, err := ClaimTaskRuns(ctx, cfg, "worker1", 10, -1)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, uint64(1), claimed[0].TaskRunID)
+
+	stats, err = GetRunQueueStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, RunQueueStats{InFlight: 1, Delayed: 1}, *stats)
+}
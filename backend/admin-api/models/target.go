@@ -0,0 +1,172 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+)
+
+// ProcessOp is a post-processing step applied to the values extracted for a
+// target.
+type ProcessOp string
+
+const (
+	// ProcessTrim trims whitespace, or the characters in Pattern if set.
+	ProcessTrim ProcessOp = "trim"
+	// ProcessRegex replaces the value with the first capture group of
+	// Pattern, or the whole match if it has no groups.
+	ProcessRegex ProcessOp = "regex"
+	// ProcessNumber parses the value as a number, ignoring currency symbols
+	// and thousands separators.
+	ProcessNumber ProcessOp = "number"
+)
+
+type ProcessStep struct {
+	Op      ProcessOp `json:"op"`
+	Pattern string    `json:"pattern,omitempty"`
+}
+
+func (s *ProcessStep) Validate() error {
+	switch s.Op {
+	case ProcessTrim, ProcessNumber:
+	case ProcessRegex:
+		if s.Pattern == "" {
+			return errors.New("regex step must have a pattern")
+		}
+		if _, err := regexp.Compile(s.Pattern); err != nil {
+			return fmt.Errorf("invalid regex %q: %v", s.Pattern, err)
+		}
+	default:
+		return fmt.Errorf("unknown process step %q", s.Op)
+	}
+	return nil
+}
+
+// QueryAccessor decides what a CSS selector target yields for each matched
+// element.
+type QueryAccessor int
+
+const (
+	// QueryAccessorText yields the text of the element and its descendants.
+	QueryAccessorText QueryAccessor = iota
+	// QueryAccessorOwnText yields the text of the element itself, selected
+	// with the ::text suffix.
+	QueryAccessorOwnText
+	// QueryAccessorAttr yields an attribute, selected with the
+	// ::attr(name) suffix.
+	QueryAccessorAttr
+)
+
+// QuerySelector is a parsed CSS selector target value such as
+// "a.title::attr(href)".
+type QuerySelector struct {
+	Selector cascadia.Selector
+	Accessor QueryAccessor
+	Attr     string
+}
+
+// ParseQuerySelector parses a CSS selector with an optional ::text or
+// ::attr(name) suffix.
+func ParseQuerySelector(value string) (*QuerySelector, error) {
+	query := &QuerySelector{Accessor: QueryAccessorText}
+	selector := strings.TrimSpace(value)
+
+	switch {
+	case strings.HasSuffix(selector, "::text"):
+		query.Accessor = QueryAccessorOwnText
+		selector = strings.TrimSuffix(selector, "::text")
+	case strings.HasSuffix(selector, ")") && strings.Contains(selector, "::attr("):
+		i := strings.LastIndex(selector, "::attr(")
+		query.Accessor = QueryAccessorAttr
+		query.Attr = strings.TrimSpace(selector[i+len("::attr(") : len(selector)-1])
+		selector = selector[:i]
+		if query.Attr == "" {
+			return nil, fmt.Errorf("selector %q must name an attribute", value)
+		}
+	}
+
+	sel, err := cascadia.Compile(strings.TrimSpace(selector))
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector %q: %v", value, err)
+	}
+	query.Selector = sel
+	return query, nil
+}
+
+// CompileRegexTarget compiles the pattern of a regex target with its flags.
+func CompileRegexTarget(pattern string, flags string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, errors.New("regex target must have a pattern")
+	}
+	for _, flag := range flags {
+		if !strings.ContainsRune("ims", flag) {
+			return nil, fmt.Errorf("unknown regex flag %q", flag)
+		}
+	}
+	expr := pattern
+	if flags != "" {
+		expr = "(?" + flags + ")" + pattern
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex %q: %v", pattern, err)
+	}
+	return re, nil
+}
+
+// HasNamedGroups reports whether the regex has named capture groups, whose
+// matches a regex target extracts as separate fields.
+func HasNamedGroups(re *regexp.Regexp) bool {
+	for _, name := range re.SubexpNames() {
+		if name != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// TableHeader decides which rows of a table target hold the column names.
+type TableHeader string
+
+const (
+	// TableHeaderAuto uses the rows of the table's thead, or else its leading
+	// rows made only of th cells.
+	TableHeaderAuto TableHeader = "auto"
+	// TableHeaderFirst uses the first row.
+	TableHeaderFirst TableHeader = "first"
+	// TableHeaderNone names the columns column_1, column_2 and so on.
+	TableHeaderNone TableHeader = "none"
+)
+
+// TableOptions locates the table of a table target among the tables its
+// selector matches and maps its columns to record fields.
+type TableOptions struct {
+	// Index picks the table among the matching ones, starting at 0.
+	Index int `json:"index,omitempty"`
+	// Caption only keeps tables whose caption contains it, ignoring case.
+	Caption string      `json:"caption,omitempty"`
+	Header  TableHeader `json:"header,omitempty"`
+	// Columns maps column names, or column numbers starting at 1, to field
+	// names. Only mapped columns are kept when it is set.
+	Columns map[string]string `json:"columns,omitempty"`
+}
+
+func (o *TableOptions) Validate() error {
+	if o.Index < 0 {
+		return errors.New("table index must not be negative")
+	}
+	switch o.Header {
+	case "", TableHeaderAuto, TableHeaderFirst, TableHeaderNone:
+	default:
+		return fmt.Errorf("unknown table header %q", o.Header)
+	}
+	for column, name := range o.Columns {
+		if strings.TrimSpace(column) == "" || strings.TrimSpace(name) == "" {
+			return errors.New("table columns must map a column to a field name")
+		}
+	}
+	return nil
+}
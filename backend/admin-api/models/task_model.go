@@ -4,7 +4,20 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 
+	"admin-api/jsonpath"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/antchfx/xpath"
+	"github.com/bytedance/sonic"
+	"github.com/gocql/gocql"
 	"gorm.io/gorm"
 )
 
@@ -32,15 +45,32 @@ type SourceType int64
 const (
 	SourceTypeUnknown SourceType = iota
 	SourceTypeUrl
+	// SourceTypeSitemap sources expand into the pages listed by a sitemap or
+	// the sitemaps of a sitemap index.
+	SourceTypeSitemap
+	// SourceTypeFeed sources expand into the entries of an RSS or Atom feed.
+	SourceTypeFeed
+	// SourceTypeCrawl sources start at their URL and follow the links of the
+	// pages they fetch.
+	SourceTypeCrawl
+	// SourceTypeApi sources call an HTTP JSON API, following its pagination.
+	SourceTypeApi
+	// SourceTypeUpload sources read a file uploaded to the task instead of
+	// fetching their URL.
+	SourceTypeUpload
 )
 
 type TargetType int64
 
 const (
-	TargetTypeUnknown TargetType = iota
-	TargetTypeAuto    TargetType = 1
-	TargetTypeXpath   TargetType = 2
-	TargetTypeQuery   TargetType = 3
+	TargetTypeUnknown    TargetType = iota
+	TargetTypeAuto       TargetType = 1
+	TargetTypeXpath      TargetType = 2
+	TargetTypeQuery      TargetType = 3
+	TargetTypeRegex      TargetType = 4
+	TargetTypeTable      TargetType = 5
+	TargetTypeStructured TargetType = 6
+	TargetTypeJsonPath   TargetType = 7
 )
 
 type TaskPeriod int64
@@ -55,9 +85,238 @@ const (
 	TaskPeriodMonthly
 )
 
+// Schedule computes the fire times of a periodic task.
+type Schedule interface {
+	// Next returns the first fire time strictly after t.
+	Next(t time.Time) time.Time
+	// String returns a stable description of the schedule, used to detect
+	// when a task's schedule has been changed.
+	String() string
+}
+
+type periodSchedule struct {
+	period TaskPeriod
+}
+
+func (s periodSchedule) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Second)
+	switch s.period {
+	case TaskPeriodMinutely:
+		return t.Add(time.Minute)
+	case TaskPeriodHourly:
+		return t.Add(time.Hour)
+	case TaskPeriodDaily:
+		return t.AddDate(0, 0, 1)
+	case TaskPeriodWeekly:
+		return t.AddDate(0, 0, 7)
+	default:
+		return t.AddDate(0, 1, 0)
+	}
+}
+
+func (s periodSchedule) String() string {
+	return fmt.Sprintf("period:%d", s.period)
+}
+
+// IsPeriodic reports whether tasks with this period run repeatedly.
+func (p TaskPeriod) IsPeriodic() bool {
+	switch p {
+	case TaskPeriodMinutely, TaskPeriodHourly, TaskPeriodDaily, TaskPeriodWeekly, TaskPeriodMonthly:
+		return true
+	default:
+		return false
+	}
+}
+
 type UrlSource struct {
 	Type SourceType `json:"type"`
 	URL  string     `json:"url"`
+	// MaxURLs caps the URLs a sitemap or feed source expands into, zero uses
+	// the worker default.
+	MaxURLs int `json:"max_urls,omitempty"`
+	// ModifiedSince only keeps the sitemap or feed entries modified after it.
+	ModifiedSince *time.Time `json:"modified_since,omitempty"`
+	// OnlyNew only keeps the sitemap or feed entries modified after the start
+	// of the previous complete run of the task.
+	OnlyNew bool `json:"only_new,omitempty"`
+	// Crawl holds the link-follow rules and limits of a crawl source.
+	Crawl *CrawlOptions `json:"crawl,omitempty"`
+	// Api holds the request and pagination of an API source.
+	Api *ApiOptions `json:"api,omitempty"`
+	// Upload is the artifact id of the file read by an upload source. The URL
+	// of an upload source is optional and only used to resolve the relative
+	// links of the file.
+	Upload string `json:"upload,omitempty"`
+}
+
+// ApiPaginationType decides how the next page of an API source is requested.
+type ApiPaginationType string
+
+const (
+	// ApiPaginationCursor sends the cursor found at the cursor path of a
+	// response in the query parameter of the next request.
+	ApiPaginationCursor ApiPaginationType = "cursor"
+	// ApiPaginationOffset increases the offset sent in the query parameter by
+	// the page size until a page has fewer items than the page size.
+	ApiPaginationOffset ApiPaginationType = "offset"
+	// ApiPaginationLink follows the rel="next" URL of the Link header.
+	ApiPaginationLink ApiPaginationType = "link"
+)
+
+// ApiOptions is the request sent to the API of an API source. Every page of
+// the response must be JSON.
+type ApiOptions struct {
+	// Method is GET or POST, GET by default.
+	Method  string            `json:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Body is sent as the JSON body of every request.
+	Body       json.RawMessage `json:"body,omitempty"`
+	Pagination *ApiPagination  `json:"pagination,omitempty"`
+}
+
+type ApiPagination struct {
+	Type ApiPaginationType `json:"type"`
+	// Param is the query parameter of the cursor or offset.
+	Param string `json:"param,omitempty"`
+	// CursorPath is the JSONPath of the next cursor in a response, the last
+	// page has none.
+	CursorPath string `json:"cursor_path,omitempty"`
+	// PageSize and ItemsPath are how much the offset grows per page and the
+	// JSONPath of the items of a response.
+	PageSize  int    `json:"page_size,omitempty"`
+	ItemsPath string `json:"items_path,omitempty"`
+	// MaxPages caps the pages requested, zero uses the worker default.
+	MaxPages int `json:"max_pages,omitempty"`
+}
+
+func (o *ApiOptions) Validate() error {
+	switch strings.ToUpper(o.Method) {
+	case "", http.MethodGet, http.MethodPost:
+	default:
+		return fmt.Errorf("unsupported api method %q", o.Method)
+	}
+	if len(o.Body) > 0 && !json.Valid(o.Body) {
+		return errors.New("api body must be valid JSON")
+	}
+	if o.Pagination != nil {
+		return o.Pagination.Validate()
+	}
+	return nil
+}
+
+func (p *ApiPagination) Validate() error {
+	if p.MaxPages < 0 {
+		return errors.New("api max_pages must not be negative")
+	}
+	switch p.Type {
+	case ApiPaginationCursor:
+		if p.Param == "" || p.CursorPath == "" {
+			return errors.New("cursor pagination must have a param and a cursor_path")
+		}
+		if _, err := jsonpath.Compile(p.CursorPath); err != nil {
+			return err
+		}
+	case ApiPaginationOffset:
+		if p.Param == "" || p.ItemsPath == "" || p.PageSize <= 0 {
+			return errors.New("offset pagination must have a param, a positive page_size and an items_path")
+		}
+		if _, err := jsonpath.Compile(p.ItemsPath); err != nil {
+			return err
+		}
+	case ApiPaginationLink:
+	default:
+		return fmt.Errorf("unknown api pagination %q", p.Type)
+	}
+	return nil
+}
+
+// CrawlOptions decides which links of the pages of a crawl source are
+// followed and how far.
+type CrawlOptions struct {
+	// Follow and FollowXpath select the elements whose href or src is
+	// followed. Every link of a page is a candidate when neither is set.
+	Follow      string `json:"follow,omitempty"`
+	FollowXpath string `json:"follow_xpath,omitempty"`
+	// FollowPattern only follows the links whose URL matches it.
+	FollowPattern string `json:"follow_pattern,omitempty"`
+	// Next selects the "next page" link of paginated listings, which is
+	// followed at the depth of the page it is on.
+	Next string `json:"next,omitempty"`
+	// MaxDepth is how many links away from the start URL pages are fetched,
+	// zero uses the worker default.
+	MaxDepth int `json:"max_depth,omitempty"`
+	// MaxPages caps the pages fetched by the crawl, zero uses the worker
+	// default.
+	MaxPages int `json:"max_pages,omitempty"`
+	// SameDomain only follows links to the host of the start URL and its
+	// subdomains.
+	SameDomain bool `json:"same_domain,omitempty"`
+}
+
+func (o *CrawlOptions) Validate() error {
+	if o.MaxDepth < 0 {
+		return errors.New("crawl max_depth must not be negative")
+	}
+	if o.MaxPages < 0 {
+		return errors.New("crawl max_pages must not be negative")
+	}
+	for _, selector := range []string{o.Follow, o.Next} {
+		if selector == "" {
+			continue
+		}
+		if _, err := cascadia.Compile(selector); err != nil {
+			return fmt.Errorf("invalid crawl selector %q: %v", selector, err)
+		}
+	}
+	if o.FollowXpath != "" {
+		if _, err := xpath.Compile(o.FollowXpath); err != nil {
+			return fmt.Errorf("invalid crawl xpath %q: %v", o.FollowXpath, err)
+		}
+	}
+	if o.FollowPattern != "" {
+		if _, err := regexp.Compile(o.FollowPattern); err != nil {
+			return fmt.Errorf("invalid crawl pattern %q: %v", o.FollowPattern, err)
+		}
+	}
+	return nil
+}
+
+// IsExpanded reports whether the source expands into other URLs at run time.
+func (s *UrlSource) IsExpanded() bool {
+	return s.Type == SourceTypeSitemap || s.Type == SourceTypeFeed
+}
+
+func (s *UrlSource) Validate() error {
+	if s.Type < SourceTypeUnknown || s.Type > SourceTypeUpload {
+		return fmt.Errorf("unknown source type %d", s.Type)
+	}
+	if s.MaxURLs < 0 {
+		return errors.New("max_urls must not be negative")
+	}
+	if s.Crawl != nil {
+		if s.Type != SourceTypeCrawl {
+			return errors.New("crawl options are only allowed on crawl sources")
+		}
+		if err := s.Crawl.Validate(); err != nil {
+			return err
+		}
+	}
+	if s.Api != nil {
+		if s.Type != SourceTypeApi {
+			return errors.New("api options are only allowed on api sources")
+		}
+		if err := s.Api.Validate(); err != nil {
+			return err
+		}
+	}
+	if s.Type == SourceTypeUpload {
+		if _, err := gocql.ParseUUID(s.Upload); err != nil {
+			return fmt.Errorf("invalid upload %q", s.Upload)
+		}
+	} else if s.Upload != "" {
+		return errors.New("upload is only allowed on upload sources")
+	}
+	return nil
 }
 
 type AutoTarget struct {
@@ -98,6 +357,23 @@ type Target struct {
 	Type  TargetType `json:"type"`
 	Name  string     `json:"name,omitempty"`
 	Value string     `json:"value"`
+	// Scope is a CSS selector for repeated blocks, such as product cards, or
+	// the JSONPath of repeated items for JSONPath targets. Targets with a
+	// scope are evaluated within each block and every block produces one
+	// record.
+	Scope string `json:"scope,omitempty"`
+	// Flags are the flags of regex targets: i for case-insensitive matching,
+	// m for multiline mode and s to let . match newlines.
+	Flags string `json:"flags,omitempty"`
+	// Table locates the table of table targets, whose value is a CSS
+	// selector for the candidate tables, and maps its columns to fields.
+	Table *TableOptions `json:"table,omitempty"`
+	// SchemaType keeps only the structured data items of this @type, such
+	// as Product or Offer, for structured targets, whose value is the path
+	// of a field such as offers.price.
+	SchemaType string `json:"schema_type,omitempty"`
+	// Process is applied to every extracted value, step by step.
+	Process []ProcessStep `json:"process,omitempty"`
 }
 
 type Output struct {
@@ -107,11 +383,203 @@ type Output struct {
 }
 
 type TaskDefinition struct {
-	Type   TaskRunType `json:"type"`
-	Source []UrlSource `json:"source"`
-	Target []Target    `json:"target"`
-	Output []Output    `json:"output"`
-	Period TaskPeriod  `json:"period"`
+	Type     TaskRunType  `json:"type"`
+	Source   []UrlSource  `json:"source"`
+	Target   []Target     `json:"target"`
+	Output   []Output     `json:"output"`
+	Period   TaskPeriod   `json:"period"`
+	Cron     string       `json:"cron,omitempty"`
+	Timezone string       `json:"timezone,omitempty"`
+	Retry    *RetryPolicy `json:"retry,omitempty"`
+	// MaxRunDurationSeconds overrides the system default for how long a run
+	// may stay running before it is failed.
+	MaxRunDurationSeconds int `json:"max_run_duration_seconds,omitempty"`
+	// ConcurrencyPolicy decides what happens to a new run while an earlier
+	// run of the task is still active.
+	ConcurrencyPolicy ConcurrencyPolicy `json:"concurrency_policy,omitempty"`
+	// SourceParallelism caps how many sources of a run are fetched at a time,
+	// zero uses the worker default.
+	SourceParallelism int `json:"source_parallelism,omitempty"`
+}
+
+// TaskRunOverrides replace parts of a task definition for a single run.
+type TaskRunOverrides struct {
+	// Source replaces the sources of the task.
+	Source []UrlSource `json:"source,omitempty"`
+	// ExtraTarget is extracted in addition to the targets of the task.
+	ExtraTarget []Target `json:"extra_target,omitempty"`
+	// Output replaces the outputs of the task.
+	Output []Output `json:"output,omitempty"`
+}
+
+// IsEmpty reports whether the overrides leave the definition unchanged.
+func (o *TaskRunOverrides) IsEmpty() bool {
+	return len(o.Source) == 0 && len(o.ExtraTarget) == 0 && len(o.Output) == 0
+}
+
+// Apply returns a copy of the definition with the overrides applied.
+func (o *TaskRunOverrides) Apply(d TaskDefinition) TaskDefinition {
+	if len(o.Source) > 0 {
+		d.Source = o.Source
+	}
+	if len(o.ExtraTarget) > 0 {
+		d.Target = append(append([]Target{}, d.Target...), o.ExtraTarget...)
+	}
+	if len(o.Output) > 0 {
+		d.Output = o.Output
+	}
+	return d
+}
+
+// Validate checks that the target can be evaluated.
+func (t *Target) Validate() error {
+	switch t.Type {
+	case TargetTypeXpath:
+		if t.Name == "" {
+			return errors.New("xpath target must have a name")
+		}
+		if _, err := xpath.Compile(t.Value); err != nil {
+			return fmt.Errorf("invalid xpath %q of target %q: %v", t.Value, t.Name, err)
+		}
+	case TargetTypeQuery:
+		if t.Name == "" {
+			return errors.New("query target must have a name")
+		}
+		if _, err := ParseQuerySelector(t.Value); err != nil {
+			return fmt.Errorf("target %q: %v", t.Name, err)
+		}
+		if t.Scope != "" {
+			if _, err := cascadia.Compile(t.Scope); err != nil {
+				return fmt.Errorf("invalid scope %q of target %q: %v", t.Scope, t.Name, err)
+			}
+		}
+	case TargetTypeTable:
+		if t.Value != "" {
+			if _, err := cascadia.Compile(t.Value); err != nil {
+				return fmt.Errorf("invalid selector %q of target %q: %v", t.Value, t.Name, err)
+			}
+		}
+		if t.Table != nil {
+			if err := t.Table.Validate(); err != nil {
+				return fmt.Errorf("target %q: %v", t.Name, err)
+			}
+		}
+	case TargetTypeJsonPath:
+		if t.Name == "" {
+			return errors.New("jsonpath target must have a name")
+		}
+		if _, err := jsonpath.Compile(t.Value); err != nil {
+			return fmt.Errorf("target %q: %v", t.Name, err)
+		}
+		if t.Scope != "" {
+			if _, err := jsonpath.Compile(t.Scope); err != nil {
+				return fmt.Errorf("invalid scope of target %q: %v", t.Name, err)
+			}
+		}
+	case TargetTypeStructured:
+		if t.Name == "" {
+			return errors.New("structured target must have a name")
+		}
+		if t.Value == "" || slices.Contains(strings.Split(t.Value, "."), "") {
+			return fmt.Errorf("invalid field path %q of target %q", t.Value, t.Name)
+		}
+	case TargetTypeRegex:
+		re, err := CompileRegexTarget(t.Value, t.Flags)
+		if err != nil {
+			return fmt.Errorf("target %q: %v", t.Name, err)
+		}
+		if t.Name == "" && !HasNamedGroups(re) {
+			return errors.New("regex target must have a name or named groups")
+		}
+	}
+	for _, step := range t.Process {
+		if err := step.Validate(); err != nil {
+			return fmt.Errorf("target %q: %v", t.Name, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks the overrides on their own. Rules that span several targets
+// are only checked by validating the definition they are applied to.
+func (o *TaskRunOverrides) Validate() error {
+	for _, source := range o.Source {
+		// Upload sources do not need a URL
+		if source.Type != SourceTypeUpload || source.URL != "" {
+			if _, err := url.ParseRequestURI(source.URL); err != nil {
+				return fmt.Errorf("invalid source url %q", source.URL)
+			}
+		}
+		if err := source.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, target := range o.ExtraTarget {
+		if err := target.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, output := range o.Output {
+		if output.Type <= OutputTypeUnknown || output.Type > OutputTypeMarkdown {
+			return fmt.Errorf("unknown output type %d", output.Type)
+		}
+	}
+	return nil
+}
+
+// Schedule returns the schedule of the task definition, or nil if the task
+// does not run periodically. A cron expression takes precedence over Period.
+func (d *TaskDefinition) Schedule() (Schedule, error) {
+	if d.Cron != "" {
+		return ParseCronSchedule(d.Cron, d.Timezone)
+	}
+	if d.Timezone != "" {
+		return nil, errors.New("timezone is only supported together with a cron expression")
+	}
+	if !d.Period.IsPeriodic() {
+		return nil, nil
+	}
+	return periodSchedule{period: d.Period}, nil
+}
+
+// Validate checks the parts of the definition that cannot be expressed by its
+// JSON structure alone.
+func (d *TaskDefinition) Validate() error {
+	if _, err := d.Schedule(); err != nil {
+		return err
+	}
+	if d.Retry != nil {
+		if err := d.Retry.Validate(); err != nil {
+			return err
+		}
+	}
+	if d.MaxRunDurationSeconds < 0 {
+		return errors.New("max_run_duration_seconds must not be negative")
+	}
+	if !d.ConcurrencyPolicy.IsValid() {
+		return fmt.Errorf("unknown concurrency policy %q", d.ConcurrencyPolicy)
+	}
+	if d.SourceParallelism < 0 {
+		return errors.New("source_parallelism must not be negative")
+	}
+	for _, source := range d.Source {
+		if err := source.Validate(); err != nil {
+			return err
+		}
+	}
+	scopes := map[TargetType]string{}
+	for _, target := range d.Target {
+		if err := target.Validate(); err != nil {
+			return err
+		}
+		if target.Scope != "" {
+			if scope, ok := scopes[target.Type]; ok && target.Scope != scope {
+				return errors.New("targets of the same type must share the same scope")
+			}
+			scopes[target.Type] = target.Scope
+		}
+	}
+	return nil
 }
 
 type Task struct {
@@ -121,6 +589,17 @@ type Task struct {
 	TaskDefinition json.RawMessage `json:"task_definition" gorm:"type:jsonb"`
 	Status         TaskStatus      `json:"status"`
 	AirflowTaskId  string          `json:"airflow_task_id"`
+	Paused         bool            `json:"paused"`
+	ResumeAt       *time.Time      `json:"resume_at"`
+}
+
+// Definition decodes the task definition stored on the task.
+func (t *Task) Definition() (*TaskDefinition, error) {
+	var definition TaskDefinition
+	if err := sonic.Unmarshal(t.TaskDefinition, &definition); err != nil {
+		return nil, fmt.Errorf("failed to decode task definition: %w", err)
+	}
+	return &definition, nil
 }
 
 func GetAllTasks(ctx context.Context) ([]Task, error) {
@@ -132,6 +611,17 @@ func GetAllTasks(ctx context.Context) ([]Task, error) {
 	return tasks, nil
 }
 
+// GetSchedulableTasks returns the tasks that have not been cancelled or
+// failed and may therefore still be fired by the scheduler.
+func GetSchedulableTasks(ctx context.Context) ([]Task, error) {
+	var tasks []Task
+	result := db.WithContext(ctx).Where("status NOT IN ?", []TaskStatus{TaskStatusCancelled, TaskStatusFailed}).Find(&tasks)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return tasks, nil
+}
+
 func GetTasksByUserId(ctx context.Context, uid string) ([]Task, error) {
 	var tasks []Task
 	result := db.WithContext(ctx).Where("owner = ?", uid).Find(&tasks)
@@ -169,10 +659,40 @@ func UpdateTask(ctx context.Context, task Task) (*Task, error) {
 	return &task, nil
 }
 
+// PauseTask stops the scheduler from firing the task until it is resumed,
+// automatically at resumeAt if it is set.
+func PauseTask(ctx context.Context, taskID uint64, resumeAt *time.Time) error {
+	result := db.WithContext(ctx).Model(&Task{}).Where("id = ?", taskID).
+		Updates(map[string]interface{}{"paused": true, "resume_at": resumeAt})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("no task found with the given ID")
+	}
+	return nil
+}
+
+// ResumeTask unpauses the task and resets its schedule, so that slots missed
+// while it was paused are not fired.
+func ResumeTask(ctx context.Context, taskID uint64) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Task{}).Where("id = ?", taskID).
+			Updates(map[string]interface{}{"paused": false, "resume_at": nil})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("no task found with the given ID")
+		}
+		return tx.Unscoped().Where("task_id = ?", taskID).Delete(&TaskSchedule{}).Error
+	})
+}
+
 func DeleteTask(ctx context.Context, taskID uint64) error {
 	result := db.WithContext(ctx).Delete(&Task{}, taskID)
 	if result.Error != nil {
 		return result.Error
 	}
 	return nil
-}
\ No newline at end of file
+}
@@ -2,7 +2,9 @@ package models
 
 import (
 	"context"
+	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/bytedance/sonic"
 	"github.com/stretchr/testify/assert"
@@ -224,3 +226,184 @@ func TestTaskDefinition(t *testing.T) {
 
 	assert.Equal(t, td, unmarshaledTD)
 }
+
+func TestTaskDefinitionSchedule(t *testing.T) {
+	from := time.Date(2026, 1, 31, 9, 30, 15, 500, time.UTC)
+
+	tests := []struct {
+		period   TaskPeriod
+		expected time.Time
+	}{
+		{TaskPeriodMinutely, time.Date(2026, 1, 31, 9, 31, 15, 0, time.UTC)},
+		{TaskPeriodHourly, time.Date(2026, 1, 31, 10, 30, 15, 0, time.UTC)},
+		{TaskPeriodDaily, time.Date(2026, 2, 1, 9, 30, 15, 0, time.UTC)},
+		{TaskPeriodWeekly, time.Date(2026, 2, 7, 9, 30, 15, 0, time.UTC)},
+		{TaskPeriodMonthly, time.Date(2026, 3, 3, 9, 30, 15, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		td := TaskDefinition{Period: tt.period}
+		schedule, err := td.Schedule()
+		require.NoError(t, err)
+		require.NotNil(t, schedule)
+		assert.Equal(t, tt.expected, schedule.Next(from), "period %d", tt.period)
+	}
+
+	for _, period := range []TaskPeriod{TaskPeriodUnknown, TaskPeriodSingle} {
+		td := TaskDefinition{Period: period}
+		schedule, err := td.Schedule()
+		assert.NoError(t, err)
+		assert.Nil(t, schedule)
+	}
+}
+
+func TestTaskDefinitionCronSchedule(t *testing.T) {
+	t.Run("Five field expression in timezone", func(t *testing.T) {
+		td := TaskDefinition{Period: TaskPeriodHourly, Cron: "30 2 * * *", Timezone: "America/New_York"}
+		schedule, err := td.Schedule()
+		require.NoError(t, err)
+
+		// Cron takes precedence over the period
+		assert.Equal(t, "cron:30 2 * * *@America/New_York", schedule.String())
+
+		// 02:30 does not exist on the day clocks spring forward, so the next fire is the day after
+		from := time.Date(2026, 3, 7, 12, 0, 0, 0, time.UTC)
+		next := schedule.Next(from)
+		assert.Equal(t, time.Date(2026, 3, 9, 6, 30, 0, 0, time.UTC), next)
+	})
+
+	t.Run("Six field expression with seconds", func(t *testing.T) {
+		td := TaskDefinition{Cron: "15 */10 * * * *"}
+		schedule, err := td.Schedule()
+		require.NoError(t, err)
+
+		next := schedule.Next(time.Date(2026, 1, 1, 9, 0, 20, 0, time.UTC))
+		assert.Equal(t, time.Date(2026, 1, 1, 9, 10, 15, 0, time.UTC), next)
+	})
+
+	t.Run("Invalid definitions", func(t *testing.T) {
+		invalid := []TaskDefinition{
+			{Cron: "* * *"},
+			{Cron: "0 9 * * *", Timezone: "Mars/Olympus"},
+			{Cron: "CRON_TZ=UTC 0 9 * * *"},
+			{Period: TaskPeriodDaily, Timezone: "Europe/London"},
+			{Target: []Target{{Type: TargetTypeXpath, Name: "title", Value: "//h1["}}},
+			{Target: []Target{{Type: TargetTypeXpath, Value: "//h1"}}},
+			{Target: []Target{{Type: TargetTypeQuery, Name: "title", Value: "h1["}}},
+			{Target: []Target{{Type: TargetTypeQuery, Value: "h1"}}},
+			{Target: []Target{{Type: TargetTypeQuery, Name: "link", Value: "a::attr()"}}},
+			{Target: []Target{{Type: TargetTypeQuery, Name: "title", Value: "h1", Process: []ProcessStep{{Op: ProcessRegex, Pattern: "("}}}}},
+			{Target: []Target{{Type: TargetTypeQuery, Name: "title", Value: "h1", Process: []ProcessStep{{Op: "upper"}}}}},
+			{Source: []UrlSource{{Type: SourceType(9), URL: "https://example.com"}}},
+			{Source: []UrlSource{{Type: SourceTypeSitemap, URL: "https://example.com/sitemap.xml", MaxURLs: -1}}},
+			{Source: []UrlSource{{Type: SourceTypeCrawl, URL: "https://example.com", Crawl: &CrawlOptions{Follow: "a["}}}},
+			{Source: []UrlSource{{Type: SourceTypeCrawl, URL: "https://example.com", Crawl: &CrawlOptions{FollowPattern: "(", MaxDepth: 2}}}},
+			{Source: []UrlSource{{Type: SourceTypeCrawl, URL: "https://example.com", Crawl: &CrawlOptions{MaxPages: -1}}}},
+			{Source: []UrlSource{{Type: SourceTypeUrl, URL: "https://example.com", Crawl: &CrawlOptions{}}}},
+			{Source: []UrlSource{{Type: SourceTypeApi, URL: "https://example.com/api", Api: &ApiOptions{Method: "DELETE"}}}},
+			{Source: []UrlSource{{Type: SourceTypeApi, URL: "https://example.com/api", Api: &ApiOptions{Body: json.RawMessage(`{"q":`)}}}},
+			{Source: []UrlSource{{Type: SourceTypeApi, URL: "https://example.com/api", Api: &ApiOptions{Pagination: &ApiPagination{Type: ApiPaginationCursor, Param: "cursor"}}}}},
+			{Source: []UrlSource{{Type: SourceTypeApi, URL: "https://example.com/api", Api: &ApiOptions{Pagination: &ApiPagination{Type: ApiPaginationOffset, Param: "offset", ItemsPath: "$.items"}}}}},
+			{Source: []UrlSource{{Type: SourceTypeApi, URL: "https://example.com/api", Api: &ApiOptions{Pagination: &ApiPagination{Type: "page"}}}}},
+			{Source: []UrlSource{{Type: SourceTypeUpload}}},
+			{Source: []UrlSource{{Type: SourceTypeUpload, Upload: "listings.csv"}}},
+			{Source: []UrlSource{{Type: SourceTypeUrl, URL: "https://example.com", Upload: "6f1c2a4e-5a3f-11ef-8000-000000000002"}}},
+			{Target: []Target{{Type: TargetTypeJsonPath, Value: "$.items[*].id"}}},
+			{Target: []Target{{Type: TargetTypeJsonPath, Name: "id", Value: "$.items[*"}}},
+			{Target: []Target{{Type: TargetTypeJsonPath, Name: "id", Value: "$.id", Scope: "$.items["}}},
+			{Target: []Target{{Type: TargetTypeStructured, Value: "offers.price", SchemaType: "Product"}}},
+			{Target: []Target{{Type: TargetTypeStructured, Name: "price", Value: "offers..price"}}},
+			{Target: []Target{{Type: TargetTypeTable, Name: "rents", Value: "table["}}},
+			{Target: []Target{{Type: TargetTypeTable, Name: "rents", Table: &TableOptions{Index: -1}}}},
+			{Target: []Target{{Type: TargetTypeTable, Name: "rents", Table: &TableOptions{Header: "last"}}}},
+			{Target: []Target{{Type: TargetTypeTable, Name: "rents", Table: &TableOptions{Columns: map[string]string{"City": ""}}}}},
+			{Target: []Target{{Type: TargetTypeRegex, Name: "status", Value: `(\d+`}}},
+			{Target: []Target{{Type: TargetTypeRegex, Name: "status", Value: `(?<!x)\d+`}}},
+			{Target: []Target{{Type: TargetTypeRegex, Name: "status", Value: `\d+`, Flags: "g"}}},
+			{Target: []Target{{Type: TargetTypeRegex, Value: `\d+`}}},
+			{Target: []Target{{Type: TargetTypeRegex, Name: "status"}}},
+			{Target: []Target{
+				{Type: TargetTypeQuery, Name: "title", Value: "h2", Scope: ".product"},
+				{Type: TargetTypeQuery, Name: "price", Value: ".price", Scope: ".listing"},
+			}},
+		}
+		for _, td := range invalid {
+			assert.Error(t, td.Validate(), "cron %q timezone %q", td.Cron, td.Timezone)
+		}
+	})
+
+	t.Run("Regex targets report compile errors", func(t *testing.T) {
+		td := TaskDefinition{Target: []Target{{Type: TargetTypeRegex, Value: `(?P<status>\d+) (?P<bytes>\d+`, Flags: "i"}}}
+		err := td.Validate()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "missing closing )")
+
+		td.Target[0].Value = `(?P<status>\d+) (?P<bytes>\d+)`
+		assert.NoError(t, td.Validate())
+	})
+}
+
+func TestTaskRunOverrides(t *testing.T) {
+	definition := TaskDefinition{
+		Source: []UrlSource{{Type: SourceTypeUrl, URL: "https://example.com"}},
+		Target: []Target{{Type: TargetTypeAuto, Value: "titles"}},
+		Output: []Output{{Type: OutputTypeJson}},
+		Period: TaskPeriodDaily,
+	}
+
+	t.Run("Overrides are applied to a copy", func(t *testing.T) {
+		overrides := TaskRunOverrides{
+			Source:      []UrlSource{{Type: SourceTypeUrl, URL: "https://example.org"}},
+			ExtraTarget: []Target{{Type: TargetTypeAuto, Value: "prices"}},
+			Output:      []Output{{Type: OutputTypeCsv}},
+		}
+		require.NoError(t, overrides.Validate())
+
+		effective := overrides.Apply(definition)
+		assert.Equal(t, "https://example.org", effective.Source[0].URL)
+		assert.Len(t, effective.Target, 2)
+		assert.Equal(t, OutputTypeCsv, effective.Output[0].Type)
+		assert.Equal(t, TaskPeriodDaily, effective.Period)
+
+		assert.Equal(t, "https://example.com", definition.Source[0].URL)
+		assert.Len(t, definition.Target, 1)
+	})
+
+	t.Run("Effective definition of a run", func(t *testing.T) {
+		definitionJSON, err := sonic.Marshal(definition)
+		require.NoError(t, err)
+		task := &Task{TaskDefinition: definitionJSON}
+
+		plain, err := (&TaskRun{}).EffectiveDefinition(task)
+		require.NoError(t, err)
+		assert.Equal(t, definition.Source, plain.Source)
+
+		overridden, err := (&TaskRun{Overrides: []byte(`{"output":[{"type":4}]}`)}).EffectiveDefinition(task)
+		require.NoError(t, err)
+		assert.Equal(t, OutputTypeMarkdown, overridden.Output[0].Type)
+		assert.Equal(t, definition.Source, overridden.Source)
+	})
+
+	t.Run("Invalid overrides", func(t *testing.T) {
+		invalid := []TaskRunOverrides{
+			{Source: []UrlSource{{Type: SourceTypeUrl, URL: "not a url"}}},
+			{ExtraTarget: []Target{{Type: TargetTypeXpath, Name: "price", Value: "//div["}}},
+			{Output: []Output{{Type: OutputType(42)}}},
+		}
+		for _, overrides := range invalid {
+			assert.Error(t, overrides.Validate())
+		}
+
+		// Upload sources do not need a URL
+		overrides := TaskRunOverrides{Source: []UrlSource{{Type: SourceTypeUpload, Upload: "6f1c2a4e-5a3f-11ef-8000-000000000002"}}}
+		assert.NoError(t, overrides.Validate())
+
+		// Table targets locate their table without a selector
+		overrides = TaskRunOverrides{ExtraTarget: []Target{{Type: TargetTypeTable, Name: "rents", Table: &TableOptions{Index: 1}}}}
+		assert.NoError(t, overrides.Validate())
+	})
+}
+
+func TestTaskUploadsID(t *testing.T) {
+	assert.Equal(t, TaskUploadsID(1), TaskUploadsID(1))
+	assert.NotEqual(t, TaskUploadsID(1), TaskUploadsID(2))
+}
@@ -1,11 +1,60 @@
 package models
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/gocql/gocql"
+	"github.com/google/uuid"
 )
 
+const (
+	// ArtifactTypeRaw artifacts hold a fetched document.
+	ArtifactTypeRaw = "raw"
+	// ArtifactTypeRecords artifacts hold the records extracted from a
+	// document, encoded as JSON.
+	ArtifactTypeRecords = "records"
+	// ArtifactTypeFrontier artifacts hold the pages discovered by a crawl
+	// source, encoded as JSON.
+	ArtifactTypeFrontier = "frontier"
+	// ArtifactTypeUpload artifacts hold a file uploaded to a task, to be read
+	// by its upload sources.
+	ArtifactTypeUpload = "upload"
+	// ArtifactTypeSkipped artifacts record a URL that was not fetched, with
+	// the reason in their additional data.
+	ArtifactTypeSkipped = "skipped"
+)
+
+const (
+	// ArtifactDataSourceIndex and ArtifactDataSourceURL tag the artifacts of
+	// a run with the source of the definition they were produced from.
+	ArtifactDataSourceIndex = "source_index"
+	ArtifactDataSourceURL   = "source_url"
+	// ArtifactDataCrawlDepth tags the artifacts of the pages of a crawl
+	// source with how many links away from its start URL they are.
+	ArtifactDataCrawlDepth = "crawl_depth"
+	// ArtifactDataApiPage tags the artifacts of the pages of an API source
+	// with the page number, starting at 0.
+	ArtifactDataApiPage = "api_page"
+	// ArtifactDataFilename is the name of an uploaded file, and
+	// ArtifactDataUploadID tags the artifacts of an upload source with the
+	// upload they were produced from.
+	ArtifactDataFilename = "filename"
+	ArtifactDataUploadID = "upload_id"
+	// ArtifactDataReason is why the URL of a skipped artifact was not fetched.
+	ArtifactDataReason = "reason"
+)
+
+// uploadsNamespace is the namespace of the ids of the upload partitions.
+var uploadsNamespace = uuid.MustParse("5c1d7a52-3f0e-4b8e-9d0a-6e2f4c7b1a90")
+
+// TaskUploadsID returns the instance id the uploads of a task are stored
+// under. It is derived from the task id, so that the files uploaded to a task
+// can be listed and read without storing the id on the task.
+func TaskUploadsID(taskID uint) gocql.UUID {
+	return gocql.UUID(uuid.NewSHA1(uploadsNamespace, []byte(fmt.Sprintf("task/%d/uploads", taskID))))
+}
+
 type TaskRunArtifact struct {
 	AirflowInstanceID gocql.UUID
 	AirflowTaskID     gocql.UUID
@@ -58,11 +107,15 @@ func (c *TaskRunArtifactRepository) ListArtifactsByTaskRunID(airflowInstanceId g
 		OFFSET ?
 	`
 	iter := c.session.Query(query, airflowInstanceId, limit, offset).Iter()
-	var artifact TaskRunArtifact
-	for iter.Scan(
-		&artifact.AirflowInstanceID, &artifact.AirflowTaskID, &artifact.ArtifactID, &artifact.CreatedAt,
-		&artifact.ArtifactType, &artifact.URL, &artifact.ContentType, &artifact.ContentLength,
-		&artifact.StatusCode, &artifact.S3Bucket, &artifact.S3Key, &artifact.AdditionalData) {
+	for {
+		// Every row gets its own artifact, as the slice keeps pointers to them
+		var artifact TaskRunArtifact
+		if !iter.Scan(
+			&artifact.AirflowInstanceID, &artifact.AirflowTaskID, &artifact.ArtifactID, &artifact.CreatedAt,
+			&artifact.ArtifactType, &artifact.URL, &artifact.ContentType, &artifact.ContentLength,
+			&artifact.StatusCode, &artifact.S3Bucket, &artifact.S3Key, &artifact.AdditionalData) {
+			break
+		}
 		artifacts = append(artifacts, &artifact)
 	}
 	if err := iter.Close(); err != nil {
@@ -70,3 +123,23 @@ func (c *TaskRunArtifactRepository) ListArtifactsByTaskRunID(airflowInstanceId g
 	}
 	return artifacts, nil
 }
+
+// GetArtifact returns an artifact of an instance, or gocql.ErrNotFound if it
+// does not exist.
+func (c *TaskRunArtifactRepository) GetArtifact(airflowInstanceId gocql.UUID, artifactId gocql.UUID) (*TaskRunArtifact, error) {
+	var artifact TaskRunArtifact
+	query := `
+		SELECT airflow_instance_id, airflow_task_id, artifact_id, created_at, artifact_type, url, content_type, 
+			   content_length, status_code, s3_bucket, s3_key, additional_data
+		FROM task_run_artifacts
+		WHERE airflow_instance_id = ? AND artifact_id = ?
+	`
+	err := c.session.Query(query, airflowInstanceId, artifactId).Scan(
+		&artifact.AirflowInstanceID, &artifact.AirflowTaskID, &artifact.ArtifactID, &artifact.CreatedAt,
+		&artifact.ArtifactType, &artifact.URL, &artifact.ContentType, &artifact.ContentLength,
+		&artifact.StatusCode, &artifact.S3Bucket, &artifact.S3Key, &artifact.AdditionalData)
+	if err != nil {
+		return nil, err
+	}
+	return &artifact, nil
+}
@@ -3,10 +3,13 @@ package models
 import (
 	"context"
 	"database/sql/driver"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
 
+	apperrors "admin-api/errors"
+
 	"github.com/bytedance/sonic"
 	"gorm.io/gorm"
 )
@@ -38,6 +41,11 @@ func (r TaskStatus) Value() (driver.Value, error) {
 	return int64(r), nil
 }
 
+// IsFinished reports whether a run with this status has stopped for good.
+func (r TaskStatus) IsFinished() bool {
+	return r == TaskStatusComplete || r == TaskStatusFailed || r == TaskStatusCancelled
+}
+
 // UnmarshalJSON implements the json.Unmarshaler interface
 func (r *TaskStatus) UnmarshalJSON(data []byte) error {
 	var v int64
@@ -55,12 +63,64 @@ func (r *TaskStatus) UnmarshalJSON(data []byte) error {
 
 type TaskRun struct {
 	gorm.Model
-	TaskID            uint       `json:"task_id" gorm:"foreignKey:ID,index:idx_task_id"`
-	AirflowInstanceID string     `json:"airflow_instance_id"`
-	Status            TaskStatus `json:"status"`
-	StartTime         time.Time  `json:"start_time"`
-	EndTime           time.Time  `json:"end_time"`
-	ErrorMessage      string     `json:"error_message"`
+	TaskID            uint        `json:"task_id" gorm:"foreignKey:ID,index:idx_task_id"`
+	Type              TaskRunType `json:"type"`
+	AirflowInstanceID string      `json:"airflow_instance_id"`
+	Status            TaskStatus  `json:"status"`
+	StartTime         time.Time   `json:"start_time"`
+	EndTime           time.Time   `json:"end_time"`
+	ErrorMessage      string      `json:"error_message"`
+	ErrorClass        ErrorClass  `json:"error_class"`
+	Attempt           int         `json:"attempt"`
+	ParentRunID       *uint       `json:"parent_run_id" gorm:"index:idx_parent_run_id"`
+	NotBefore         time.Time   `json:"not_before"`
+	HeartbeatAt       time.Time   `json:"heartbeat_at"`
+	CancelledBy       string      `json:"cancelled_by"`
+	CancelledAt       time.Time   `json:"cancelled_at"`
+	// Overrides holds the TaskRunOverrides of a manually triggered run.
+	Overrides json.RawMessage `json:"overrides,omitempty" gorm:"type:jsonb"`
+	// BackfillID, WindowStart and WindowEnd are set on the runs of a backfill.
+	BackfillID  *uint     `json:"backfill_id" gorm:"index:idx_backfill_id"`
+	WindowStart time.Time `json:"window_start"`
+	WindowEnd   time.Time `json:"window_end"`
+	// PipelineRunID and PipelineNodeKey are set on the runs of a pipeline.
+	PipelineRunID   *uint  `json:"pipeline_run_id" gorm:"index:idx_pipeline_run_id"`
+	PipelineNodeKey string `json:"pipeline_node_key"`
+	// SourcesSucceeded and SourcesFailed count the sources of the definition
+	// the worker processed, and SourceErrors holds the []SourceError of the
+	// failed ones. SourcesSkipped counts the sources that were not fetched
+	// because robots.txt disallows them.
+	SourcesSucceeded int             `json:"sources_succeeded"`
+	SourcesFailed    int             `json:"sources_failed"`
+	SourcesSkipped   int             `json:"sources_skipped"`
+	SourceErrors     json.RawMessage `json:"source_errors,omitempty" gorm:"type:jsonb"`
+}
+
+// SourceError is the failure of one source of a run.
+type SourceError struct {
+	Index      int        `json:"index"`
+	URL        string     `json:"url"`
+	ErrorClass ErrorClass `json:"error_class"`
+	Message    string     `json:"message"`
+}
+
+// EffectiveDefinition returns the definition the run executes: the definition
+// of its task with the run's overrides applied.
+func (r *TaskRun) EffectiveDefinition(task *Task) (*TaskDefinition, error) {
+	definition, err := task.Definition()
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Overrides) == 0 {
+		return definition, nil
+	}
+
+	var overrides TaskRunOverrides
+	if err := sonic.Unmarshal(r.Overrides, &overrides); err != nil {
+		return nil, fmt.Errorf("failed to decode task run overrides: %w", err)
+	}
+	effective := overrides.Apply(*definition)
+	return &effective, nil
 }
 
 func ListRunsForTask(ctx context.Context, taskUid uint64) ([]TaskRun, error) {
@@ -77,7 +137,7 @@ func GetTaskRun(ctx context.Context, uid uint64) (*TaskRun, error) {
 	result := db.WithContext(ctx).Where("id = ?", uid).First(&run)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return nil, fmt.Errorf("task not found")
+			return nil, fmt.Errorf("%w: %d", apperrors.ErrTaskRunNotFound, uid)
 		}
 		return nil, result.Error
 	}
@@ -96,6 +156,57 @@ func GetLatestRunForTask(ctx context.Context, uid uint64) (*TaskRun, error) {
 	return run, nil
 }
 
+// GetPreviousCompletedTaskRun returns the latest complete run of the task
+// created before the given run, or nil if there is none.
+func GetPreviousCompletedTaskRun(ctx context.Context, taskID uint64, taskRunID uint64) (*TaskRun, error) {
+	var run *TaskRun
+	result := db.WithContext(ctx).Order("id desc").
+		Where("task_id = ? AND id < ? AND status = ?", taskID, taskRunID, TaskStatusComplete).First(&run)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return run, nil
+}
+
+// GetRetryOfTaskRun returns the run created to retry the given run, or nil if
+// it has not been retried.
+func GetRetryOfTaskRun(ctx context.Context, parentRunID uint64) (*TaskRun, error) {
+	var run *TaskRun
+	result := db.WithContext(ctx).Where("parent_run_id = ?", parentRunID).First(&run)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return run, nil
+}
+
+func ListRunningTaskRuns(ctx context.Context) ([]TaskRun, error) {
+	var taskRuns []TaskRun
+	result := db.WithContext(ctx).Where("status = ?", TaskStatusRunning).Find(&taskRuns)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return taskRuns, nil
+}
+
+// ListStaleCreatedTaskRuns returns the created task runs that were due before
+// cutoff and have not been updated since, i.e. runs that no worker started.
+func ListStaleCreatedTaskRuns(ctx context.Context, cutoff time.Time) ([]TaskRun, error) {
+	var taskRuns []TaskRun
+	result := db.WithContext(ctx).
+		Where("status = ? AND updated_at < ? AND not_before < ?", TaskStatusCreated, cutoff, cutoff).
+		Find(&taskRuns)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return taskRuns, nil
+}
+
 func CreateTaskRun(ctx context.Context, taskRun TaskRun) (*TaskRun, error) {
 	result := db.WithContext(ctx).Create(&taskRun)
 	if result.Error != nil {
@@ -114,3 +225,139 @@ func UpdateTaskRun(ctx context.Context, taskRun TaskRun, taskRunID uint64) (*Tas
 	}
 	return &taskRun, nil
 }
+
+// FinishRunningTaskRun records the outcome of a task run if it is still
+// running. It reports false if the run was cancelled or timed out in the
+// meantime.
+func FinishRunningTaskRun(ctx context.Context, taskRun TaskRun, taskRunID uint64) (bool, error) {
+	result := db.WithContext(ctx).Model(&TaskRun{}).
+		Where("id = ? AND status = ?", taskRunID, TaskStatusRunning).
+		Updates(taskRun)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func HeartbeatTaskRun(ctx context.Context, taskRunID uint64, heartbeatAt time.Time) error {
+	result := db.WithContext(ctx).Model(&TaskRun{}).Where("id = ?", taskRunID).Update("heartbeat_at", heartbeatAt)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("no task run found with the given ID")
+	}
+	return nil
+}
+
+// FailRunningTaskRun marks a task run as failed if it is still running. It
+// reports false if the run finished in the meantime.
+func FailRunningTaskRun(ctx context.Context, taskRunID uint64, errorClass ErrorClass, errorMessage string, endTime time.Time) (bool, error) {
+	return failTaskRun(ctx, taskRunID, TaskStatusRunning, errorClass, errorMessage, endTime)
+}
+
+// FailCreatedTaskRun marks a task run as failed if no worker has started it
+// yet. It reports false if the run was started or finished in the meantime.
+func FailCreatedTaskRun(ctx context.Context, taskRunID uint64, errorClass ErrorClass, errorMessage string, endTime time.Time) (bool, error) {
+	return failTaskRun(ctx, taskRunID, TaskStatusCreated, errorClass, errorMessage, endTime)
+}
+
+func failTaskRun(ctx context.Context, taskRunID uint64, status TaskStatus, errorClass ErrorClass, errorMessage string, endTime time.Time) (bool, error) {
+	result := db.WithContext(ctx).Model(&TaskRun{}).
+		Where("id = ? AND status = ?", taskRunID, status).
+		Updates(map[string]interface{}{
+			"status":        TaskStatusFailed,
+			"error_class":   errorClass,
+			"error_message": errorMessage,
+			"end_time":      endTime,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// StartTaskRun marks a created task run as running. A run that is already
+// running is started again, as its previous worker stopped before finishing
+// it. It reports false if the run has finished or is still pending.
+func StartTaskRun(ctx context.Context, taskRunID uint64, airflowInstanceID string, startTime time.Time) (bool, error) {
+	result := db.WithContext(ctx).Model(&TaskRun{}).
+		Where("id = ? AND status IN ?", taskRunID, ActiveTaskRunStatuses).
+		Updates(map[string]interface{}{
+			"status":              TaskStatusRunning,
+			"airflow_instance_id": airflowInstanceID,
+			"start_time":          startTime,
+			"heartbeat_at":        startTime,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// CancelTaskRun marks a task run as cancelled unless it has already finished.
+// It reports false if the run was already complete, failed or cancelled.
+func CancelTaskRun(ctx context.Context, taskRunID uint64, cancelledBy string, cancelledAt time.Time) (bool, error) {
+	result := db.WithContext(ctx).Model(&TaskRun{}).
+		Where("id = ? AND status NOT IN ?", taskRunID, []TaskStatus{TaskStatusComplete, TaskStatusFailed, TaskStatusCancelled}).
+		Updates(map[string]interface{}{
+			"status":       TaskStatusCancelled,
+			"cancelled_by": cancelledBy,
+			"cancelled_at": cancelledAt,
+			"end_time":     cancelledAt,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func ListActiveTaskRuns(ctx context.Context, taskID uint64) ([]TaskRun, error) {
+	var taskRuns []TaskRun
+	result := db.WithContext(ctx).Where("task_id = ? AND status IN ?", taskID, ActiveTaskRunStatuses).Find(&taskRuns)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return taskRuns, nil
+}
+
+// CountActiveTaskRunsForOwner counts the active runs across all tasks owned by
+// the given user.
+func CountActiveTaskRunsForOwner(ctx context.Context, owner string) (int64, error) {
+	var count int64
+	result := db.WithContext(ctx).Model(&TaskRun{}).
+		Joins("JOIN tasks ON tasks.id = task_runs.task_id AND tasks.deleted_at IS NULL").
+		Where("tasks.owner = ? AND task_runs.status IN ?", owner, ActiveTaskRunStatuses).
+		Count(&count)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return count, nil
+}
+
+// ListPendingTaskRunsForOwner returns the runs held back by a concurrency
+// limit across all tasks owned by the given user, oldest first.
+func ListPendingTaskRunsForOwner(ctx context.Context, owner string) ([]TaskRun, error) {
+	var taskRuns []TaskRun
+	result := db.WithContext(ctx).
+		Joins("JOIN tasks ON tasks.id = task_runs.task_id AND tasks.deleted_at IS NULL").
+		Where("tasks.owner = ? AND task_runs.status = ?", owner, TaskStatusPending).
+		Order("task_runs.id").
+		Find(&taskRuns)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return taskRuns, nil
+}
+
+// PromotePendingTaskRun moves a pending task run to created. It reports false
+// if the run was no longer pending.
+func PromotePendingTaskRun(ctx context.Context, taskRunID uint64) (bool, error) {
+	result := db.WithContext(ctx).Model(&TaskRun{}).
+		Where("id = ? AND status = ?", taskRunID, TaskStatusPending).
+		Update("status", TaskStatusCreated)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
@@ -5,6 +5,8 @@ import (
 	"testing"
 	"time"
 
+	apperrors "admin-api/errors"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gorm.io/driver/sqlite"
@@ -78,9 +80,8 @@ func TestGetTaskRun(t *testing.T) {
 
 	t.Run("Get non-existing task run", func(t *testing.T) {
 		run, err := GetTaskRun(context.Background(), 999)
-		assert.Error(t, err)
+		assert.ErrorIs(t, err, apperrors.ErrTaskRunNotFound)
 		assert.Nil(t, run)
-		assert.Contains(t, err.Error(), "task not found")
 	})
 }
 
@@ -113,6 +114,35 @@ func TestGetLatestRunForTask(t *testing.T) {
 	})
 }
 
+func TestGetPreviousCompletedTaskRun(t *testing.T) {
+	testDB := setupTestDBForTaskRun(t)
+	defer testDB.Migrator().DropTable(&TaskRun{})
+
+	testRuns := []TaskRun{
+		{TaskID: 1, Status: TaskStatusComplete, StartTime: time.Now().Add(-3 * time.Hour)},
+		{TaskID: 1, Status: TaskStatusComplete, StartTime: time.Now().Add(-2 * time.Hour)},
+		{TaskID: 1, Status: TaskStatusFailed, StartTime: time.Now().Add(-time.Hour)},
+		{TaskID: 1, Status: TaskStatusRunning, StartTime: time.Now()},
+		{TaskID: 1, Status: TaskStatusComplete, StartTime: time.Now()},
+	}
+	for i := range testRuns {
+		require.NoError(t, testDB.Create(&testRuns[i]).Error)
+	}
+
+	t.Run("Latest complete run before the given run", func(t *testing.T) {
+		run, err := GetPreviousCompletedTaskRun(context.Background(), 1, uint64(testRuns[3].ID))
+		require.NoError(t, err)
+		require.NotNil(t, run)
+		assert.Equal(t, testRuns[1].ID, run.ID)
+	})
+
+	t.Run("No previous complete run", func(t *testing.T) {
+		run, err := GetPreviousCompletedTaskRun(context.Background(), 1, uint64(testRuns[0].ID))
+		assert.NoError(t, err)
+		assert.Nil(t, run)
+	})
+}
+
 func TestCreateTaskRun(t *testing.T) {
 	testDB := setupTestDBForTaskRun(t)
 	defer testDB.Migrator().DropTable(&TaskRun{})
@@ -172,3 +202,32 @@ func TestUpdateTaskRun(t *testing.T) {
 	assert.Equal(t, taskRun.EndTime.Unix(), updatedRun.EndTime.Unix())
 	assert.Equal(t, "Completed successfully", updatedRun.ErrorMessage)
 }
+
+func TestFinishRunningTaskRun(t *testing.T) {
+	testDB := setupTestDBForTaskRun(t)
+	defer testDB.Migrator().DropTable(&TaskRun{})
+
+	running := TaskRun{TaskID: 1, Status: TaskStatusRunning}
+	cancelled := TaskRun{TaskID: 1, Status: TaskStatusCancelled}
+	require.NoError(t, testDB.Create(&running).Error)
+	require.NoError(t, testDB.Create(&cancelled).Error)
+
+	update := TaskRun{Status: TaskStatusComplete, EndTime: time.Now(), ErrorMessage: "Completed successfully"}
+
+	finished, err := FinishRunningTaskRun(context.Background(), update, uint64(running.ID))
+	require.NoError(t, err)
+	assert.True(t, finished)
+
+	finished, err = FinishRunningTaskRun(context.Background(), update, uint64(cancelled.ID))
+	require.NoError(t, err)
+	assert.False(t, finished)
+
+	run, err := GetTaskRun(context.Background(), uint64(running.ID))
+	require.NoError(t, err)
+	assert.Equal(t, TaskStatusComplete, run.Status)
+	assert.Equal(t, "Completed successfully", run.ErrorMessage)
+
+	run, err = GetTaskRun(context.Background(), uint64(cancelled.ID))
+	require.NoError(t, err)
+	assert.Equal(t, TaskStatusCancelled, run.Status)
+}
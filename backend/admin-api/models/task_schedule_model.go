@@ -0,0 +1,70 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TaskSchedule holds the scheduler state of a periodic task. It is kept in
+// Postgres so that schedules survive restarts and are shared by all replicas.
+type TaskSchedule struct {
+	gorm.Model
+	TaskID    uint      `json:"task_id" gorm:"uniqueIndex:idx_task_schedule_task_id"`
+	Spec      string    `json:"spec"`
+	NextRunAt time.Time `json:"next_run_at" gorm:"index:idx_task_schedule_next_run_at"`
+	LastRunAt time.Time `json:"last_run_at"`
+}
+
+func GetTaskSchedule(ctx context.Context, taskID uint64) (*TaskSchedule, error) {
+	var schedule *TaskSchedule
+	result := db.WithContext(ctx).Where("task_id = ?", taskID).First(&schedule)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return schedule, nil
+}
+
+// SaveTaskSchedule creates the schedule of a task, or resets it if one already
+// exists.
+func SaveTaskSchedule(ctx context.Context, schedule TaskSchedule) (*TaskSchedule, error) {
+	result := db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "task_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"spec", "next_run_at", "updated_at"}),
+	}).Create(&schedule)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &schedule, nil
+}
+
+// AdvanceTaskSchedule moves the schedule of a task from expectedNextRunAt to
+// nextRunAt. It reports false if the schedule was advanced concurrently, in
+// which case the caller must not fire the run.
+func AdvanceTaskSchedule(ctx context.Context, taskID uint64, expectedNextRunAt time.Time, nextRunAt time.Time, lastRunAt time.Time) (bool, error) {
+	result := db.WithContext(ctx).Model(&TaskSchedule{}).
+		Where("task_id = ? AND next_run_at = ?", taskID, expectedNextRunAt).
+		Updates(map[string]interface{}{
+			"next_run_at": nextRunAt,
+			"last_run_at": lastRunAt,
+			"updated_at":  time.Now(),
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func DeleteTaskSchedule(ctx context.Context, taskID uint64) error {
+	result := db.WithContext(ctx).Unscoped().Where("task_id = ?", taskID).Delete(&TaskSchedule{})
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
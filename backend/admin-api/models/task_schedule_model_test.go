@@ -0,0 +1,74 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDBForTaskSchedule(t *testing.T) *gorm.DB {
+	testDB, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+
+	err = testDB.AutoMigrate(&TaskSchedule{})
+	require.NoError(t, err)
+
+	db = testDB
+	return testDB
+}
+
+func TestSaveTaskSchedule(t *testing.T) {
+	testDB := setupTestDBForTaskSchedule(t)
+	defer testDB.Migrator().DropTable(&TaskSchedule{})
+
+	ctx := context.Background()
+	nextRunAt := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	_, err := SaveTaskSchedule(ctx, TaskSchedule{TaskID: 1, Spec: "period:4", NextRunAt: nextRunAt})
+	require.NoError(t, err)
+
+	// Saving again resets the existing schedule instead of adding a new one
+	_, err = SaveTaskSchedule(ctx, TaskSchedule{TaskID: 1, Spec: "period:5", NextRunAt: nextRunAt.Add(time.Hour)})
+	require.NoError(t, err)
+
+	var count int64
+	require.NoError(t, testDB.Model(&TaskSchedule{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+
+	schedule, err := GetTaskSchedule(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "period:5", schedule.Spec)
+	assert.True(t, nextRunAt.Add(time.Hour).Equal(schedule.NextRunAt))
+
+	schedule, err = GetTaskSchedule(ctx, 2)
+	assert.NoError(t, err)
+	assert.Nil(t, schedule)
+}
+
+func TestAdvanceTaskSchedule(t *testing.T) {
+	testDB := setupTestDBForTaskSchedule(t)
+	defer testDB.Migrator().DropTable(&TaskSchedule{})
+
+	ctx := context.Background()
+	nextRunAt := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	_, err := SaveTaskSchedule(ctx, TaskSchedule{TaskID: 1, Spec: "period:4", NextRunAt: nextRunAt})
+	require.NoError(t, err)
+
+	schedule, err := GetTaskSchedule(ctx, 1)
+	require.NoError(t, err)
+
+	claimed, err := AdvanceTaskSchedule(ctx, 1, schedule.NextRunAt, nextRunAt.AddDate(0, 0, 1), nextRunAt)
+	require.NoError(t, err)
+	assert.True(t, claimed)
+
+	// A second replica working from the same state must not claim the slot again
+	claimed, err = AdvanceTaskSchedule(ctx, 1, schedule.NextRunAt, nextRunAt.AddDate(0, 0, 1), nextRunAt)
+	require.NoError(t, err)
+	assert.False(t, claimed)
+}
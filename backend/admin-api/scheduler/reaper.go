@@ -0,0 +1,192 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"admin-api/config"
+	"admin-api/models"
+
+	"github.com/uptrace/opentelemetry-go-extra/otelzap"
+	"go.uber.org/zap"
+)
+
+const reaperLockKey = "reaper:leader"
+
+type TaskRunTimer interface {
+	TimeOutTaskRun(ctx context.Context, taskRun models.TaskRun, message string) (bool, error)
+	FailCreatedTaskRun(ctx context.Context, taskRun models.TaskRun, message string) (bool, error)
+}
+
+// Reaper fails running task runs that have exceeded their maximum run
+// duration or whose worker has stopped sending heartbeats, and created runs
+// that no worker has started, e.g. because they never reached the queue.
+// Like the scheduler, only the replica holding the reaper lock does any work.
+type Reaper struct {
+	logger     *otelzap.Logger
+	runTimer   TaskRunTimer
+	cfg        config.ReaperConfig
+	instanceID string
+}
+
+func NewReaper(logger *otelzap.Logger, runTimer TaskRunTimer, cfg config.ReaperConfig) *Reaper {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "admin-api"
+	}
+
+	return &Reaper{
+		logger:     logger,
+		runTimer:   runTimer,
+		cfg:        cfg,
+		instanceID: fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+	}
+}
+
+// Run reaps stuck task runs every configured interval until ctx is cancelled.
+func (r *Reaper) Run(ctx context.Context) {
+	r.logger.Ctx(ctx).Info("Starting task run reaper", zap.String("instance_id", r.instanceID))
+
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.tick(ctx, time.Now()); err != nil {
+			r.logger.Ctx(ctx).Error("Reaper tick failed", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			if err := models.ReleaseLock(context.Background(), reaperLockKey, r.instanceID); err != nil {
+				r.logger.Ctx(ctx).Error("Failed to release reaper leader lock", zap.Error(err))
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Reaper) tick(ctx context.Context, now time.Time) error {
+	isLeader, err := models.AcquireLock(ctx, reaperLockKey, r.instanceID, r.cfg.LockTTL)
+	if err != nil {
+		return fmt.Errorf("failed to acquire reaper leader lock: %w", err)
+	}
+	if !isLeader {
+		return nil
+	}
+
+	taskRuns, err := models.ListRunningTaskRuns(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list running task runs: %w", err)
+	}
+
+	maxRunDurations := make(map[uint]time.Duration)
+	for _, taskRun := range taskRuns {
+		maxRunDuration, ok := maxRunDurations[taskRun.TaskID]
+		if !ok {
+			maxRunDuration, err = r.maxRunDuration(ctx, taskRun.TaskID)
+			if err != nil {
+				r.logger.Ctx(ctx).Error("Failed to get max run duration", zap.Uint("task_id", taskRun.TaskID), zap.Error(err))
+				continue
+			}
+			maxRunDurations[taskRun.TaskID] = maxRunDuration
+		}
+
+		message := r.timeoutMessage(&taskRun, maxRunDuration, now)
+		if message == "" {
+			continue
+		}
+
+		reaped, err := r.runTimer.TimeOutTaskRun(ctx, taskRun, message)
+		if err != nil {
+			r.logger.Ctx(ctx).Error("Failed to time out task run", zap.Uint("task_run_id", taskRun.ID), zap.Error(err))
+			continue
+		}
+		if reaped {
+			r.logger.Ctx(ctx).Info("Timed out task run", zap.Uint("task_run_id", taskRun.ID), zap.String("reason", message))
+		}
+	}
+
+	return r.reapCreated(ctx, now)
+}
+
+// reapCreated fails the created task runs that are overdue by more than the
+// created timeout and are missing from the run queue. Runs that are still
+// queued only wait behind a backlog and are left to the workers.
+func (r *Reaper) reapCreated(ctx context.Context, now time.Time) error {
+	if r.cfg.CreatedTimeout <= 0 {
+		return nil
+	}
+
+	taskRuns, err := models.ListStaleCreatedTaskRuns(ctx, now.Add(-r.cfg.CreatedTimeout))
+	if err != nil {
+		return fmt.Errorf("failed to list stale created task runs: %w", err)
+	}
+
+	if len(taskRuns) == 0 {
+		return nil
+	}
+
+	queued, err := models.ListQueuedTaskRunIDs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list queued task runs: %w", err)
+	}
+
+	message := fmt.Sprintf("task run was not started within %s", r.cfg.CreatedTimeout)
+	for _, taskRun := range taskRuns {
+		if queued[uint64(taskRun.ID)] {
+			continue
+		}
+
+		reaped, err := r.runTimer.FailCreatedTaskRun(ctx, taskRun, message)
+		if err != nil {
+			r.logger.Ctx(ctx).Error("Failed to fail created task run", zap.Uint("task_run_id", taskRun.ID), zap.Error(err))
+			continue
+		}
+		if reaped {
+			r.logger.Ctx(ctx).Info("Failed stale created task run", zap.Uint("task_run_id", taskRun.ID))
+		}
+	}
+	return nil
+}
+
+func (r *Reaper) maxRunDuration(ctx context.Context, taskID uint) (time.Duration, error) {
+	task, err := models.GetTaskById(ctx, uint64(taskID))
+	if err != nil {
+		return 0, err
+	}
+
+	definition, err := task.Definition()
+	if err != nil {
+		return 0, err
+	}
+
+	if definition.MaxRunDurationSeconds > 0 {
+		return time.Duration(definition.MaxRunDurationSeconds) * time.Second, nil
+	}
+	return r.cfg.DefaultMaxRunDuration, nil
+}
+
+// timeoutMessage returns why the task run should be timed out, or an empty
+// string if it is still within its limits.
+func (r *Reaper) timeoutMessage(taskRun *models.TaskRun, maxRunDuration time.Duration, now time.Time) string {
+	startTime := taskRun.StartTime
+	if startTime.IsZero() {
+		startTime = taskRun.UpdatedAt
+	}
+
+	if maxRunDuration > 0 && now.Sub(startTime) > maxRunDuration {
+		return fmt.Sprintf("task run exceeded its maximum run duration of %s", maxRunDuration)
+	}
+
+	lastHeartbeat := taskRun.HeartbeatAt
+	if lastHeartbeat.IsZero() {
+		lastHeartbeat = startTime
+	}
+	if r.cfg.HeartbeatTimeout > 0 && now.Sub(lastHeartbeat) > r.cfg.HeartbeatTimeout {
+		return fmt.Sprintf("no heartbeat from worker for %s", r.cfg.HeartbeatTimeout)
+	}
+	return ""
+}
@@ -0,0 +1,138 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"admin-api/config"
+	"admin-api/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/opentelemetry-go-extra/otelzap"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type taskRunTimeoutRecorder struct {
+	messages map[uint]string
+}
+
+func (r *taskRunTimeoutRecorder) TimeOutTaskRun(ctx context.Context, taskRun models.TaskRun, message string) (bool, error) {
+	failed, err := models.FailRunningTaskRun(ctx, uint64(taskRun.ID), models.ErrorClassTimeout, message, time.Now())
+	if err != nil || !failed {
+		return failed, err
+	}
+	r.messages[taskRun.ID] = message
+	return true, nil
+}
+
+func (r *taskRunTimeoutRecorder) FailCreatedTaskRun(ctx context.Context, taskRun models.TaskRun, message string) (bool, error) {
+	failed, err := models.FailCreatedTaskRun(ctx, uint64(taskRun.ID), models.ErrorClassQueue, message, time.Now())
+	if err != nil || !failed {
+		return failed, err
+	}
+	r.messages[taskRun.ID] = message
+	return true, nil
+}
+
+func setupTestReaper(t *testing.T, instanceID string) (*Reaper, *taskRunTimeoutRecorder) {
+	logger, _ := zap.NewDevelopment()
+	recorder := &taskRunTimeoutRecorder{messages: make(map[uint]string)}
+	r := NewReaper(otelzap.New(logger), recorder, config.ReaperConfig{
+		Interval:              time.Second,
+		LockTTL:               time.Minute,
+		DefaultMaxRunDuration: time.Hour,
+		HeartbeatTimeout:      5 * time.Minute,
+		CreatedTimeout:        time.Hour,
+	})
+	r.instanceID = instanceID
+	return r, recorder
+}
+
+func createRunningTaskRun(t *testing.T, db *gorm.DB, task models.Task, startTime time.Time, heartbeatAt time.Time) models.TaskRun {
+	taskRun := models.TaskRun{TaskID: task.ID, Status: models.TaskStatusRunning, StartTime: startTime, HeartbeatAt: heartbeatAt}
+	require.NoError(t, db.Create(&taskRun).Error)
+	return taskRun
+}
+
+func TestReaperTick(t *testing.T) {
+	db := setupTestDB(t)
+	mr := setupMiniRedis(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	now := time.Now()
+	defaultTask := createTask(t, db, models.TaskDefinition{Period: models.TaskPeriodSingle}, models.TaskStatusRunning)
+	shortTask := createTask(t, db, models.TaskDefinition{Period: models.TaskPeriodSingle, MaxRunDurationSeconds: 600}, models.TaskStatusRunning)
+
+	healthy := createRunningTaskRun(t, db, defaultTask, now.Add(-30*time.Minute), now.Add(-time.Minute))
+	overdue := createRunningTaskRun(t, db, defaultTask, now.Add(-2*time.Hour), now.Add(-time.Minute))
+	overdueOverride := createRunningTaskRun(t, db, shortTask, now.Add(-20*time.Minute), now.Add(-time.Minute))
+	silent := createRunningTaskRun(t, db, defaultTask, now.Add(-20*time.Minute), now.Add(-10*time.Minute))
+
+	// Created runs that never reached a worker, and ones that are still due
+	lost := models.TaskRun{TaskID: defaultTask.ID, Status: models.TaskStatusCreated, NotBefore: now.Add(-2 * time.Hour)}
+	waiting := models.TaskRun{TaskID: defaultTask.ID, Status: models.TaskStatusCreated}
+	delayed := models.TaskRun{TaskID: defaultTask.ID, Status: models.TaskStatusCreated, NotBefore: now.Add(time.Hour)}
+	// Old created runs that are still queued, behind a backlog or delayed
+	backlogged := models.TaskRun{TaskID: defaultTask.ID, Status: models.TaskStatusCreated, NotBefore: now.Add(-2 * time.Hour)}
+	retrying := models.TaskRun{TaskID: defaultTask.ID, Status: models.TaskStatusCreated, NotBefore: now.Add(-2 * time.Hour)}
+	for _, taskRun := range []*models.TaskRun{&lost, &waiting, &delayed, &backlogged, &retrying} {
+		require.NoError(t, db.Create(taskRun).Error)
+	}
+	require.NoError(t, db.Model(&models.TaskRun{}).
+		Where("id IN ?", []uint{lost.ID, delayed.ID, backlogged.ID, retrying.ID}).
+		Update("updated_at", now.Add(-2*time.Hour)).Error)
+	require.NoError(t, models.EnqueueTaskRun(ctx, backlogged.ID))
+	require.NoError(t, models.EnqueueTaskRunAt(ctx, retrying.ID, now.Add(-time.Hour)))
+
+	leader, leaderTimeouts := setupTestReaper(t, "leader")
+	follower, followerTimeouts := setupTestReaper(t, "follower")
+
+	require.NoError(t, leader.tick(ctx, now))
+	require.NoError(t, follower.tick(ctx, now))
+
+	t.Run("Follower does not reap runs", func(t *testing.T) {
+		assert.Empty(t, followerTimeouts.messages)
+	})
+
+	t.Run("Runs past their deadline are timed out", func(t *testing.T) {
+		assert.Equal(t, "task run exceeded its maximum run duration of 1h0m0s", leaderTimeouts.messages[overdue.ID])
+		assert.Equal(t, "task run exceeded its maximum run duration of 10m0s", leaderTimeouts.messages[overdueOverride.ID])
+	})
+
+	t.Run("Runs without a recent heartbeat are timed out", func(t *testing.T) {
+		assert.Equal(t, "no heartbeat from worker for 5m0s", leaderTimeouts.messages[silent.ID])
+	})
+
+	t.Run("Healthy runs are left running", func(t *testing.T) {
+		assert.NotContains(t, leaderTimeouts.messages, healthy.ID)
+
+		taskRun, err := models.GetTaskRun(ctx, uint64(healthy.ID))
+		require.NoError(t, err)
+		assert.Equal(t, models.TaskStatusRunning, taskRun.Status)
+	})
+
+	t.Run("Created runs that were not started in time are failed", func(t *testing.T) {
+		assert.Equal(t, "task run was not started within 1h0m0s", leaderTimeouts.messages[lost.ID])
+		assert.NotContains(t, leaderTimeouts.messages, waiting.ID)
+		assert.NotContains(t, leaderTimeouts.messages, delayed.ID)
+		assert.NotContains(t, leaderTimeouts.messages, backlogged.ID)
+		assert.NotContains(t, leaderTimeouts.messages, retrying.ID)
+
+		taskRun, err := models.GetTaskRun(ctx, uint64(lost.ID))
+		require.NoError(t, err)
+		assert.Equal(t, models.TaskStatusFailed, taskRun.Status)
+		assert.Equal(t, models.ErrorClassQueue, taskRun.ErrorClass)
+	})
+
+	t.Run("Timed out runs are failed", func(t *testing.T) {
+		taskRun, err := models.GetTaskRun(ctx, uint64(overdue.ID))
+		require.NoError(t, err)
+		assert.Equal(t, models.TaskStatusFailed, taskRun.Status)
+		assert.Equal(t, models.ErrorClassTimeout, taskRun.ErrorClass)
+		assert.False(t, taskRun.EndTime.IsZero())
+	})
+}
@@ -0,0 +1,177 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"admin-api/config"
+	apperrors "admin-api/errors"
+	"admin-api/models"
+
+	"github.com/uptrace/opentelemetry-go-extra/otelzap"
+	"go.uber.org/zap"
+)
+
+const leaderLockKey = "scheduler:leader"
+
+type TaskRunCreator interface {
+	CreateTaskRun(ctx context.Context, taskRun models.TaskRun) (*models.TaskRun, error)
+}
+
+// Scheduler fires the runs of periodic tasks; delayed runs are queued by the
+// workers. Paused tasks are skipped until they are resumed. Every replica runs
+// a scheduler, but only the one holding the leader lock in Redis fires runs,
+// and each fire time is claimed in Postgres before a run is created.
+type Scheduler struct {
+	logger     *otelzap.Logger
+	runCreator TaskRunCreator
+	cfg        config.SchedulerConfig
+	instanceID string
+}
+
+func NewScheduler(logger *otelzap.Logger, runCreator TaskRunCreator, cfg config.SchedulerConfig) *Scheduler {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "admin-api"
+	}
+
+	return &Scheduler{
+		logger:     logger,
+		runCreator: runCreator,
+		cfg:        cfg,
+		instanceID: fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+	}
+}
+
+// Run fires due tasks every configured interval until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.logger.Ctx(ctx).Info("Starting scheduler", zap.String("instance_id", s.instanceID))
+
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.tick(ctx, time.Now()); err != nil {
+			s.logger.Ctx(ctx).Error("Scheduler tick failed", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			if err := models.ReleaseLock(context.Background(), leaderLockKey, s.instanceID); err != nil {
+				s.logger.Ctx(ctx).Error("Failed to release scheduler leader lock", zap.Error(err))
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) tick(ctx context.Context, now time.Time) error {
+	isLeader, err := models.AcquireLock(ctx, leaderLockKey, s.instanceID, s.cfg.LockTTL)
+	if err != nil {
+		return fmt.Errorf("failed to acquire scheduler leader lock: %w", err)
+	}
+	if !isLeader {
+		return nil
+	}
+
+	tasks, err := models.GetSchedulableTasks(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list schedulable tasks: %w", err)
+	}
+
+	for _, task := range tasks {
+		if err := s.scheduleTask(ctx, &task, now); err != nil {
+			s.logger.Ctx(ctx).Error("Failed to schedule task", zap.Uint("task_id", task.ID), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) scheduleTask(ctx context.Context, task *models.Task, now time.Time) error {
+	if task.Paused {
+		if task.ResumeAt == nil || task.ResumeAt.After(now) {
+			return nil
+		}
+		if err := s.resumeTask(ctx, task); err != nil {
+			return err
+		}
+	}
+
+	definition, err := task.Definition()
+	if err != nil {
+		return err
+	}
+
+	schedule, err := definition.Schedule()
+	if err != nil {
+		return err
+	}
+	if schedule == nil {
+		return nil
+	}
+
+	state, err := models.GetTaskSchedule(ctx, uint64(task.ID))
+	if err != nil {
+		return err
+	}
+
+	// First time we see this task, or its schedule has changed since the
+	// state was computed: start counting from now.
+	if state == nil || state.Spec != schedule.String() {
+		_, err := models.SaveTaskSchedule(ctx, models.TaskSchedule{
+			TaskID:    task.ID,
+			Spec:      schedule.String(),
+			NextRunAt: schedule.Next(now),
+		})
+		return err
+	}
+
+	if state.NextRunAt.After(now) {
+		return nil
+	}
+
+	// Fire once for the slot that is due, skipping any slots that were
+	// missed while no scheduler was running.
+	claimed, err := models.AdvanceTaskSchedule(ctx, uint64(task.ID), state.NextRunAt, schedule.Next(now), now)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return nil
+	}
+
+	taskRun, err := s.runCreator.CreateTaskRun(ctx, models.TaskRun{
+		TaskID: task.ID,
+		Type:   models.TaskRunTypePeriodic,
+	})
+	if errors.Is(err, apperrors.ErrConcurrentRun) {
+		s.logger.Ctx(ctx).Info("Skipped periodic task run while previous run is active", zap.Uint("task_id", task.ID))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	s.logger.Ctx(ctx).Info("Fired periodic task run", zap.Uint("task_id", task.ID), zap.Uint("task_run_id", taskRun.ID))
+	return nil
+}
+
+// resumeTask unpauses a task whose resume time has passed. Its schedule is
+// reset, so the next run fires at the first slot after now.
+func (s *Scheduler) resumeTask(ctx context.Context, task *models.Task) error {
+	if err := models.ResumeTask(ctx, uint64(task.ID)); err != nil {
+		return err
+	}
+	if err := models.ClearTaskCache(ctx, uint64(task.ID)); err != nil {
+		return err
+	}
+
+	task.Paused = false
+	task.ResumeAt = nil
+	s.logger.Ctx(ctx).Info("Resumed paused task", zap.Uint("task_id", task.ID))
+	return nil
+}
@@ -0,0 +1,176 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"admin-api/config"
+	"admin-api/models"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/bytedance/sonic"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/opentelemetry-go-extra/otelzap"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type taskRunRecorder struct {
+	runs []models.TaskRun
+}
+
+func (r *taskRunRecorder) CreateTaskRun(ctx context.Context, taskRun models.TaskRun) (*models.TaskRun, error) {
+	createdTaskRun, err := models.CreateTaskRun(ctx, taskRun)
+	if err != nil {
+		return nil, err
+	}
+	r.runs = append(r.runs, *createdTaskRun)
+	return createdTaskRun, nil
+}
+
+func setupTestScheduler(t *testing.T, instanceID string) (*Scheduler, *taskRunRecorder) {
+	logger, _ := zap.NewDevelopment()
+	recorder := &taskRunRecorder{}
+	s := NewScheduler(otelzap.New(logger), recorder, config.SchedulerConfig{
+		Interval: time.Second,
+		LockTTL:  time.Minute,
+	})
+	s.instanceID = instanceID
+	return s, recorder
+}
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	err = db.AutoMigrate(&models.Task{}, &models.TaskRun{}, &models.TaskSchedule{})
+	require.NoError(t, err)
+
+	models.SetDB(db)
+	return db
+}
+
+func setupMiniRedis(t *testing.T) *miniredis.Miniredis {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+
+	models.SetRedis(redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	}))
+	return mr
+}
+
+func createTask(t *testing.T, db *gorm.DB, definition models.TaskDefinition, status models.TaskStatus) models.Task {
+	definitionJSON, err := sonic.Marshal(definition)
+	require.NoError(t, err)
+
+	task := models.Task{Owner: "user1", TaskName: "Task", TaskDefinition: definitionJSON, Status: status}
+	require.NoError(t, db.Create(&task).Error)
+	return task
+}
+
+func TestSchedulerTick(t *testing.T) {
+	db := setupTestDB(t)
+	mr := setupMiniRedis(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	hourly := createTask(t, db, models.TaskDefinition{Period: models.TaskPeriodHourly}, models.TaskStatusCreated)
+	createTask(t, db, models.TaskDefinition{Period: models.TaskPeriodSingle}, models.TaskStatusCreated)
+	createTask(t, db, models.TaskDefinition{Period: models.TaskPeriodMinutely}, models.TaskStatusCancelled)
+
+	leader, leaderRuns := setupTestScheduler(t, "leader")
+	follower, followerRuns := setupTestScheduler(t, "follower")
+	now := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	t.Run("First tick only initialises the schedule", func(t *testing.T) {
+		require.NoError(t, leader.tick(ctx, now))
+		assert.Empty(t, leaderRuns.runs)
+
+		state, err := models.GetTaskSchedule(ctx, uint64(hourly.ID))
+		require.NoError(t, err)
+		require.NotNil(t, state)
+		assert.True(t, now.Add(time.Hour).Equal(state.NextRunAt))
+	})
+
+	t.Run("Only periodic active tasks are scheduled", func(t *testing.T) {
+		var count int64
+		require.NoError(t, db.Model(&models.TaskSchedule{}).Count(&count).Error)
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("Follower does not fire runs", func(t *testing.T) {
+		require.NoError(t, follower.tick(ctx, now.Add(2*time.Hour)))
+		assert.Empty(t, followerRuns.runs)
+	})
+
+	t.Run("Leader fires due run once", func(t *testing.T) {
+		require.NoError(t, leader.tick(ctx, now.Add(90*time.Minute)))
+		require.Len(t, leaderRuns.runs, 1)
+		assert.Equal(t, hourly.ID, leaderRuns.runs[0].TaskID)
+		assert.Equal(t, models.TaskRunTypePeriodic, leaderRuns.runs[0].Type)
+
+		require.NoError(t, leader.tick(ctx, now.Add(91*time.Minute)))
+		assert.Len(t, leaderRuns.runs, 1)
+
+		state, err := models.GetTaskSchedule(ctx, uint64(hourly.ID))
+		require.NoError(t, err)
+		assert.True(t, now.Add(150*time.Minute).Equal(state.NextRunAt))
+	})
+
+	t.Run("Changed schedule is recomputed", func(t *testing.T) {
+		definitionJSON, err := sonic.Marshal(models.TaskDefinition{Period: models.TaskPeriodDaily})
+		require.NoError(t, err)
+		require.NoError(t, db.Model(&hourly).Update("task_definition", definitionJSON).Error)
+
+		require.NoError(t, leader.tick(ctx, now.Add(3*time.Hour)))
+		assert.Len(t, leaderRuns.runs, 1)
+
+		state, err := models.GetTaskSchedule(ctx, uint64(hourly.ID))
+		require.NoError(t, err)
+		assert.Equal(t, "period:4", state.Spec)
+		assert.True(t, now.Add(27*time.Hour).Equal(state.NextRunAt))
+	})
+}
+
+func TestSchedulerPausedTask(t *testing.T) {
+	db := setupTestDB(t)
+	mr := setupMiniRedis(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	s, runs := setupTestScheduler(t, "leader")
+	now := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	hourly := createTask(t, db, models.TaskDefinition{Period: models.TaskPeriodHourly}, models.TaskStatusCreated)
+	require.NoError(t, s.tick(ctx, now))
+
+	resumeAt := now.Add(3 * time.Hour)
+	require.NoError(t, models.PauseTask(ctx, uint64(hourly.ID), &resumeAt))
+
+	t.Run("Paused task is not fired", func(t *testing.T) {
+		require.NoError(t, s.tick(ctx, now.Add(90*time.Minute)))
+		assert.Empty(t, runs.runs)
+	})
+
+	t.Run("Task is resumed at its resume time", func(t *testing.T) {
+		resumedAt := now.Add(3*time.Hour + 30*time.Minute)
+		require.NoError(t, s.tick(ctx, resumedAt))
+
+		// Slots missed while paused are not fired
+		assert.Empty(t, runs.runs)
+
+		task, err := models.GetTaskById(ctx, uint64(hourly.ID))
+		require.NoError(t, err)
+		assert.False(t, task.Paused)
+		assert.Nil(t, task.ResumeAt)
+
+		state, err := models.GetTaskSchedule(ctx, uint64(hourly.ID))
+		require.NoError(t, err)
+		assert.True(t, resumedAt.Add(time.Hour).Equal(state.NextRunAt))
+	})
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	apperrors "admin-api/errors"
+	"admin-api/models"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/uptrace/opentelemetry-go-extra/otelzap"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultBackfillConcurrency = 1
+	maxBackfillConcurrency     = 10
+	maxBackfillWindows         = 1000
+)
+
+type BackfillService struct {
+	logger      *otelzap.Logger
+	taskService *TaskService
+}
+
+func NewBackfillService(logger *otelzap.Logger, taskService *TaskService) *BackfillService {
+	return &BackfillService{logger: logger, taskService: taskService}
+}
+
+// CreateBackfill creates one run of the task per window between the start and
+// end of the request. The runs are pending and are started at most
+// MaxConcurrency at a time.
+func (s *BackfillService) CreateBackfill(ctx context.Context, taskID string, request models.CreateBackfillRequest, createdBy string) (*models.BackfillDto, error) {
+	taskIDUint, err := strconv.ParseUint(taskID, 10, 64)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Failed to parse task id", zap.Error(err))
+		return nil, err
+	}
+
+	task, err := models.GetTaskById(ctx, taskIDUint)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Error while getting task from db", zap.Error(err))
+		return nil, err
+	}
+	if task.Paused {
+		return nil, apperrors.ErrTaskPaused
+	}
+
+	definition, err := task.Definition()
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Error while decoding task definition", zap.Error(err))
+		return nil, err
+	}
+
+	step, windows, err := backfillWindows(request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", apperrors.ErrInvalidBackfill, err)
+	}
+
+	maxConcurrency := request.MaxConcurrency
+	if maxConcurrency == 0 {
+		maxConcurrency = defaultBackfillConcurrency
+	}
+	if maxConcurrency < 0 || maxConcurrency > maxBackfillConcurrency {
+		return nil, fmt.Errorf("%w: max_concurrency must be between 1 and %d", apperrors.ErrInvalidBackfill, maxBackfillConcurrency)
+	}
+
+	taskRuns := make([]models.TaskRun, 0, len(windows))
+	for _, window := range windows {
+		sources, err := models.RenderSourceURLs(definition.Source, window)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", apperrors.ErrInvalidBackfill, err)
+		}
+
+		// A window can render a template into an invalid URL
+		overrides := models.TaskRunOverrides{Source: sources}
+		if err := overrides.Validate(); err != nil {
+			return nil, fmt.Errorf("%w: window starting at %s: %v", apperrors.ErrInvalidBackfill, window.Start.Format(time.RFC3339), err)
+		}
+
+		encodedOverrides, err := sonic.Marshal(overrides)
+		if err != nil {
+			s.logger.Ctx(ctx).Error("Failed to encode task run overrides", zap.Error(err))
+			return nil, err
+		}
+
+		taskRuns = append(taskRuns, models.TaskRun{
+			TaskID:      task.ID,
+			Type:        models.TaskRunTypeSingle,
+			Status:      models.TaskStatusPending,
+			Attempt:     1,
+			Overrides:   encodedOverrides,
+			WindowStart: window.Start,
+			WindowEnd:   window.End,
+		})
+	}
+
+	backfill, err := models.CreateBackfill(ctx, models.Backfill{
+		TaskID:         task.ID,
+		Start:          request.Start,
+		End:            request.End,
+		StepSeconds:    int64(step / time.Second),
+		MaxConcurrency: maxConcurrency,
+		CreatedBy:      createdBy,
+	}, taskRuns)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Failed to create backfill", zap.Error(err))
+		return nil, err
+	}
+
+	if err := s.taskService.promotePendingTaskRuns(ctx, task.ID); err != nil {
+		s.logger.Ctx(ctx).Error("Error while promoting pending task runs", zap.Error(err))
+	}
+
+	return s.getBackfillProgress(ctx, backfill)
+}
+
+func (s *BackfillService) ListBackfills(ctx context.Context, taskID string) ([]*models.BackfillDto, error) {
+	taskIDUint, err := strconv.ParseUint(taskID, 10, 64)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Failed to parse task id", zap.Error(err))
+		return nil, err
+	}
+
+	backfills, err := models.ListBackfillsForTask(ctx, taskIDUint)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Error while listing backfills", zap.Error(err))
+		return nil, err
+	}
+
+	backfillDtos := make([]*models.BackfillDto, 0, len(backfills))
+	for _, backfill := range backfills {
+		backfillDto, err := s.getBackfillProgress(ctx, &backfill)
+		if err != nil {
+			return nil, err
+		}
+		backfillDto.Windows = nil
+		backfillDtos = append(backfillDtos, backfillDto)
+	}
+	return backfillDtos, nil
+}
+
+// GetBackfill returns the backfill with the status of the latest run of each
+// of its windows.
+func (s *BackfillService) GetBackfill(ctx context.Context, taskID string, backfillID string) (*models.BackfillDto, error) {
+	backfillIDUint, err := strconv.ParseUint(backfillID, 10, 64)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Failed to parse backfill id", zap.Error(err))
+		return nil, err
+	}
+
+	backfill, err := models.GetBackfill(ctx, backfillIDUint)
+	if err != nil {
+		if !errors.Is(err, apperrors.ErrBackfillNotFound) {
+			s.logger.Ctx(ctx).Error("Error while getting backfill", zap.Error(err))
+		}
+		return nil, err
+	}
+	if strconv.FormatUint(uint64(backfill.TaskID), 10) != taskID {
+		return nil, apperrors.ErrBackfillNotFound
+	}
+
+	return s.getBackfillProgress(ctx, backfill)
+}
+
+func (s *BackfillService) getBackfillProgress(ctx context.Context, backfill *models.Backfill) (*models.BackfillDto, error) {
+	taskRuns, err := models.ListBackfillRuns(ctx, uint64(backfill.ID))
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Error while listing backfill runs", zap.Error(err))
+		return nil, err
+	}
+
+	backfillDto := &models.BackfillDto{
+		ID:             strconv.FormatUint(uint64(backfill.ID), 10),
+		TaskID:         strconv.FormatUint(uint64(backfill.TaskID), 10),
+		Start:          backfill.Start,
+		End:            backfill.End,
+		Step:           (time.Duration(backfill.StepSeconds) * time.Second).String(),
+		MaxConcurrency: backfill.MaxConcurrency,
+		CreatedBy:      backfill.CreatedBy,
+		CreatedAt:      backfill.CreatedAt,
+	}
+
+	// Retries share the window of the run they retry, the latest one wins.
+	// Windows are keyed by instant, as equal times may differ in location.
+	windowIndex := make(map[int64]int)
+	for _, taskRun := range taskRuns {
+		window := models.BackfillWindowDto{
+			Start:   taskRun.WindowStart,
+			End:     taskRun.WindowEnd,
+			RunID:   strconv.FormatUint(uint64(taskRun.ID), 10),
+			Status:  taskRun.Status,
+			Attempt: taskRun.Attempt,
+		}
+		if i, ok := windowIndex[taskRun.WindowStart.UnixNano()]; ok {
+			backfillDto.Windows[i] = window
+			continue
+		}
+		windowIndex[taskRun.WindowStart.UnixNano()] = len(backfillDto.Windows)
+		backfillDto.Windows = append(backfillDto.Windows, window)
+	}
+
+	for _, window := range backfillDto.Windows {
+		backfillDto.Progress.Total++
+		switch window.Status {
+		case models.TaskStatusPending:
+			backfillDto.Progress.Pending++
+		case models.TaskStatusComplete:
+			backfillDto.Progress.Complete++
+		case models.TaskStatusFailed:
+			backfillDto.Progress.Failed++
+		case models.TaskStatusCancelled:
+			backfillDto.Progress.Cancelled++
+		default:
+			backfillDto.Progress.Active++
+		}
+	}
+	return backfillDto, nil
+}
+
+func backfillWindows(request models.CreateBackfillRequest) (time.Duration, []models.BackfillWindow, error) {
+	step, err := time.ParseDuration(request.Step)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid step %q", request.Step)
+	}
+	if step < time.Second {
+		return 0, nil, errors.New("step must be at least one second")
+	}
+	if !request.End.After(request.Start) {
+		return 0, nil, errors.New("end must be after start")
+	}
+	if request.End.Sub(request.Start)/step >= maxBackfillWindows {
+		return 0, nil, fmt.Errorf("backfill must not have more than %d windows", maxBackfillWindows)
+	}
+
+	return step, models.BackfillWindows(request.Start, request.End, step), nil
+}
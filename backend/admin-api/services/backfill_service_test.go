@@ -0,0 +1,135 @@
+package services
+
+import (
+	apperrors "admin-api/errors"
+	"admin-api/models"
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/opentelemetry-go-extra/otelzap"
+	"go.uber.org/zap"
+)
+
+func TestCreateBackfill(t *testing.T) {
+	taskService, db, mr := setupTestService(t)
+	defer mr.Close()
+	logger, _ := zap.NewDevelopment()
+	service := NewBackfillService(otelzap.New(logger), taskService)
+	ctx := context.Background()
+	require.NoError(t, db.AutoMigrate(&models.Backfill{}))
+	require.NoError(t, models.EnsureRunQueue(ctx))
+
+	taskDefinition := mockTaskDefinition()
+	taskDefinition.Source = []models.UrlSource{{Type: models.SourceTypeUrl, URL: `https://example.com/?date={{.Start.Format "2006-01-02"}}`}}
+	taskDefinitionJSON, _ := sonic.Marshal(taskDefinition)
+	task := models.Task{Owner: "user1", TaskName: "Task", TaskDefinition: taskDefinitionJSON}
+	require.NoError(t, db.Create(&task).Error)
+	taskID := strconv.FormatUint(uint64(task.ID), 10)
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var backfill *models.BackfillDto
+
+	t.Run("Runs are created per window", func(t *testing.T) {
+		var err error
+		backfill, err = service.CreateBackfill(ctx, taskID, models.CreateBackfillRequest{
+			Start:          start,
+			End:            start.AddDate(0, 0, 5),
+			Step:           "24h",
+			MaxConcurrency: 2,
+		}, "user1")
+		require.NoError(t, err)
+		assert.Equal(t, "24h0m0s", backfill.Step)
+		assert.Equal(t, models.BackfillProgressDto{Total: 5, Pending: 3, Active: 2}, backfill.Progress)
+		require.Len(t, backfill.Windows, 5)
+		assert.Equal(t, start.AddDate(0, 0, 4), backfill.Windows[4].Start)
+
+		runID, _ := strconv.ParseUint(backfill.Windows[2].RunID, 10, 64)
+		taskRun, err := models.GetTaskRun(ctx, runID)
+		require.NoError(t, err)
+		definition, err := taskRun.EffectiveDefinition(&task)
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com/?date=2026-01-03", definition.Source[0].URL)
+	})
+
+	t.Run("Finished runs make room for pending windows", func(t *testing.T) {
+		_, err := taskService.UpdateTaskRun(ctx, models.TaskRun{Status: models.TaskStatusComplete}, backfill.Windows[0].RunID)
+		require.NoError(t, err)
+
+		progress, err := service.GetBackfill(ctx, taskID, backfill.ID)
+		require.NoError(t, err)
+		assert.Equal(t, models.BackfillProgressDto{Total: 5, Pending: 2, Active: 2, Complete: 1}, progress.Progress)
+		assert.Equal(t, models.TaskStatusCreated, progress.Windows[2].Status)
+	})
+
+	t.Run("Retries replace the window of the run they retry", func(t *testing.T) {
+		retried, err := models.GetTaskRun(ctx, mustParseUint(t, backfill.Windows[1].RunID))
+		require.NoError(t, err)
+		retry := models.TaskRun{
+			TaskID:      task.ID,
+			Status:      models.TaskStatusPending,
+			Attempt:     2,
+			BackfillID:  retried.BackfillID,
+			WindowStart: retried.WindowStart.In(time.FixedZone("CET", 3600)),
+			WindowEnd:   retried.WindowEnd,
+		}
+		require.NoError(t, db.Create(&retry).Error)
+
+		progress, err := service.GetBackfill(ctx, taskID, backfill.ID)
+		require.NoError(t, err)
+		require.Len(t, progress.Windows, 5)
+		assert.Equal(t, strconv.FormatUint(uint64(retry.ID), 10), progress.Windows[1].RunID)
+		assert.Equal(t, 2, progress.Windows[1].Attempt)
+	})
+
+	t.Run("Backfills are listed without windows", func(t *testing.T) {
+		backfills, err := service.ListBackfills(ctx, taskID)
+		require.NoError(t, err)
+		require.Len(t, backfills, 1)
+		assert.Equal(t, 5, backfills[0].Progress.Total)
+		assert.Nil(t, backfills[0].Windows)
+	})
+
+	t.Run("Backfill of another task is not found", func(t *testing.T) {
+		_, err := service.GetBackfill(ctx, "999", backfill.ID)
+		assert.ErrorIs(t, err, apperrors.ErrBackfillNotFound)
+	})
+
+	t.Run("Invalid requests", func(t *testing.T) {
+		invalid := []models.CreateBackfillRequest{
+			{Start: start, End: start, Step: "24h"},
+			{Start: start, End: start.AddDate(0, 0, 1), Step: "daily"},
+			{Start: start, End: start.AddDate(10, 0, 0), Step: "1h"},
+			{Start: start, End: start.AddDate(0, 0, 1), Step: "1h", MaxConcurrency: 100},
+		}
+		for _, request := range invalid {
+			_, err := service.CreateBackfill(ctx, taskID, request, "user1")
+			assert.ErrorIs(t, err, apperrors.ErrInvalidBackfill)
+		}
+	})
+
+	t.Run("Rendered urls are validated", func(t *testing.T) {
+		invalidDefinition := mockTaskDefinition()
+		invalidDefinition.Source = []models.UrlSource{{Type: models.SourceTypeUrl, URL: `{{.Start.Format "2006-01-02"}}`}}
+		invalidDefinitionJSON, _ := sonic.Marshal(invalidDefinition)
+		invalidTask := models.Task{Owner: "user1", TaskName: "Invalid task", TaskDefinition: invalidDefinitionJSON}
+		require.NoError(t, db.Create(&invalidTask).Error)
+
+		_, err := service.CreateBackfill(ctx, strconv.FormatUint(uint64(invalidTask.ID), 10), models.CreateBackfillRequest{
+			Start: start,
+			End:   start.AddDate(0, 0, 1),
+			Step:  "24h",
+		}, "user1")
+		assert.ErrorIs(t, err, apperrors.ErrInvalidBackfill)
+	})
+}
+
+func mustParseUint(t *testing.T, value string) uint64 {
+	parsed, err := strconv.ParseUint(value, 10, 64)
+	require.NoError(t, err)
+	return parsed
+}
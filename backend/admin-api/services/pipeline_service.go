@@ -0,0 +1,516 @@
+package services
+
+import (
+	apperrors "admin-api/errors"
+	"admin-api/models"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/gocql/gocql"
+	"github.com/uptrace/opentelemetry-go-extra/otelzap"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxPipelineSources caps the number of sources passed from upstream runs
+	// to a downstream run.
+	maxPipelineSources = 1000
+
+	pipelineArtifactPageSize = 100
+)
+
+type PipelineService struct {
+	logger      *otelzap.Logger
+	taskService *TaskService
+}
+
+// NewPipelineService creates the pipeline service. It only triggers the
+// downstream runs of finished runs once it is set as the pipeline hook of the
+// task service.
+func NewPipelineService(logger *otelzap.Logger, taskService *TaskService) *PipelineService {
+	return &PipelineService{logger: logger, taskService: taskService}
+}
+
+func (s *PipelineService) CreatePipeline(ctx context.Context, request models.CreatePipelineRequest, owner string) (*models.PipelineDto, error) {
+	pipeline := models.Pipeline{Owner: owner, Name: request.Name}
+	for _, node := range request.Nodes {
+		taskID, err := strconv.ParseUint(node.TaskID, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid task id %q of node %q", apperrors.ErrInvalidPipeline, node.TaskID, node.Key)
+		}
+
+		task, err := models.GetTaskById(ctx, taskID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("%w: task %d of node %q does not exist", apperrors.ErrInvalidPipeline, taskID, node.Key)
+			}
+			s.logger.Ctx(ctx).Error("Error while getting task from db", zap.Error(err))
+			return nil, err
+		}
+		if task.Owner != owner {
+			return nil, fmt.Errorf("%w: task %d of node %q does not exist", apperrors.ErrInvalidPipeline, taskID, node.Key)
+		}
+
+		pipeline.Nodes = append(pipeline.Nodes, models.PipelineNode{Key: node.Key, TaskID: task.ID})
+	}
+	for _, edge := range request.Edges {
+		pipeline.Edges = append(pipeline.Edges, models.PipelineEdge{
+			FromNode:  edge.From,
+			ToNode:    edge.To,
+			Condition: edge.Condition,
+			Input:     edge.Input,
+		})
+	}
+
+	if err := pipeline.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", apperrors.ErrInvalidPipeline, err)
+	}
+
+	createdPipeline, err := models.CreatePipeline(ctx, pipeline)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Failed to create pipeline", zap.Error(err))
+		return nil, err
+	}
+	return mapPipelineToDto(createdPipeline), nil
+}
+
+func (s *PipelineService) ListPipelines(ctx context.Context, owner string) ([]*models.PipelineDto, error) {
+	pipelines, err := models.ListPipelinesByOwner(ctx, owner)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Error while listing pipelines", zap.Error(err))
+		return nil, err
+	}
+
+	pipelineDtos := make([]*models.PipelineDto, 0, len(pipelines))
+	for _, pipeline := range pipelines {
+		pipelineDtos = append(pipelineDtos, mapPipelineToDto(&pipeline))
+	}
+	return pipelineDtos, nil
+}
+
+func (s *PipelineService) GetPipeline(ctx context.Context, pipelineID string, owner string) (*models.PipelineDto, error) {
+	pipeline, err := s.getPipeline(ctx, pipelineID, owner)
+	if err != nil {
+		return nil, err
+	}
+	return mapPipelineToDto(pipeline), nil
+}
+
+func (s *PipelineService) DeletePipeline(ctx context.Context, pipelineID string, owner string) error {
+	pipeline, err := s.getPipeline(ctx, pipelineID, owner)
+	if err != nil {
+		return err
+	}
+
+	if err := models.DeletePipeline(ctx, uint64(pipeline.ID)); err != nil {
+		s.logger.Ctx(ctx).Error("Error while deleting pipeline", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// StartPipelineRun starts a run of the pipeline, which runs the nodes without
+// upstream nodes right away.
+func (s *PipelineService) StartPipelineRun(ctx context.Context, pipelineID string, owner string, triggeredBy string) (*models.PipelineRunDto, error) {
+	pipeline, err := s.getPipeline(ctx, pipelineID, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	pipelineRun := models.PipelineRun{
+		PipelineID:  pipeline.ID,
+		Status:      models.TaskStatusRunning,
+		StartTime:   time.Now(),
+		TriggeredBy: triggeredBy,
+	}
+	for _, node := range pipeline.Nodes {
+		pipelineRun.NodeRuns = append(pipelineRun.NodeRuns, models.PipelineNodeRun{
+			NodeKey: node.Key,
+			Status:  models.PipelineNodeWaiting,
+		})
+	}
+
+	createdPipelineRun, err := models.CreatePipelineRun(ctx, pipelineRun)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Failed to create pipeline run", zap.Error(err))
+		return nil, err
+	}
+
+	if err := s.advancePipelineRun(ctx, pipeline, uint64(createdPipelineRun.ID)); err != nil {
+		s.logger.Ctx(ctx).Error("Error while advancing pipeline run", zap.Error(err))
+		return nil, err
+	}
+
+	return s.getPipelineRun(ctx, pipeline, uint64(createdPipelineRun.ID))
+}
+
+func (s *PipelineService) ListPipelineRuns(ctx context.Context, pipelineID string, owner string) ([]*models.PipelineRunDto, error) {
+	pipeline, err := s.getPipeline(ctx, pipelineID, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	pipelineRuns, err := models.ListPipelineRuns(ctx, uint64(pipeline.ID))
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Error while listing pipeline runs", zap.Error(err))
+		return nil, err
+	}
+
+	pipelineRunDtos := make([]*models.PipelineRunDto, 0, len(pipelineRuns))
+	for _, pipelineRun := range pipelineRuns {
+		pipelineRunDtos = append(pipelineRunDtos, mapPipelineRunToDto(pipeline, &pipelineRun))
+	}
+	return pipelineRunDtos, nil
+}
+
+// GetPipelineRun returns the status of the pipeline run and of each of its
+// nodes.
+func (s *PipelineService) GetPipelineRun(ctx context.Context, pipelineID string, pipelineRunID string, owner string) (*models.PipelineRunDto, error) {
+	pipeline, err := s.getPipeline(ctx, pipelineID, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	pipelineRunIDUint, err := strconv.ParseUint(pipelineRunID, 10, 64)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Failed to parse pipeline run id", zap.Error(err))
+		return nil, err
+	}
+
+	return s.getPipelineRun(ctx, pipeline, pipelineRunIDUint)
+}
+
+func (s *PipelineService) getPipeline(ctx context.Context, pipelineID string, owner string) (*models.Pipeline, error) {
+	pipelineIDUint, err := strconv.ParseUint(pipelineID, 10, 64)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Failed to parse pipeline id", zap.Error(err))
+		return nil, err
+	}
+
+	pipeline, err := models.GetPipeline(ctx, pipelineIDUint)
+	if err != nil {
+		if !errors.Is(err, apperrors.ErrPipelineNotFound) {
+			s.logger.Ctx(ctx).Error("Error while getting pipeline", zap.Error(err))
+		}
+		return nil, err
+	}
+	if pipeline.Owner != owner {
+		return nil, apperrors.ErrPipelineNotFound
+	}
+	return pipeline, nil
+}
+
+func (s *PipelineService) getPipelineRun(ctx context.Context, pipeline *models.Pipeline, pipelineRunID uint64) (*models.PipelineRunDto, error) {
+	pipelineRun, err := models.GetPipelineRun(ctx, pipelineRunID)
+	if err != nil {
+		if !errors.Is(err, apperrors.ErrPipelineRunNotFound) {
+			s.logger.Ctx(ctx).Error("Error while getting pipeline run", zap.Error(err))
+		}
+		return nil, err
+	}
+	if pipelineRun.PipelineID != pipeline.ID {
+		return nil, apperrors.ErrPipelineRunNotFound
+	}
+	return mapPipelineRunToDto(pipeline, pipelineRun), nil
+}
+
+// TaskRunFinished records the final status of a pipeline node and triggers
+// the nodes that depend on it. A failed run that is retried keeps its node
+// running with the retry.
+func (s *PipelineService) TaskRunFinished(ctx context.Context, taskRun *models.TaskRun, retryRun *models.TaskRun) error {
+	pipelineRun, err := models.GetPipelineRun(ctx, uint64(*taskRun.PipelineRunID))
+	if err != nil {
+		return err
+	}
+
+	pipeline, err := models.GetPipeline(ctx, uint64(pipelineRun.PipelineID))
+	if err != nil {
+		return err
+	}
+
+	return models.WithLock(ctx, pipelineRunLockKey(pipelineRun.ID), s.taskService.cfg.LockTTL, s.taskService.cfg.LockWait, func() error {
+		nodeRun, err := getPipelineNodeRun(ctx, uint64(pipelineRun.ID), taskRun.PipelineNodeKey)
+		if err != nil {
+			return err
+		}
+		// Stale reports of earlier attempts do not change the node
+		if nodeRun.TaskRunID == nil || *nodeRun.TaskRunID != taskRun.ID || nodeRun.Status.IsFinished() {
+			return nil
+		}
+
+		switch {
+		case retryRun != nil:
+			nodeRun.TaskRunID = &retryRun.ID
+		case taskRun.Status == models.TaskStatusComplete:
+			nodeRun.Status = models.PipelineNodeSucceeded
+		default:
+			nodeRun.Status = models.PipelineNodeFailed
+			nodeRun.Message = taskRun.ErrorMessage
+		}
+		if err := models.UpdatePipelineNodeRun(ctx, *nodeRun); err != nil {
+			return err
+		}
+
+		return s.advance(ctx, pipeline, uint64(pipelineRun.ID))
+	})
+}
+
+func (s *PipelineService) advancePipelineRun(ctx context.Context, pipeline *models.Pipeline, pipelineRunID uint64) error {
+	return models.WithLock(ctx, pipelineRunLockKey(uint(pipelineRunID)), s.taskService.cfg.LockTTL, s.taskService.cfg.LockWait, func() error {
+		return s.advance(ctx, pipeline, pipelineRunID)
+	})
+}
+
+// advance starts every waiting node whose upstream nodes have all finished and
+// whose incoming edges are all satisfied, and skips the waiting nodes whose
+// incoming edges can no longer be satisfied. The pipeline run finishes once
+// every node has. It must be called while holding the pipeline run lock.
+func (s *PipelineService) advance(ctx context.Context, pipeline *models.Pipeline, pipelineRunID uint64) error {
+	pipelineRun, err := models.GetPipelineRun(ctx, pipelineRunID)
+	if err != nil {
+		return err
+	}
+	if pipelineRun.Status.IsFinished() {
+		return nil
+	}
+
+	nodeRuns := make(map[string]*models.PipelineNodeRun, len(pipelineRun.NodeRuns))
+	for i := range pipelineRun.NodeRuns {
+		nodeRuns[pipelineRun.NodeRuns[i].NodeKey] = &pipelineRun.NodeRuns[i]
+	}
+
+	// Visiting the nodes in dependency order lets skips cascade in one pass
+	for _, key := range pipeline.TopologicalOrder() {
+		nodeRun := nodeRuns[key]
+		if nodeRun == nil || nodeRun.Status != models.PipelineNodeWaiting {
+			continue
+		}
+
+		ready, satisfied := true, true
+		incomingEdges := pipeline.IncomingEdges(key)
+		for _, edge := range incomingEdges {
+			upstream := nodeRuns[edge.FromNode]
+			if upstream == nil || !upstream.Status.IsFinished() {
+				ready = false
+				break
+			}
+			if !edge.Condition.Satisfied(upstream.Status) {
+				satisfied = false
+			}
+		}
+		if !ready {
+			continue
+		}
+
+		if !satisfied {
+			nodeRun.Status = models.PipelineNodeSkipped
+		} else if err := s.startNode(ctx, pipeline.Node(key), pipelineRunID, nodeRun, incomingEdges, nodeRuns); err != nil {
+			s.logger.Ctx(ctx).Error("Error while starting pipeline node", zap.String("node", key), zap.Error(err))
+			nodeRun.Status = models.PipelineNodeFailed
+			nodeRun.Message = err.Error()
+		}
+		if err := models.UpdatePipelineNodeRun(ctx, *nodeRun); err != nil {
+			return err
+		}
+	}
+
+	status := models.TaskStatusComplete
+	for _, nodeRun := range nodeRuns {
+		if !nodeRun.Status.IsFinished() {
+			return nil
+		}
+		if nodeRun.Status == models.PipelineNodeFailed {
+			status = models.TaskStatusFailed
+		}
+	}
+	return models.FinishPipelineRun(ctx, pipelineRunID, status, time.Now())
+}
+
+// startNode creates the run of a node with the sources passed along its
+// incoming edges.
+func (s *PipelineService) startNode(ctx context.Context, node *models.PipelineNode, pipelineRunID uint64, nodeRun *models.PipelineNodeRun, incomingEdges []models.PipelineEdge, nodeRuns map[string]*models.PipelineNodeRun) error {
+	var sources []models.UrlSource
+	seen := make(map[string]bool)
+	for _, edge := range incomingEdges {
+		if edge.Input == models.PipelineEdgeInputNone {
+			continue
+		}
+
+		urls, err := s.upstreamURLs(ctx, nodeRuns[edge.FromNode], edge.Input)
+		if err != nil {
+			return err
+		}
+		for _, u := range urls {
+			if seen[u] || len(sources) >= maxPipelineSources {
+				continue
+			}
+			seen[u] = true
+			sources = append(sources, models.UrlSource{Type: models.SourceTypeUrl, URL: u})
+		}
+	}
+
+	pipelineRunIDUint := uint(pipelineRunID)
+	taskRun := models.TaskRun{
+		TaskID:          node.TaskID,
+		Type:            models.TaskRunTypeSingle,
+		PipelineRunID:   &pipelineRunIDUint,
+		PipelineNodeKey: node.Key,
+	}
+	if len(sources) > 0 {
+		overrides, err := sonic.Marshal(models.TaskRunOverrides{Source: sources})
+		if err != nil {
+			return err
+		}
+		taskRun.Overrides = overrides
+	}
+
+	createdTaskRun, err := s.taskService.CreateTaskRun(ctx, taskRun)
+	if err != nil {
+		return err
+	}
+
+	nodeRun.Status = models.PipelineNodeRunning
+	nodeRun.TaskRunID = &createdTaskRun.ID
+	return nil
+}
+
+// upstreamURLs returns the URLs the run of an upstream node passes on: the
+// URLs of its artifacts, or the URLs extracted into their additional data.
+func (s *PipelineService) upstreamURLs(ctx context.Context, upstream *models.PipelineNodeRun, input models.PipelineEdgeInput) ([]string, error) {
+	if upstream.TaskRunID == nil {
+		return nil, nil
+	}
+
+	taskRun, err := models.GetTaskRun(ctx, uint64(*upstream.TaskRunID))
+	if err != nil {
+		return nil, err
+	}
+	if taskRun.AirflowInstanceID == "" {
+		return nil, nil
+	}
+
+	airflowUUID, err := gocql.ParseUUID(taskRun.AirflowInstanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	var urls []string
+	for offset := 0; len(urls) < maxPipelineSources; offset += pipelineArtifactPageSize {
+		artifacts, err := s.taskService.taskRunArtifactRepository.ListArtifactsByTaskRunID(airflowUUID, pipelineArtifactPageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, artifact := range artifacts {
+			switch input {
+			case models.PipelineEdgeInputArtifacts:
+				urls = append(urls, artifact.URL)
+			case models.PipelineEdgeInputUrls:
+				// The additional data of raw documents only describes the fetch
+				if artifact.ArtifactType == models.ArtifactTypeRaw {
+					continue
+				}
+				for key, value := range artifact.AdditionalData {
+					if key != models.ArtifactDataSourceURL && isAbsoluteURL(value) {
+						urls = append(urls, value)
+					}
+				}
+			}
+		}
+
+		if len(artifacts) < pipelineArtifactPageSize {
+			break
+		}
+	}
+	return urls, nil
+}
+
+func getPipelineNodeRun(ctx context.Context, pipelineRunID uint64, key string) (*models.PipelineNodeRun, error) {
+	pipelineRun, err := models.GetPipelineRun(ctx, pipelineRunID)
+	if err != nil {
+		return nil, err
+	}
+	for _, nodeRun := range pipelineRun.NodeRuns {
+		if nodeRun.NodeKey == key {
+			return &nodeRun, nil
+		}
+	}
+	return nil, fmt.Errorf("pipeline run %d has no node %q", pipelineRunID, key)
+}
+
+func pipelineRunLockKey(pipelineRunID uint) string {
+	return fmt.Sprintf("pipeline-run:%d", pipelineRunID)
+}
+
+func isAbsoluteURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func mapPipelineToDto(pipeline *models.Pipeline) *models.PipelineDto {
+	pipelineDto := &models.PipelineDto{
+		ID:        strconv.FormatUint(uint64(pipeline.ID), 10),
+		Owner:     pipeline.Owner,
+		Name:      pipeline.Name,
+		Nodes:     make([]models.PipelineNodeDto, 0, len(pipeline.Nodes)),
+		Edges:     mapPipelineEdgesToDto(pipeline.Edges),
+		CreatedAt: pipeline.CreatedAt,
+	}
+	for _, node := range pipeline.Nodes {
+		pipelineDto.Nodes = append(pipelineDto.Nodes, models.PipelineNodeDto{
+			Key:    node.Key,
+			TaskID: strconv.FormatUint(uint64(node.TaskID), 10),
+		})
+	}
+	return pipelineDto
+}
+
+func mapPipelineEdgesToDto(edges []models.PipelineEdge) []models.PipelineEdgeDto {
+	edgeDtos := make([]models.PipelineEdgeDto, 0, len(edges))
+	for _, edge := range edges {
+		edgeDtos = append(edgeDtos, models.PipelineEdgeDto{
+			From:      edge.FromNode,
+			To:        edge.ToNode,
+			Condition: edge.Condition,
+			Input:     edge.Input,
+		})
+	}
+	return edgeDtos
+}
+
+func mapPipelineRunToDto(pipeline *models.Pipeline, pipelineRun *models.PipelineRun) *models.PipelineRunDto {
+	pipelineRunDto := &models.PipelineRunDto{
+		ID:          strconv.FormatUint(uint64(pipelineRun.ID), 10),
+		PipelineID:  strconv.FormatUint(uint64(pipelineRun.PipelineID), 10),
+		Status:      pipelineRun.Status,
+		StartTime:   pipelineRun.StartTime,
+		EndTime:     pipelineRun.EndTime,
+		TriggeredBy: pipelineRun.TriggeredBy,
+		Edges:       mapPipelineEdgesToDto(pipeline.Edges),
+	}
+
+	nodeRuns := make(map[string]models.PipelineNodeRun, len(pipelineRun.NodeRuns))
+	for _, nodeRun := range pipelineRun.NodeRuns {
+		nodeRuns[nodeRun.NodeKey] = nodeRun
+	}
+	for _, key := range pipeline.TopologicalOrder() {
+		nodeRun := nodeRuns[key]
+		nodeDto := models.PipelineRunNodeDto{
+			Key:     key,
+			TaskID:  strconv.FormatUint(uint64(pipeline.Node(key).TaskID), 10),
+			Status:  nodeRun.Status,
+			Message: nodeRun.Message,
+		}
+		if nodeRun.TaskRunID != nil {
+			nodeDto.TaskRunID = strconv.FormatUint(uint64(*nodeRun.TaskRunID), 10)
+		}
+		pipelineRunDto.Nodes = append(pipelineRunDto.Nodes, nodeDto)
+	}
+	return pipelineRunDto
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	apperrors "admin-api/errors"
+	"admin-api/models"
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/opentelemetry-go-extra/otelzap"
+	"go.uber.org/zap"
+)
+
+func TestPipelineRun(t *testing.T) {
+	taskService, db, mr := setupTestService(t)
+	defer mr.Close()
+	logger, _ := zap.NewDevelopment()
+	service := NewPipelineService(otelzap.New(logger), taskService)
+	taskService.SetPipelineHook(service)
+	ctx := context.Background()
+	require.NoError(t, db.AutoMigrate(&models.Pipeline{}, &models.PipelineNode{}, &models.PipelineEdge{}, &models.PipelineRun{}, &models.PipelineNodeRun{}))
+	require.NoError(t, models.EnsureRunQueue(ctx))
+
+	mockRepo := &MockTaskRunArtifactRepository{}
+	taskService.taskRunArtifactRepository = mockRepo
+
+	taskDefinitionJSON, _ := sonic.Marshal(mockTaskDefinition())
+	taskIDs := map[string]string{}
+	for _, name := range []string{"discover", "scrape", "alert"} {
+		task := models.Task{Owner: "user1", TaskName: name, TaskDefinition: taskDefinitionJSON}
+		require.NoError(t, db.Create(&task).Error)
+		taskIDs[name] = strconv.FormatUint(uint64(task.ID), 10)
+	}
+
+	pipeline, err := service.CreatePipeline(ctx, models.CreatePipelineRequest{
+		Name: "Listings",
+		Nodes: []models.PipelineNodeDto{
+			{Key: "discover", TaskID: taskIDs["discover"]},
+			{Key: "scrape", TaskID: taskIDs["scrape"]},
+			{Key: "alert", TaskID: taskIDs["alert"]},
+		},
+		Edges: []models.PipelineEdgeDto{
+			{From: "discover", To: "scrape", Condition: models.PipelineEdgeOnSuccess, Input: models.PipelineEdgeInputUrls},
+			{From: "discover", To: "alert", Condition: models.PipelineEdgeOnFailure},
+		},
+	}, "user1")
+	require.NoError(t, err)
+
+	var pipelineRun *models.PipelineRunDto
+
+	t.Run("Nodes without upstream nodes start right away", func(t *testing.T) {
+		pipelineRun, err = service.StartPipelineRun(ctx, pipeline.ID, "user1", "user1")
+		require.NoError(t, err)
+		assert.Equal(t, models.TaskStatusRunning, pipelineRun.Status)
+		require.Len(t, pipelineRun.Nodes, 3)
+		assert.Equal(t, "discover", pipelineRun.Nodes[0].Key)
+		assert.Equal(t, models.PipelineNodeRunning, pipelineRun.Nodes[0].Status)
+		assert.NotEmpty(t, pipelineRun.Nodes[0].TaskRunID)
+		assert.Equal(t, models.PipelineNodeWaiting, pipelineRun.Nodes[1].Status)
+		assert.Len(t, pipelineRun.Edges, 2)
+	})
+
+	t.Run("Finished runs trigger downstream runs with their URLs", func(t *testing.T) {
+		airflowInstanceID := gocql.UUIDFromTime(time.Now())
+		mockRepo.On("ListArtifactsByTaskRunID", airflowInstanceID, pipelineArtifactPageSize, 0).Return([]*models.TaskRunArtifact{
+			{URL: "https://example.com/listings", AdditionalData: map[string]string{"listing": "https://example.com/listing/1", "title": "Listing"}},
+			{URL: "https://example.com/listings?page=2", AdditionalData: map[string]string{"listing": "https://example.com/listing/2", "title": "Listing"}},
+		}, nil)
+
+		_, err := taskService.UpdateTaskRun(ctx, models.TaskRun{
+			Status:            models.TaskStatusComplete,
+			AirflowInstanceID: airflowInstanceID.String(),
+		}, pipelineRun.Nodes[0].TaskRunID)
+		require.NoError(t, err)
+
+		pipelineRun, err = service.GetPipelineRun(ctx, pipeline.ID, pipelineRun.ID, "user1")
+		require.NoError(t, err)
+		nodes := map[string]models.PipelineRunNodeDto{}
+		for _, node := range pipelineRun.Nodes {
+			nodes[node.Key] = node
+		}
+		assert.Equal(t, models.PipelineNodeSucceeded, nodes["discover"].Status)
+		assert.Equal(t, models.PipelineNodeSkipped, nodes["alert"].Status)
+		require.Equal(t, models.PipelineNodeRunning, nodes["scrape"].Status)
+
+		scrapeRunID, _ := strconv.ParseUint(nodes["scrape"].TaskRunID, 10, 64)
+		scrapeRun, err := models.GetTaskRun(ctx, scrapeRunID)
+		require.NoError(t, err)
+		assert.Equal(t, "scrape", scrapeRun.PipelineNodeKey)
+		var overrides models.TaskRunOverrides
+		require.NoError(t, sonic.Unmarshal(scrapeRun.Overrides, &overrides))
+		assert.Equal(t, []models.UrlSource{
+			{Type: models.SourceTypeUrl, URL: "https://example.com/listing/1"},
+			{Type: models.SourceTypeUrl, URL: "https://example.com/listing/2"},
+		}, overrides.Source)
+	})
+
+	t.Run("Pipeline run finishes with its last node", func(t *testing.T) {
+		var scrapeRunID string
+		for _, node := range pipelineRun.Nodes {
+			if node.Key == "scrape" {
+				scrapeRunID = node.TaskRunID
+			}
+		}
+		_, err := taskService.UpdateTaskRun(ctx, models.TaskRun{Status: models.TaskStatusFailed}, scrapeRunID)
+		require.NoError(t, err)
+
+		pipelineRun, err = service.GetPipelineRun(ctx, pipeline.ID, pipelineRun.ID, "user1")
+		require.NoError(t, err)
+		assert.Equal(t, models.TaskStatusFailed, pipelineRun.Status)
+		assert.False(t, pipelineRun.EndTime.IsZero())
+	})
+
+	t.Run("Pipelines of other users are not found", func(t *testing.T) {
+		_, err := service.GetPipeline(ctx, pipeline.ID, "user2")
+		assert.ErrorIs(t, err, apperrors.ErrPipelineNotFound)
+	})
+
+	t.Run("Invalid pipelines", func(t *testing.T) {
+		_, err := service.CreatePipeline(ctx, models.CreatePipelineRequest{
+			Nodes: []models.PipelineNodeDto{{Key: "a", TaskID: taskIDs["discover"]}, {Key: "b", TaskID: taskIDs["scrape"]}},
+			Edges: []models.PipelineEdgeDto{
+				{From: "a", To: "b", Condition: models.PipelineEdgeAlways},
+				{From: "b", To: "a", Condition: models.PipelineEdgeAlways},
+			},
+		}, "user1")
+		assert.ErrorIs(t, err, apperrors.ErrInvalidPipeline)
+
+		_, err = service.CreatePipeline(ctx, models.CreatePipelineRequest{
+			Nodes: []models.PipelineNodeDto{{Key: "a", TaskID: taskIDs["discover"]}},
+		}, "user2")
+		assert.ErrorIs(t, err, apperrors.ErrInvalidPipeline)
+	})
+
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"admin-api/config"
+	"admin-api/models"
+	"context"
+	"time"
+
+	"github.com/uptrace/opentelemetry-go-extra/otelzap"
+	"go.uber.org/zap"
+)
+
+const defaultDeadLetterCount = 100
+
+type QueueService struct {
+	logger *otelzap.Logger
+	cfg    config.QueueConfig
+}
+
+func NewQueueService(logger *otelzap.Logger, cfg config.QueueConfig) *QueueService {
+	return &QueueService{logger: logger, cfg: cfg}
+}
+
+func (s *QueueService) GetQueueStats(ctx context.Context) (*models.RunQueueStats, error) {
+	stats, err := models.GetRunQueueStats(ctx)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Failed to get run queue stats", zap.Error(err))
+		return nil, err
+	}
+	return stats, nil
+}
+
+func (s *QueueService) ListDeadLetters(ctx context.Context, count int64) ([]models.DeadLetter, error) {
+	if count <= 0 {
+		count = defaultDeadLetterCount
+	}
+
+	deadLetters, err := models.ListDeadLetters(ctx, count)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Failed to list dead letters", zap.Error(err))
+		return nil, err
+	}
+	return deadLetters, nil
+}
+
+func (s *QueueService) RequeueDeadLetter(ctx context.Context, messageID string) (*models.DeadLetter, error) {
+	deadLetter, err := models.RequeueDeadLetter(ctx, messageID)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Failed to requeue dead letter", zap.String("message_id", messageID), zap.Error(err))
+		return nil, err
+	}
+
+	s.logger.Ctx(ctx).Info("Requeued dead letter", zap.String("message_id", messageID), zap.Uint64("task_run_id", deadLetter.TaskRunID))
+	return deadLetter, nil
+}
+
+func (s *QueueService) DiscardDeadLetter(ctx context.Context, messageID string) error {
+	if err := models.DiscardDeadLetter(ctx, messageID); err != nil {
+		s.logger.Ctx(ctx).Error("Failed to discard dead letter", zap.String("message_id", messageID), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// ClaimTaskRuns hands queued task runs to a worker.
+func (s *QueueService) ClaimTaskRuns(ctx context.Context, consumer string, count int64, block time.Duration) ([]models.QueuedTaskRun, error) {
+	queuedRuns, err := models.ClaimTaskRuns(ctx, s.cfg, consumer, count, block)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Failed to claim task runs", zap.String("consumer", consumer), zap.Error(err))
+		return nil, err
+	}
+	return queuedRuns, nil
+}
+
+// PromoteDelayedTaskRuns queues the delayed task runs that are due at now.
+func (s *QueueService) PromoteDelayedTaskRuns(ctx context.Context, now time.Time) (int, error) {
+	promoted, err := models.PromoteDelayedTaskRuns(ctx, now)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Failed to promote delayed task runs", zap.Error(err))
+		return promoted, err
+	}
+	return promoted, nil
+}
+
+// AckTaskRun marks a claimed task run as handled by the worker.
+func (s *QueueService) AckTaskRun(ctx context.Context, queuedRun models.QueuedTaskRun) error {
+	if err := models.AckTaskRun(ctx, queuedRun.MessageID); err != nil {
+		s.logger.Ctx(ctx).Error("Failed to acknowledge task run", zap.Uint64("task_run_id", queuedRun.TaskRunID), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// ExtendTaskRunClaim keeps a task run claimed by the worker executing it.
+func (s *QueueService) ExtendTaskRunClaim(ctx context.Context, consumer string, queuedRun models.QueuedTaskRun) (bool, error) {
+	extended, err := models.ExtendTaskRunClaim(ctx, consumer, queuedRun.MessageID)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Failed to extend task run claim", zap.Uint64("task_run_id", queuedRun.TaskRunID), zap.Error(err))
+		return false, err
+	}
+	return extended, nil
+}
+
+// DeadLetterTaskRun gives up on a claimed task run that can never succeed.
+func (s *QueueService) DeadLetterTaskRun(ctx context.Context, queuedRun models.QueuedTaskRun, reason string) error {
+	if err := models.DeadLetterTaskRun(ctx, queuedRun, reason); err != nil {
+		s.logger.Ctx(ctx).Error("Failed to dead-letter task run", zap.Uint64("task_run_id", queuedRun.TaskRunID), zap.Error(err))
+		return err
+	}
+
+	s.logger.Ctx(ctx).Warn("Dead-lettered task run", zap.Uint64("task_run_id", queuedRun.TaskRunID), zap.String("reason", reason))
+	return nil
+}
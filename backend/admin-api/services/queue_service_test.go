@@ -0,0 +1,64 @@
+package services
+
+import (
+	"admin-api/config"
+	"admin-api/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/opentelemetry-go-extra/otelzap"
+	"go.uber.org/zap"
+)
+
+func setupTestQueueService(t *testing.T) *QueueService {
+	logger, _ := zap.NewDevelopment()
+	return NewQueueService(otelzap.New(logger), config.QueueConfig{VisibilityTimeout: time.Minute, MaxDeliveries: 3})
+}
+
+func TestCreateTaskRunEnqueuesRun(t *testing.T) {
+	taskService, db, mr := setupTestService(t)
+	defer mr.Close()
+	queueService := setupTestQueueService(t)
+	ctx := context.Background()
+
+	require.NoError(t, models.EnsureRunQueue(ctx))
+
+	taskDefinitionJSON, _ := sonic.Marshal(mockTaskDefinition())
+	task := models.Task{Owner: "user1", TaskName: "Task", TaskDefinition: taskDefinitionJSON}
+	require.NoError(t, db.Create(&task).Error)
+
+	taskRun, err := taskService.CreateTaskRun(ctx, models.TaskRun{TaskID: task.ID})
+	require.NoError(t, err)
+
+	stats, err := queueService.GetQueueStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Waiting)
+
+	claimed, err := queueService.ClaimTaskRuns(ctx, "worker1", 1, -1)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, uint64(taskRun.ID), claimed[0].TaskRunID)
+
+	require.NoError(t, queueService.DeadLetterTaskRun(ctx, claimed[0], "task not found"))
+
+	deadLetters, err := queueService.ListDeadLetters(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, deadLetters, 1)
+	assert.Equal(t, "task not found", deadLetters[0].Reason)
+
+	_, err = queueService.RequeueDeadLetter(ctx, deadLetters[0].MessageID)
+	require.NoError(t, err)
+
+	claimed, err = queueService.ClaimTaskRuns(ctx, "worker1", 1, -1)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	require.NoError(t, queueService.AckTaskRun(ctx, claimed[0]))
+
+	stats, err = queueService.GetQueueStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, models.RunQueueStats{}, *stats)
+}
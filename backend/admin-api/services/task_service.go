@@ -1,13 +1,21 @@
 package services
 
 import (
+	"admin-api/clients"
+	"admin-api/config"
+	apperrors "admin-api/errors"
 	"admin-api/models"
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
 	"strconv"
 	"time"
 
+	"github.com/bytedance/sonic"
 	"github.com/gocql/gocql"
 	"github.com/uptrace/opentelemetry-go-extra/otelzap"
 	"go.uber.org/zap"
@@ -17,15 +25,43 @@ import (
 type ArtifactRepository interface {
 	InsertArtifact(artifact *models.TaskRunArtifact) error
 	ListArtifactsByTaskRunID(airflowInstanceId gocql.UUID, limit int, offset int) ([]*models.TaskRunArtifact, error)
+	GetArtifact(airflowInstanceId gocql.UUID, artifactId gocql.UUID) (*models.TaskRunArtifact, error)
+}
+
+const (
+	defaultSchedulePreviewCount = 5
+	maxSchedulePreviewCount     = 50
+
+	// replacedByConcurrencyPolicy is recorded as the canceller of runs
+	// replaced by a newer run of the same task.
+	replacedByConcurrencyPolicy = "concurrency-policy"
+
+	// maxUploadBytes caps the size of a file uploaded to a task.
+	maxUploadBytes = 32 << 20
+)
+
+// PipelineHook is notified when a run that belongs to a pipeline finishes.
+// retryRun is the next attempt of the run if it is retried.
+type PipelineHook interface {
+	TaskRunFinished(ctx context.Context, taskRun *models.TaskRun, retryRun *models.TaskRun) error
 }
 
 type TaskService struct {
 	logger                    *otelzap.Logger
 	taskRunArtifactRepository ArtifactRepository
+	blobs                     clients.BlobStore
+	cfg                       config.ConcurrencyConfig
+	pipelineHook              PipelineHook
 }
 
-func NewTaskService(logger *otelzap.Logger, taskRunMetadataRepository ArtifactRepository) *TaskService {
-	return &TaskService{logger: logger, taskRunArtifactRepository: taskRunMetadataRepository}
+func NewTaskService(logger *otelzap.Logger, taskRunMetadataRepository ArtifactRepository, blobs clients.BlobStore, cfg config.ConcurrencyConfig) *TaskService {
+	return &TaskService{logger: logger, taskRunArtifactRepository: taskRunMetadataRepository, blobs: blobs, cfg: cfg}
+}
+
+// SetPipelineHook sets the hook that advances pipelines when one of their
+// runs finishes. Without it, finished runs do not trigger downstream runs.
+func (s *TaskService) SetPipelineHook(hook PipelineHook) {
+	s.pipelineHook = hook
 }
 
 func (s *TaskService) GetAllTasks(ctx context.Context) ([]models.TaskDto, error) {
@@ -103,6 +139,10 @@ func (s *TaskService) GetTaskById(ctx context.Context, taskID string) (*models.T
 }
 
 func (s *TaskService) CreateTask(ctx context.Context, task models.Task, userID string) (*models.Task, error) {
+	if err := s.validateTaskDefinition(ctx, task.TaskDefinition); err != nil {
+		return nil, err
+	}
+
 	createTask := models.Task{
 		Owner:          userID,
 		TaskDefinition: task.TaskDefinition,
@@ -136,6 +176,10 @@ func (s *TaskService) UpdateTask(ctx context.Context, task models.Task, userID s
 		return nil, err
 	}
 
+	if err := s.validateTaskDefinition(ctx, task.TaskDefinition); err != nil {
+		return nil, err
+	}
+
 	existingTask.TaskDefinition = task.TaskDefinition
 	existingTask.TaskName = task.TaskName
 	existingTask.Status = task.Status
@@ -171,6 +215,95 @@ func (s *TaskService) DeleteTask(ctx context.Context, taskID string) error {
 	return nil
 }
 
+func (s *TaskService) PauseTask(ctx context.Context, taskID string, resumeAt *time.Time) (*models.TaskDto, error) {
+	taskIDUint, err := strconv.ParseUint(taskID, 10, 64)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Failed to parse task id", zap.Error(err))
+		return nil, err
+	}
+
+	if resumeAt != nil && !resumeAt.After(time.Now()) {
+		return nil, apperrors.ErrInvalidResumeTime
+	}
+
+	if err := models.PauseTask(ctx, taskIDUint, resumeAt); err != nil {
+		s.logger.Ctx(ctx).Error("Failed to pause task", zap.Error(err))
+		return nil, err
+	}
+
+	return s.getUncachedTask(ctx, taskIDUint)
+}
+
+func (s *TaskService) ResumeTask(ctx context.Context, taskID string) (*models.TaskDto, error) {
+	taskIDUint, err := strconv.ParseUint(taskID, 10, 64)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Failed to parse task id", zap.Error(err))
+		return nil, err
+	}
+
+	if err := models.ResumeTask(ctx, taskIDUint); err != nil {
+		s.logger.Ctx(ctx).Error("Failed to resume task", zap.Error(err))
+		return nil, err
+	}
+
+	return s.getUncachedTask(ctx, taskIDUint)
+}
+
+// getUncachedTask clears the cached copy of a task that has just been changed
+// and returns it as stored in the database.
+func (s *TaskService) getUncachedTask(ctx context.Context, taskID uint64) (*models.TaskDto, error) {
+	if err := models.ClearTaskCache(ctx, taskID); err != nil {
+		s.logger.Ctx(ctx).Error("Failed to clear task cache", zap.Error(err))
+		return nil, err
+	}
+
+	task, err := models.GetTaskById(ctx, taskID)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Error while getting task from db", zap.Error(err))
+		return nil, err
+	}
+
+	return s.MapTaskToDto(ctx, task)
+}
+
+func (s *TaskService) PreviewSchedule(ctx context.Context, request models.SchedulePreviewRequest) ([]time.Time, error) {
+	definition := models.TaskDefinition{Period: request.Period, Cron: request.Cron, Timezone: request.Timezone}
+	schedule, err := definition.Schedule()
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Failed to parse schedule", zap.Error(err))
+		return nil, fmt.Errorf("%w: %v", apperrors.ErrInvalidTaskDefinition, err)
+	}
+	if schedule == nil {
+		return nil, fmt.Errorf("%w: task does not run periodically", apperrors.ErrInvalidTaskDefinition)
+	}
+
+	count := request.Count
+	if count <= 0 {
+		count = defaultSchedulePreviewCount
+	}
+	if count > maxSchedulePreviewCount {
+		count = maxSchedulePreviewCount
+	}
+
+	location, err := models.LoadTimezone(request.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", apperrors.ErrInvalidTaskDefinition, err)
+	}
+
+	fireTime := request.From
+	if fireTime.IsZero() {
+		fireTime = time.Now()
+	}
+
+	fireTimes := make([]time.Time, 0, count)
+	for i := 0; i < count; i++ {
+		fireTime = schedule.Next(fireTime)
+		fireTimes = append(fireTimes, fireTime.In(location))
+	}
+
+	return fireTimes, nil
+}
+
 func (s *TaskService) ListTaskRuns(ctx context.Context, taskID string) ([]*models.TaskRunDto, error) {
 	taskIDUint, err := strconv.ParseUint(taskID, 10, 64)
 	if err != nil {
@@ -211,16 +344,311 @@ func (s *TaskService) GetTaskRun(ctx context.Context, taskRunID string) (*models
 }
 
 func (s *TaskService) CreateTaskRun(ctx context.Context, taskRun models.TaskRun) (*models.TaskRun, error) {
-	taskRun.Status = models.TaskStatusCreated
-	createdTaskRun, err := models.CreateTaskRun(ctx, taskRun)
+	task, err := models.GetTaskById(ctx, uint64(taskRun.TaskID))
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Error while getting task from db", zap.Error(err))
+		return nil, err
+	}
+	if task.Paused {
+		return nil, apperrors.ErrTaskPaused
+	}
+
+	definition, err := task.Definition()
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Error while decoding task definition", zap.Error(err))
+		return nil, err
+	}
+
+	if taskRun.Attempt == 0 {
+		taskRun.Attempt = 1
+	}
+
+	var createdTaskRun *models.TaskRun
+	var replacedTaskRunIDs []uint
+	err = models.WithLock(ctx, ownerRunsLockKey(task.Owner), s.cfg.LockTTL, s.cfg.LockWait, func() error {
+		status, replaced, err := s.admitTaskRun(ctx, task, definition.ConcurrencyPolicy)
+		replacedTaskRunIDs = replaced
+		if err != nil {
+			return err
+		}
+
+		taskRun.Status = status
+		createdTaskRun, err = models.CreateTaskRun(ctx, taskRun)
+		return err
+	})
+	// Replaced runs are finished outside the owner's lock, as advancing their
+	// pipeline creates runs under it
+	for _, taskRunID := range replacedTaskRunIDs {
+		replacedRun, err := models.GetTaskRun(ctx, uint64(taskRunID))
+		if err != nil {
+			s.logger.Ctx(ctx).Error("Error while getting replaced task run", zap.Uint("task_run_id", taskRunID), zap.Error(err))
+			continue
+		}
+		s.taskRunFinished(ctx, replacedRun, nil)
+	}
 	if err != nil {
 		s.logger.Ctx(ctx).Error("Error while creating task run", zap.Error(err))
 		return nil, err
 	}
 
+	// Pending runs are enqueued once they are promoted
+	if createdTaskRun.Status == models.TaskStatusPending {
+		return createdTaskRun, nil
+	}
+
+	if err := s.enqueueTaskRun(ctx, createdTaskRun); err != nil {
+		return nil, err
+	}
 	return createdTaskRun, nil
 }
 
+// enqueueTaskRun queues a created task run, delayed until its NotBefore. A run
+// that cannot be queued is failed, as it would otherwise stay active forever
+// and block the concurrency policy of its task and the owner's cap.
+func (s *TaskService) enqueueTaskRun(ctx context.Context, taskRun *models.TaskRun) error {
+	var err error
+	if taskRun.NotBefore.After(time.Now()) {
+		err = models.EnqueueTaskRunAt(ctx, taskRun.ID, taskRun.NotBefore)
+	} else {
+		err = models.EnqueueTaskRun(ctx, taskRun.ID)
+	}
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Error while enqueueing task run", zap.Uint("task_run_id", taskRun.ID), zap.Error(err))
+		if _, failErr := s.FailCreatedTaskRun(ctx, *taskRun, fmt.Sprintf("failed to enqueue task run: %v", err)); failErr != nil {
+			s.logger.Ctx(ctx).Error("Error while failing unqueued task run", zap.Uint("task_run_id", taskRun.ID), zap.Error(failErr))
+		}
+		return err
+	}
+	return nil
+}
+
+// TriggerTaskRun starts a single run of the task right away, optionally with
+// one-off overrides of its definition.
+func (s *TaskService) TriggerTaskRun(ctx context.Context, taskID string, overrides *models.TaskRunOverrides) (*models.TaskRun, error) {
+	taskIDUint, err := strconv.ParseUint(taskID, 10, 64)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Failed to parse task id", zap.Error(err))
+		return nil, err
+	}
+
+	taskRun := models.TaskRun{TaskID: uint(taskIDUint), Type: models.TaskRunTypeSingle}
+	return s.createTaskRunWithOverrides(ctx, taskRun, overrides)
+}
+
+// CreateTaskRunFromRequest creates a run of a task requested through the API.
+// Unlike CreateTaskRun, it only takes the task and validated overrides from
+// the caller.
+func (s *TaskService) CreateTaskRunFromRequest(ctx context.Context, request models.CreateTaskRunRequest) (*models.TaskRun, error) {
+	return s.createTaskRunWithOverrides(ctx, models.TaskRun{TaskID: request.TaskID}, request.Overrides)
+}
+
+// createTaskRunWithOverrides validates the overrides against the definition
+// of the task and creates the run with them.
+func (s *TaskService) createTaskRunWithOverrides(ctx context.Context, taskRun models.TaskRun, overrides *models.TaskRunOverrides) (*models.TaskRun, error) {
+	if overrides != nil && !overrides.IsEmpty() {
+		if err := overrides.Validate(); err != nil {
+			return nil, fmt.Errorf("%w: %v", apperrors.ErrInvalidRunOverrides, err)
+		}
+
+		task, err := models.GetTaskById(ctx, uint64(taskRun.TaskID))
+		if err != nil {
+			s.logger.Ctx(ctx).Error("Error while getting task from db", zap.Error(err))
+			return nil, err
+		}
+		definition, err := task.Definition()
+		if err != nil {
+			s.logger.Ctx(ctx).Error("Error while decoding task definition", zap.Error(err))
+			return nil, err
+		}
+		// The extra targets must also fit the targets of the task
+		effective := overrides.Apply(*definition)
+		if err := effective.Validate(); err != nil {
+			return nil, fmt.Errorf("%w: %v", apperrors.ErrInvalidRunOverrides, err)
+		}
+
+		taskRun.Overrides, err = sonic.Marshal(overrides)
+		if err != nil {
+			s.logger.Ctx(ctx).Error("Failed to encode task run overrides", zap.Error(err))
+			return nil, err
+		}
+	}
+
+	return s.CreateTaskRun(ctx, taskRun)
+}
+
+// admitTaskRun applies the concurrency policy of the task and the per-user cap
+// to a new run, and returns the status the run should be created with and the
+// ids of the runs it cancelled to replace them. It must be called while
+// holding the owner's run lock.
+func (s *TaskService) admitTaskRun(ctx context.Context, task *models.Task, policy models.ConcurrencyPolicy) (models.TaskStatus, []uint, error) {
+	var replaced []uint
+	if policy != models.ConcurrencyPolicyAllow {
+		activeTaskRuns, err := models.ListActiveTaskRuns(ctx, uint64(task.ID))
+		if err != nil {
+			return models.TaskStatusUnknown, nil, err
+		}
+
+		if len(activeTaskRuns) > 0 {
+			switch policy {
+			case models.ConcurrencyPolicyForbid:
+				return models.TaskStatusUnknown, nil, apperrors.ErrConcurrentRun
+			case models.ConcurrencyPolicyQueue:
+				return models.TaskStatusPending, nil, nil
+			case models.ConcurrencyPolicyReplace:
+				for _, activeTaskRun := range activeTaskRuns {
+					cancelled, err := s.cancelTaskRun(ctx, &activeTaskRun, replacedByConcurrencyPolicy)
+					if cancelled {
+						replaced = append(replaced, activeTaskRun.ID)
+					}
+					if err != nil {
+						return models.TaskStatusUnknown, replaced, err
+					}
+				}
+			}
+		}
+	}
+
+	if s.cfg.MaxActiveRunsPerUser > 0 {
+		activeCount, err := models.CountActiveTaskRunsForOwner(ctx, task.Owner)
+		if err != nil {
+			return models.TaskStatusUnknown, replaced, err
+		}
+		if activeCount >= int64(s.cfg.MaxActiveRunsPerUser) {
+			if policy == models.ConcurrencyPolicyQueue {
+				return models.TaskStatusPending, replaced, nil
+			}
+			return models.TaskStatusUnknown, replaced, apperrors.ErrConcurrencyLimit
+		}
+	}
+
+	return models.TaskStatusCreated, replaced, nil
+}
+
+// promotePendingTaskRuns enqueues the pending runs of the task owner's tasks,
+// oldest first, as long as they no longer exceed a concurrency limit.
+func (s *TaskService) promotePendingTaskRuns(ctx context.Context, taskID uint) error {
+	task, err := models.GetTaskById(ctx, uint64(taskID))
+	if err != nil {
+		return err
+	}
+
+	var promotedTaskRuns []models.TaskRun
+	err = models.WithLock(ctx, ownerRunsLockKey(task.Owner), s.cfg.LockTTL, s.cfg.LockWait, func() error {
+		pendingTaskRuns, err := models.ListPendingTaskRunsForOwner(ctx, task.Owner)
+		if err != nil || len(pendingTaskRuns) == 0 {
+			return err
+		}
+
+		activeCount, err := models.CountActiveTaskRunsForOwner(ctx, task.Owner)
+		if err != nil {
+			return err
+		}
+
+		busyTasks := make(map[uint]bool)
+		backfillSlots := make(map[uint]int64)
+		for _, pendingTaskRun := range pendingTaskRuns {
+			if s.cfg.MaxActiveRunsPerUser > 0 && activeCount >= int64(s.cfg.MaxActiveRunsPerUser) {
+				break
+			}
+
+			// Backfill runs are limited by the concurrency of their backfill,
+			// other pending runs wait until their task has no active run.
+			backfillID := pendingTaskRun.BackfillID
+			if backfillID != nil {
+				slots, ok := backfillSlots[*backfillID]
+				if !ok {
+					slots, err = freeBackfillSlots(ctx, uint64(*backfillID))
+					if err != nil {
+						return err
+					}
+				}
+				backfillSlots[*backfillID] = slots
+				if slots <= 0 {
+					continue
+				}
+			} else {
+				if busyTasks[pendingTaskRun.TaskID] {
+					continue
+				}
+				busyTasks[pendingTaskRun.TaskID] = true
+
+				activeTaskRuns, err := models.ListActiveTaskRuns(ctx, uint64(pendingTaskRun.TaskID))
+				if err != nil {
+					return err
+				}
+				if len(activeTaskRuns) > 0 {
+					continue
+				}
+			}
+
+			promoted, err := models.PromotePendingTaskRun(ctx, uint64(pendingTaskRun.ID))
+			if err != nil {
+				return err
+			}
+			if promoted {
+				pendingTaskRun.Status = models.TaskStatusCreated
+				promotedTaskRuns = append(promotedTaskRuns, pendingTaskRun)
+				activeCount++
+				if backfillID != nil {
+					backfillSlots[*backfillID]--
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Every promoted run is queued, or failed if it cannot be, before the
+	// first error is returned
+	var enqueueErr error
+	for _, taskRun := range promotedTaskRuns {
+		if err := s.enqueueTaskRun(ctx, &taskRun); err != nil {
+			if enqueueErr == nil {
+				enqueueErr = err
+			}
+			continue
+		}
+		s.logger.Ctx(ctx).Info("Promoted pending task run", zap.Uint("task_run_id", taskRun.ID))
+	}
+	return enqueueErr
+}
+
+// freeBackfillSlots returns how many more runs of the backfill may be active.
+func freeBackfillSlots(ctx context.Context, backfillID uint64) (int64, error) {
+	backfill, err := models.GetBackfill(ctx, backfillID)
+	if err != nil {
+		return 0, err
+	}
+
+	activeCount, err := models.CountActiveBackfillRuns(ctx, backfillID)
+	if err != nil {
+		return 0, err
+	}
+	return int64(backfill.MaxConcurrency) - activeCount, nil
+}
+
+// taskRunFinished lets the pipeline the finished run belongs to, if any,
+// trigger its downstream runs. retryRun is the next attempt of the run if it
+// is retried.
+func (s *TaskService) taskRunFinished(ctx context.Context, taskRun *models.TaskRun, retryRun *models.TaskRun) {
+	if s.pipelineHook == nil || taskRun.PipelineRunID == nil {
+		return
+	}
+	if err := s.pipelineHook.TaskRunFinished(ctx, taskRun, retryRun); err != nil {
+		s.logger.Ctx(ctx).Error("Error while advancing pipeline run", zap.Uint("pipeline_run_id", *taskRun.PipelineRunID), zap.Error(err))
+	}
+}
+
+func ownerRunsLockKey(owner string) string {
+	return fmt.Sprintf("task-runs:owner:%s", owner)
+}
+
+func retryLockKey(taskRunID uint64) string {
+	return fmt.Sprintf("task-runs:retry:%d", taskRunID)
+}
+
 func (s *TaskService) UpdateTaskRun(ctx context.Context, taskRun models.TaskRun, taskRunID string) (*models.TaskRun, error) {
 	taskRunIDUint, err := strconv.ParseUint(taskRunID, 10, 64)
 	if err != nil {
@@ -234,9 +662,301 @@ func (s *TaskService) UpdateTaskRun(ctx context.Context, taskRun models.TaskRun,
 		return nil, err
 	}
 
+	if err := s.handleTaskRunUpdate(ctx, taskRun.Status, taskRunIDUint); err != nil {
+		return nil, err
+	}
 	return updatedTaskRun, nil
 }
 
+// FinishTaskRun records the outcome a worker reports for a running task run.
+// It reports false, without retrying the run or advancing its pipeline, if
+// the run is no longer running, e.g. because it was cancelled or timed out
+// while the worker executed it.
+func (s *TaskService) FinishTaskRun(ctx context.Context, taskRun models.TaskRun, taskRunID uint64) (bool, error) {
+	finished, err := models.FinishRunningTaskRun(ctx, taskRun, taskRunID)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Error while finishing task run", zap.Error(err))
+		return false, err
+	}
+	if !finished {
+		return false, nil
+	}
+
+	return true, s.handleTaskRunUpdate(ctx, taskRun.Status, taskRunID)
+}
+
+// handleTaskRunUpdate retries a run that was updated to failed, and promotes
+// pending runs and advances the pipeline of a run that finished.
+func (s *TaskService) handleTaskRunUpdate(ctx context.Context, status models.TaskStatus, taskRunID uint64) error {
+	var retryRun *models.TaskRun
+	var err error
+	if status == models.TaskStatusFailed {
+		retryRun, err = s.retryTaskRun(ctx, taskRunID)
+		if err != nil {
+			s.logger.Ctx(ctx).Error("Error while retrying task run", zap.Uint64("task_run_id", taskRunID), zap.Error(err))
+			return err
+		}
+	}
+
+	if status.IsFinished() {
+		finishedTaskRun, err := models.GetTaskRun(ctx, taskRunID)
+		if err != nil {
+			s.logger.Ctx(ctx).Error("Error while getting task run", zap.Error(err))
+			return err
+		}
+		if err := s.promotePendingTaskRuns(ctx, finishedTaskRun.TaskID); err != nil {
+			s.logger.Ctx(ctx).Error("Error while promoting pending task runs", zap.Error(err))
+		}
+		s.taskRunFinished(ctx, finishedTaskRun, retryRun)
+	}
+	return nil
+}
+
+// retryTaskRun creates the next attempt of a failed task run if the retry
+// policy of its task allows it. It returns nil if the run is not retried.
+func (s *TaskService) retryTaskRun(ctx context.Context, taskRunID uint64) (*models.TaskRun, error) {
+	failedRun, err := models.GetTaskRun(ctx, taskRunID)
+	if err != nil {
+		return nil, err
+	}
+
+	task, err := models.GetTaskById(ctx, uint64(failedRun.TaskID))
+	if err != nil {
+		return nil, err
+	}
+
+	definition, err := task.Definition()
+	if err != nil {
+		return nil, err
+	}
+
+	attempt := max(failedRun.Attempt, 1)
+	if task.Paused || definition.Retry == nil || !definition.Retry.ShouldRetry(attempt, failedRun.ErrorClass) {
+		return nil, nil
+	}
+
+	// The failure may be reported more than once, even concurrently, e.g. by
+	// a worker and the reaper. Only the first report creates the retry.
+	var retryRun *models.TaskRun
+	err = models.WithLock(ctx, retryLockKey(taskRunID), s.cfg.LockTTL, s.cfg.LockWait, func() error {
+		existingRetry, err := models.GetRetryOfTaskRun(ctx, taskRunID)
+		if err != nil {
+			return err
+		}
+		if existingRetry != nil {
+			retryRun = existingRetry
+			return nil
+		}
+
+		parentRunID := failedRun.ID
+		retryRun, err = s.CreateTaskRun(ctx, models.TaskRun{
+			TaskID:      failedRun.TaskID,
+			Type:        failedRun.Type,
+			Attempt:     attempt + 1,
+			ParentRunID: &parentRunID,
+			NotBefore:   time.Now().Add(definition.Retry.Backoff(attempt)),
+			Overrides:   failedRun.Overrides,
+			BackfillID:  failedRun.BackfillID,
+			WindowStart: failedRun.WindowStart,
+			WindowEnd:   failedRun.WindowEnd,
+
+			PipelineRunID:   failedRun.PipelineRunID,
+			PipelineNodeKey: failedRun.PipelineNodeKey,
+		})
+		if err != nil {
+			return err
+		}
+
+		s.logger.Ctx(ctx).Info("Scheduled task run retry",
+			zap.Uint64("task_run_id", taskRunID),
+			zap.Uint("retry_task_run_id", retryRun.ID),
+			zap.Int("attempt", retryRun.Attempt),
+			zap.Time("not_before", retryRun.NotBefore))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return retryRun, nil
+}
+
+// StartTaskRun marks a queued task run as running and returns it with the
+// definition it executes. Runs that have finished in the meantime, e.g.
+// because they were cancelled, are reported with ErrTaskRunFinished.
+func (s *TaskService) StartTaskRun(ctx context.Context, taskRunID uint64) (*models.TaskRun, *models.TaskDefinition, error) {
+	taskRun, err := models.GetTaskRun(ctx, taskRunID)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Error while getting task run", zap.Error(err))
+		return nil, nil, err
+	}
+
+	// Artifacts are stored under the instance id, a restarted run keeps it
+	airflowInstanceID := taskRun.AirflowInstanceID
+	if airflowInstanceID == "" {
+		airflowInstanceID = gocql.TimeUUID().String()
+	}
+
+	started, err := models.StartTaskRun(ctx, taskRunID, airflowInstanceID, time.Now())
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Error while starting task run", zap.Error(err))
+		return nil, nil, err
+	}
+	if !started {
+		return nil, nil, apperrors.ErrTaskRunFinished
+	}
+
+	task, err := models.GetTaskById(ctx, uint64(taskRun.TaskID))
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Error while getting task from db", zap.Error(err))
+		return nil, nil, err
+	}
+
+	definition, err := taskRun.EffectiveDefinition(task)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Error while decoding task definition", zap.Error(err))
+		return nil, nil, err
+	}
+
+	taskRun.Status = models.TaskStatusRunning
+	taskRun.AirflowInstanceID = airflowInstanceID
+	return taskRun, definition, nil
+}
+
+// PreviousCompletedTaskRun returns the latest complete run of the task of the
+// given run that was created before it, or nil if there is none.
+func (s *TaskService) PreviousCompletedTaskRun(ctx context.Context, taskRun *models.TaskRun) (*models.TaskRun, error) {
+	previous, err := models.GetPreviousCompletedTaskRun(ctx, uint64(taskRun.TaskID), uint64(taskRun.ID))
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Error while getting previous task run", zap.Error(err))
+		return nil, err
+	}
+	return previous, nil
+}
+
+func (s *TaskService) HeartbeatTaskRun(ctx context.Context, taskRunID string) error {
+	taskRunIDUint, err := strconv.ParseUint(taskRunID, 10, 64)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Failed to parse task run id", zap.Error(err))
+		return err
+	}
+
+	if err := models.HeartbeatTaskRun(ctx, taskRunIDUint, time.Now()); err != nil {
+		s.logger.Ctx(ctx).Error("Error while recording task run heartbeat", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// TimeOutTaskRun fails a running task run that has exceeded its deadline or
+// stopped sending heartbeats, and retries it like any other timed out run. It
+// reports false if the run was no longer running.
+func (s *TaskService) TimeOutTaskRun(ctx context.Context, taskRun models.TaskRun, message string) (bool, error) {
+	now := time.Now()
+	failed, err := models.FailRunningTaskRun(ctx, uint64(taskRun.ID), models.ErrorClassTimeout, message, now)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Error while timing out task run", zap.Error(err))
+		return false, err
+	}
+	if !failed {
+		return false, nil
+	}
+
+	err = models.PublishTaskRunEvent(ctx, models.TaskRunEvent{
+		Type:      models.TaskRunEventTimedOut,
+		TaskID:    taskRun.TaskID,
+		TaskRunID: taskRun.ID,
+		Status:    models.TaskStatusFailed,
+		Message:   message,
+		Time:      now,
+	})
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Error while publishing task run event", zap.Error(err))
+	}
+
+	return true, s.handleTaskRunUpdate(ctx, models.TaskStatusFailed, uint64(taskRun.ID))
+}
+
+// FailCreatedTaskRun fails a task run that no worker has started, because it
+// could not be enqueued or has waited too long to be claimed, and retries it
+// like any other failed run. It reports false if the run was started or
+// finished in the meantime.
+func (s *TaskService) FailCreatedTaskRun(ctx context.Context, taskRun models.TaskRun, message string) (bool, error) {
+	failed, err := models.FailCreatedTaskRun(ctx, uint64(taskRun.ID), models.ErrorClassQueue, message, time.Now())
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Error while failing created task run", zap.Error(err))
+		return false, err
+	}
+	if !failed {
+		return false, nil
+	}
+
+	return true, s.handleTaskRunUpdate(ctx, models.TaskStatusFailed, uint64(taskRun.ID))
+}
+
+// CancelTaskRun cancels a task run that has not finished yet and signals the
+// worker executing it to stop.
+func (s *TaskService) CancelTaskRun(ctx context.Context, taskRunID string, cancelledBy string) (*models.TaskRunDto, error) {
+	taskRunIDUint, err := strconv.ParseUint(taskRunID, 10, 64)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Failed to parse task run id", zap.Error(err))
+		return nil, err
+	}
+
+	taskRun, err := models.GetTaskRun(ctx, taskRunIDUint)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Error while getting task run", zap.Error(err))
+		return nil, err
+	}
+
+	cancelled, err := s.cancelTaskRun(ctx, taskRun, cancelledBy)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Error while cancelling task run", zap.Error(err))
+		return nil, err
+	}
+	if !cancelled {
+		return nil, apperrors.ErrTaskRunFinished
+	}
+
+	if err := s.promotePendingTaskRuns(ctx, taskRun.TaskID); err != nil {
+		s.logger.Ctx(ctx).Error("Error while promoting pending task runs", zap.Error(err))
+	}
+
+	cancelledRun, err := models.GetTaskRun(ctx, taskRunIDUint)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Error while getting task run", zap.Error(err))
+		return nil, err
+	}
+	s.taskRunFinished(ctx, cancelledRun, nil)
+	return s.MapTaskRunToDto(ctx, cancelledRun), nil
+}
+
+// cancelTaskRun cancels the task run unless it has already finished and
+// signals the worker executing it to stop.
+func (s *TaskService) cancelTaskRun(ctx context.Context, taskRun *models.TaskRun, cancelledBy string) (bool, error) {
+	now := time.Now()
+	cancelled, err := models.CancelTaskRun(ctx, uint64(taskRun.ID), cancelledBy, now)
+	if err != nil || !cancelled {
+		return false, err
+	}
+
+	if err := models.SignalTaskRunCancelled(ctx, taskRun.ID); err != nil {
+		return true, err
+	}
+
+	err = models.PublishTaskRunEvent(ctx, models.TaskRunEvent{
+		Type:      models.TaskRunEventCancelled,
+		TaskID:    taskRun.TaskID,
+		TaskRunID: taskRun.ID,
+		Status:    models.TaskStatusCancelled,
+		Message:   fmt.Sprintf("cancelled by %s", cancelledBy),
+		Time:      now,
+	})
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Error while publishing task run event", zap.Error(err))
+	}
+	return true, nil
+}
+
 func (s *TaskService) GetTaskRunArtifacts(ctx context.Context, taskRunID string, page int, pageSize int) ([]*models.TaskRunArtifactDto, error) {
 	taskRunIDUint, err := strconv.ParseUint(taskRunID, 10, 64)
 	if err != nil {
@@ -287,6 +1007,137 @@ func (s *TaskService) CreateTaskRunArtifact(ctx context.Context, artifact *model
 	return taskRunArtifact, nil
 }
 
+// UploadTaskFile stores a file uploaded to a task as a blob and records it as
+// an upload artifact of the task, which its upload sources reference by id.
+func (s *TaskService) UploadTaskFile(ctx context.Context, taskID string, filename string, contentType string, body io.Reader) (*models.TaskRunArtifactDto, error) {
+	taskIDUint, err := strconv.ParseUint(taskID, 10, 64)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Failed to parse task id", zap.Error(err))
+		return nil, err
+	}
+
+	task, err := models.GetTaskById(ctx, taskIDUint)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Error while getting task from db", zap.Error(err))
+		return nil, err
+	}
+
+	content, err := io.ReadAll(io.LimitReader(body, maxUploadBytes+1))
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Error while reading uploaded file", zap.Error(err))
+		return nil, err
+	}
+	if len(content) == 0 {
+		return nil, fmt.Errorf("%w: file is empty", apperrors.ErrInvalidUpload)
+	}
+	if len(content) > maxUploadBytes {
+		return nil, fmt.Errorf("%w: file is larger than %d bytes", apperrors.ErrInvalidUpload, maxUploadBytes)
+	}
+
+	artifactID := gocql.TimeUUID()
+	key := fmt.Sprintf("task-uploads/%d/%s", task.ID, artifactID)
+	bucket, err := s.blobs.Put(ctx, key, content)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Error while storing uploaded file", zap.Error(err))
+		return nil, err
+	}
+
+	uploadsID := models.TaskUploadsID(task.ID)
+	artifact := &models.TaskRunArtifact{
+		AirflowInstanceID: uploadsID,
+		AirflowTaskID:     uploadsID,
+		ArtifactID:        artifactID,
+		CreatedAt:         time.Now(),
+		ArtifactType:      models.ArtifactTypeUpload,
+		ContentType:       uploadContentType(filename, contentType, content),
+		ContentLength:     len(content),
+		S3Bucket:          bucket,
+		S3Key:             key,
+		AdditionalData:    map[string]string{models.ArtifactDataFilename: filepath.Base(filename)},
+	}
+	if err := s.taskRunArtifactRepository.InsertArtifact(artifact); err != nil {
+		s.logger.Ctx(ctx).Error("Error while inserting upload artifact", zap.Error(err))
+		return nil, err
+	}
+
+	return s.MapTaskRunArtifactToDto(ctx, artifact), nil
+}
+
+// ListTaskUploads returns a page of the files uploaded to a task, newest
+// first.
+func (s *TaskService) ListTaskUploads(ctx context.Context, taskID string, page int, pageSize int) ([]*models.TaskRunArtifactDto, error) {
+	taskIDUint, err := strconv.ParseUint(taskID, 10, 64)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Failed to parse task id", zap.Error(err))
+		return nil, err
+	}
+
+	offset := (page - 1) * pageSize
+	artifacts, err := s.taskRunArtifactRepository.ListArtifactsByTaskRunID(models.TaskUploadsID(uint(taskIDUint)), pageSize, offset)
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Error while getting task uploads", zap.Error(err))
+		return nil, err
+	}
+
+	uploadsDto := []*models.TaskRunArtifactDto{}
+	for _, artifact := range artifacts {
+		uploadsDto = append(uploadsDto, s.MapTaskRunArtifactToDto(ctx, artifact))
+	}
+	return uploadsDto, nil
+}
+
+// GetTaskUpload returns the upload artifact of a task referenced by an upload
+// source, or ErrUploadNotFound if the task has no such upload.
+func (s *TaskService) GetTaskUpload(ctx context.Context, taskID uint, uploadID string) (*models.TaskRunArtifact, error) {
+	artifactID, err := gocql.ParseUUID(uploadID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", apperrors.ErrUploadNotFound, uploadID)
+	}
+
+	artifact, err := s.taskRunArtifactRepository.GetArtifact(models.TaskUploadsID(taskID), artifactID)
+	if errors.Is(err, gocql.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s", apperrors.ErrUploadNotFound, uploadID)
+	}
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Error while getting task upload", zap.Error(err))
+		return nil, err
+	}
+	if artifact.ArtifactType != models.ArtifactTypeUpload {
+		return nil, fmt.Errorf("%w: %s", apperrors.ErrUploadNotFound, uploadID)
+	}
+	return artifact, nil
+}
+
+// uploadContentType returns the content type of an uploaded file. Browsers
+// send exports such as CSV files as application/octet-stream, so the type is
+// then guessed from the file name and the content.
+func uploadContentType(filename string, contentType string, content []byte) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType != "" && mediaType != "application/octet-stream" {
+		return contentType
+	}
+	if byExtension := mime.TypeByExtension(filepath.Ext(filename)); byExtension != "" {
+		return byExtension
+	}
+	return http.DetectContentType(content)
+}
+
+func (s *TaskService) validateTaskDefinition(ctx context.Context, taskDefinition []byte) error {
+	task := models.Task{TaskDefinition: taskDefinition}
+	definition, err := task.Definition()
+	if err != nil {
+		s.logger.Ctx(ctx).Error("Failed to decode task definition", zap.Error(err))
+		return fmt.Errorf("%w: %v", apperrors.ErrInvalidTaskDefinition, err)
+	}
+
+	if err := definition.Validate(); err != nil {
+		s.logger.Ctx(ctx).Error("Task definition is invalid", zap.Error(err))
+		return fmt.Errorf("%w: %v", apperrors.ErrInvalidTaskDefinition, err)
+	}
+
+	return nil
+}
+
 func (s *TaskService) MapTaskToDto(ctx context.Context, task *models.Task) (*models.TaskDto, error) {
 	// taskRun, err := models.GetLatestRunForTask(ctx, uint64(task.ID))
 	// if err != nil {
@@ -305,6 +1156,8 @@ func (s *TaskService) MapTaskToDto(ctx context.Context, task *models.Task) (*mod
 		TaskDefinition: string(task.TaskDefinition),
 		Status:         task.Status,
 		Owner:          task.Owner,
+		Paused:         task.Paused,
+		ResumeAt:       task.ResumeAt,
 		CreatedAt:      task.CreatedAt,
 		UpdatedAt:      task.UpdatedAt,
 		DeletedAt:      task.DeletedAt.Time,
@@ -315,11 +1168,37 @@ func (s *TaskService) MapTaskToDto(ctx context.Context, task *models.Task) (*mod
 
 func (s *TaskService) MapTaskRunToDto(ctx context.Context, taskRun *models.TaskRun) *models.TaskRunDto {
 	taskRunDto := &models.TaskRunDto{
+		ID:           strconv.FormatUint(uint64(taskRun.ID), 10),
 		TaskID:       strconv.FormatUint(uint64(taskRun.TaskID), 10),
+		Type:         taskRun.Type,
 		Status:       taskRun.Status,
 		StartTime:    taskRun.StartTime,
 		EndTime:      taskRun.EndTime,
 		ErrorMessage: taskRun.ErrorMessage,
+		ErrorClass:   taskRun.ErrorClass,
+		Attempt:      taskRun.Attempt,
+		HeartbeatAt:  taskRun.HeartbeatAt,
+		CancelledBy:  taskRun.CancelledBy,
+		CancelledAt:  taskRun.CancelledAt,
+		Overrides:    string(taskRun.Overrides),
+	}
+	if taskRun.BackfillID != nil {
+		taskRunDto.BackfillID = strconv.FormatUint(uint64(*taskRun.BackfillID), 10)
+	}
+	if taskRun.PipelineRunID != nil {
+		taskRunDto.PipelineRunID = strconv.FormatUint(uint64(*taskRun.PipelineRunID), 10)
+		taskRunDto.PipelineNodeKey = taskRun.PipelineNodeKey
+	}
+	if taskRun.ParentRunID != nil {
+		taskRunDto.ParentRunID = strconv.FormatUint(uint64(*taskRun.ParentRunID), 10)
+	}
+	taskRunDto.SourcesSucceeded = taskRun.SourcesSucceeded
+	taskRunDto.SourcesFailed = taskRun.SourcesFailed
+	taskRunDto.SourcesSkipped = taskRun.SourcesSkipped
+	if len(taskRun.SourceErrors) > 0 {
+		if err := sonic.Unmarshal(taskRun.SourceErrors, &taskRunDto.SourceErrors); err != nil {
+			s.logger.Ctx(ctx).Error("Error while decoding source errors of task run", zap.Uint("task_run_id", taskRun.ID), zap.Error(err))
+		}
 	}
 	return taskRunDto
 }
@@ -368,6 +1247,8 @@ func (s *TaskService) MapDtoToTaskRunArtifact(ctx context.Context, artifact *mod
 		ContentLength:     artifact.ContentLength,
 		StatusCode:        artifact.StatusCode,
 		AdditionalData:    artifact.AdditionalData,
+		S3Bucket:          artifact.S3Bucket,
+		S3Key:             artifact.S3Key,
 	}
 	return taskRunArtifact, nil
 }
@@ -1,11 +1,15 @@
 package services
 
 import (
+	"admin-api/config"
+	apperrors "admin-api/errors"
 	"admin-api/models"
 	"context"
 	"errors"
 	"math/rand"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -53,7 +57,10 @@ func setupMiniRedis(t *testing.T) *miniredis.Miniredis {
 func setupTestService(t *testing.T) (*TaskService, *gorm.DB, *miniredis.Miniredis) {
 	logger, _ := zap.NewDevelopment()
 	taskRunArtifactRepo := &models.TaskRunArtifactRepository{}
-	service := NewTaskService(otelzap.New(logger), taskRunArtifactRepo)
+	service := NewTaskService(otelzap.New(logger), taskRunArtifactRepo, &memoryBlobStore{blobs: map[string][]byte{}}, config.ConcurrencyConfig{
+		LockTTL:  time.Second,
+		LockWait: time.Second,
+	})
 	db := setupTestDB(t)
 	mr := setupMiniRedis(t)
 	return service, db, mr
@@ -149,6 +156,59 @@ func TestCreateTask(t *testing.T) {
 	})
 }
 
+func TestCreateTaskWithInvalidSchedule(t *testing.T) {
+	service, _, mr := setupTestService(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	taskDefinition := mockTaskDefinition()
+	taskDefinition.Cron = "0 9 * * *"
+	taskDefinition.Timezone = "Europe/Nowhere"
+	taskDefinitionJSON, _ := sonic.Marshal(taskDefinition)
+
+	createdTask, err := service.CreateTask(ctx, models.Task{TaskName: "New Task", TaskDefinition: taskDefinitionJSON}, "user1")
+	assert.Nil(t, createdTask)
+	assert.ErrorIs(t, err, apperrors.ErrInvalidTaskDefinition)
+	assert.Contains(t, err.Error(), "Europe/Nowhere")
+}
+
+func TestPreviewSchedule(t *testing.T) {
+	service, _, mr := setupTestService(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	t.Run("Weekdays at 09:00 London across DST", func(t *testing.T) {
+		fireTimes, err := service.PreviewSchedule(ctx, models.SchedulePreviewRequest{
+			Cron:     "0 9 * * 1-5",
+			Timezone: "Europe/London",
+			From:     time.Date(2026, 3, 27, 0, 0, 0, 0, time.UTC),
+			Count:    2,
+		})
+		require.NoError(t, err)
+		require.Len(t, fireTimes, 2)
+		assert.Equal(t, "2026-03-27T09:00:00Z", fireTimes[0].Format(time.RFC3339))
+		assert.Equal(t, "2026-03-30T09:00:00+01:00", fireTimes[1].Format(time.RFC3339))
+	})
+
+	t.Run("Default count", func(t *testing.T) {
+		fireTimes, err := service.PreviewSchedule(ctx, models.SchedulePreviewRequest{Period: models.TaskPeriodHourly})
+		require.NoError(t, err)
+		assert.Len(t, fireTimes, defaultSchedulePreviewCount)
+	})
+
+	t.Run("Invalid expression", func(t *testing.T) {
+		fireTimes, err := service.PreviewSchedule(ctx, models.SchedulePreviewRequest{Cron: "0 25 * * *"})
+		assert.Nil(t, fireTimes)
+		assert.ErrorIs(t, err, apperrors.ErrInvalidTaskDefinition)
+	})
+
+	t.Run("Not periodic", func(t *testing.T) {
+		fireTimes, err := service.PreviewSchedule(ctx, models.SchedulePreviewRequest{Period: models.TaskPeriodSingle})
+		assert.Nil(t, fireTimes)
+		assert.ErrorIs(t, err, apperrors.ErrInvalidTaskDefinition)
+	})
+}
+
 func TestUpdateTask(t *testing.T) {
 	service, db, mr := setupTestService(t)
 	defer mr.Close()
@@ -217,17 +277,636 @@ func TestListTaskRuns(t *testing.T) {
 	})
 }
 
+func TestUpdateTaskRunRetriesFailedRun(t *testing.T) {
+	service, db, mr := setupTestService(t)
+	defer mr.Close()
+	ctx := context.Background()
+	require.NoError(t, models.EnsureRunQueue(ctx))
+
+	taskDefinition := mockTaskDefinition()
+	taskDefinition.Retry = &models.RetryPolicy{
+		MaxAttempts:           2,
+		InitialBackoffSeconds: 60,
+		RetryableErrors:       []models.ErrorClass{models.ErrorClassNetwork},
+	}
+	taskDefinitionJSON, _ := sonic.Marshal(taskDefinition)
+	task := models.Task{Owner: "user1", TaskName: "Flaky Task", TaskDefinition: taskDefinitionJSON}
+	require.NoError(t, db.Create(&task).Error)
+
+	firstRun, err := service.CreateTaskRun(ctx, models.TaskRun{TaskID: task.ID, Type: models.TaskRunTypePeriodic})
+	require.NoError(t, err)
+	assert.Equal(t, 1, firstRun.Attempt)
+
+	t.Run("Non retryable failure is not retried", func(t *testing.T) {
+		otherRun, err := service.CreateTaskRun(ctx, models.TaskRun{TaskID: task.ID})
+		require.NoError(t, err)
+
+		_, err = service.UpdateTaskRun(ctx, models.TaskRun{Status: models.TaskStatusFailed, ErrorClass: models.ErrorClassHttp4xx}, strconv.FormatUint(uint64(otherRun.ID), 10))
+		require.NoError(t, err)
+
+		retry, err := models.GetRetryOfTaskRun(ctx, uint64(otherRun.ID))
+		require.NoError(t, err)
+		assert.Nil(t, retry)
+	})
+
+	t.Run("Retryable failure is retried after the backoff", func(t *testing.T) {
+		failure := models.TaskRun{Status: models.TaskStatusFailed, ErrorClass: models.ErrorClassNetwork, ErrorMessage: "connection reset"}
+		_, err := service.UpdateTaskRun(ctx, failure, strconv.FormatUint(uint64(firstRun.ID), 10))
+		require.NoError(t, err)
+
+		// Reporting the same failure again does not create a second retry
+		_, err = service.UpdateTaskRun(ctx, failure, strconv.FormatUint(uint64(firstRun.ID), 10))
+		require.NoError(t, err)
+
+		var retries []models.TaskRun
+		require.NoError(t, db.Where("parent_run_id = ?", firstRun.ID).Find(&retries).Error)
+		require.Len(t, retries, 1)
+		assert.Equal(t, 2, retries[0].Attempt)
+		assert.Equal(t, models.TaskRunTypePeriodic, retries[0].Type)
+		assert.Equal(t, models.TaskStatusCreated, retries[0].Status)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), retries[0].NotBefore, 5*time.Second)
+
+		stats, err := models.GetRunQueueStats(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), stats.Delayed)
+
+		retryDto, err := service.GetTaskRun(ctx, strconv.FormatUint(uint64(retries[0].ID), 10))
+		require.NoError(t, err)
+		assert.Equal(t, strconv.FormatUint(uint64(firstRun.ID), 10), retryDto.ParentRunID)
+
+		// The retry is the last allowed attempt
+		_, err = service.UpdateTaskRun(ctx, failure, strconv.FormatUint(uint64(retries[0].ID), 10))
+		require.NoError(t, err)
+		retry, err := models.GetRetryOfTaskRun(ctx, uint64(retries[0].ID))
+		require.NoError(t, err)
+		assert.Nil(t, retry)
+	})
+}
+
+func TestConcurrentFailureReportsRetryOnce(t *testing.T) {
+	service, db, mr := setupTestService(t)
+	defer mr.Close()
+	ctx := context.Background()
+	require.NoError(t, models.EnsureRunQueue(ctx))
+	// The in-memory database only exists on a single connection
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	taskDefinition := mockTaskDefinition()
+	taskDefinition.Retry = &models.RetryPolicy{
+		MaxAttempts:     3,
+		RetryableErrors: []models.ErrorClass{models.ErrorClassNetwork, models.ErrorClassTimeout},
+	}
+	taskDefinitionJSON, _ := sonic.Marshal(taskDefinition)
+	task := models.Task{Owner: "user1", TaskName: "Flaky Task", TaskDefinition: taskDefinitionJSON}
+	require.NoError(t, db.Create(&task).Error)
+
+	taskRun, err := service.CreateTaskRun(ctx, models.TaskRun{TaskID: task.ID})
+	require.NoError(t, err)
+	taskRunID := strconv.FormatUint(uint64(taskRun.ID), 10)
+
+	// A worker and the reaper report the failure at the same time
+	failure := models.TaskRun{Status: models.TaskStatusFailed, ErrorClass: models.ErrorClassNetwork}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := service.UpdateTaskRun(ctx, failure, taskRunID)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	var retries []models.TaskRun
+	require.NoError(t, db.Where("parent_run_id = ?", taskRun.ID).Find(&retries).Error)
+	assert.Len(t, retries, 1)
+}
+
+func TestTimeOutTaskRun(t *testing.T) {
+	service, db, mr := setupTestService(t)
+	defer mr.Close()
+	ctx := context.Background()
+	require.NoError(t, models.EnsureRunQueue(ctx))
+
+	subscriber := mr.NewSubscriber()
+	defer subscriber.Close()
+	subscriber.Subscribe(models.TaskRunEventsChannel)
+	// miniredis blocks publishers until the message is read
+	events := make(chan string, 10)
+	go func() {
+		for message := range subscriber.Messages() {
+			events <- message.Message
+		}
+	}()
+
+	taskDefinition := mockTaskDefinition()
+	taskDefinition.Retry = &models.RetryPolicy{
+		MaxAttempts:     2,
+		RetryableErrors: []models.ErrorClass{models.ErrorClassTimeout},
+	}
+	taskDefinitionJSON, _ := sonic.Marshal(taskDefinition)
+	task := models.Task{Owner: "user1", TaskName: "Slow Task", TaskDefinition: taskDefinitionJSON}
+	require.NoError(t, db.Create(&task).Error)
+
+	taskRun := models.TaskRun{TaskID: task.ID, Status: models.TaskStatusRunning, Attempt: 1}
+	require.NoError(t, db.Create(&taskRun).Error)
+
+	t.Run("Running task run is failed and retried", func(t *testing.T) {
+		timedOut, err := service.TimeOutTaskRun(ctx, taskRun, "no heartbeat from worker for 5m0s")
+		require.NoError(t, err)
+		assert.True(t, timedOut)
+
+		failedRun, err := models.GetTaskRun(ctx, uint64(taskRun.ID))
+		require.NoError(t, err)
+		assert.Equal(t, models.TaskStatusFailed, failedRun.Status)
+		assert.Equal(t, models.ErrorClassTimeout, failedRun.ErrorClass)
+		assert.Equal(t, "no heartbeat from worker for 5m0s", failedRun.ErrorMessage)
+		assert.False(t, failedRun.EndTime.IsZero())
+
+		retry, err := models.GetRetryOfTaskRun(ctx, uint64(taskRun.ID))
+		require.NoError(t, err)
+		require.NotNil(t, retry)
+		assert.Equal(t, 2, retry.Attempt)
+
+		select {
+		case message := <-events:
+			var event models.TaskRunEvent
+			require.NoError(t, sonic.Unmarshal([]byte(message), &event))
+			assert.Equal(t, models.TaskRunEventTimedOut, event.Type)
+			assert.Equal(t, taskRun.ID, event.TaskRunID)
+			assert.Equal(t, models.TaskStatusFailed, event.Status)
+		case <-time.After(time.Second):
+			t.Fatal("no task run event published")
+		}
+	})
+
+	t.Run("Finished task run is left alone", func(t *testing.T) {
+		timedOut, err := service.TimeOutTaskRun(ctx, taskRun, "no heartbeat from worker for 5m0s")
+		require.NoError(t, err)
+		assert.False(t, timedOut)
+	})
+}
+
+func TestFinishTaskRun(t *testing.T) {
+	service, db, mr := setupTestService(t)
+	defer mr.Close()
+	ctx := context.Background()
+	require.NoError(t, models.EnsureRunQueue(ctx))
+
+	taskDefinition := mockTaskDefinition()
+	taskDefinition.Retry = &models.RetryPolicy{
+		MaxAttempts:     2,
+		RetryableErrors: []models.ErrorClass{models.ErrorClassNetwork},
+	}
+	taskDefinitionJSON, _ := sonic.Marshal(taskDefinition)
+	task := models.Task{Owner: "user1", TaskName: "Task", TaskDefinition: taskDefinitionJSON}
+	require.NoError(t, db.Create(&task).Error)
+	failure := models.TaskRun{Status: models.TaskStatusFailed, ErrorClass: models.ErrorClassNetwork}
+
+	t.Run("Running task run is finished and retried", func(t *testing.T) {
+		taskRun := models.TaskRun{TaskID: task.ID, Status: models.TaskStatusRunning, Attempt: 1}
+		require.NoError(t, db.Create(&taskRun).Error)
+
+		finished, err := service.FinishTaskRun(ctx, failure, uint64(taskRun.ID))
+		require.NoError(t, err)
+		assert.True(t, finished)
+
+		retry, err := models.GetRetryOfTaskRun(ctx, uint64(taskRun.ID))
+		require.NoError(t, err)
+		assert.NotNil(t, retry)
+	})
+
+	t.Run("Task run that is no longer running is left alone", func(t *testing.T) {
+		taskRun := models.TaskRun{TaskID: task.ID, Status: models.TaskStatusCancelled, Attempt: 1}
+		require.NoError(t, db.Create(&taskRun).Error)
+
+		finished, err := service.FinishTaskRun(ctx, failure, uint64(taskRun.ID))
+		require.NoError(t, err)
+		assert.False(t, finished)
+
+		cancelledRun, err := models.GetTaskRun(ctx, uint64(taskRun.ID))
+		require.NoError(t, err)
+		assert.Equal(t, models.TaskStatusCancelled, cancelledRun.Status)
+		retry, err := models.GetRetryOfTaskRun(ctx, uint64(taskRun.ID))
+		require.NoError(t, err)
+		assert.Nil(t, retry)
+	})
+}
+
+func TestCreateTaskRunEnqueueFailure(t *testing.T) {
+	service, db, mr := setupTestService(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	taskDefinition := mockTaskDefinition()
+	taskDefinition.ConcurrencyPolicy = models.ConcurrencyPolicyForbid
+	taskDefinitionJSON, _ := sonic.Marshal(taskDefinition)
+	task := models.Task{Owner: "user1", TaskName: "Task", TaskDefinition: taskDefinitionJSON}
+	require.NoError(t, db.Create(&task).Error)
+
+	// Adding to the run queue fails while its key holds another type
+	require.NoError(t, mr.Set(models.RunQueueStream, "broken"))
+	_, err := service.CreateTaskRun(ctx, models.TaskRun{TaskID: task.ID})
+	require.Error(t, err)
+
+	var taskRuns []models.TaskRun
+	require.NoError(t, db.Where("task_id = ?", task.ID).Find(&taskRuns).Error)
+	require.Len(t, taskRuns, 1)
+	assert.Equal(t, models.TaskStatusFailed, taskRuns[0].Status)
+	assert.Equal(t, models.ErrorClassQueue, taskRuns[0].ErrorClass)
+
+	// The failed run does not block the next one
+	mr.Del(models.RunQueueStream)
+	require.NoError(t, models.EnsureRunQueue(ctx))
+	taskRun, err := service.CreateTaskRun(ctx, models.TaskRun{TaskID: task.ID})
+	require.NoError(t, err)
+	assert.Equal(t, models.TaskStatusCreated, taskRun.Status)
+}
+
+func TestCreateTaskRunConcurrencyPolicy(t *testing.T) {
+	service, db, mr := setupTestService(t)
+	defer mr.Close()
+	ctx := context.Background()
+	require.NoError(t, models.EnsureRunQueue(ctx))
+
+	createTask := func(policy models.ConcurrencyPolicy) models.Task {
+		taskDefinition := mockTaskDefinition()
+		taskDefinition.ConcurrencyPolicy = policy
+		taskDefinitionJSON, _ := sonic.Marshal(taskDefinition)
+		task := models.Task{Owner: "user1", TaskName: "Task", TaskDefinition: taskDefinitionJSON}
+		require.NoError(t, db.Create(&task).Error)
+		return task
+	}
+	finish := func(taskRun *models.TaskRun) {
+		_, err := service.UpdateTaskRun(ctx, models.TaskRun{Status: models.TaskStatusComplete}, strconv.FormatUint(uint64(taskRun.ID), 10))
+		require.NoError(t, err)
+	}
+
+	t.Run("Allow runs overlap", func(t *testing.T) {
+		task := createTask(models.ConcurrencyPolicyAllow)
+		first, err := service.CreateTaskRun(ctx, models.TaskRun{TaskID: task.ID})
+		require.NoError(t, err)
+		second, err := service.CreateTaskRun(ctx, models.TaskRun{TaskID: task.ID})
+		require.NoError(t, err)
+		assert.Equal(t, models.TaskStatusCreated, second.Status)
+		finish(first)
+		finish(second)
+	})
+
+	t.Run("Forbid skips overlapping runs", func(t *testing.T) {
+		task := createTask(models.ConcurrencyPolicyForbid)
+		first, err := service.CreateTaskRun(ctx, models.TaskRun{TaskID: task.ID})
+		require.NoError(t, err)
+
+		_, err = service.CreateTaskRun(ctx, models.TaskRun{TaskID: task.ID})
+		assert.ErrorIs(t, err, apperrors.ErrConcurrentRun)
+
+		finish(first)
+		second, err := service.CreateTaskRun(ctx, models.TaskRun{TaskID: task.ID})
+		require.NoError(t, err)
+		finish(second)
+	})
+
+	t.Run("Replace cancels the active run", func(t *testing.T) {
+		task := createTask(models.ConcurrencyPolicyReplace)
+		first, err := service.CreateTaskRun(ctx, models.TaskRun{TaskID: task.ID})
+		require.NoError(t, err)
+
+		second, err := service.CreateTaskRun(ctx, models.TaskRun{TaskID: task.ID})
+		require.NoError(t, err)
+		assert.Equal(t, models.TaskStatusCreated, second.Status)
+
+		replaced, err := models.GetTaskRun(ctx, uint64(first.ID))
+		require.NoError(t, err)
+		assert.Equal(t, models.TaskStatusCancelled, replaced.Status)
+		assert.Equal(t, replacedByConcurrencyPolicy, replaced.CancelledBy)
+		finish(second)
+	})
+
+	t.Run("Queue holds runs until the active run finishes", func(t *testing.T) {
+		task := createTask(models.ConcurrencyPolicyQueue)
+		first, err := service.CreateTaskRun(ctx, models.TaskRun{TaskID: task.ID})
+		require.NoError(t, err)
+
+		second, err := service.CreateTaskRun(ctx, models.TaskRun{TaskID: task.ID})
+		require.NoError(t, err)
+		assert.Equal(t, models.TaskStatusPending, second.Status)
+
+		finish(first)
+		promoted, err := models.GetTaskRun(ctx, uint64(second.ID))
+		require.NoError(t, err)
+		assert.Equal(t, models.TaskStatusCreated, promoted.Status)
+		finish(promoted)
+	})
+
+	t.Run("Replaced runs reach the pipeline hook", func(t *testing.T) {
+		hook := &recordingPipelineHook{}
+		service.SetPipelineHook(hook)
+		defer service.SetPipelineHook(nil)
+
+		task := createTask(models.ConcurrencyPolicyReplace)
+		pipelineRunID := uint(42)
+		first, err := service.CreateTaskRun(ctx, models.TaskRun{TaskID: task.ID, PipelineRunID: &pipelineRunID})
+		require.NoError(t, err)
+
+		second, err := service.CreateTaskRun(ctx, models.TaskRun{TaskID: task.ID})
+		require.NoError(t, err)
+
+		require.Len(t, hook.finished, 1)
+		assert.Equal(t, first.ID, hook.finished[0].ID)
+		assert.Equal(t, models.TaskStatusCancelled, hook.finished[0].Status)
+		finish(second)
+	})
+
+	t.Run("Promoted runs wait for their backoff", func(t *testing.T) {
+		task := createTask(models.ConcurrencyPolicyQueue)
+		first, err := service.CreateTaskRun(ctx, models.TaskRun{TaskID: task.ID})
+		require.NoError(t, err)
+
+		second, err := service.CreateTaskRun(ctx, models.TaskRun{TaskID: task.ID, NotBefore: time.Now().Add(time.Hour)})
+		require.NoError(t, err)
+		assert.Equal(t, models.TaskStatusPending, second.Status)
+
+		finish(first)
+		delayed, err := mr.ZMembers(models.RunQueueDelayedSet)
+		require.NoError(t, err)
+		assert.Contains(t, delayed, strconv.FormatUint(uint64(second.ID), 10))
+		mr.Del(models.RunQueueDelayedSet)
+
+		promoted, err := models.GetTaskRun(ctx, uint64(second.ID))
+		require.NoError(t, err)
+		finish(promoted)
+	})
+
+	t.Run("Promoted runs that cannot be enqueued are failed", func(t *testing.T) {
+		task := createTask(models.ConcurrencyPolicyQueue)
+		first, err := service.CreateTaskRun(ctx, models.TaskRun{TaskID: task.ID})
+		require.NoError(t, err)
+
+		second, err := service.CreateTaskRun(ctx, models.TaskRun{TaskID: task.ID})
+		require.NoError(t, err)
+
+		// Adding to the run queue fails while its key holds another type
+		mr.Del(models.RunQueueStream)
+		require.NoError(t, mr.Set(models.RunQueueStream, "broken"))
+		finish(first)
+		mr.Del(models.RunQueueStream)
+		require.NoError(t, models.EnsureRunQueue(ctx))
+
+		failed, err := models.GetTaskRun(ctx, uint64(second.ID))
+		require.NoError(t, err)
+		assert.Equal(t, models.TaskStatusFailed, failed.Status)
+		assert.Equal(t, models.ErrorClassQueue, failed.ErrorClass)
+	})
+
+	t.Run("Per-user cap limits active runs", func(t *testing.T) {
+		service.cfg.MaxActiveRunsPerUser = 1
+		defer func() { service.cfg.MaxActiveRunsPerUser = 0 }()
+
+		allowed := createTask(models.ConcurrencyPolicyAllow)
+		queued := createTask(models.ConcurrencyPolicyQueue)
+
+		first, err := service.CreateTaskRun(ctx, models.TaskRun{TaskID: allowed.ID})
+		require.NoError(t, err)
+
+		_, err = service.CreateTaskRun(ctx, models.TaskRun{TaskID: allowed.ID})
+		assert.ErrorIs(t, err, apperrors.ErrConcurrencyLimit)
+
+		pending, err := service.CreateTaskRun(ctx, models.TaskRun{TaskID: queued.ID})
+		require.NoError(t, err)
+		assert.Equal(t, models.TaskStatusPending, pending.Status)
+
+		finish(first)
+		promoted, err := models.GetTaskRun(ctx, uint64(pending.ID))
+		require.NoError(t, err)
+		assert.Equal(t, models.TaskStatusCreated, promoted.Status)
+	})
+}
+
+func TestTriggerTaskRun(t *testing.T) {
+	service, db, mr := setupTestService(t)
+	defer mr.Close()
+	ctx := context.Background()
+	require.NoError(t, models.EnsureRunQueue(ctx))
+
+	taskDefinitionJSON, _ := sonic.Marshal(mockTaskDefinition())
+	task := models.Task{Owner: "user1", TaskName: "Task", TaskDefinition: taskDefinitionJSON}
+	require.NoError(t, db.Create(&task).Error)
+	taskID := strconv.FormatUint(uint64(task.ID), 10)
+
+	t.Run("Trigger without overrides", func(t *testing.T) {
+		taskRun, err := service.TriggerTaskRun(ctx, taskID, nil)
+		require.NoError(t, err)
+		assert.Equal(t, models.TaskRunTypeSingle, taskRun.Type)
+		assert.Equal(t, models.TaskStatusCreated, taskRun.Status)
+		assert.Empty(t, taskRun.Overrides)
+	})
+
+	t.Run("Trigger with overrides", func(t *testing.T) {
+		overrides := &models.TaskRunOverrides{
+			Source: []models.UrlSource{{Type: models.SourceTypeUrl, URL: "https://example.org"}},
+			Output: []models.Output{{Type: models.OutputTypeCsv}},
+		}
+		taskRun, err := service.TriggerTaskRun(ctx, taskID, overrides)
+		require.NoError(t, err)
+
+		storedRun, err := models.GetTaskRun(ctx, uint64(taskRun.ID))
+		require.NoError(t, err)
+		definition, err := storedRun.EffectiveDefinition(&task)
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.org", definition.Source[0].URL)
+		assert.Equal(t, models.OutputTypeCsv, definition.Output[0].Type)
+
+		taskRunDto, err := service.GetTaskRun(ctx, strconv.FormatUint(uint64(taskRun.ID), 10))
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"source":[{"type":1,"url":"https://example.org"}],"output":[{"type":2,"value":""}]}`, taskRunDto.Overrides)
+	})
+
+	t.Run("Invalid overrides", func(t *testing.T) {
+		overrides := &models.TaskRunOverrides{Source: []models.UrlSource{{URL: "not a url"}}}
+		_, err := service.TriggerTaskRun(ctx, taskID, overrides)
+		assert.ErrorIs(t, err, apperrors.ErrInvalidRunOverrides)
+	})
+
+	t.Run("Requested runs validate their overrides", func(t *testing.T) {
+		request := models.CreateTaskRunRequest{
+			TaskID:    task.ID,
+			Overrides: &models.TaskRunOverrides{Source: []models.UrlSource{{URL: "not a url"}}},
+		}
+		_, err := service.CreateTaskRunFromRequest(ctx, request)
+		assert.ErrorIs(t, err, apperrors.ErrInvalidRunOverrides)
+
+		request.Overrides = &models.TaskRunOverrides{Output: []models.Output{{Type: models.OutputTypeCsv}}}
+		taskRun, err := service.CreateTaskRunFromRequest(ctx, request)
+		require.NoError(t, err)
+		assert.Equal(t, 1, taskRun.Attempt)
+		assert.JSONEq(t, `{"output":[{"type":2,"value":""}]}`, string(taskRun.Overrides))
+	})
+
+	t.Run("Overrides are validated against the task definition", func(t *testing.T) {
+		scopedDefinition := mockTaskDefinition()
+		scopedDefinition.Target = []models.Target{{Type: models.TargetTypeQuery, Name: "title", Value: "h2", Scope: "article"}}
+		scopedDefinitionJSON, _ := sonic.Marshal(scopedDefinition)
+		scopedTask := models.Task{Owner: "user1", TaskName: "Scoped task", TaskDefinition: scopedDefinitionJSON}
+		require.NoError(t, db.Create(&scopedTask).Error)
+		scopedTaskID := strconv.FormatUint(uint64(scopedTask.ID), 10)
+
+		overrides := &models.TaskRunOverrides{
+			ExtraTarget: []models.Target{{Type: models.TargetTypeQuery, Name: "price", Value: ".price", Scope: "li"}},
+		}
+		_, err := service.TriggerTaskRun(ctx, scopedTaskID, overrides)
+		assert.ErrorIs(t, err, apperrors.ErrInvalidRunOverrides)
+
+		overrides = &models.TaskRunOverrides{
+			ExtraTarget: []models.Target{{Type: models.TargetTypeTable, Name: "rents", Table: &models.TableOptions{Caption: "rents"}}},
+		}
+		_, err = service.TriggerTaskRun(ctx, scopedTaskID, overrides)
+		assert.NoError(t, err)
+	})
+}
+
+func TestPauseAndResumeTask(t *testing.T) {
+	service, db, mr := setupTestService(t)
+	defer mr.Close()
+	ctx := context.Background()
+	require.NoError(t, db.AutoMigrate(&models.TaskSchedule{}))
+
+	taskDefinitionJSON, _ := sonic.Marshal(mockTaskDefinition())
+	task := models.Task{Owner: "user1", TaskName: "Task", TaskDefinition: taskDefinitionJSON}
+	require.NoError(t, db.Create(&task).Error)
+	taskID := strconv.FormatUint(uint64(task.ID), 10)
+
+	t.Run("Resume time must be in the future", func(t *testing.T) {
+		resumeAt := time.Now().Add(-time.Hour)
+		_, err := service.PauseTask(ctx, taskID, &resumeAt)
+		assert.ErrorIs(t, err, apperrors.ErrInvalidResumeTime)
+	})
+
+	t.Run("Paused task does not create runs", func(t *testing.T) {
+		resumeAt := time.Now().Add(time.Hour)
+		pausedTask, err := service.PauseTask(ctx, taskID, &resumeAt)
+		require.NoError(t, err)
+		assert.True(t, pausedTask.Paused)
+		require.NotNil(t, pausedTask.ResumeAt)
+		assert.WithinDuration(t, resumeAt, *pausedTask.ResumeAt, time.Second)
+
+		_, err = service.CreateTaskRun(ctx, models.TaskRun{TaskID: task.ID})
+		assert.ErrorIs(t, err, apperrors.ErrTaskPaused)
+	})
+
+	t.Run("Resumed task creates runs again", func(t *testing.T) {
+		_, err := models.SaveTaskSchedule(ctx, models.TaskSchedule{TaskID: task.ID, Spec: "period:3", NextRunAt: time.Now().Add(-time.Hour)})
+		require.NoError(t, err)
+
+		resumedTask, err := service.ResumeTask(ctx, taskID)
+		require.NoError(t, err)
+		assert.False(t, resumedTask.Paused)
+		assert.Nil(t, resumedTask.ResumeAt)
+
+		state, err := models.GetTaskSchedule(ctx, uint64(task.ID))
+		require.NoError(t, err)
+		assert.Nil(t, state)
+
+		_, err = service.CreateTaskRun(ctx, models.TaskRun{TaskID: task.ID})
+		assert.NoError(t, err)
+	})
+}
+
+func TestCancelTaskRun(t *testing.T) {
+	service, db, mr := setupTestService(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	task := models.Task{Owner: "user1", TaskName: "Task"}
+	require.NoError(t, db.Create(&task).Error)
+
+	taskRun := models.TaskRun{TaskID: task.ID, Status: models.TaskStatusRunning}
+	require.NoError(t, db.Create(&taskRun).Error)
+	taskRunID := strconv.FormatUint(uint64(taskRun.ID), 10)
+
+	t.Run("Running task run is cancelled", func(t *testing.T) {
+		cancelledRun, err := service.CancelTaskRun(ctx, taskRunID, "user1")
+		require.NoError(t, err)
+		assert.Equal(t, models.TaskStatusCancelled, cancelledRun.Status)
+		assert.Equal(t, "user1", cancelledRun.CancelledBy)
+		assert.False(t, cancelledRun.CancelledAt.IsZero())
+
+		cancelled, err := models.IsTaskRunCancelled(ctx, taskRun.ID)
+		require.NoError(t, err)
+		assert.True(t, cancelled)
+	})
+
+	t.Run("Finished task run cannot be cancelled", func(t *testing.T) {
+		_, err := service.CancelTaskRun(ctx, taskRunID, "user2")
+		assert.ErrorIs(t, err, apperrors.ErrTaskRunFinished)
+
+		taskRun, err := models.GetTaskRun(ctx, uint64(taskRun.ID))
+		require.NoError(t, err)
+		assert.Equal(t, "user1", taskRun.CancelledBy)
+	})
+}
+
+func TestStartTaskRun(t *testing.T) {
+	service, db, mr := setupTestService(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	taskDefinitionJSON, _ := sonic.Marshal(mockTaskDefinition())
+	task := models.Task{Owner: "user1", TaskName: "Task", TaskDefinition: taskDefinitionJSON}
+	require.NoError(t, db.Create(&task).Error)
+
+	overrides, _ := sonic.Marshal(models.TaskRunOverrides{Source: []models.UrlSource{{Type: models.SourceTypeUrl, URL: "https://example.com/override"}}})
+	taskRun := models.TaskRun{TaskID: task.ID, Status: models.TaskStatusCreated, Overrides: overrides}
+	require.NoError(t, db.Create(&taskRun).Error)
+
+	t.Run("Created task run is started", func(t *testing.T) {
+		startedRun, definition, err := service.StartTaskRun(ctx, uint64(taskRun.ID))
+		require.NoError(t, err)
+		assert.Equal(t, models.TaskStatusRunning, startedRun.Status)
+		assert.Equal(t, "https://example.com/override", definition.Source[0].URL)
+
+		storedRun, err := models.GetTaskRun(ctx, uint64(taskRun.ID))
+		require.NoError(t, err)
+		assert.Equal(t, models.TaskStatusRunning, storedRun.Status)
+		assert.Equal(t, startedRun.AirflowInstanceID, storedRun.AirflowInstanceID)
+		assert.False(t, storedRun.StartTime.IsZero())
+	})
+
+	t.Run("Restarted task run keeps its instance id", func(t *testing.T) {
+		storedRun, err := models.GetTaskRun(ctx, uint64(taskRun.ID))
+		require.NoError(t, err)
+
+		restartedRun, _, err := service.StartTaskRun(ctx, uint64(taskRun.ID))
+		require.NoError(t, err)
+		assert.Equal(t, storedRun.AirflowInstanceID, restartedRun.AirflowInstanceID)
+	})
+
+	t.Run("Cancelled task run is not started", func(t *testing.T) {
+		_, err := service.CancelTaskRun(ctx, strconv.FormatUint(uint64(taskRun.ID), 10), "user1")
+		require.NoError(t, err)
+
+		_, _, err = service.StartTaskRun(ctx, uint64(taskRun.ID))
+		assert.ErrorIs(t, err, apperrors.ErrTaskRunFinished)
+	})
+}
+
 func TestGetTaskRunArtifacts(t *testing.T) {
-	service, _, mr := setupTestService(t)
+	service, db, mr := setupTestService(t)
 	defer mr.Close()
 	ctx := context.Background()
 
+	taskDefinitionJSON, _ := sonic.Marshal(mockTaskDefinition())
+	task := models.Task{Owner: "user1", TaskName: "Task", TaskDefinition: taskDefinitionJSON}
+	require.NoError(t, db.Create(&task).Error)
+
 	mockRepo := &MockTaskRunArtifactRepository{}
 	service.taskRunArtifactRepository = mockRepo
 
 	t.Run("Successful retrieval", func(t *testing.T) {
 		taskRun := models.TaskRun{
-			TaskID:            1,
+			TaskID:            task.ID,
 			AirflowInstanceID: gocql.UUIDFromTime(time.Now()).String(),
 			Status:            models.TaskStatusComplete,
 			StartTime:         time.Now(),
@@ -319,6 +998,102 @@ func TestCreateTaskRunArtifact(t *testing.T) {
 	})
 }
 
+func TestUploadTaskFile(t *testing.T) {
+	service, db, mr := setupTestService(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	taskDefinitionJSON, _ := sonic.Marshal(mockTaskDefinition())
+	task := models.Task{Owner: "user1", TaskName: "Task", TaskDefinition: taskDefinitionJSON}
+	require.NoError(t, db.Create(&task).Error)
+	taskID := strconv.FormatUint(uint64(task.ID), 10)
+
+	mockRepo := &MockTaskRunArtifactRepository{}
+	service.taskRunArtifactRepository = mockRepo
+	blobs := service.blobs.(*memoryBlobStore)
+
+	t.Run("Successful upload", func(t *testing.T) {
+		var inserted *models.TaskRunArtifact
+		mockRepo.On("InsertArtifact", mock.AnythingOfType("*models.TaskRunArtifact")).Run(func(args mock.Arguments) {
+			inserted = args.Get(0).(*models.TaskRunArtifact)
+		}).Return(nil).Once()
+
+		upload, err := service.UploadTaskFile(ctx, taskID, "exports/listings.csv", "application/octet-stream", strings.NewReader("name,price\nflat,100\n"))
+		require.NoError(t, err)
+
+		assert.Equal(t, models.ArtifactTypeUpload, upload.ArtifactType)
+		assert.Equal(t, "text/csv; charset=utf-8", upload.ContentType)
+		assert.Equal(t, 20, upload.ContentLength)
+		assert.Equal(t, "listings.csv", upload.AdditionalData[models.ArtifactDataFilename])
+		assert.Equal(t, models.TaskUploadsID(task.ID), inserted.AirflowInstanceID)
+		assert.Equal(t, "test-bucket", inserted.S3Bucket)
+		assert.Equal(t, "name,price\nflat,100\n", string(blobs.blobs[inserted.S3Key]))
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Empty and oversized files are rejected", func(t *testing.T) {
+		_, err := service.UploadTaskFile(ctx, taskID, "empty.html", "text/html", strings.NewReader(""))
+		assert.ErrorIs(t, err, apperrors.ErrInvalidUpload)
+
+		_, err = service.UploadTaskFile(ctx, taskID, "large.html", "text/html", strings.NewReader(strings.Repeat("a", maxUploadBytes+1)))
+		assert.ErrorIs(t, err, apperrors.ErrInvalidUpload)
+	})
+
+	t.Run("Unknown task", func(t *testing.T) {
+		_, err := service.UploadTaskFile(ctx, "9999", "listings.csv", "text/csv", strings.NewReader("name\n"))
+		assert.Error(t, err)
+	})
+}
+
+func TestListTaskUploads(t *testing.T) {
+	service, _, mr := setupTestService(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	mockRepo := &MockTaskRunArtifactRepository{}
+	service.taskRunArtifactRepository = mockRepo
+
+	uploads := []*models.TaskRunArtifact{
+		{ArtifactID: gocql.TimeUUID(), ArtifactType: models.ArtifactTypeUpload, AdditionalData: map[string]string{models.ArtifactDataFilename: "listings.csv"}},
+		{ArtifactID: gocql.TimeUUID(), ArtifactType: models.ArtifactTypeUpload, AdditionalData: map[string]string{models.ArtifactDataFilename: "prices.html"}},
+	}
+	mockRepo.On("ListArtifactsByTaskRunID", models.TaskUploadsID(1), 10, 10).Return(uploads, nil)
+
+	listed, err := service.ListTaskUploads(ctx, "1", 2, 10)
+	require.NoError(t, err)
+	require.Len(t, listed, 2)
+	assert.Equal(t, uploads[0].ArtifactID.String(), listed[0].ArtifactID)
+	assert.Equal(t, "listings.csv", listed[0].AdditionalData[models.ArtifactDataFilename])
+	assert.Equal(t, uploads[1].ArtifactID.String(), listed[1].ArtifactID)
+	assert.Equal(t, "prices.html", listed[1].AdditionalData[models.ArtifactDataFilename])
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetTaskUpload(t *testing.T) {
+	service, _, mr := setupTestService(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	mockRepo := &MockTaskRunArtifactRepository{}
+	service.taskRunArtifactRepository = mockRepo
+
+	uploadID := gocql.TimeUUID()
+	artifact := &models.TaskRunArtifact{ArtifactID: uploadID, ArtifactType: models.ArtifactTypeUpload, S3Key: "task-uploads/1/" + uploadID.String()}
+	mockRepo.On("GetArtifact", models.TaskUploadsID(1), uploadID).Return(artifact, nil)
+	mockRepo.On("GetArtifact", models.TaskUploadsID(2), uploadID).Return(nil, gocql.ErrNotFound)
+
+	upload, err := service.GetTaskUpload(ctx, 1, uploadID.String())
+	require.NoError(t, err)
+	assert.Equal(t, artifact, upload)
+
+	// Uploads of other tasks are not found
+	_, err = service.GetTaskUpload(ctx, 2, uploadID.String())
+	assert.ErrorIs(t, err, apperrors.ErrUploadNotFound)
+
+	_, err = service.GetTaskUpload(ctx, 1, "not-a-uuid")
+	assert.ErrorIs(t, err, apperrors.ErrUploadNotFound)
+}
+
 func TestGetTaskRun(t *testing.T) {
 	service, db, mr := setupTestService(t)
 	defer mr.Close()
@@ -342,6 +1117,23 @@ func TestGetTaskRun(t *testing.T) {
 		assert.Equal(t, taskRun.Status, retrievedTaskRun.Status)
 	})
 
+	t.Run("Per-source results", func(t *testing.T) {
+		taskRun := models.TaskRun{
+			TaskID:           1,
+			Status:           models.TaskStatusComplete,
+			SourcesSucceeded: 2,
+			SourcesFailed:    1,
+			SourceErrors:     []byte(`[{"index":1,"url":"https://example.com/b","error_class":"http_4xx","message":"status 404"}]`),
+		}
+		require.NoError(t, db.Create(&taskRun).Error)
+
+		retrievedTaskRun, err := service.GetTaskRun(ctx, strconv.FormatUint(uint64(taskRun.ID), 10))
+		require.NoError(t, err)
+		assert.Equal(t, 2, retrievedTaskRun.SourcesSucceeded)
+		assert.Equal(t, 1, retrievedTaskRun.SourcesFailed)
+		assert.Equal(t, []models.SourceError{{Index: 1, URL: "https://example.com/b", ErrorClass: models.ErrorClassHttp4xx, Message: "status 404"}}, retrievedTaskRun.SourceErrors)
+	})
+
 	t.Run("TaskRun not found", func(t *testing.T) {
 		nonExistentID := "999"
 		retrievedTaskRun, err := service.GetTaskRun(ctx, nonExistentID)
@@ -406,6 +1198,16 @@ func mockTaskDefinitionWithRandomPeriod() models.TaskDefinition {
 	return task
 }
 
+// recordingPipelineHook records the finished runs it is notified of.
+type recordingPipelineHook struct {
+	finished []*models.TaskRun
+}
+
+func (h *recordingPipelineHook) TaskRunFinished(ctx context.Context, taskRun *models.TaskRun, retryRun *models.TaskRun) error {
+	h.finished = append(h.finished, taskRun)
+	return nil
+}
+
 // MockTaskRunArtifactRepository is a mock implementation of the TaskRunArtifactRepository
 type MockTaskRunArtifactRepository struct {
 	mock.Mock
@@ -421,6 +1223,31 @@ func (m *MockTaskRunArtifactRepository) InsertArtifact(artifact *models.TaskRunA
 	return args.Error(0)
 }
 
+func (m *MockTaskRunArtifactRepository) GetArtifact(airflowInstanceID gocql.UUID, artifactID gocql.UUID) (*models.TaskRunArtifact, error) {
+	args := m.Called(airflowInstanceID, artifactID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.TaskRunArtifact), args.Error(1)
+}
+
+type memoryBlobStore struct {
+	blobs map[string][]byte
+}
+
+func (s *memoryBlobStore) Put(ctx context.Context, key string, body []byte) (string, error) {
+	s.blobs[key] = body
+	return "test-bucket", nil
+}
+
+func (s *memoryBlobStore) Get(ctx context.Context, bucket string, key string) ([]byte, error) {
+	body, ok := s.blobs[key]
+	if !ok {
+		return nil, errors.New("blob not found")
+	}
+	return body, nil
+}
+
 func TestGetAllTasks(t *testing.T) {
 	service, db, mr := setupTestService(t)
 	defer mr.Close()
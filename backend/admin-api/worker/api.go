@@ -0,0 +1,223 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"admin-api/jsonpath"
+	"admin-api/models"
+
+	"github.com/bytedance/sonic"
+)
+
+// defaultApiMaxPages caps the pages requested by an API source when neither
+// the source nor the worker config sets a cap.
+const defaultApiMaxPages = 100
+
+// callApi requests the pages of an API source one after the other, following
+// its pagination until the last page or its page limit. Every page is stored
+// and extracted like a URL source and tagged with its page number. A page
+// that fails fails the source, since its records would be incomplete.
+func (w *Worker) callApi(ctx context.Context, taskRun *models.TaskRun, definition *models.TaskDefinition, index int, source models.UrlSource) sourceResult {
+	options := models.ApiOptions{}
+	if source.Api != nil {
+		options = *source.Api
+	}
+	pagination := models.ApiPagination{}
+	if options.Pagination != nil {
+		pagination = *options.Pagination
+	}
+
+	request := Request{
+		Method: strings.ToUpper(options.Method),
+		URL:    source.URL,
+		Header: map[string]string{"Accept": "application/json"},
+	}
+	for name, value := range options.Headers {
+		request.Header[http.CanonicalHeaderKey(name)] = value
+	}
+	if len(options.Body) > 0 {
+		request.Body = options.Body
+		if _, ok := request.Header["Content-Type"]; !ok {
+			request.Header["Content-Type"] = "application/json"
+		}
+	}
+
+	pager, err := newApiPager(source.URL, pagination)
+	if err != nil {
+		return sourceResult{done: true, err: err, errorClass: models.ErrorClassExtraction}
+	}
+
+	maxPages := firstPositive(pagination.MaxPages, w.cfg.ApiMaxPages, defaultApiMaxPages)
+	for page := 0; page < maxPages; page++ {
+		if page > 0 && w.isCancelled(ctx, taskRun.ID) {
+			break
+		}
+
+		tags := map[string]string{
+			models.ArtifactDataSourceIndex: strconv.Itoa(index),
+			models.ArtifactDataSourceURL:   source.URL,
+			models.ArtifactDataApiPage:     strconv.Itoa(page),
+		}
+		result, pageResult := w.fetchAndProcess(ctx, taskRun, definition, request, tags)
+		if pageResult.skipped != nil {
+			// The pages before a disallowed page were processed
+			if page == 0 {
+				return pageResult
+			}
+			break
+		}
+		if pageResult.err != nil {
+			if page > 0 {
+				pageResult.err = fmt.Errorf("page %d of %s: %w", page, source.URL, pageResult.err)
+			}
+			return pageResult
+		}
+
+		next, err := pager.next(result)
+		if err != nil {
+			return sourceResult{done: true, err: fmt.Errorf("failed to read the pagination of %s: %w", source.URL, err), errorClass: models.ErrorClassExtraction}
+		}
+		if next == "" || next == request.URL {
+			break
+		}
+		request.URL = next
+	}
+	return sourceResult{done: true}
+}
+
+// apiPager computes the URL of the next page of an API source.
+type apiPager struct {
+	pagination models.ApiPagination
+	base       *url.URL
+	cursorPath *jsonpath.Path
+	itemsPath  *jsonpath.Path
+	offset     int
+}
+
+func newApiPager(sourceURL string, pagination models.ApiPagination) (*apiPager, error) {
+	base, err := url.Parse(sourceURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid api url %s: %w", sourceURL, err)
+	}
+
+	pager := &apiPager{pagination: pagination, base: base}
+	switch pagination.Type {
+	case models.ApiPaginationCursor:
+		if pager.cursorPath, err = jsonpath.Compile(pagination.CursorPath); err != nil {
+			return nil, err
+		}
+	case models.ApiPaginationOffset:
+		if pager.itemsPath, err = jsonpath.Compile(pagination.ItemsPath); err != nil {
+			return nil, err
+		}
+		// The source URL may start at another offset than 0
+		pager.offset, _ = strconv.Atoi(base.Query().Get(pagination.Param))
+	}
+	return pager, nil
+}
+
+// next returns the URL of the page after result, or "" if it is the last one.
+func (p *apiPager) next(result *FetchResult) (string, error) {
+	switch p.pagination.Type {
+	case models.ApiPaginationCursor:
+		var doc any
+		if err := sonic.Unmarshal(result.Body, &doc); err != nil {
+			return "", err
+		}
+		values := p.cursorPath.Select(doc)
+		if len(values) == 0 {
+			return "", nil
+		}
+		cursor := cursorString(values[0])
+		if cursor == "" {
+			return "", nil
+		}
+		return p.withParam(cursor), nil
+	case models.ApiPaginationOffset:
+		var doc any
+		if err := sonic.Unmarshal(result.Body, &doc); err != nil {
+			return "", err
+		}
+		items := p.itemsPath.Select(doc)
+		count := len(items)
+		// A path to the list itself, such as $.items, selects one value
+		if count == 1 {
+			if list, ok := items[0].([]any); ok {
+				count = len(list)
+			}
+		}
+		if count < p.pagination.PageSize {
+			return "", nil
+		}
+		p.offset += p.pagination.PageSize
+		return p.withParam(strconv.Itoa(p.offset)), nil
+	case models.ApiPaginationLink:
+		return nextLink(result.Header.Values("Link"), result.FinalURL), nil
+	}
+	return "", nil
+}
+
+func (p *apiPager) withParam(value string) string {
+	u := *p.base
+	query := u.Query()
+	query.Set(p.pagination.Param, value)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func cursorString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// nextLink returns the rel="next" URL of Link headers, resolved against the
+// URL of the response, or "" if there is none.
+func nextLink(headers []string, responseURL string) string {
+	for _, header := range headers {
+		for {
+			start := strings.IndexByte(header, '<')
+			end := strings.IndexByte(header, '>')
+			if start < 0 || end < start {
+				break
+			}
+			link := header[start+1 : end]
+			header = header[end+1:]
+			params := header
+			if i := strings.IndexByte(header, '<'); i >= 0 {
+				params = header[:i]
+			}
+
+			for _, param := range strings.Split(params, ";") {
+				name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+				if !ok || !strings.EqualFold(strings.TrimSpace(name), "rel") {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(value), `",`)) {
+					if strings.EqualFold(rel, "next") {
+						base, err := url.Parse(responseURL)
+						if err != nil {
+							return link
+						}
+						return resolveLink(base, link)
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,207 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"admin-api/extract"
+	"admin-api/models"
+
+	"github.com/bytedance/sonic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var apiItems = []string{"a", "b", "c", "d", "e"}
+
+// apiRequest is a request received by the test API.
+type apiRequest struct {
+	method        string
+	query         string
+	authorization string
+	body          string
+}
+
+func newApiServer(t *testing.T) (*httptest.Server, func() []apiRequest) {
+	var mu sync.Mutex
+	var requests []apiRequest
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, apiRequest{method: r.Method, query: r.URL.RawQuery, authorization: r.Header.Get("Authorization"), body: string(body)})
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		items := func(from, to int) string {
+			var data []string
+			for i := from; i < min(to, len(apiItems)); i++ {
+				data = append(data, fmt.Sprintf(`{"id":%q}`, apiItems[i]))
+			}
+			return "[" + strings.Join(data, ",") + "]"
+		}
+		switch r.URL.Path {
+		case "/cursor":
+			// The cursor is the index of the first item of the page
+			from, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+			next := "null"
+			if from+2 < len(apiItems) {
+				next = strconv.Itoa(from + 2)
+			}
+			fmt.Fprintf(w, `{"data":%s,"meta":{"next":%s}}`, items(from, from+2), next)
+		case "/offset":
+			offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+			fmt.Fprintf(w, `{"items":%s}`, items(offset, offset+2))
+		case "/link":
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			if page < 2 {
+				w.Header().Add("Link", fmt.Sprintf(`<%s/link?page=%d>; rel="next", <%s/link?page=2>; rel="last"`, server.URL, page+1, server.URL))
+			}
+			fmt.Fprint(w, items(page*2, page*2+2))
+		case "/broken":
+			if r.URL.Query().Get("cursor") != "" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			fmt.Fprint(w, `{"data":[],"meta":{"next":"x"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return server, func() []apiRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]apiRequest(nil), requests...)
+	}
+}
+
+// apiRecords returns the ids of the records extracted from every page of an
+// API source, in page order.
+func apiRecords(t *testing.T, taskRuns *fakeTaskRunStore, blobs *memoryBlobStore) []any {
+	pages := map[int][]extract.Record{}
+	for _, artifact := range taskRuns.artifacts {
+		if artifact.ArtifactType != models.ArtifactTypeRecords {
+			continue
+		}
+		var records []extract.Record
+		require.NoError(t, sonic.Unmarshal(blobs.blobs[artifact.S3Key], &records))
+		page, err := strconv.Atoi(artifact.AdditionalData[models.ArtifactDataApiPage])
+		require.NoError(t, err)
+		pages[page] = records
+	}
+
+	var ids []any
+	for page := 0; page < len(pages); page++ {
+		for _, record := range pages[page] {
+			ids = append(ids, record["id"])
+		}
+	}
+	return ids
+}
+
+func TestWorkerProcessApiSource(t *testing.T) {
+	ctx := context.Background()
+	target := []models.Target{{Type: models.TargetTypeJsonPath, Name: "id", Value: "$..id"}}
+
+	t.Run("Cursor pagination", func(t *testing.T) {
+		server, requests := newApiServer(t)
+		defer server.Close()
+
+		worker, _, taskRuns, blobs := setupTestWorker(t)
+		taskRuns.addRun(1, &models.TaskDefinition{Target: target, Source: []models.UrlSource{{
+			Type: models.SourceTypeApi,
+			URL:  server.URL + "/cursor",
+			Api: &models.ApiOptions{
+				Method:     "post",
+				Headers:    map[string]string{"authorization": "Bearer token"},
+				Body:       json.RawMessage(`{"query":"flats"}`),
+				Pagination: &models.ApiPagination{Type: models.ApiPaginationCursor, Param: "cursor", CursorPath: "$.meta.next"},
+			},
+		}}})
+
+		worker.process(ctx, models.QueuedTaskRun{MessageID: "1-0", TaskRunID: 1})
+
+		assert.Equal(t, models.TaskStatusComplete, taskRuns.updates["1"].Status)
+		assert.Equal(t, []any{"a", "b", "c", "d", "e"}, apiRecords(t, taskRuns, blobs))
+		assert.Equal(t, []apiRequest{
+			{method: http.MethodPost, query: "", authorization: "Bearer token", body: `{"query":"flats"}`},
+			{method: http.MethodPost, query: "cursor=2", authorization: "Bearer token", body: `{"query":"flats"}`},
+			{method: http.MethodPost, query: "cursor=4", authorization: "Bearer token", body: `{"query":"flats"}`},
+		}, requests())
+	})
+
+	t.Run("Offset pagination", func(t *testing.T) {
+		server, requests := newApiServer(t)
+		defer server.Close()
+
+		worker, _, taskRuns, blobs := setupTestWorker(t)
+		taskRuns.addRun(1, &models.TaskDefinition{Target: target, Source: []models.UrlSource{{
+			Type: models.SourceTypeApi,
+			URL:  server.URL + "/offset?offset=1",
+			Api: &models.ApiOptions{
+				Pagination: &models.ApiPagination{Type: models.ApiPaginationOffset, Param: "offset", PageSize: 2, ItemsPath: "$.items"},
+			},
+		}}})
+
+		worker.process(ctx, models.QueuedTaskRun{MessageID: "1-0", TaskRunID: 1})
+
+		assert.Equal(t, []any{"b", "c", "d", "e"}, apiRecords(t, taskRuns, blobs))
+		var queries []string
+		for _, request := range requests() {
+			queries = append(queries, request.query)
+		}
+		assert.Equal(t, []string{"offset=1", "offset=3", "offset=5"}, queries)
+	})
+
+	t.Run("Link header pagination with a page limit", func(t *testing.T) {
+		server, requests := newApiServer(t)
+		defer server.Close()
+
+		worker, _, taskRuns, blobs := setupTestWorker(t)
+		taskRuns.addRun(1, &models.TaskDefinition{Target: target, Source: []models.UrlSource{{
+			Type: models.SourceTypeApi,
+			URL:  server.URL + "/link",
+			Api:  &models.ApiOptions{Pagination: &models.ApiPagination{Type: models.ApiPaginationLink, MaxPages: 2}},
+		}}})
+
+		worker.process(ctx, models.QueuedTaskRun{MessageID: "1-0", TaskRunID: 1})
+
+		assert.Equal(t, []any{"a", "b", "c", "d"}, apiRecords(t, taskRuns, blobs))
+		assert.Len(t, requests(), 2)
+	})
+
+	t.Run("A failed page fails the source", func(t *testing.T) {
+		server, _ := newApiServer(t)
+		defer server.Close()
+
+		worker, _, taskRuns, _ := setupTestWorker(t)
+		taskRuns.addRun(1, &models.TaskDefinition{Target: target, Source: []models.UrlSource{{
+			Type: models.SourceTypeApi,
+			URL:  server.URL + "/broken",
+			Api:  &models.ApiOptions{Pagination: &models.ApiPagination{Type: models.ApiPaginationCursor, Param: "cursor", CursorPath: "$.meta.next"}},
+		}}})
+
+		worker.process(ctx, models.QueuedTaskRun{MessageID: "1-0", TaskRunID: 1})
+
+		update := taskRuns.updates["1"]
+		assert.Equal(t, models.TaskStatusFailed, update.Status)
+		assert.Equal(t, models.ErrorClassHttp4xx, update.ErrorClass)
+		assert.Contains(t, update.ErrorMessage, "page 1 of")
+	})
+}
+
+func TestNextLink(t *testing.T) {
+	headers := []string{`<https://api.example.com/items?page=1>; rel="prev", </items?page=3>; rel="next last"`}
+	assert.Equal(t, "https://api.example.com/items?page=3", nextLink(headers, "https://api.example.com/items?page=2"))
+	assert.Equal(t, "", nextLink([]string{`<https://api.example.com/items?page=1>; rel="first"`}, "https://api.example.com/items"))
+	assert.Equal(t, "", nextLink(nil, "https://api.example.com/items"))
+}
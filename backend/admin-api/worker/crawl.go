@@ -0,0 +1,354 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"admin-api/models"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xpath"
+	"github.com/bytedance/sonic"
+	"github.com/gocql/gocql"
+	"go.uber.org/zap"
+	"golang.org/x/net/html"
+)
+
+const (
+	// defaultCrawlMaxDepth and defaultCrawlMaxPages limit crawl sources when
+	// neither the source nor the worker config sets a limit.
+	defaultCrawlMaxDepth = 2
+	defaultCrawlMaxPages = 100
+	// defaultFollowSelector selects the links followed by crawl sources
+	// without follow rules.
+	defaultFollowSelector = "a[href]"
+)
+
+// Statuses of the pages of a crawl frontier.
+const (
+	crawlPageFetched = "fetched"
+	crawlPageFailed  = "failed"
+	// crawlPagePending pages were discovered but not fetched because the
+	// crawl reached its page limit or was cancelled.
+	crawlPagePending = "pending"
+	// crawlPageSkipped pages were not fetched because robots.txt disallows
+	// them.
+	crawlPageSkipped = "skipped"
+)
+
+// crawlPage is an entry of the frontier of a crawl, stored as an artifact of
+// the run when the crawl ends.
+type crawlPage struct {
+	URL    string `json:"url"`
+	Depth  int    `json:"depth"`
+	Parent string `json:"parent,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// crawlRules are the compiled link-follow rules of a crawl source.
+type crawlRules struct {
+	follow      cascadia.Selector
+	followXpath *xpath.Expr
+	pattern     *regexp.Regexp
+	next        cascadia.Selector
+	// domain is the host of the start URL without its www. prefix when
+	// links are kept to the same domain.
+	domain string
+}
+
+func compileCrawlRules(options models.CrawlOptions, start *url.URL) (*crawlRules, error) {
+	rules := &crawlRules{}
+	var err error
+	if options.Follow != "" || options.FollowXpath == "" {
+		follow := options.Follow
+		if follow == "" {
+			follow = defaultFollowSelector
+		}
+		if rules.follow, err = cascadia.Compile(follow); err != nil {
+			return nil, fmt.Errorf("invalid crawl selector %q: %w", follow, err)
+		}
+	}
+	if options.FollowXpath != "" {
+		if rules.followXpath, err = xpath.Compile(options.FollowXpath); err != nil {
+			return nil, fmt.Errorf("invalid crawl xpath %q: %w", options.FollowXpath, err)
+		}
+	}
+	if options.FollowPattern != "" {
+		if rules.pattern, err = regexp.Compile(options.FollowPattern); err != nil {
+			return nil, fmt.Errorf("invalid crawl pattern %q: %w", options.FollowPattern, err)
+		}
+	}
+	if options.Next != "" {
+		if rules.next, err = cascadia.Compile(options.Next); err != nil {
+			return nil, fmt.Errorf("invalid crawl selector %q: %w", options.Next, err)
+		}
+	}
+	if options.SameDomain {
+		rules.domain = strings.TrimPrefix(strings.ToLower(start.Hostname()), "www.")
+	}
+	return rules, nil
+}
+
+// inScope reports whether a link is on the domain of the start URL or one of
+// its subdomains, when the crawl is kept to it.
+func (r *crawlRules) inScope(link *url.URL) bool {
+	if r.domain == "" {
+		return true
+	}
+	// Host names are case insensitive
+	host := strings.ToLower(link.Hostname())
+	return host == r.domain || strings.HasSuffix(host, "."+r.domain)
+}
+
+// links returns the links of a page to follow one level deeper and its next
+// page links, resolved against the page URL and normalized.
+func (r *crawlRules) links(body []byte, pageURL string) (follow []string, next []string, err error) {
+	root, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resolve := func(links []string, value string, pattern *regexp.Regexp) []string {
+		u, err := base.Parse(strings.TrimSpace(value))
+		if err != nil {
+			return links
+		}
+		normalized, ok := normalizeURL(u)
+		if !ok || !r.inScope(u) || (pattern != nil && !pattern.MatchString(normalized)) {
+			return links
+		}
+		return append(links, normalized)
+	}
+
+	doc := goquery.NewDocumentFromNode(root)
+	if r.follow != nil {
+		doc.FindMatcher(r.follow).Each(func(i int, s *goquery.Selection) {
+			if value, ok := linkAttr(s.Nodes[0]); ok {
+				follow = resolve(follow, value, r.pattern)
+			}
+		})
+	}
+	if r.followXpath != nil {
+		if nodes, ok := r.followXpath.Evaluate(htmlquery.CreateXPathNavigator(root)).(*xpath.NodeIterator); ok {
+			for nodes.MoveNext() {
+				current := nodes.Current()
+				if current.NodeType() == xpath.AttributeNode {
+					follow = resolve(follow, current.Value(), r.pattern)
+				} else if value, ok := linkAttr(current.(*htmlquery.NodeNavigator).Current()); ok {
+					follow = resolve(follow, value, r.pattern)
+				}
+			}
+		}
+	}
+	if r.next != nil {
+		doc.FindMatcher(r.next).Each(func(i int, s *goquery.Selection) {
+			if value, ok := linkAttr(s.Nodes[0]); ok {
+				next = resolve(next, value, nil)
+			}
+		})
+	}
+	return follow, next, nil
+}
+
+func linkAttr(node *html.Node) (string, bool) {
+	for _, name := range []string{"href", "src"} {
+		for _, attr := range node.Attr {
+			if attr.Key == name && strings.TrimSpace(attr.Val) != "" {
+				return attr.Val, true
+			}
+		}
+	}
+	return "", false
+}
+
+// normalizeURL returns the form of an http or https URL that the crawl
+// deduplicates on: lowercase scheme and host, no default port, no fragment, a
+// root path instead of an empty one and sorted query parameters.
+func normalizeURL(u *url.URL) (string, bool) {
+	scheme := strings.ToLower(u.Scheme)
+	if (scheme != "http" && scheme != "https") || u.Host == "" {
+		return "", false
+	}
+
+	normalized := *u
+	normalized.Scheme = scheme
+	normalized.User = nil
+	normalized.Fragment = ""
+	normalized.RawFragment = ""
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && !(scheme == "http" && port == "80") && !(scheme == "https" && port == "443") {
+		host += ":" + port
+	}
+	normalized.Host = host
+	if normalized.Path == "" {
+		normalized.Path = "/"
+		normalized.RawPath = ""
+	}
+	if normalized.RawQuery != "" {
+		normalized.RawQuery = normalized.Query().Encode()
+	}
+	return normalized.String(), true
+}
+
+// crawl fetches the pages of a crawl source breadth first, from its start URL
+// and following the links selected by its rules up to its depth and page
+// limits. Every fetched page is stored and extracted like a URL source and
+// tagged with its depth; the frontier of the crawl is stored as an artifact
+// when it ends. Pages that cannot be fetched or that robots.txt disallows are
+// recorded in the frontier and only fail or skip the source when the start URL
+// cannot be fetched or is disallowed.
+func (w *Worker) crawl(ctx context.Context, taskRun *models.TaskRun, definition *models.TaskDefinition, index int, source models.UrlSource) sourceResult {
+	options := models.CrawlOptions{}
+	if source.Crawl != nil {
+		options = *source.Crawl
+	}
+
+	start, err := url.Parse(source.URL)
+	if err != nil {
+		return sourceResult{done: true, err: fmt.Errorf("invalid crawl url %s: %w", source.URL, err), errorClass: models.ErrorClassExtraction}
+	}
+	startURL, ok := normalizeURL(start)
+	if !ok {
+		return sourceResult{done: true, err: fmt.Errorf("invalid crawl url %s", source.URL), errorClass: models.ErrorClassExtraction}
+	}
+	rules, err := compileCrawlRules(options, start)
+	if err != nil {
+		return sourceResult{done: true, err: err, errorClass: models.ErrorClassExtraction}
+	}
+
+	maxDepth := firstPositive(options.MaxDepth, w.cfg.CrawlMaxDepth, defaultCrawlMaxDepth)
+	maxPages := firstPositive(options.MaxPages, w.cfg.CrawlMaxPages, defaultCrawlMaxPages)
+
+	frontier := []*crawlPage{{URL: startURL, Status: crawlPagePending}}
+	seen := map[string]bool{startURL: true}
+	enqueue := func(links []string, depth int, parent string) {
+		for _, link := range links {
+			if seen[link] {
+				continue
+			}
+			seen[link] = true
+			frontier = append(frontier, &crawlPage{URL: link, Depth: depth, Parent: parent, Status: crawlPagePending})
+		}
+	}
+
+	var result sourceResult
+	fetched := 0
+	for i := 0; i < len(frontier) && fetched < maxPages; i++ {
+		page := frontier[i]
+		if i > 0 && w.isCancelled(ctx, taskRun.ID) {
+			break
+		}
+
+		tags := map[string]string{
+			models.ArtifactDataSourceIndex: strconv.Itoa(index),
+			models.ArtifactDataSourceURL:   source.URL,
+			models.ArtifactDataCrawlDepth:  strconv.Itoa(page.Depth),
+		}
+		fetchResult, pageResult := w.fetchAndProcess(ctx, taskRun, definition, Request{URL: page.URL}, tags)
+		if i == 0 {
+			result = pageResult
+		}
+		if pageResult.skipped != nil {
+			page.Status = crawlPageSkipped
+			page.Error = pageResult.skipped.Error()
+			if i == 0 {
+				break
+			}
+			continue
+		}
+		fetched++
+		if pageResult.err != nil {
+			page.Status = crawlPageFailed
+			page.Error = pageResult.err.Error()
+			if i == 0 {
+				break
+			}
+			continue
+		}
+		page.Status = crawlPageFetched
+
+		if !strings.Contains(fetchResult.ContentType, "html") {
+			continue
+		}
+		follow, next, err := rules.links(fetchResult.Body, fetchResult.FinalURL)
+		if err != nil {
+			w.logger.Ctx(ctx).Warn("Failed to read crawl links", zap.Uint("task_run_id", taskRun.ID), zap.String("url", page.URL), zap.Error(err))
+			continue
+		}
+		enqueue(next, page.Depth, page.URL)
+		if page.Depth < maxDepth {
+			enqueue(follow, page.Depth+1, page.URL)
+		}
+	}
+
+	if err := w.storeFrontier(ctx, taskRun, source, index, frontier); err != nil && result.err == nil {
+		return sourceResult{done: true, err: fmt.Errorf("failed to store crawl frontier of %s: %w", source.URL, err)}
+	}
+	return result
+}
+
+// storeFrontier stores the pages discovered by a crawl as a JSON blob and
+// records it as a frontier artifact of the run.
+func (w *Worker) storeFrontier(ctx context.Context, taskRun *models.TaskRun, source models.UrlSource, index int, frontier []*crawlPage) error {
+	body, err := sonic.Marshal(frontier)
+	if err != nil {
+		return err
+	}
+
+	artifactID := gocql.TimeUUID()
+	key := fmt.Sprintf("task-runs/%d/%s.json", taskRun.ID, artifactID)
+
+	bucket, err := w.blobs.Put(ctx, key, body)
+	if err != nil {
+		return err
+	}
+
+	counts := map[string]int{}
+	for _, page := range frontier {
+		counts[page.Status]++
+	}
+
+	_, err = w.taskRuns.CreateTaskRunArtifact(ctx, &models.CreateTaskRunArtifactDto{
+		AirflowInstanceID: taskRun.AirflowInstanceID,
+		AirflowTaskID:     taskRun.AirflowInstanceID,
+		ArtifactID:        artifactID.String(),
+		CreatedAt:         time.Now(),
+		ArtifactType:      models.ArtifactTypeFrontier,
+		URL:               source.URL,
+		ContentType:       "application/json",
+		ContentLength:     len(body),
+		AdditionalData: map[string]string{
+			models.ArtifactDataSourceIndex: strconv.Itoa(index),
+			models.ArtifactDataSourceURL:   source.URL,
+			"pages_fetched":                strconv.Itoa(counts[crawlPageFetched]),
+			"pages_failed":                 strconv.Itoa(counts[crawlPageFailed]),
+			"pages_pending":                strconv.Itoa(counts[crawlPagePending]),
+			"pages_skipped":                strconv.Itoa(counts[crawlPageSkipped]),
+		},
+		S3Bucket: bucket,
+		S3Key:    key,
+	})
+	return err
+}
+
+func firstPositive(values ...int) int {
+	for _, value := range values {
+		if value > 0 {
+			return value
+		}
+	}
+	return 0
+}
@@ -0,0 +1,325 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"admin-api/config"
+	"admin-api/models"
+
+	"github.com/gocql/gocql"
+)
+
+const (
+	// maxRetryAfter caps how long a Retry-After header can delay a retry.
+	maxRetryAfter = time.Minute
+	// hostSlotPollInterval is how often a full host is polled for a free
+	// request slot.
+	hostSlotPollInterval = 50 * time.Millisecond
+	// hostSlotMargin is added to the request timeout to bound how long a
+	// request slot is held.
+	hostSlotMargin = 10 * time.Second
+)
+
+var (
+	errTooManyRedirects = errors.New("too many redirects")
+	errBodyTooLarge     = errors.New("response body too large")
+)
+
+// FetchResult is a successfully fetched document.
+type FetchResult struct {
+	URL         string
+	FinalURL    string
+	StatusCode  int
+	ContentType string
+	Header      http.Header
+	Body        []byte
+	Attempts    int
+}
+
+// Request is a request sent by Do. Its method defaults to GET.
+type Request struct {
+	Method string
+	URL    string
+	Header map[string]string
+	Body   []byte
+}
+
+// FetchError is a failed fetch, classified so that the task's retry policy
+// can decide whether to retry the run.
+type FetchError struct {
+	Class      models.ErrorClass
+	StatusCode int
+	Attempts   int
+	Err        error
+}
+
+func (e *FetchError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// Fetcher downloads documents over HTTP, retrying network errors, 429 and
+// 5xx responses with exponential backoff. When enabled, it skips the URLs
+// disallowed by robots.txt and spaces out and limits the requests sent to
+// each host across all workers.
+type Fetcher struct {
+	client       *http.Client
+	robotsClient *http.Client
+	cfg          config.FetcherConfig
+}
+
+func NewFetcher(httpClient *http.Client, cfg config.FetcherConfig) *Fetcher {
+	f := &Fetcher{cfg: cfg}
+
+	client := *httpClient
+	client.Timeout = cfg.Timeout
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) > cfg.MaxRedirects {
+			return fmt.Errorf("%w: stopped after %d redirects", errTooManyRedirects, cfg.MaxRedirects)
+		}
+		// Redirects may lead to paths or hosts that robots.txt disallows
+		_, err := f.checkRobots(req.Context(), req.URL)
+		return err
+	}
+	f.client = &client
+
+	robotsClient := *httpClient
+	robotsClient.Timeout = cfg.Timeout
+	robotsClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) > maxRobotsRedirects {
+			return fmt.Errorf("%w: stopped after %d redirects", errTooManyRedirects, maxRobotsRedirects)
+		}
+		return nil
+	}
+	f.robotsClient = &robotsClient
+	return f
+}
+
+func (f *Fetcher) Fetch(ctx context.Context, url string) (*FetchResult, error) {
+	return f.Do(ctx, Request{URL: url})
+}
+
+// Do sends the request, retrying it like Fetch. A request that robots.txt
+// disallows is not sent and fails with an error wrapping
+// errDisallowedByRobots.
+func (f *Fetcher) Do(ctx context.Context, request Request) (*FetchResult, error) {
+	u, err := url.Parse(request.URL)
+	if err != nil {
+		return nil, &FetchError{Class: models.ErrorClassUnknown, Err: err}
+	}
+	crawlDelay, err := f.checkRobots(ctx, u)
+	if err != nil {
+		var fetchErr *FetchError
+		if errors.As(err, &fetchErr) {
+			return nil, fetchErr
+		}
+		return nil, &FetchError{Class: models.ErrorClassUnknown, Err: err}
+	}
+
+	var fetchErr *FetchError
+	for attempt := 1; ; attempt++ {
+		release, waitErr := f.waitForHost(ctx, u.Host, crawlDelay)
+		if waitErr != nil {
+			return nil, &FetchError{Class: models.ErrorClassUnknown, Attempts: attempt, Err: waitErr}
+		}
+		result, retryAfter, err := f.fetchOnce(ctx, request)
+		release()
+		if err == nil {
+			result.Attempts = attempt
+			return result, nil
+		}
+
+		fetchErr = err
+		fetchErr.Attempts = attempt
+		if attempt > f.cfg.MaxRetries || !isRetryable(fetchErr.Class) {
+			return nil, fetchErr
+		}
+
+		backoff := f.cfg.RetryBackoff << (attempt - 1)
+		if retryAfter > 0 {
+			backoff = min(retryAfter, maxRetryAfter)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fetchErr
+		case <-time.After(backoff):
+		}
+	}
+}
+
+func (f *Fetcher) fetchOnce(ctx context.Context, request Request) (*FetchResult, time.Duration, *FetchError) {
+	method := request.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body io.Reader
+	if request.Body != nil {
+		body = bytes.NewReader(request.Body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, request.URL, body)
+	if err != nil {
+		return nil, 0, &FetchError{Class: models.ErrorClassUnknown, Err: err}
+	}
+	if f.cfg.UserAgent != "" {
+		req.Header.Set("User-Agent", f.cfg.UserAgent)
+	}
+	for name, value := range request.Header {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, 0, &FetchError{Class: classifyError(err), Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		fetchErr := &FetchError{
+			Class:      classifyStatus(resp.StatusCode),
+			StatusCode: resp.StatusCode,
+			Err:        fmt.Errorf("%s %s: %s", method, request.URL, resp.Status),
+		}
+		return nil, retryAfter(resp), fetchErr
+	}
+
+	data, err := readBody(resp.Body, f.cfg.MaxBodyBytes)
+	if err != nil {
+		return nil, 0, &FetchError{Class: classifyError(err), StatusCode: resp.StatusCode, Err: err}
+	}
+
+	return &FetchResult{
+		URL:         request.URL,
+		FinalURL:    resp.Request.URL.String(),
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Header:      resp.Header,
+		Body:        data,
+	}, 0, nil
+}
+
+func readBody(body io.Reader, maxBytes int64) ([]byte, error) {
+	if maxBytes <= 0 {
+		return io.ReadAll(body)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("%w: exceeds %d bytes", errBodyTooLarge, maxBytes)
+	}
+	return data, nil
+}
+
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func classifyStatus(statusCode int) models.ErrorClass {
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		return models.ErrorClassRateLimited
+	case statusCode >= http.StatusInternalServerError:
+		return models.ErrorClassHttp5xx
+	default:
+		return models.ErrorClassHttp4xx
+	}
+}
+
+// waitForHost waits until a request may be sent to host: until one of the
+// concurrent request slots of the host is free and at least the politeness
+// interval, or the Crawl-delay of the host if it is longer, has passed since
+// the previous request to it. The returned function releases the slot.
+func (f *Fetcher) waitForHost(ctx context.Context, host string, crawlDelay time.Duration) (func(), error) {
+	politeness := f.cfg.Politeness
+	release := func() {}
+	if politeness.MaxConcurrency > 0 {
+		owner := gocql.TimeUUID().String()
+		// The slot outlives the request, redirects included, in case the
+		// worker crashes before releasing it
+		ttl := max(f.cfg.Timeout, time.Second) + hostSlotMargin
+		for {
+			acquired, err := models.AcquireHostSlot(ctx, host, owner, politeness.MaxConcurrency, ttl)
+			if err != nil {
+				return nil, fmt.Errorf("failed to acquire request slot of %s: %w", host, err)
+			}
+			if acquired {
+				break
+			}
+			if err := sleep(ctx, hostSlotPollInterval); err != nil {
+				return nil, err
+			}
+		}
+		release = func() {
+			models.ReleaseHostSlot(context.Background(), host, owner)
+		}
+	}
+
+	if interval := max(politeness.MinInterval, crawlDelay); interval > 0 {
+		wait, err := models.ReserveHostSlot(ctx, host, interval)
+		if err != nil {
+			release()
+			return nil, fmt.Errorf("failed to reserve request slot of %s: %w", host, err)
+		}
+		if err := sleep(ctx, wait); err != nil {
+			release()
+			return nil, err
+		}
+	}
+	return release, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+func classifyError(err error) models.ErrorClass {
+	// Errors of redirects, such as an unreachable robots.txt, keep their class
+	var fetchErr *FetchError
+	if errors.As(err, &fetchErr) {
+		return fetchErr.Class
+	}
+	if errors.Is(err, errTooManyRedirects) || errors.Is(err, errBodyTooLarge) || errors.Is(err, errDisallowedByRobots) {
+		return models.ErrorClassUnknown
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return models.ErrorClassTimeout
+	}
+	return models.ErrorClassNetwork
+}
+
+func isRetryable(class models.ErrorClass) bool {
+	switch class {
+	case models.ErrorClassNetwork, models.ErrorClassTimeout, models.ErrorClassRateLimited, models.ErrorClassHttp5xx:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package worker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"admin-api/config"
+	"admin-api/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testFetcherConfig() config.FetcherConfig {
+	return config.FetcherConfig{
+		Timeout:      time.Second,
+		MaxRedirects: 2,
+		MaxRetries:   2,
+		RetryBackoff: time.Millisecond,
+		UserAgent:    "test-agent",
+		MaxBodyBytes: 1024,
+	}
+}
+
+func TestFetch(t *testing.T) {
+	ctx := context.Background()
+	fetcher := NewFetcher(&http.Client{}, testFetcherConfig())
+
+	t.Run("Successful fetch", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "test-agent", r.UserAgent())
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html></html>"))
+		}))
+		defer server.Close()
+
+		result, err := fetcher.Fetch(ctx, server.URL)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, result.StatusCode)
+		assert.Equal(t, "text/html", result.ContentType)
+		assert.Equal(t, "<html></html>", string(result.Body))
+		assert.Equal(t, 1, result.Attempts)
+	})
+
+	t.Run("Server errors are retried", func(t *testing.T) {
+		var requests atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if requests.Add(1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("ok"))
+		}))
+		defer server.Close()
+
+		result, err := fetcher.Fetch(ctx, server.URL)
+		require.NoError(t, err)
+		assert.Equal(t, 3, result.Attempts)
+	})
+
+	t.Run("Client errors are not retried", func(t *testing.T) {
+		var requests atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer server.Close()
+
+		_, err := fetcher.Fetch(ctx, server.URL)
+		var fetchErr *FetchError
+		require.ErrorAs(t, err, &fetchErr)
+		assert.Equal(t, models.ErrorClassHttp4xx, fetchErr.Class)
+		assert.Equal(t, http.StatusNotFound, fetchErr.StatusCode)
+		assert.Equal(t, int32(1), requests.Load())
+	})
+
+	t.Run("Rate limits give up after the retries", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer server.Close()
+
+		_, err := fetcher.Fetch(ctx, server.URL)
+		var fetchErr *FetchError
+		require.ErrorAs(t, err, &fetchErr)
+		assert.Equal(t, models.ErrorClassRateLimited, fetchErr.Class)
+		assert.Equal(t, 3, fetchErr.Attempts)
+	})
+
+	t.Run("Redirects are limited", func(t *testing.T) {
+		var server *httptest.Server
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, server.URL+r.URL.Path+"x", http.StatusFound)
+		}))
+		defer server.Close()
+
+		_, err := fetcher.Fetch(ctx, server.URL+"/")
+		var fetchErr *FetchError
+		require.ErrorAs(t, err, &fetchErr)
+		assert.Equal(t, models.ErrorClassUnknown, fetchErr.Class)
+		assert.Equal(t, 1, fetchErr.Attempts)
+	})
+
+	t.Run("Large bodies are rejected", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(strings.Repeat("a", 2048)))
+		}))
+		defer server.Close()
+
+		_, err := fetcher.Fetch(ctx, server.URL)
+		assert.ErrorIs(t, err, errBodyTooLarge)
+	})
+
+	t.Run("Timeouts are classified", func(t *testing.T) {
+		cfg := testFetcherConfig()
+		cfg.Timeout = 20 * time.Millisecond
+		cfg.MaxRetries = 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+		}))
+		defer server.Close()
+
+		_, err := NewFetcher(&http.Client{}, cfg).Fetch(ctx, server.URL)
+		var fetchErr *FetchError
+		require.ErrorAs(t, err, &fetchErr)
+		assert.Equal(t, models.ErrorClassTimeout, fetchErr.Class)
+	})
+}
@@ -0,0 +1,299 @@
+package worker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"admin-api/models"
+)
+
+const (
+	// defaultRobotsCacheTTL is how long a robots.txt is cached when the
+	// config does not set a period.
+	defaultRobotsCacheTTL = 24 * time.Hour
+	// robotsUnreachableTTL is how long an unreachable robots.txt is cached,
+	// so that it is requested again soon without being requested for every
+	// URL of its host.
+	robotsUnreachableTTL = time.Minute
+	// maxRobotsBytes caps the part of a robots.txt that is read, RFC 9309
+	// requires parsing at least 500 KiB.
+	maxRobotsBytes = 500 << 10
+	// maxRobotsRedirects is how many redirects are followed for a robots.txt.
+	maxRobotsRedirects = 5
+)
+
+var (
+	errDisallowedByRobots = errors.New("disallowed by robots.txt")
+	errRobotsUnreachable  = errors.New("robots.txt is unreachable")
+)
+
+// robotsRule is an Allow or Disallow line of a robots.txt group.
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// robotsRules are the rules of a robots.txt that apply to the fetcher's user
+// agent.
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+	// unreachable is set when the robots.txt could not be fetched, in which
+	// case no URL of the host may be fetched until it can be. statusCode is
+	// the status it was answered with, 0 for a network error.
+	unreachable bool
+	statusCode  int
+}
+
+// rulesFor returns the rules of a fetched robots.txt for userAgent. Like RFC
+// 9309, a missing robots.txt (4xx) allows everything and one that cannot be
+// fetched (5xx, 429 or a network error) disallows everything.
+func rulesFor(robots *models.RobotsFile, userAgent string) *robotsRules {
+	switch {
+	case robots.StatusCode >= 200 && robots.StatusCode < 300:
+		return parseRobots([]byte(robots.Body), userAgent)
+	case robots.StatusCode >= 400 && robots.StatusCode < 500 && robots.StatusCode != http.StatusTooManyRequests:
+		return &robotsRules{}
+	default:
+		return &robotsRules{unreachable: true, statusCode: robots.StatusCode}
+	}
+}
+
+// parseRobots returns the rules of the groups of a robots.txt whose
+// User-agent matches userAgent, or else of the groups for "*".
+func parseRobots(body []byte, userAgent string) *robotsRules {
+	userAgent = strings.ToLower(userAgent)
+
+	var matched, wildcard robotsRules
+	var matchedFound bool
+	// The groups the rules belong to. A group starts with its User-agent
+	// lines; other lines, such as Sitemap, do not end them.
+	var inMatched, inWildcard, inAgents bool
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64<<10), maxRobotsBytes)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				inMatched, inWildcard, inAgents = false, false, true
+			}
+			agent := strings.ToLower(value)
+			if i := strings.IndexByte(agent, '/'); i >= 0 {
+				agent = agent[:i]
+			}
+			switch {
+			case agent == "*":
+				inWildcard = true
+			case agent != "" && agent == userAgent:
+				inMatched, matchedFound = true, true
+			}
+		case "allow", "disallow", "crawl-delay":
+			inAgents = false
+			var groups []*robotsRules
+			if inMatched {
+				groups = append(groups, &matched)
+			}
+			if inWildcard {
+				groups = append(groups, &wildcard)
+			}
+			for _, group := range groups {
+				if key == "crawl-delay" {
+					if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+						group.crawlDelay = time.Duration(seconds * float64(time.Second))
+					}
+					continue
+				}
+				// An empty Disallow allows everything and adds no rule
+				if value != "" {
+					group.rules = append(group.rules, robotsRule{allow: key == "allow", pattern: value})
+				}
+			}
+		}
+	}
+
+	if matchedFound {
+		return &matched
+	}
+	return &wildcard
+}
+
+// allowed reports whether the path of a URL, with its query, may be fetched.
+// The most specific rule, the one with the longest pattern, decides; Allow
+// wins when an Allow and a Disallow rule are as specific.
+func (r *robotsRules) allowed(path string) bool {
+	if r.unreachable {
+		return false
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+
+	allowed, length := true, -1
+	for _, rule := range r.rules {
+		if !robotsMatch(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > length || (len(rule.pattern) == length && rule.allow) {
+			allowed, length = rule.allow, len(rule.pattern)
+		}
+	}
+	return allowed
+}
+
+// robotsMatch reports whether a robots.txt pattern matches path. Patterns
+// match prefixes of the path, "*" matches any sequence of characters and a
+// trailing "$" anchors the pattern at the end of the path.
+func robotsMatch(pattern string, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(path[pos:], part)
+		}
+		index := strings.Index(path[pos:], part)
+		if index < 0 {
+			return false
+		}
+		pos += index + len(part)
+	}
+	return !anchored || pos == len(path)
+}
+
+// robotsUserAgent returns the token matched against the User-agent lines of
+// robots.txt: the configured one, or else the product token of the fetcher's
+// User-Agent, e.g. admin-api-worker for admin-api-worker/1.0.
+func (f *Fetcher) robotsUserAgent() string {
+	if f.cfg.Robots.UserAgent != "" {
+		return f.cfg.Robots.UserAgent
+	}
+	token, _, _ := strings.Cut(f.cfg.UserAgent, "/")
+	return strings.TrimSpace(token)
+}
+
+// robots returns the rules of the robots.txt of the host of u for the
+// fetcher's user agent, fetching the robots.txt when it is not cached.
+func (f *Fetcher) robots(ctx context.Context, u *url.URL) (*robotsRules, error) {
+	origin := strings.ToLower(u.Scheme + "://" + u.Host)
+	robots, err := models.GetRobotsFromCache(ctx, origin)
+	if err != nil {
+		return nil, err
+	}
+	if robots == nil {
+		robots = f.fetchRobots(ctx, origin)
+		if err := ctx.Err(); err != nil {
+			// A cancelled fetch says nothing about the robots.txt
+			return nil, err
+		}
+
+		ttl := f.cfg.Robots.CacheTTL
+		if ttl <= 0 {
+			ttl = defaultRobotsCacheTTL
+		}
+		if robots.StatusCode == 0 || robots.StatusCode >= http.StatusInternalServerError || robots.StatusCode == http.StatusTooManyRequests {
+			ttl = min(ttl, robotsUnreachableTTL)
+		}
+		if err := models.SetRobotsCache(ctx, origin, robots, ttl); err != nil {
+			return nil, err
+		}
+	}
+	return rulesFor(robots, f.robotsUserAgent()), nil
+}
+
+func (f *Fetcher) fetchRobots(ctx context.Context, origin string) *models.RobotsFile {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, origin+"/robots.txt", nil)
+	if err != nil {
+		return &models.RobotsFile{}
+	}
+	if f.cfg.UserAgent != "" {
+		req.Header.Set("User-Agent", f.cfg.UserAgent)
+	}
+
+	resp, err := f.robotsClient.Do(req)
+	if err != nil {
+		return &models.RobotsFile{}
+	}
+	defer resp.Body.Close()
+
+	robots := &models.RobotsFile{StatusCode: resp.StatusCode}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		// A robots.txt larger than the cap is parsed up to it
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxRobotsBytes))
+		if err != nil {
+			return &models.RobotsFile{}
+		}
+		robots.Body = string(body)
+	}
+	return robots
+}
+
+// checkRobots returns an error wrapping errDisallowedByRobots when the
+// robots.txt of its host disallows u, and the Crawl-delay of the host. When
+// the robots.txt is unreachable it returns a *FetchError with a retryable
+// class instead, so that a temporary outage of the site fails the source
+// rather than skipping it.
+func (f *Fetcher) checkRobots(ctx context.Context, u *url.URL) (time.Duration, error) {
+	if !f.cfg.Robots.Enabled {
+		return 0, nil
+	}
+
+	rules, err := f.robots(ctx, u)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read robots.txt of %s: %w", u.Host, err)
+	}
+	if rules.unreachable {
+		return 0, &FetchError{
+			Class:      robotsErrorClass(rules.statusCode),
+			StatusCode: rules.statusCode,
+			Err:        fmt.Errorf("%s: %w on %s", u, errRobotsUnreachable, u.Host),
+		}
+	}
+	if !rules.allowed(u.RequestURI()) {
+		return 0, fmt.Errorf("%s: %w", u, errDisallowedByRobots)
+	}
+
+	delay := rules.crawlDelay
+	if f.cfg.Robots.MaxCrawlDelay > 0 {
+		delay = min(delay, f.cfg.Robots.MaxCrawlDelay)
+	}
+	return delay, nil
+}
+
+// robotsErrorClass classifies an unreachable robots.txt by the status it was
+// answered with, like the response of the page itself would be.
+func robotsErrorClass(statusCode int) models.ErrorClass {
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		return models.ErrorClassRateLimited
+	case statusCode >= http.StatusInternalServerError:
+		return models.ErrorClassHttp5xx
+	default:
+		return models.ErrorClassNetwork
+	}
+}
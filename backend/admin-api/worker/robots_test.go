@@ -0,0 +1,321 @@
+package worker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"admin-api/config"
+	"admin-api/models"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const robotsTxt = `# Shop robots
+User-agent: *
+Disallow: /private
+Allow: /private/open
+Crawl-delay: 5
+
+User-agent: admin-api-worker
+User-agent: other-bot
+Disallow: /search
+Disallow: /*.pdf$
+Allow: /search/help
+Disallow: /tmp/*/cache
+Crawl-delay: 0.5
+
+Sitemap: https://example.com/sitemap.xml
+`
+
+func TestParseRobots(t *testing.T) {
+	t.Run("The group of the user agent applies", func(t *testing.T) {
+		rules := parseRobots([]byte(robotsTxt), "Admin-API-Worker")
+		assert.Equal(t, 500*time.Millisecond, rules.crawlDelay)
+
+		tests := map[string]bool{
+			"/":                   true,
+			"/private":            true,
+			"/search":             false,
+			"/search?q=flats":     false,
+			"/search/help":        true,
+			"/files/report.pdf":   false,
+			"/files/report.pdf?x": true,
+			"/tmp/a/b/cache/x":    false,
+			"/tmp/cache":          true,
+			"/robots.txt":         true,
+		}
+		for path, allowed := range tests {
+			assert.Equal(t, allowed, rules.allowed(path), path)
+		}
+	})
+
+	t.Run("Other user agents get the wildcard group", func(t *testing.T) {
+		rules := parseRobots([]byte(robotsTxt), "curious-bot")
+		assert.Equal(t, 5*time.Second, rules.crawlDelay)
+		assert.False(t, rules.allowed("/private/data"))
+		assert.True(t, rules.allowed("/private/open/data"))
+		assert.True(t, rules.allowed("/search"))
+	})
+
+	t.Run("Empty and missing robots.txt allow everything", func(t *testing.T) {
+		assert.True(t, parseRobots([]byte("User-agent: *\nDisallow:\n"), "bot").allowed("/anything"))
+		assert.True(t, rulesFor(&models.RobotsFile{StatusCode: http.StatusNotFound}, "bot").allowed("/anything"))
+	})
+
+	t.Run("Unreachable robots.txt disallows everything", func(t *testing.T) {
+		for _, statusCode := range []int{0, http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+			assert.False(t, rulesFor(&models.RobotsFile{StatusCode: statusCode}, "bot").allowed("/"), statusCode)
+		}
+	})
+}
+
+func TestRobotsMatch(t *testing.T) {
+	assert.True(t, robotsMatch("/a", "/abc"))
+	assert.True(t, robotsMatch("/a*c", "/abbbc"))
+	assert.True(t, robotsMatch("/*.php$", "/x/index.php"))
+	assert.False(t, robotsMatch("/*.php$", "/x/index.php5"))
+	assert.True(t, robotsMatch("/abc$", "/abc"))
+	assert.False(t, robotsMatch("/abc$", "/abcd"))
+	assert.False(t, robotsMatch("/b", "/abc"))
+}
+
+func setupRobotsFetcher(t *testing.T, cfg func(*config.FetcherConfig)) *Fetcher {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	t.Cleanup(mr.Close)
+	models.SetRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+
+	fetcherConfig := testFetcherConfig()
+	fetcherConfig.UserAgent = "admin-api-worker/1.0"
+	fetcherConfig.Robots = config.RobotsConfig{Enabled: true, CacheTTL: time.Hour}
+	if cfg != nil {
+		cfg(&fetcherConfig)
+	}
+	return NewFetcher(&http.Client{}, fetcherConfig)
+}
+
+func TestFetchRobots(t *testing.T) {
+	ctx := context.Background()
+
+	var robotsRequests, pageRequests atomic.Int32
+	robotsStatus := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			robotsRequests.Add(1)
+			w.WriteHeader(robotsStatus)
+			w.Write([]byte(robotsTxt))
+		case "/moved":
+			http.Redirect(w, r, "/search?q=moved", http.StatusFound)
+		default:
+			pageRequests.Add(1)
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer server.Close()
+
+	t.Run("Disallowed URLs are not fetched", func(t *testing.T) {
+		robotsRequests.Store(0)
+		pageRequests.Store(0)
+		fetcher := setupRobotsFetcher(t, nil)
+
+		_, err := fetcher.Fetch(ctx, server.URL+"/search?q=flats")
+		assert.ErrorIs(t, err, errDisallowedByRobots)
+		var fetchErr *FetchError
+		require.ErrorAs(t, err, &fetchErr)
+		assert.Equal(t, models.ErrorClassUnknown, fetchErr.Class)
+
+		result, err := fetcher.Fetch(ctx, server.URL+"/search/help")
+		require.NoError(t, err)
+		assert.Equal(t, "ok", string(result.Body))
+
+		// Redirects to disallowed URLs are not followed either
+		_, err = fetcher.Fetch(ctx, server.URL+"/moved")
+		assert.ErrorIs(t, err, errDisallowedByRobots)
+
+		// robots.txt is fetched once and then read from the cache
+		assert.Equal(t, int32(1), robotsRequests.Load())
+		assert.Equal(t, int32(1), pageRequests.Load())
+	})
+
+	t.Run("The configured user agent token selects the group", func(t *testing.T) {
+		fetcher := setupRobotsFetcher(t, func(cfg *config.FetcherConfig) {
+			cfg.Robots.UserAgent = "curious-bot"
+		})
+
+		_, err := fetcher.Fetch(ctx, server.URL+"/search?q=flats")
+		require.NoError(t, err)
+		_, err = fetcher.Fetch(ctx, server.URL+"/private/data")
+		assert.ErrorIs(t, err, errDisallowedByRobots)
+	})
+
+	t.Run("Unreachable robots.txt fails with a retryable error", func(t *testing.T) {
+		robotsStatus = http.StatusServiceUnavailable
+		defer func() { robotsStatus = http.StatusOK }()
+		pageRequests.Store(0)
+		fetcher := setupRobotsFetcher(t, nil)
+
+		_, err := fetcher.Fetch(ctx, server.URL+"/")
+		assert.ErrorIs(t, err, errRobotsUnreachable)
+		assert.NotErrorIs(t, err, errDisallowedByRobots)
+		var fetchErr *FetchError
+		require.ErrorAs(t, err, &fetchErr)
+		assert.Equal(t, models.ErrorClassHttp5xx, fetchErr.Class)
+		assert.Equal(t, http.StatusServiceUnavailable, fetchErr.StatusCode)
+		assert.Equal(t, int32(0), pageRequests.Load())
+	})
+
+	t.Run("Crawl-delay spaces out requests", func(t *testing.T) {
+		fetcher := setupRobotsFetcher(t, func(cfg *config.FetcherConfig) {
+			cfg.Robots.MaxCrawlDelay = 100 * time.Millisecond
+		})
+
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			_, err := fetcher.Fetch(ctx, server.URL+"/")
+			require.NoError(t, err)
+		}
+		// The Crawl-delay of 0.5s is capped at 100ms
+		elapsed := time.Since(start)
+		assert.GreaterOrEqual(t, elapsed, 200*time.Millisecond)
+		assert.Less(t, elapsed, 500*time.Millisecond)
+	})
+}
+
+func TestFetchPoliteness(t *testing.T) {
+	ctx := context.Background()
+
+	var inFlight, maxInFlight atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			seen := maxInFlight.Load()
+			if current <= seen || maxInFlight.CompareAndSwap(seen, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// Fetchers of different workers share the limits of the host
+	setupRobotsFetcher(t, nil)
+	cfg := testFetcherConfig()
+	cfg.Politeness = config.PolitenessConfig{MaxConcurrency: 2}
+	fetchers := []*Fetcher{NewFetcher(&http.Client{}, cfg), NewFetcher(&http.Client{}, cfg)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := fetchers[i%2].Fetch(ctx, server.URL)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), maxInFlight.Load())
+}
+
+func TestWorkerSkipsDisallowedSources(t *testing.T) {
+	ctx := context.Background()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte(robotsTxt))
+		case "/list":
+			w.Write([]byte(`<a href="/items/1">Item 1</a><a href="/search?q=items">Search</a>`))
+		default:
+			w.Write([]byte(`<h1>` + r.URL.Path + `</h1>`))
+		}
+	}))
+	defer server.Close()
+
+	t.Run("Disallowed sources are recorded as skipped", func(t *testing.T) {
+		worker, _, taskRuns, _ := setupTestWorker(t)
+		worker.fetcher = setupRobotsFetcher(t, nil)
+		taskRuns.addRun(1, &models.TaskDefinition{Source: []models.UrlSource{
+			{Type: models.SourceTypeUrl, URL: server.URL + "/items/1"},
+			{Type: models.SourceTypeUrl, URL: server.URL + "/search?q=flats"},
+		}})
+
+		worker.process(ctx, models.QueuedTaskRun{MessageID: "1-0", TaskRunID: 1})
+
+		update := taskRuns.updates["1"]
+		assert.Equal(t, models.TaskStatusComplete, update.Status)
+		assert.Equal(t, 1, update.SourcesSucceeded)
+		assert.Equal(t, 0, update.SourcesFailed)
+		assert.Equal(t, 1, update.SourcesSkipped)
+
+		var skipped []*models.CreateTaskRunArtifactDto
+		for _, artifact := range taskRuns.artifacts {
+			if artifact.ArtifactType == models.ArtifactTypeSkipped {
+				skipped = append(skipped, artifact)
+			}
+		}
+		require.Len(t, skipped, 1)
+		assert.Equal(t, server.URL+"/search?q=flats", skipped[0].URL)
+		assert.Equal(t, "1", skipped[0].AdditionalData[models.ArtifactDataSourceIndex])
+		assert.Contains(t, skipped[0].AdditionalData[models.ArtifactDataReason], "disallowed by robots.txt")
+		assert.Empty(t, skipped[0].S3Key)
+	})
+
+	t.Run("Sources of hosts with an unreachable robots.txt fail the run", func(t *testing.T) {
+		unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`<h1>` + r.URL.Path + `</h1>`))
+		}))
+		defer unavailable.Close()
+
+		worker, _, taskRuns, _ := setupTestWorker(t)
+		worker.fetcher = setupRobotsFetcher(t, nil)
+		taskRuns.addRun(1, &models.TaskDefinition{Source: []models.UrlSource{
+			{Type: models.SourceTypeUrl, URL: unavailable.URL + "/items/1"},
+			{Type: models.SourceTypeUrl, URL: unavailable.URL + "/items/2"},
+		}})
+
+		worker.process(ctx, models.QueuedTaskRun{MessageID: "1-0", TaskRunID: 1})
+
+		update := taskRuns.updates["1"]
+		assert.Equal(t, models.TaskStatusFailed, update.Status)
+		assert.Equal(t, models.ErrorClassHttp5xx, update.ErrorClass)
+		assert.Equal(t, 2, update.SourcesFailed)
+		assert.Equal(t, 0, update.SourcesSkipped)
+		for _, artifact := range taskRuns.artifacts {
+			assert.NotEqual(t, models.ArtifactTypeSkipped, artifact.ArtifactType)
+		}
+	})
+
+	t.Run("Disallowed crawl pages are skipped", func(t *testing.T) {
+		worker, _, taskRuns, blobs := setupTestWorker(t)
+		worker.fetcher = setupRobotsFetcher(t, nil)
+		taskRuns.addRun(1, &models.TaskDefinition{Source: []models.UrlSource{{
+			Type:  models.SourceTypeCrawl,
+			URL:   server.URL + "/list",
+			Crawl: &models.CrawlOptions{MaxDepth: 1},
+		}}})
+
+		worker.process(ctx, models.QueuedTaskRun{MessageID: "1-0", TaskRunID: 1})
+
+		artifact, frontier := crawlFrontier(t, taskRuns, blobs)
+		assert.Equal(t, "2", artifact.AdditionalData["pages_fetched"])
+		assert.Equal(t, "1", artifact.AdditionalData["pages_skipped"])
+		require.Len(t, frontier, 3)
+		assert.Equal(t, server.URL+"/search?q=items", frontier[2].URL)
+		assert.Equal(t, crawlPageSkipped, frontier[2].Status)
+	})
+}
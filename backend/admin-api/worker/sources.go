@@ -0,0 +1,347 @@
+package worker
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"admin-api/models"
+)
+
+const (
+	// defaultMaxSourceURLs caps the URLs a sitemap or feed source expands
+	// into when neither the source nor the worker config sets a cap.
+	defaultMaxSourceURLs = 1000
+	// maxSitemapDepth is how many levels of sitemap indexes are followed.
+	maxSitemapDepth = 3
+	// maxSitemapBytes caps the size of a decompressed sitemap, which the
+	// sitemap protocol limits to 50MB.
+	maxSitemapBytes = 50 << 20
+)
+
+// plannedSource is a concrete URL the worker fetches for a run. Sources that
+// could not be expanded are planned with their error, so that they are
+// reported like the sources that could not be fetched, and sources whose
+// sitemap or feed robots.txt disallows with the reason they are skipped.
+type plannedSource struct {
+	source     models.UrlSource
+	err        error
+	errorClass models.ErrorClass
+	skipped    error
+}
+
+// sourceEntry is a URL listed by a sitemap or a feed.
+type sourceEntry struct {
+	URL      string
+	Modified time.Time
+}
+
+// planSources expands the sitemap and feed sources of the run into the URLs
+// they list and keeps the other sources as they are.
+func (w *Worker) planSources(ctx context.Context, taskRun *models.TaskRun, sources []models.UrlSource) []plannedSource {
+	var planned []plannedSource
+	for _, source := range sources {
+		if !source.IsExpanded() {
+			planned = append(planned, plannedSource{source: source})
+			continue
+		}
+
+		urls, err := w.expandSource(ctx, taskRun, source)
+		if errors.Is(err, errDisallowedByRobots) {
+			planned = append(planned, plannedSource{source: source, skipped: err})
+			continue
+		}
+		if err != nil {
+			failed := plannedSource{source: source, err: fmt.Errorf("failed to expand %s: %w", source.URL, err), errorClass: models.ErrorClassExtraction}
+			var fetchErr *FetchError
+			if errors.As(err, &fetchErr) {
+				failed.errorClass = fetchErr.Class
+			}
+			planned = append(planned, failed)
+			continue
+		}
+		for _, u := range urls {
+			planned = append(planned, plannedSource{source: models.UrlSource{Type: models.SourceTypeUrl, URL: u}})
+		}
+	}
+	return planned
+}
+
+// expandSource returns the URLs listed by a sitemap or feed source that were
+// modified after its cutoff, up to its cap. Entries without a modification
+// time are always kept.
+func (w *Worker) expandSource(ctx context.Context, taskRun *models.TaskRun, source models.UrlSource) ([]string, error) {
+	var cutoff time.Time
+	if source.ModifiedSince != nil {
+		cutoff = *source.ModifiedSince
+	}
+	if source.OnlyNew {
+		previous, err := w.taskRuns.PreviousCompletedTaskRun(ctx, taskRun)
+		if err != nil {
+			return nil, err
+		}
+		if previous != nil && previous.StartTime.After(cutoff) {
+			cutoff = previous.StartTime
+		}
+	}
+
+	limit := source.MaxURLs
+	if limit <= 0 {
+		limit = w.cfg.MaxSourceURLs
+	}
+	if limit <= 0 {
+		limit = defaultMaxSourceURLs
+	}
+
+	expansion := &sourceExpansion{worker: w, cutoff: cutoff, limit: limit, seen: map[string]bool{}}
+	var err error
+	switch source.Type {
+	case models.SourceTypeSitemap:
+		err = expansion.sitemap(ctx, source.URL, 0)
+	case models.SourceTypeFeed:
+		err = expansion.feed(ctx, source.URL)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return expansion.urls, nil
+}
+
+type sourceExpansion struct {
+	worker *Worker
+	cutoff time.Time
+	limit  int
+	seen   map[string]bool
+	urls   []string
+}
+
+func (e *sourceExpansion) full() bool {
+	return len(e.urls) >= e.limit
+}
+
+func (e *sourceExpansion) isModified(entry sourceEntry) bool {
+	return e.cutoff.IsZero() || entry.Modified.IsZero() || entry.Modified.After(e.cutoff)
+}
+
+func (e *sourceExpansion) add(entries []sourceEntry) {
+	for _, entry := range entries {
+		if e.full() {
+			return
+		}
+		if entry.URL == "" || e.seen[entry.URL] || !e.isModified(entry) {
+			continue
+		}
+		e.seen[entry.URL] = true
+		e.urls = append(e.urls, entry.URL)
+	}
+}
+
+// sitemap adds the pages of a sitemap, following the sitemaps of sitemap
+// indexes that were modified after the cutoff.
+func (e *sourceExpansion) sitemap(ctx context.Context, sitemapURL string, depth int) error {
+	body, err := e.fetch(ctx, sitemapURL)
+	if err != nil {
+		return err
+	}
+
+	pages, sitemaps, err := parseSitemap(body)
+	if err != nil {
+		return fmt.Errorf("invalid sitemap %s: %w", sitemapURL, err)
+	}
+	e.add(pages)
+
+	for _, sitemap := range sitemaps {
+		if e.full() || depth+1 >= maxSitemapDepth {
+			break
+		}
+		if !e.isModified(sitemap) {
+			continue
+		}
+		if err := e.sitemap(ctx, sitemap.URL, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *sourceExpansion) feed(ctx context.Context, feedURL string) error {
+	body, err := e.fetch(ctx, feedURL)
+	if err != nil {
+		return err
+	}
+
+	entries, err := parseFeed(body, feedURL)
+	if err != nil {
+		return fmt.Errorf("invalid feed %s: %w", feedURL, err)
+	}
+	e.add(entries)
+	return nil
+}
+
+// fetch fetches a sitemap or feed, decompressing gzipped sitemaps.
+func (e *sourceExpansion) fetch(ctx context.Context, u string) ([]byte, error) {
+	result, err := e.worker.fetcher.Fetch(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(result.Body, []byte{0x1f, 0x8b}) {
+		return result.Body, nil
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(result.Body))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(io.LimitReader(reader, maxSitemapBytes))
+}
+
+type sitemapDocument struct {
+	XMLName  xml.Name
+	URLs     []sitemapEntry `xml:"url"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+type sitemapEntry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// parseSitemap returns the pages of a urlset sitemap or the sitemaps of a
+// sitemap index.
+func parseSitemap(body []byte) ([]sourceEntry, []sourceEntry, error) {
+	var doc sitemapDocument
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		return nil, nil, err
+	}
+	if doc.XMLName.Local != "urlset" && doc.XMLName.Local != "sitemapindex" {
+		return nil, nil, fmt.Errorf("unexpected root element %q", doc.XMLName.Local)
+	}
+
+	toEntries := func(entries []sitemapEntry) []sourceEntry {
+		result := make([]sourceEntry, 0, len(entries))
+		for _, entry := range entries {
+			result = append(result, sourceEntry{URL: strings.TrimSpace(entry.Loc), Modified: parseEntryTime(entry.LastMod)})
+		}
+		return result
+	}
+	return toEntries(doc.URLs), toEntries(doc.Sitemaps), nil
+}
+
+type feedDocument struct {
+	XMLName xml.Name
+	// RSS 2.0 items are in the channel, RSS 1.0 items are next to it
+	Channel struct {
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	Items   []rssItem   `xml:"item"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssItem struct {
+	Link    string `xml:"link"`
+	GUID    string `xml:"guid"`
+	PubDate string `xml:"pubDate"`
+	// Date is the Dublin Core date of RSS 1.0 items
+	Date string `xml:"date"`
+}
+
+type atomEntry struct {
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"link"`
+	Updated   string `xml:"updated"`
+	Published string `xml:"published"`
+}
+
+// parseFeed returns the entries of an RSS or Atom feed, with their links
+// resolved against the feed URL.
+func parseFeed(body []byte, feedURL string) ([]sourceEntry, error) {
+	var doc feedDocument
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		return nil, err
+	}
+	base, _ := url.Parse(feedURL)
+
+	var entries []sourceEntry
+	switch doc.XMLName.Local {
+	case "rss", "RDF":
+		for _, item := range append(doc.Channel.Items, doc.Items...) {
+			link := strings.TrimSpace(item.Link)
+			if link == "" && strings.HasPrefix(item.GUID, "http") {
+				link = strings.TrimSpace(item.GUID)
+			}
+			modified := parseEntryTime(item.PubDate)
+			if modified.IsZero() {
+				modified = parseEntryTime(item.Date)
+			}
+			entries = append(entries, sourceEntry{URL: resolveLink(base, link), Modified: modified})
+		}
+	case "feed":
+		for _, entry := range doc.Entries {
+			var link string
+			for _, l := range entry.Links {
+				if l.Rel == "" || l.Rel == "alternate" {
+					link = l.Href
+					break
+				}
+			}
+			modified := parseEntryTime(entry.Updated)
+			if modified.IsZero() {
+				modified = parseEntryTime(entry.Published)
+			}
+			entries = append(entries, sourceEntry{URL: resolveLink(base, link), Modified: modified})
+		}
+	default:
+		return nil, fmt.Errorf("unexpected root element %q", doc.XMLName.Local)
+	}
+	return entries, nil
+}
+
+func resolveLink(base *url.URL, link string) string {
+	link = strings.TrimSpace(link)
+	if base == nil || link == "" {
+		return link
+	}
+	u, err := base.Parse(link)
+	if err != nil {
+		return link
+	}
+	return u.String()
+}
+
+// entryTimeLayouts are the layouts of sitemap lastmod values (W3C datetime)
+// and of RSS and Atom dates.
+var entryTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+}
+
+// parseEntryTime parses the modification time of an entry, returning the zero
+// time if it is missing or not understood.
+func parseEntryTime(value string) time.Time {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}
+	}
+	for _, layout := range entryTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,150 @@
+package worker
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"admin-api/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipped(t *testing.T, body string) []byte {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	_, err := writer.Write([]byte(body))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+func newSourcesServer(t *testing.T) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := func(s string) { w.Write([]byte(strings.ReplaceAll(s, "BASE", server.URL))) }
+		switch r.URL.Path {
+		case "/sitemap_index.xml":
+			body(`<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>BASE/sitemap-new.xml.gz</loc><lastmod>2026-03-01</lastmod></sitemap>
+  <sitemap><loc>BASE/sitemap-old.xml</loc><lastmod>2025-01-01T00:00:00Z</lastmod></sitemap>
+</sitemapindex>`)
+		case "/sitemap-new.xml.gz":
+			w.Write(gzipped(t, strings.ReplaceAll(`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>BASE/pages/1</loc><lastmod>2026-03-01T10:00:00+00:00</lastmod></url>
+  <url><loc>BASE/pages/2</loc><lastmod>2026-01-15</lastmod></url>
+  <url><loc>BASE/pages/3</loc></url>
+  <url><loc>BASE/pages/1</loc></url>
+</urlset>`, "BASE", server.URL)))
+		case "/sitemap-old.xml":
+			body(`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>BASE/pages/old</loc><lastmod>2024-12-01</lastmod></url>
+</urlset>`)
+		case "/rss.xml":
+			body(`<rss version="2.0"><channel><title>News</title>
+  <item><link>/news/2</link><pubDate>Mon, 02 Mar 2026 09:00:00 +0000</pubDate></item>
+  <item><guid>BASE/news/1</guid><pubDate>Sun, 1 Feb 2026 09:00:00 GMT</pubDate></item>
+</channel></rss>`)
+		case "/atom.xml":
+			body(`<feed xmlns="http://www.w3.org/2005/Atom"><title>Blog</title>
+  <entry><link rel="self" href="BASE/self"/><link href="BASE/posts/b"/><updated>2026-03-02T09:00:00Z</updated></entry>
+  <entry><link rel="alternate" href="BASE/posts/a"/><published>2026-01-02T09:00:00Z</published></entry>
+</feed>`)
+		case "/not-a-feed.xml":
+			body(`<html><body>Not a feed</body></html>`)
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html>" + r.URL.Path + "</html>"))
+		}
+	}))
+	return server
+}
+
+func TestExpandSource(t *testing.T) {
+	ctx := context.Background()
+	server := newSourcesServer(t)
+	defer server.Close()
+
+	worker, _, taskRuns, _ := setupTestWorker(t)
+	taskRun := &models.TaskRun{}
+	taskRun.ID = 1
+
+	t.Run("Sitemap indexes are followed", func(t *testing.T) {
+		urls, err := worker.expandSource(ctx, taskRun, models.UrlSource{Type: models.SourceTypeSitemap, URL: server.URL + "/sitemap_index.xml"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{server.URL + "/pages/1", server.URL + "/pages/2", server.URL + "/pages/3", server.URL + "/pages/old"}, urls)
+	})
+
+	t.Run("Sitemap entries are filtered by lastmod", func(t *testing.T) {
+		since := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+		urls, err := worker.expandSource(ctx, taskRun, models.UrlSource{Type: models.SourceTypeSitemap, URL: server.URL + "/sitemap_index.xml", ModifiedSince: &since})
+		require.NoError(t, err)
+		assert.Equal(t, []string{server.URL + "/pages/1", server.URL + "/pages/3"}, urls)
+	})
+
+	t.Run("URLs are capped", func(t *testing.T) {
+		urls, err := worker.expandSource(ctx, taskRun, models.UrlSource{Type: models.SourceTypeSitemap, URL: server.URL + "/sitemap_index.xml", MaxURLs: 2})
+		require.NoError(t, err)
+		assert.Len(t, urls, 2)
+	})
+
+	t.Run("RSS feeds", func(t *testing.T) {
+		urls, err := worker.expandSource(ctx, taskRun, models.UrlSource{Type: models.SourceTypeFeed, URL: server.URL + "/rss.xml"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{server.URL + "/news/2", server.URL + "/news/1"}, urls)
+	})
+
+	t.Run("Atom feeds only keep new entries", func(t *testing.T) {
+		previous := &models.TaskRun{StartTime: time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)}
+		taskRuns.previousRuns[1] = previous
+		defer delete(taskRuns.previousRuns, 1)
+
+		urls, err := worker.expandSource(ctx, taskRun, models.UrlSource{Type: models.SourceTypeFeed, URL: server.URL + "/atom.xml", OnlyNew: true})
+		require.NoError(t, err)
+		assert.Equal(t, []string{server.URL + "/posts/b"}, urls)
+	})
+
+	t.Run("Only new without a previous run keeps every entry", func(t *testing.T) {
+		urls, err := worker.expandSource(ctx, taskRun, models.UrlSource{Type: models.SourceTypeFeed, URL: server.URL + "/atom.xml", OnlyNew: true})
+		require.NoError(t, err)
+		assert.Len(t, urls, 2)
+	})
+
+	t.Run("Invalid feeds", func(t *testing.T) {
+		_, err := worker.expandSource(ctx, taskRun, models.UrlSource{Type: models.SourceTypeFeed, URL: server.URL + "/not-a-feed.xml"})
+		assert.Error(t, err)
+	})
+}
+
+func TestWorkerProcessExpandedSources(t *testing.T) {
+	ctx := context.Background()
+	server := newSourcesServer(t)
+	defer server.Close()
+
+	worker, _, taskRuns, _ := setupTestWorker(t)
+	taskRuns.addRun(1, &models.TaskDefinition{Source: []models.UrlSource{
+		{Type: models.SourceTypeFeed, URL: server.URL + "/rss.xml"},
+		{Type: models.SourceTypeSitemap, URL: server.URL + "/missing.xml"},
+	}})
+
+	worker.process(ctx, models.QueuedTaskRun{MessageID: "1-0", TaskRunID: 1})
+
+	update := taskRuns.updates["1"]
+	assert.Equal(t, models.TaskStatusComplete, update.Status)
+	assert.Equal(t, 2, update.SourcesSucceeded)
+	assert.Equal(t, 1, update.SourcesFailed)
+	assert.Contains(t, string(update.SourceErrors), server.URL+"/missing.xml")
+
+	var urls []string
+	for _, artifact := range taskRuns.artifacts {
+		urls = append(urls, artifact.URL)
+	}
+	assert.ElementsMatch(t, []string{server.URL + "/news/2", server.URL + "/news/1"}, urls)
+}
@@ -0,0 +1,50 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	apperrors "admin-api/errors"
+	"admin-api/models"
+)
+
+// readUpload processes the file uploaded to the task that an upload source
+// references like a fetched document. The file is stored again as a raw
+// artifact of the run, so that the run keeps its documents like any other
+// source.
+func (w *Worker) readUpload(ctx context.Context, taskRun *models.TaskRun, definition *models.TaskDefinition, index int, source models.UrlSource) sourceResult {
+	upload, err := w.taskRuns.GetTaskUpload(ctx, taskRun.TaskID, source.Upload)
+	if err != nil {
+		if errors.Is(err, apperrors.ErrUploadNotFound) {
+			return sourceResult{done: true, err: err}
+		}
+		return sourceResult{done: true, err: fmt.Errorf("failed to get upload %s: %w", source.Upload, err)}
+	}
+
+	body, err := w.blobs.Get(ctx, upload.S3Bucket, upload.S3Key)
+	if err != nil {
+		return sourceResult{done: true, err: fmt.Errorf("failed to read upload %s: %w", source.Upload, err)}
+	}
+
+	// The URL of the source is where the file was exported from, relative
+	// links are resolved against it
+	u := source.URL
+	if u == "" {
+		u = "upload:" + source.Upload
+	}
+	result := &FetchResult{
+		URL:         u,
+		FinalURL:    u,
+		ContentType: upload.ContentType,
+		Body:        body,
+	}
+	tags := map[string]string{
+		models.ArtifactDataSourceIndex: strconv.Itoa(index),
+		models.ArtifactDataSourceURL:   source.URL,
+		models.ArtifactDataUploadID:    source.Upload,
+		models.ArtifactDataFilename:    upload.AdditionalData[models.ArtifactDataFilename],
+	}
+	return w.processDocument(ctx, taskRun, definition, result, tags)
+}
@@ -0,0 +1,73 @@
+package worker
+
+import (
+	"context"
+	"testing"
+
+	"admin-api/extract"
+	"admin-api/models"
+
+	"github.com/bytedance/sonic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const uploadedHTML = `<ul>
+  <li class="listing"><a href="/flats/1">Flat 1</a></li>
+  <li class="listing"><a href="/flats/2">Flat 2</a></li>
+</ul>`
+
+func TestWorkerProcessUploadSource(t *testing.T) {
+	ctx := context.Background()
+	uploadID := "6f1c2a4e-5a3f-11ef-8000-000000000002"
+	targets := []models.Target{
+		{Type: models.TargetTypeQuery, Name: "name", Value: ".listing a"},
+		{Type: models.TargetTypeQuery, Name: "link", Value: ".listing a::attr(href)"},
+	}
+
+	setup := func(t *testing.T, source models.UrlSource) (*fakeTaskRunStore, *memoryBlobStore) {
+		worker, _, taskRuns, blobs := setupTestWorker(t)
+		blobs.blobs["task-uploads/0/"+uploadID] = []byte(uploadedHTML)
+		taskRuns.uploads["0/"+uploadID] = &models.TaskRunArtifact{
+			ArtifactType:   models.ArtifactTypeUpload,
+			ContentType:    "text/html",
+			S3Bucket:       "test-bucket",
+			S3Key:          "task-uploads/0/" + uploadID,
+			AdditionalData: map[string]string{models.ArtifactDataFilename: "listings.html"},
+		}
+		taskRuns.addRun(1, &models.TaskDefinition{Target: targets, Source: []models.UrlSource{source}})
+
+		worker.process(ctx, models.QueuedTaskRun{MessageID: "1-0", TaskRunID: 1})
+		return taskRuns, blobs
+	}
+
+	t.Run("The uploaded file is extracted like a fetched document", func(t *testing.T) {
+		taskRuns, blobs := setup(t, models.UrlSource{Type: models.SourceTypeUpload, URL: "https://flats.example.com/search", Upload: uploadID})
+
+		assert.Equal(t, models.TaskStatusComplete, taskRuns.updates["1"].Status)
+		require.Len(t, taskRuns.artifacts, 2)
+
+		raw := taskRuns.artifacts[0]
+		assert.Equal(t, models.ArtifactTypeRaw, raw.ArtifactType)
+		assert.Equal(t, "https://flats.example.com/search", raw.URL)
+		assert.Equal(t, "text/html", raw.ContentType)
+		assert.Equal(t, uploadID, raw.AdditionalData[models.ArtifactDataUploadID])
+		assert.Equal(t, "listings.html", raw.AdditionalData[models.ArtifactDataFilename])
+		assert.Equal(t, uploadedHTML, string(blobs.blobs[raw.S3Key]))
+
+		var records []extract.Record
+		require.NoError(t, sonic.Unmarshal(blobs.blobs[taskRuns.artifacts[1].S3Key], &records))
+		assert.Equal(t, []extract.Record{
+			{"name": "Flat 1", "link": "https://flats.example.com/flats/1"},
+			{"name": "Flat 2", "link": "https://flats.example.com/flats/2"},
+		}, records)
+	})
+
+	t.Run("A missing upload fails the source", func(t *testing.T) {
+		taskRuns, _ := setup(t, models.UrlSource{Type: models.SourceTypeUpload, Upload: "6f1c2a4e-5a3f-11ef-8000-000000000003"})
+
+		update := taskRuns.updates["1"]
+		assert.Equal(t, models.TaskStatusFailed, update.Status)
+		assert.Contains(t, update.ErrorMessage, "upload not found")
+	})
+}
@@ -0,0 +1,538 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"admin-api/config"
+	apperrors "admin-api/errors"
+	"admin-api/extract"
+	"admin-api/models"
+
+	"github.com/bytedance/sonic"
+	"github.com/gocql/gocql"
+	"github.com/uptrace/opentelemetry-go-extra/otelzap"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// maxLinkAdditionalData caps the extracted links recorded in the additional
+// data of a records artifact.
+const maxLinkAdditionalData = 1000
+
+type RunQueue interface {
+	ClaimTaskRuns(ctx context.Context, consumer string, count int64, block time.Duration) ([]models.QueuedTaskRun, error)
+	AckTaskRun(ctx context.Context, queuedRun models.QueuedTaskRun) error
+	DeadLetterTaskRun(ctx context.Context, queuedRun models.QueuedTaskRun, reason string) error
+	ExtendTaskRunClaim(ctx context.Context, consumer string, queuedRun models.QueuedTaskRun) (bool, error)
+	PromoteDelayedTaskRuns(ctx context.Context, now time.Time) (int, error)
+}
+
+type TaskRunStore interface {
+	StartTaskRun(ctx context.Context, taskRunID uint64) (*models.TaskRun, *models.TaskDefinition, error)
+	HeartbeatTaskRun(ctx context.Context, taskRunID string) error
+	PreviousCompletedTaskRun(ctx context.Context, taskRun *models.TaskRun) (*models.TaskRun, error)
+	FinishTaskRun(ctx context.Context, taskRun models.TaskRun, taskRunID uint64) (bool, error)
+	CreateTaskRunArtifact(ctx context.Context, artifact *models.CreateTaskRunArtifactDto) (*models.TaskRunArtifact, error)
+	GetTaskUpload(ctx context.Context, taskID uint, uploadID string) (*models.TaskRunArtifact, error)
+}
+
+type BlobStore interface {
+	Put(ctx context.Context, key string, body []byte) (string, error)
+	Get(ctx context.Context, bucket string, key string) ([]byte, error)
+}
+
+// Worker claims task runs from the run queue, fetches their sources, stores
+// each fetched document and the records extracted from it as artifacts and
+// reports the outcome of the run.
+type Worker struct {
+	logger   *otelzap.Logger
+	queue    RunQueue
+	taskRuns TaskRunStore
+	fetcher  *Fetcher
+	blobs    BlobStore
+	cfg      config.WorkerConfig
+	consumer string
+}
+
+func NewWorker(logger *otelzap.Logger, queue RunQueue, taskRuns TaskRunStore, fetcher *Fetcher, blobs BlobStore, cfg config.WorkerConfig) *Worker {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "admin-api"
+	}
+
+	return &Worker{
+		logger:   logger,
+		queue:    queue,
+		taskRuns: taskRuns,
+		fetcher:  fetcher,
+		blobs:    blobs,
+		cfg:      cfg,
+		consumer: fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+	}
+}
+
+// Run executes queued task runs with the configured concurrency until ctx is
+// cancelled.
+func (w *Worker) Run(ctx context.Context) {
+	w.logger.Ctx(ctx).Info("Starting worker", zap.String("consumer", w.consumer), zap.Int("concurrency", w.cfg.Concurrency))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.promoteDelayed(ctx)
+	}()
+	for i := 0; i < max(w.cfg.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				if err := w.poll(ctx); err != nil && ctx.Err() == nil {
+					w.logger.Ctx(ctx).Error("Worker poll failed", zap.Error(err))
+					select {
+					case <-ctx.Done():
+					case <-time.After(w.cfg.PollInterval):
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	w.logger.Ctx(ctx).Info("Stopped worker", zap.String("consumer", w.consumer))
+}
+
+// promoteDelayed moves delayed runs, such as retries waiting for their
+// backoff, to the run queue once they are due. Every worker promotes them, so
+// they are queued as long as any worker is up.
+func (w *Worker) promoteDelayed(ctx context.Context) {
+	ticker := time.NewTicker(max(w.cfg.PollInterval, time.Second))
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.queue.PromoteDelayedTaskRuns(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			w.logger.Ctx(ctx).Error("Failed to promote delayed task runs", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll claims one task run and executes it.
+func (w *Worker) poll(ctx context.Context) error {
+	queuedRuns, err := w.queue.ClaimTaskRuns(ctx, w.consumer, 1, w.cfg.PollInterval)
+	if err != nil {
+		return err
+	}
+
+	for _, queuedRun := range queuedRuns {
+		w.process(ctx, queuedRun)
+	}
+	return nil
+}
+
+func (w *Worker) process(ctx context.Context, queuedRun models.QueuedTaskRun) {
+	taskRunField := zap.Uint64("task_run_id", queuedRun.TaskRunID)
+
+	taskRun, definition, err := w.taskRuns.StartTaskRun(ctx, queuedRun.TaskRunID)
+	switch {
+	case errors.Is(err, apperrors.ErrTaskRunFinished):
+		// Cancelled or replaced while it was queued
+		w.ack(ctx, queuedRun)
+		return
+	case errors.Is(err, apperrors.ErrTaskRunNotFound), errors.Is(err, gorm.ErrRecordNotFound):
+		// The run or its task was deleted while it was queued
+		if err := w.queue.DeadLetterTaskRun(ctx, queuedRun, "task run not found"); err != nil {
+			w.logger.Ctx(ctx).Error("Failed to dead-letter task run", taskRunField, zap.Error(err))
+		}
+		return
+	case err != nil:
+		// Left unacknowledged, the run is redelivered after the visibility timeout
+		w.logger.Ctx(ctx).Error("Failed to start task run", taskRunField, zap.Error(err))
+		return
+	}
+
+	runCtx, stopHeartbeat := context.WithCancel(ctx)
+	go w.heartbeat(runCtx, queuedRun)
+	result := w.execute(runCtx, taskRun, definition)
+	stopHeartbeat()
+
+	if result.cancelled {
+		w.logger.Ctx(ctx).Info("Task run was cancelled", taskRunField)
+		w.ack(ctx, queuedRun)
+		return
+	}
+
+	update := models.TaskRun{
+		Status:           models.TaskStatusComplete,
+		EndTime:          time.Now(),
+		SourcesSucceeded: result.succeeded,
+		SourcesFailed:    len(result.sourceErrors),
+		SourcesSkipped:   result.skipped,
+	}
+	if len(result.sourceErrors) > 0 {
+		update.SourceErrors, _ = sonic.Marshal(result.sourceErrors)
+	}
+	if result.err != nil {
+		update.Status = models.TaskStatusFailed
+		update.ErrorClass = result.errorClass
+		update.ErrorMessage = result.err.Error()
+	}
+	finished, err := w.taskRuns.FinishTaskRun(ctx, update, uint64(taskRun.ID))
+	if err != nil {
+		w.logger.Ctx(ctx).Error("Failed to update task run", taskRunField, zap.Error(err))
+		return
+	}
+	if !finished {
+		// Cancelled or timed out after its sources were processed
+		w.logger.Ctx(ctx).Info("Task run was no longer running", taskRunField)
+	}
+
+	w.ack(ctx, queuedRun)
+}
+
+type runResult struct {
+	cancelled    bool
+	succeeded    int
+	skipped      int
+	sourceErrors []models.SourceError
+	// err and errorClass are set when the run failed as a whole
+	err        error
+	errorClass models.ErrorClass
+}
+
+// sourceResult is the outcome of one source of a run.
+type sourceResult struct {
+	done       bool
+	err        error
+	errorClass models.ErrorClass
+	// skipped is why the source was not fetched, e.g. because robots.txt
+	// disallows it. Skipped sources neither succeed nor fail.
+	skipped error
+}
+
+// execute processes the sources of the run, with sitemap and feed sources
+// expanded into the URLs they list, up to the source parallelism at a time. A
+// source that fails does not stop the others; the run only fails when none of
+// its sources succeeded. No new source is started once the run is cancelled.
+func (w *Worker) execute(ctx context.Context, taskRun *models.TaskRun, definition *models.TaskDefinition) runResult {
+	parallelism := definition.SourceParallelism
+	if parallelism <= 0 {
+		parallelism = w.cfg.SourceParallelism
+	}
+	slots := make(chan struct{}, max(parallelism, 1))
+
+	planned := w.planSources(ctx, taskRun, definition.Source)
+	results := make([]sourceResult, len(planned))
+	var wg sync.WaitGroup
+	for i, plan := range planned {
+		if plan.err != nil {
+			results[i] = sourceResult{done: true, err: plan.err, errorClass: plan.errorClass}
+			continue
+		}
+		if plan.skipped != nil {
+			results[i] = w.skip(ctx, taskRun, plan.source.URL, plan.skipped, sourceTags(i, plan.source))
+			continue
+		}
+
+		source := plan.source
+		slots <- struct{}{}
+		if w.isCancelled(ctx, taskRun.ID) {
+			<-slots
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[i] = w.executeSource(ctx, taskRun, definition, i, source)
+		}()
+	}
+	wg.Wait()
+
+	// The run may have been cancelled while its last sources were fetched
+	if w.isCancelled(ctx, taskRun.ID) {
+		return runResult{cancelled: true}
+	}
+
+	var result runResult
+	for i, source := range results {
+		if !source.done {
+			continue
+		}
+		if source.skipped != nil {
+			result.skipped++
+			continue
+		}
+		if source.err == nil {
+			result.succeeded++
+			continue
+		}
+		result.sourceErrors = append(result.sourceErrors, models.SourceError{
+			Index:      i,
+			URL:        planned[i].source.URL,
+			ErrorClass: source.errorClass,
+			Message:    source.err.Error(),
+		})
+	}
+
+	if result.succeeded == 0 && len(result.sourceErrors) > 0 {
+		first := results[result.sourceErrors[0].Index]
+		result.err = first.err
+		result.errorClass = first.errorClass
+		if len(result.sourceErrors) > 1 {
+			result.err = fmt.Errorf("all %d sources failed, first: %w", len(result.sourceErrors), first.err)
+		}
+	}
+	return result
+}
+
+// executeSource fetches one source, stores the fetched document and extracts
+// the targets of the run from it. Crawl sources fetch every page they reach,
+// API sources every page of the response and upload sources read their file
+// instead.
+func (w *Worker) executeSource(ctx context.Context, taskRun *models.TaskRun, definition *models.TaskDefinition, index int, source models.UrlSource) sourceResult {
+	switch source.Type {
+	case models.SourceTypeCrawl:
+		return w.crawl(ctx, taskRun, definition, index, source)
+	case models.SourceTypeApi:
+		return w.callApi(ctx, taskRun, definition, index, source)
+	case models.SourceTypeUpload:
+		return w.readUpload(ctx, taskRun, definition, index, source)
+	}
+
+	_, result := w.fetchAndProcess(ctx, taskRun, definition, Request{URL: source.URL}, sourceTags(index, source))
+	return result
+}
+
+// sourceTags returns the tags of the artifacts of a source.
+func sourceTags(index int, source models.UrlSource) map[string]string {
+	return map[string]string{
+		models.ArtifactDataSourceIndex: strconv.Itoa(index),
+		models.ArtifactDataSourceURL:   source.URL,
+	}
+}
+
+// fetchAndProcess fetches a document, stores it and extracts the targets of
+// the run from it, tagging its artifacts with tags. A document that robots.txt
+// disallows is skipped.
+func (w *Worker) fetchAndProcess(ctx context.Context, taskRun *models.TaskRun, definition *models.TaskDefinition, request Request, tags map[string]string) (*FetchResult, sourceResult) {
+	result, err := w.fetcher.Do(ctx, request)
+	if errors.Is(err, errDisallowedByRobots) {
+		return nil, w.skip(ctx, taskRun, request.URL, err, tags)
+	}
+	if err != nil {
+		var fetchErr *FetchError
+		if errors.As(err, &fetchErr) {
+			return nil, sourceResult{done: true, err: err, errorClass: fetchErr.Class}
+		}
+		return nil, sourceResult{done: true, err: err}
+	}
+
+	return result, w.processDocument(ctx, taskRun, definition, result, tags)
+}
+
+// processDocument stores a document and extracts the targets of the run from
+// it, tagging its artifacts with tags.
+func (w *Worker) processDocument(ctx context.Context, taskRun *models.TaskRun, definition *models.TaskDefinition, result *FetchResult, tags map[string]string) sourceResult {
+	u := result.URL
+	if err := w.storeArtifact(ctx, taskRun, result, tags); err != nil {
+		return sourceResult{done: true, err: fmt.Errorf("failed to store artifact of %s: %w", u, err)}
+	}
+
+	doc := extract.Document{
+		URL:         result.FinalURL,
+		ContentType: result.ContentType,
+		Body:        result.Body,
+	}
+	extracted, err := extract.Extract(doc, definition.Target)
+	if err != nil {
+		return sourceResult{done: true, err: fmt.Errorf("failed to extract %s: %w", u, err), errorClass: models.ErrorClassExtraction}
+	}
+	for _, targetResult := range extracted {
+		for _, warning := range targetResult.Warnings {
+			w.logger.Ctx(ctx).Warn("Extraction warning", zap.Uint("task_run_id", taskRun.ID), zap.String("url", u), zap.String("warning", warning))
+		}
+		if len(targetResult.Records) == 0 && len(targetResult.Warnings) == 0 {
+			continue
+		}
+		if err := w.storeRecords(ctx, taskRun, result, targetResult, tags); err != nil {
+			return sourceResult{done: true, err: fmt.Errorf("failed to store records of %s: %w", u, err)}
+		}
+	}
+	return sourceResult{done: true}
+}
+
+func (w *Worker) isCancelled(ctx context.Context, taskRunID uint) bool {
+	cancelled, err := models.IsTaskRunCancelled(ctx, taskRunID)
+	if err != nil {
+		w.logger.Ctx(ctx).Error("Failed to check task run cancellation", zap.Uint("task_run_id", taskRunID), zap.Error(err))
+	}
+	return cancelled
+}
+
+// storeArtifact stores the fetched body as a blob and records it as a raw
+// artifact of the run, tagged with its source.
+func (w *Worker) storeArtifact(ctx context.Context, taskRun *models.TaskRun, result *FetchResult, tags map[string]string) error {
+	artifactID := gocql.TimeUUID()
+	key := fmt.Sprintf("task-runs/%d/%s", taskRun.ID, artifactID)
+
+	bucket, err := w.blobs.Put(ctx, key, result.Body)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.taskRuns.CreateTaskRunArtifact(ctx, &models.CreateTaskRunArtifactDto{
+		AirflowInstanceID: taskRun.AirflowInstanceID,
+		AirflowTaskID:     taskRun.AirflowInstanceID,
+		ArtifactID:        artifactID.String(),
+		CreatedAt:         time.Now(),
+		ArtifactType:      models.ArtifactTypeRaw,
+		URL:               result.URL,
+		ContentType:       result.ContentType,
+		ContentLength:     len(result.Body),
+		StatusCode:        result.StatusCode,
+		AdditionalData: withTags(map[string]string{
+			"final_url": result.FinalURL,
+			"attempts":  strconv.Itoa(result.Attempts),
+		}, tags),
+		S3Bucket: bucket,
+		S3Key:    key,
+	})
+	return err
+}
+
+// storeRecords stores the records extracted from a document for one target
+// type as a JSON blob and records it as a records artifact of the run, tagged
+// with its source. The extraction warnings and the extracted links are also
+// kept in the additional data of the artifact, so that pipelines can pass the
+// links to downstream runs.
+func (w *Worker) storeRecords(ctx context.Context, taskRun *models.TaskRun, result *FetchResult, extracted extract.TargetResult, tags map[string]string) error {
+	records := extracted.Records
+	if records == nil {
+		records = []extract.Record{}
+	}
+	body, err := sonic.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	artifactID := gocql.TimeUUID()
+	key := fmt.Sprintf("task-runs/%d/%s.json", taskRun.ID, artifactID)
+
+	bucket, err := w.blobs.Put(ctx, key, body)
+	if err != nil {
+		return err
+	}
+
+	additionalData := withTags(map[string]string{
+		"records":     strconv.Itoa(len(records)),
+		"target_type": strconv.FormatInt(int64(extracted.TargetType), 10),
+	}, tags)
+	for i, warning := range extracted.Warnings {
+		additionalData[fmt.Sprintf("warning.%d", i)] = warning
+	}
+	for i, record := range records {
+		for name, value := range record {
+			if link, ok := value.(string); ok && isLink(link) && len(additionalData) <= maxLinkAdditionalData {
+				additionalData[fmt.Sprintf("%s.%d", name, i)] = link
+			}
+		}
+	}
+
+	_, err = w.taskRuns.CreateTaskRunArtifact(ctx, &models.CreateTaskRunArtifactDto{
+		AirflowInstanceID: taskRun.AirflowInstanceID,
+		AirflowTaskID:     taskRun.AirflowInstanceID,
+		ArtifactID:        artifactID.String(),
+		CreatedAt:         time.Now(),
+		ArtifactType:      models.ArtifactTypeRecords,
+		URL:               result.URL,
+		ContentType:       "application/json",
+		ContentLength:     len(body),
+		StatusCode:        result.StatusCode,
+		AdditionalData:    additionalData,
+		S3Bucket:          bucket,
+		S3Key:             key,
+	})
+	return err
+}
+
+// skip records a URL that was not fetched as a skipped artifact of the run,
+// with the reason it was skipped.
+func (w *Worker) skip(ctx context.Context, taskRun *models.TaskRun, u string, reason error, tags map[string]string) sourceResult {
+	w.logger.Ctx(ctx).Info("Skipped URL", zap.Uint("task_run_id", taskRun.ID), zap.String("url", u), zap.String("reason", reason.Error()))
+
+	_, err := w.taskRuns.CreateTaskRunArtifact(ctx, &models.CreateTaskRunArtifactDto{
+		AirflowInstanceID: taskRun.AirflowInstanceID,
+		AirflowTaskID:     taskRun.AirflowInstanceID,
+		ArtifactID:        gocql.TimeUUID().String(),
+		CreatedAt:         time.Now(),
+		ArtifactType:      models.ArtifactTypeSkipped,
+		URL:               u,
+		AdditionalData: withTags(map[string]string{
+			models.ArtifactDataReason: reason.Error(),
+		}, tags),
+	})
+	if err != nil {
+		return sourceResult{done: true, err: fmt.Errorf("failed to store skipped artifact of %s: %w", u, err)}
+	}
+	return sourceResult{done: true, skipped: reason}
+}
+
+func withTags(additionalData map[string]string, tags map[string]string) map[string]string {
+	for key, value := range tags {
+		additionalData[key] = value
+	}
+	return additionalData
+}
+
+func isLink(value string) bool {
+	return strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://")
+}
+
+// heartbeat records that the run is alive and keeps it claimed, so that the
+// run queue does not hand it to another worker while it is executed.
+func (w *Worker) heartbeat(ctx context.Context, queuedRun models.QueuedTaskRun) {
+	if w.cfg.HeartbeatInterval <= 0 {
+		return
+	}
+
+	taskRunField := zap.Uint64("task_run_id", queuedRun.TaskRunID)
+	ticker := time.NewTicker(w.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.taskRuns.HeartbeatTaskRun(ctx, strconv.FormatUint(queuedRun.TaskRunID, 10)); err != nil {
+				w.logger.Ctx(ctx).Error("Failed to send task run heartbeat", taskRunField, zap.Error(err))
+			}
+			extended, err := w.queue.ExtendTaskRunClaim(ctx, w.consumer, queuedRun)
+			if err != nil {
+				w.logger.Ctx(ctx).Error("Failed to extend task run claim", taskRunField, zap.Error(err))
+			} else if !extended {
+				w.logger.Ctx(ctx).Warn("Task run is no longer claimed by this worker", taskRunField)
+			}
+		}
+	}
+}
+
+func (w *Worker) ack(ctx context.Context, queuedRun models.QueuedTaskRun) {
+	if err := w.queue.AckTaskRun(ctx, queuedRun); err != nil {
+		w.logger.Ctx(ctx).Error("Failed to acknowledge task run", zap.Uint64("task_run_id", queuedRun.TaskRunID), zap.Error(err))
+	}
+}
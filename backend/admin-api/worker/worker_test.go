@@ -0,0 +1,404 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"admin-api/config"
+	apperrors "admin-api/errors"
+	"admin-api/models"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/bytedance/sonic"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/opentelemetry-go-extra/otelzap"
+	"go.uber.org/zap"
+)
+
+type fakeQueue struct {
+	mu           sync.Mutex
+	acked        []uint64
+	deadLettered []uint64
+	extended     []uint64
+	promotions   int
+}
+
+func (q *fakeQueue) ClaimTaskRuns(ctx context.Context, consumer string, count int64, block time.Duration) ([]models.QueuedTaskRun, error) {
+	return nil, nil
+}
+
+func (q *fakeQueue) PromoteDelayedTaskRuns(ctx context.Context, now time.Time) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.promotions++
+	return 0, nil
+}
+
+func (q *fakeQueue) AckTaskRun(ctx context.Context, queuedRun models.QueuedTaskRun) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.acked = append(q.acked, queuedRun.TaskRunID)
+	return nil
+}
+
+func (q *fakeQueue) ExtendTaskRunClaim(ctx context.Context, consumer string, queuedRun models.QueuedTaskRun) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.extended = append(q.extended, queuedRun.TaskRunID)
+	return true, nil
+}
+
+func (q *fakeQueue) DeadLetterTaskRun(ctx context.Context, queuedRun models.QueuedTaskRun, reason string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.deadLettered = append(q.deadLettered, queuedRun.TaskRunID)
+	return nil
+}
+
+type fakeTaskRunStore struct {
+	mu          sync.Mutex
+	taskRuns    map[uint64]*models.TaskRun
+	definitions map[uint64]*models.TaskDefinition
+	updates     map[string]models.TaskRun
+	artifacts   []*models.CreateTaskRunArtifactDto
+	// previousRuns are the previous complete runs by task run id
+	previousRuns map[uint64]*models.TaskRun
+	// uploads are the uploads of the tasks by task id and upload id
+	uploads map[string]*models.TaskRunArtifact
+}
+
+func newFakeTaskRunStore() *fakeTaskRunStore {
+	return &fakeTaskRunStore{
+		taskRuns:     map[uint64]*models.TaskRun{},
+		definitions:  map[uint64]*models.TaskDefinition{},
+		updates:      map[string]models.TaskRun{},
+		previousRuns: map[uint64]*models.TaskRun{},
+		uploads:      map[string]*models.TaskRunArtifact{},
+	}
+}
+
+func (s *fakeTaskRunStore) addRun(id uint, definition *models.TaskDefinition) {
+	taskRun := &models.TaskRun{AirflowInstanceID: "9d1c4b8e-5a3f-11ef-8000-000000000001", Status: models.TaskStatusCreated}
+	taskRun.ID = id
+	s.taskRuns[uint64(id)] = taskRun
+	s.definitions[uint64(id)] = definition
+}
+
+func (s *fakeTaskRunStore) StartTaskRun(ctx context.Context, taskRunID uint64) (*models.TaskRun, *models.TaskDefinition, error) {
+	taskRun, ok := s.taskRuns[taskRunID]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %d", apperrors.ErrTaskRunNotFound, taskRunID)
+	}
+	if taskRun.Status.IsFinished() {
+		return nil, nil, apperrors.ErrTaskRunFinished
+	}
+	return taskRun, s.definitions[taskRunID], nil
+}
+
+func (s *fakeTaskRunStore) HeartbeatTaskRun(ctx context.Context, taskRunID string) error {
+	return nil
+}
+
+func (s *fakeTaskRunStore) PreviousCompletedTaskRun(ctx context.Context, taskRun *models.TaskRun) (*models.TaskRun, error) {
+	return s.previousRuns[uint64(taskRun.ID)], nil
+}
+
+func (s *fakeTaskRunStore) FinishTaskRun(ctx context.Context, taskRun models.TaskRun, taskRunID uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.taskRuns[taskRunID].Status.IsFinished() {
+		return false, nil
+	}
+	s.updates[strconv.FormatUint(taskRunID, 10)] = taskRun
+	return true, nil
+}
+
+func (s *fakeTaskRunStore) GetTaskUpload(ctx context.Context, taskID uint, uploadID string) (*models.TaskRunArtifact, error) {
+	upload, ok := s.uploads[fmt.Sprintf("%d/%s", taskID, uploadID)]
+	if !ok {
+		return nil, apperrors.ErrUploadNotFound
+	}
+	return upload, nil
+}
+
+func (s *fakeTaskRunStore) CreateTaskRunArtifact(ctx context.Context, artifact *models.CreateTaskRunArtifactDto) (*models.TaskRunArtifact, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.artifacts = append(s.artifacts, artifact)
+	return &models.TaskRunArtifact{}, nil
+}
+
+type memoryBlobStore struct {
+	mu    sync.Mutex
+	blobs map[string][]byte
+}
+
+func (s *memoryBlobStore) Put(ctx context.Context, key string, body []byte) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[key] = body
+	return "test-bucket", nil
+}
+
+func (s *memoryBlobStore) Get(ctx context.Context, bucket string, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	body, ok := s.blobs[key]
+	if !ok {
+		return nil, errors.New("blob not found")
+	}
+	return body, nil
+}
+
+func setupTestWorker(t *testing.T) (*Worker, *fakeQueue, *fakeTaskRunStore, *memoryBlobStore) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	t.Cleanup(mr.Close)
+	models.SetRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+
+	logger, _ := zap.NewDevelopment()
+	queue := &fakeQueue{}
+	taskRuns := newFakeTaskRunStore()
+	blobs := &memoryBlobStore{blobs: map[string][]byte{}}
+	worker := NewWorker(otelzap.New(logger), queue, taskRuns, NewFetcher(&http.Client{}, testFetcherConfig()), blobs, config.WorkerConfig{
+		Concurrency:       1,
+		PollInterval:      10 * time.Millisecond,
+		HeartbeatInterval: time.Second,
+	})
+	return worker, queue, taskRuns, blobs
+}
+
+func TestWorkerProcess(t *testing.T) {
+	ctx := context.Background()
+	var inFlight, maxInFlight atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/slow") {
+			current := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for {
+				seen := maxInFlight.Load()
+				if current <= seen || maxInFlight.CompareAndSwap(seen, current) {
+					break
+				}
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html>" + r.URL.Path + "</html>"))
+	}))
+	defer server.Close()
+
+	t.Run("Sources are stored as artifacts", func(t *testing.T) {
+		worker, queue, taskRuns, blobs := setupTestWorker(t)
+		taskRuns.addRun(1, &models.TaskDefinition{Source: []models.UrlSource{
+			{Type: models.SourceTypeUrl, URL: server.URL + "/a"},
+			{Type: models.SourceTypeUrl, URL: server.URL + "/b"},
+		}})
+
+		worker.process(ctx, models.QueuedTaskRun{MessageID: "1-0", TaskRunID: 1})
+
+		assert.Equal(t, models.TaskStatusComplete, taskRuns.updates["1"].Status)
+		assert.Equal(t, []uint64{1}, queue.acked)
+		require.Len(t, taskRuns.artifacts, 2)
+		artifact := taskRuns.artifacts[1]
+		assert.Equal(t, models.ArtifactTypeRaw, artifact.ArtifactType)
+		assert.Equal(t, server.URL+"/b", artifact.URL)
+		assert.Equal(t, http.StatusOK, artifact.StatusCode)
+		assert.Equal(t, "text/html", artifact.ContentType)
+		assert.Equal(t, "test-bucket", artifact.S3Bucket)
+		assert.Equal(t, "<html>/b</html>", string(blobs.blobs[artifact.S3Key]))
+	})
+
+	t.Run("Xpath targets are extracted into records", func(t *testing.T) {
+		worker, _, taskRuns, blobs := setupTestWorker(t)
+		taskRuns.addRun(5, &models.TaskDefinition{
+			Source: []models.UrlSource{{Type: models.SourceTypeUrl, URL: server.URL + "/links"}},
+			Target: []models.Target{{Type: models.TargetTypeXpath, Name: "path", Value: "//html"}},
+		})
+
+		worker.process(ctx, models.QueuedTaskRun{MessageID: "5-0", TaskRunID: 5})
+
+		assert.Equal(t, models.TaskStatusComplete, taskRuns.updates["5"].Status)
+		require.Len(t, taskRuns.artifacts, 2)
+		records := taskRuns.artifacts[1]
+		assert.Equal(t, models.ArtifactTypeRecords, records.ArtifactType)
+		assert.Equal(t, "1", records.AdditionalData["records"])
+		assert.Equal(t, "2", records.AdditionalData["target_type"])
+		assert.JSONEq(t, `[{"path":"/links"}]`, string(blobs.blobs[records.S3Key]))
+	})
+
+	t.Run("Extraction warnings are kept with the records", func(t *testing.T) {
+		worker, _, taskRuns, blobs := setupTestWorker(t)
+		taskRuns.addRun(6, &models.TaskDefinition{
+			Source: []models.UrlSource{{Type: models.SourceTypeUrl, URL: server.URL + "/links"}},
+			Target: []models.Target{{Type: models.TargetTypeQuery, Name: "missing", Value: "table"}},
+		})
+
+		worker.process(ctx, models.QueuedTaskRun{MessageID: "6-0", TaskRunID: 6})
+
+		assert.Equal(t, models.TaskStatusComplete, taskRuns.updates["6"].Status)
+		require.Len(t, taskRuns.artifacts, 2)
+		records := taskRuns.artifacts[1]
+		assert.Equal(t, "3", records.AdditionalData["target_type"])
+		assert.Equal(t, `target "missing" matched nothing`, records.AdditionalData["warning.0"])
+		assert.JSONEq(t, `[]`, string(blobs.blobs[records.S3Key]))
+	})
+
+	t.Run("Failed fetches fail the run with their error class", func(t *testing.T) {
+		worker, queue, taskRuns, _ := setupTestWorker(t)
+		taskRuns.addRun(2, &models.TaskDefinition{Source: []models.UrlSource{{Type: models.SourceTypeUrl, URL: server.URL + "/missing"}}})
+
+		worker.process(ctx, models.QueuedTaskRun{MessageID: "2-0", TaskRunID: 2})
+
+		update := taskRuns.updates["2"]
+		assert.Equal(t, models.TaskStatusFailed, update.Status)
+		assert.Equal(t, models.ErrorClassHttp4xx, update.ErrorClass)
+		assert.Equal(t, 0, update.SourcesSucceeded)
+		assert.Equal(t, 1, update.SourcesFailed)
+		assert.Equal(t, []uint64{2}, queue.acked)
+	})
+
+	t.Run("Failed sources do not fail the other sources", func(t *testing.T) {
+		worker, _, taskRuns, _ := setupTestWorker(t)
+		taskRuns.addRun(7, &models.TaskDefinition{
+			Source: []models.UrlSource{
+				{Type: models.SourceTypeUrl, URL: server.URL + "/a"},
+				{Type: models.SourceTypeUrl, URL: server.URL + "/missing"},
+				{Type: models.SourceTypeUrl, URL: server.URL + "/b"},
+			},
+			Target:            []models.Target{{Type: models.TargetTypeXpath, Name: "path", Value: "//html"}},
+			SourceParallelism: 3,
+		})
+
+		worker.process(ctx, models.QueuedTaskRun{MessageID: "7-0", TaskRunID: 7})
+
+		update := taskRuns.updates["7"]
+		assert.Equal(t, models.TaskStatusComplete, update.Status)
+		assert.Equal(t, 2, update.SourcesSucceeded)
+		assert.Equal(t, 1, update.SourcesFailed)
+		var sourceErrors []models.SourceError
+		require.NoError(t, sonic.Unmarshal(update.SourceErrors, &sourceErrors))
+		require.Len(t, sourceErrors, 1)
+		assert.Equal(t, 1, sourceErrors[0].Index)
+		assert.Equal(t, server.URL+"/missing", sourceErrors[0].URL)
+		assert.Equal(t, models.ErrorClassHttp4xx, sourceErrors[0].ErrorClass)
+
+		require.Len(t, taskRuns.artifacts, 4)
+		for _, artifact := range taskRuns.artifacts {
+			index := artifact.AdditionalData[models.ArtifactDataSourceIndex]
+			assert.Contains(t, []string{"0", "2"}, index)
+			assert.Equal(t, artifact.URL, artifact.AdditionalData[models.ArtifactDataSourceURL])
+		}
+	})
+
+	t.Run("Sources are fetched up to the source parallelism at a time", func(t *testing.T) {
+		worker, _, taskRuns, _ := setupTestWorker(t)
+		var sources []models.UrlSource
+		for i := 0; i < 6; i++ {
+			sources = append(sources, models.UrlSource{Type: models.SourceTypeUrl, URL: fmt.Sprintf("%s/slow/%d", server.URL, i)})
+		}
+		taskRuns.addRun(8, &models.TaskDefinition{Source: sources, SourceParallelism: 2})
+		maxInFlight.Store(0)
+
+		worker.process(ctx, models.QueuedTaskRun{MessageID: "8-0", TaskRunID: 8})
+
+		assert.Equal(t, 6, taskRuns.updates["8"].SourcesSucceeded)
+		assert.Equal(t, int32(2), maxInFlight.Load())
+	})
+
+	t.Run("Heartbeats keep the run claimed", func(t *testing.T) {
+		worker, queue, taskRuns, _ := setupTestWorker(t)
+		worker.cfg.HeartbeatInterval = 10 * time.Millisecond
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(50 * time.Millisecond)
+			w.Write([]byte("<html></html>"))
+		}))
+		defer slow.Close()
+		taskRuns.addRun(8, &models.TaskDefinition{Source: []models.UrlSource{{Type: models.SourceTypeUrl, URL: slow.URL}}})
+
+		worker.process(ctx, models.QueuedTaskRun{MessageID: "8-0", TaskRunID: 8})
+
+		assert.Equal(t, models.TaskStatusComplete, taskRuns.updates["8"].Status)
+		queue.mu.Lock()
+		defer queue.mu.Unlock()
+		assert.NotEmpty(t, queue.extended)
+		assert.Equal(t, uint64(8), queue.extended[0])
+	})
+
+	t.Run("Cancelled runs are not executed", func(t *testing.T) {
+		worker, queue, taskRuns, _ := setupTestWorker(t)
+		taskRuns.addRun(3, &models.TaskDefinition{Source: []models.UrlSource{{Type: models.SourceTypeUrl, URL: server.URL + "/a"}}})
+		require.NoError(t, models.SignalTaskRunCancelled(ctx, 3))
+
+		worker.process(ctx, models.QueuedTaskRun{MessageID: "3-0", TaskRunID: 3})
+
+		assert.Empty(t, taskRuns.updates)
+		assert.Empty(t, taskRuns.artifacts)
+		assert.Equal(t, []uint64{3}, queue.acked)
+	})
+
+	t.Run("Runs that stopped running are not overwritten", func(t *testing.T) {
+		worker, queue, taskRuns, _ := setupTestWorker(t)
+		// The reaper times the run out while its source is fetched
+		reaper := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			taskRuns.mu.Lock()
+			taskRuns.taskRuns[7].Status = models.TaskStatusFailed
+			taskRuns.mu.Unlock()
+			w.Write([]byte("<html></html>"))
+		}))
+		defer reaper.Close()
+		taskRuns.addRun(7, &models.TaskDefinition{Source: []models.UrlSource{{Type: models.SourceTypeUrl, URL: reaper.URL}}})
+
+		worker.process(ctx, models.QueuedTaskRun{MessageID: "7-0", TaskRunID: 7})
+
+		assert.Empty(t, taskRuns.updates)
+		assert.Equal(t, models.TaskStatusFailed, taskRuns.taskRuns[7].Status)
+		assert.Equal(t, []uint64{7}, queue.acked)
+	})
+
+	t.Run("Unknown runs are dead-lettered", func(t *testing.T) {
+		worker, queue, _, _ := setupTestWorker(t)
+
+		worker.process(ctx, models.QueuedTaskRun{MessageID: "4-0", TaskRunID: 4})
+
+		assert.Equal(t, []uint64{4}, queue.deadLettered)
+		assert.Empty(t, queue.acked)
+	})
+}
+
+func TestWorkerRun(t *testing.T) {
+	t.Run("Delayed runs are promoted while the worker runs", func(t *testing.T) {
+		worker, queue, _, _ := setupTestWorker(t)
+		worker.cfg.PollInterval = time.Second
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			worker.Run(ctx)
+			close(done)
+		}()
+
+		assert.Eventually(t, func() bool {
+			queue.mu.Lock()
+			defer queue.mu.Unlock()
+			return queue.promotions >= 2
+		}, 3*time.Second, 10*time.Millisecond)
+		cancel()
+		<-done
+	})
+}